@@ -0,0 +1,153 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"skenario/pkg/plugin"
+	"skenario/pkg/serve"
+	"skenario/pkg/simulator"
+)
+
+const debugHelp = `commands:
+  step [n]            run the next n movements (default 1)
+  until <duration>    run until a simulated time, eg "until 90s"
+  until-kind <kind>   run until the next movement is of a kind, eg "until-kind autoscaler_tick"
+  pending [n]         show the next n pending movements (default 20)
+  stocks [filter]     show stocks whose names contain filter
+  recent              show the movements made by the last command
+  help                show this help
+  quit                stop debugging
+`
+
+// debug steps through the scenario in the run request held by requestFile, reading
+// commands from in until it is told to quit or in is closed.
+func debug(requestFile string, in io.Reader, out io.Writer) {
+	f, err := os.Open(requestFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer f.Close()
+
+	runReq := &serve.SkenarioRunRequest{}
+	err = json.NewDecoder(f).Decode(runReq)
+	if err != nil {
+		panic(fmt.Errorf("could not read run request '%s': %s", requestFile, err.Error()))
+	}
+
+	plugin.Init()
+	defer plugin.Shutdown()
+
+	session, err := serve.NewDebugSession(context.Background(), runReq)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer session.Close()
+
+	fmt.Fprintf(out, "Debugging a %s run of %s with seed %d.\n%s", runReq.TrafficPattern, runReq.RunFor, runReq.Seed, debugHelp)
+	printDebugState(out, session, serve.DebugCommand{Action: "inspect"}, "status")
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			return
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		arg := ""
+		if len(fields) > 1 {
+			arg = fields[1]
+		}
+
+		switch fields[0] {
+		case "step", "s":
+			steps, _ := strconv.Atoi(arg)
+			printDebugState(out, session, serve.DebugCommand{Action: "step", Steps: steps}, "recent")
+		case "until":
+			at, err := time.ParseDuration(arg)
+			if err != nil {
+				fmt.Fprintf(out, "could not read duration '%s': %s\n", arg, err.Error())
+				continue
+			}
+			printDebugState(out, session, serve.DebugCommand{Action: "run_until", At: at}, "status")
+		case "until-kind":
+			printDebugState(out, session, serve.DebugCommand{Action: "run_until_kind", Kind: simulator.MovementKind(arg)}, "pending")
+		case "pending", "p":
+			shown, _ := strconv.Atoi(arg)
+			printDebugState(out, session, serve.DebugCommand{Action: "inspect", Pending: shown}, "pending")
+		case "stocks":
+			printDebugState(out, session, serve.DebugCommand{Action: "inspect", Stock: arg}, "stocks")
+		case "recent":
+			printDebugState(out, session, serve.DebugCommand{Action: "inspect"}, "recent")
+		case "help", "h":
+			fmt.Fprint(out, debugHelp)
+		case "quit", "q":
+			return
+		default:
+			fmt.Fprintf(out, "unknown command '%s'\n%s", fields[0], debugHelp)
+		}
+	}
+}
+
+func printDebugState(out io.Writer, session *serve.DebugSession, cmd serve.DebugCommand, show string) {
+	state, err := session.Do(context.Background(), cmd)
+	if err != nil {
+		fmt.Fprintln(out, err.Error())
+		return
+	}
+
+	switch show {
+	case "recent":
+		for _, m := range state.Recent {
+			outcome := "moved " + string(m.Moved)
+			if m.Ignored != "" {
+				outcome = "ignored: " + m.Ignored
+			}
+			fmt.Fprintf(out, "  %-14s %-28s %s -> %s (%s)\n", m.OccursAt, m.Kind, m.From, m.To, outcome)
+		}
+	case "pending":
+		for _, m := range state.Pending {
+			fmt.Fprintf(out, "  %-14s %-28s %s -> %s\n", m.OccursAt.Sub(time.Unix(0, 0)), m.Kind, m.From, m.To)
+		}
+		if state.PendingCount > len(state.Pending) {
+			fmt.Fprintf(out, "  ... and %d more\n", state.PendingCount-len(state.Pending))
+		}
+	case "stocks":
+		for _, s := range state.Stocks {
+			fmt.Fprintf(out, "  %-36s %-12s %d\n", s.Name, s.KindStocked, s.Count)
+		}
+	}
+
+	halted := ""
+	if state.Halted {
+		halted = ", halted"
+	}
+	fmt.Fprintf(out, "at %s after %d movements, %d pending%s\n", state.CurrentTime, state.MovementCount, state.PendingCount, halted)
+}
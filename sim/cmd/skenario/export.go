@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"skenario/pkg/data"
+	"skenario/pkg/serve"
+)
+
+// exportRun writes a stored run as the export flags describe.
+func exportRun(backend data.Backend, scenarioRunId int64) {
+	start := time.Unix(0, 0)
+	if *exportStart != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, *exportStart)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if *exportOut != "" {
+		f, err := os.Create(*exportOut)
+		if err != nil {
+			panic(err.Error())
+		}
+		defer f.Close()
+		out = f
+	}
+
+	err := serve.ExportRun(out, backend, scenarioRunId, *exportFormat, *exportSeries, start)
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -16,19 +16,65 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 
+	"skenario/pkg/data"
 	"skenario/pkg/serve"
 )
 
+var store = flag.String("store", "skenario.db", "where runs are kept: a SQLite database file, memory, or a postgres:// URL")
+var listPatterns = flag.Bool("list-patterns", false, "list the available traffic patterns and their config schemas, then exit")
+var debugRequest = flag.String("debug", "", "step through the scenario in this run request JSON file, instead of serving")
+var exportRunId = flag.Int64("export", 0, "export the stored run with this scenario run id, instead of serving")
+var exportFormat = flag.String("export-format", serve.CSVExport, "format to export a run in: csv, parquet or openmetrics")
+var exportSeries = flag.String("export-series", "", "series of results to export, eg tally_lines, or every series when empty")
+var exportStart = flag.String("export-start", "", "RFC 3339 time at which OpenMetrics timestamps start, or the epoch when empty")
+var exportOut = flag.String("export-out", "", "file to export a run to, or standard output when empty")
+
 func main() {
+	flag.Parse()
+
+	if *listPatterns {
+		printPatterns()
+		return
+	}
+
+	if *debugRequest != "" {
+		debug(*debugRequest, os.Stdin, os.Stdout)
+		return
+	}
+
+	backend, err := data.OpenBackend(*store)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	if *exportRunId != 0 {
+		exportRun(backend, *exportRunId)
+		return
+	}
+
 	sighup := make(chan os.Signal, 1)
 	signal.Notify(sighup, os.Interrupt)
 
-	server := serve.SkenarioServer{IndexRoot: "sim/pkg/serve"}
+	server := serve.SkenarioServer{IndexRoot: "sim/pkg/serve", Backend: backend}
 	server.Serve()
 
 	<-sighup
 	server.Shutdown()
 }
+
+func printPatterns() {
+	for _, p := range serve.DescribePatterns() {
+		schema, err := json.MarshalIndent(p.ConfigSchema, "  ", "  ")
+		if err != nil {
+			panic(err.Error())
+		}
+
+		fmt.Printf("%s (%s)\n  %s\n\n", p.Name, p.Description, schema)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"encoding/json"
+
+	"skenario/pkg/simulator"
+)
+
+// AutoscalerStat is one of the stats an autoscaler was sent before it was asked to scale.
+type AutoscalerStat struct {
+	Time    int64  `json:"time"`
+	PodName string `json:"pod_name"`
+	Type    string `json:"type"`
+	Value   int32  `json:"value"`
+}
+
+// AutoscalerDecision is what a service's autoscaler was told and what it recommended at
+// one tick. Service is empty for the main service.
+type AutoscalerDecision struct {
+	DecidedAt   int64            `json:"decided_at"`
+	Service     string           `json:"service"`
+	Stats       []AutoscalerStat `json:"stats"`
+	Desired     int64            `json:"desired"`
+	Recommended int64            `json:"recommended"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// language=sql
+var insertAutoscalerDecision = `insert into autoscaler_decisions(
+	decided_at
+  , service
+  , stats
+  , desired
+  , recommended
+  , error
+  , scenario_run_id
+) values (?, ?, ?, ?, ?, ?, ?)
+`
+
+// language=sql
+var AutoscalerDecisionsQuery = `
+select
+    decided_at
+  , service
+  , stats
+  , desired
+  , recommended
+  , coalesce(error, '')
+from autoscaler_decisions
+where scenario_run_id = ?
+order by decided_at, id
+;
+`
+
+// newAutoscalerDecision gives the form in which a decision is stored.
+func newAutoscalerDecision(decision *simulator.AutoscalerDecision) AutoscalerDecision {
+	stats := make([]AutoscalerStat, len(decision.Stats))
+	for i, stat := range decision.Stats {
+		stats[i] = AutoscalerStat{
+			Time:    stat.Time,
+			PodName: stat.PodName,
+			Type:    stat.Type.String(),
+			Value:   stat.Value,
+		}
+	}
+
+	stored := AutoscalerDecision{
+		DecidedAt:   decision.DecidedAt.UnixNano(),
+		Service:     decision.Service,
+		Stats:       stats,
+		Desired:     int64(decision.Desired),
+		Recommended: int64(decision.Recommended),
+	}
+	if decision.Err != nil {
+		stored.Error = decision.Err.Error()
+	}
+
+	return stored
+}
+
+// writeAutoscalerDecisions writes a run's autoscaler decisions in one transaction.
+func writeAutoscalerDecisions(db database, scenarioRunId int64, decisions []*simulator.AutoscalerDecision) error {
+	return db.withTx(func() error {
+		for _, d := range decisions {
+			decision := newAutoscalerDecision(d)
+			stats, err := json.Marshal(decision.Stats)
+			if err != nil {
+				return err
+			}
+
+			var pluginErr interface{}
+			if decision.Error != "" {
+				pluginErr = decision.Error
+			}
+
+			err = db.exec(insertAutoscalerDecision,
+				decision.DecidedAt,
+				decision.Service,
+				string(stats),
+				decision.Desired,
+				decision.Recommended,
+				pluginErr,
+				scenarioRunId,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *storer) AutoscalerDecisions(scenarioRunId int64) ([]AutoscalerDecision, error) {
+	decisions := make([]AutoscalerDecision, 0)
+	err := s.db.eachRow(AutoscalerDecisionsQuery, []interface{}{scenarioRunId}, func(r row) error {
+		var decision AutoscalerDecision
+		var stats string
+		err := r.Scan(&decision.DecidedAt, &decision.Service, &stats, &decision.Desired, &decision.Recommended, &decision.Error)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal([]byte(stats), &decision.Stats)
+		if err != nil {
+			return err
+		}
+
+		decisions = append(decisions, decision)
+		return nil
+	})
+
+	return decisions, err
+}
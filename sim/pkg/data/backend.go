@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// Backend is where runs are kept. Each use of it, such as each request to the server, opens
+// its own RunStore and releases the store when done. Stores opened from one Backend share
+// their runs.
+type Backend interface {
+	Open() (store RunStore, release func(), err error)
+	Close() error
+}
+
+// OpenBackend opens the backend that a data source names:
+//
+//	memory                  runs are kept in this process, and lost when it exits
+//	postgres://...          a PostgreSQL database, given as a connection URL
+//	sqlite:skenario.db      a SQLite database file; the sqlite: prefix may be left off
+//
+// PostgreSQL and SQLite databases are migrated to the current schema.
+func OpenBackend(dataSource string) (Backend, error) {
+	switch {
+	case dataSource == "memory":
+		return NewMemoryBackend(0), nil
+	case strings.HasPrefix(dataSource, "postgres://"), strings.HasPrefix(dataSource, "postgresql://"):
+		return openPostgresBackend(dataSource)
+	case dataSource == "":
+		return nil, fmt.Errorf("no data source was given")
+	default:
+		return NewSQLiteBackend(strings.TrimPrefix(dataSource, "sqlite:")), nil
+	}
+}
+
+// NewSQLiteBackend keeps runs in a SQLite database file, opening a connection for each
+// store.
+func NewSQLiteBackend(fileName string) Backend {
+	return &sqliteBackend{fileName: fileName}
+}
+
+type sqliteBackend struct {
+	fileName string
+}
+
+func (b *sqliteBackend) Open() (RunStore, func(), error) {
+	conn, err := sqlite3.Open(b.fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open database file '%s': %s", b.fileName, err.Error())
+	}
+
+	err = Migrate(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("could not migrate skenario schema: %s", err.Error())
+	}
+
+	return newSQLiteStore(conn), func() { conn.Close() }, nil
+}
+
+func (b *sqliteBackend) Close() error {
+	return nil
+}
+
+// NewMemoryBackend keeps runs in this process, until it exits. Once maxRuns runs are kept,
+// writing another drops the run that was least recently written or read. Zero keeps every
+// run.
+func NewMemoryBackend(maxRuns int) Backend {
+	return &memoryBackend{store: newMemoryStore(maxRuns)}
+}
+
+type memoryBackend struct {
+	store RunStore
+}
+
+func (b *memoryBackend) Open() (RunStore, func(), error) {
+	return b.store, func() {}, nil
+}
+
+func (b *memoryBackend) Close() error {
+	return nil
+}
+
+type postgresBackend struct {
+	db *sql.DB
+}
+
+func openPostgresBackend(url string) (Backend, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not connect to PostgreSQL: %s", err.Error())
+	}
+	defer conn.Close()
+
+	err = migrate(&postgresDatabase{conn: conn}, postgresMigrations, postgresViews)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not migrate skenario schema: %s", err.Error())
+	}
+
+	return &postgresBackend{db: db}, nil
+}
+
+func (b *postgresBackend) Open() (RunStore, func(), error) {
+	conn, err := b.db.Conn(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not connect to PostgreSQL: %s", err.Error())
+	}
+
+	return newPostgresStore(conn), func() { conn.Close() }, nil
+}
+
+func (b *postgresBackend) Close() error {
+	return b.db.Close()
+}
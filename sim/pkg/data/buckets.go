@@ -0,0 +1,188 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+// TallyBucket aggregates one stock's tally over a bucket of time starting at StartsAt.
+// Mean is weighted by how long each tally was held during the bucket.
+type TallyBucket struct {
+	StartsAt    int64   `json:"starts_at"`
+	StockName   string  `json:"stock_name"`
+	KindStocked string  `json:"kind_stocked"`
+	Min         int64   `json:"min"`
+	Max         int64   `json:"max"`
+	Mean        float64 `json:"mean"`
+	Last        int64   `json:"last"`
+}
+
+// ResponseTimeBucket aggregates the response times of requests that completed in a bucket
+// of time starting at StartsAt.
+type ResponseTimeBucket struct {
+	StartsAt int64   `json:"starts_at"`
+	Count    int64   `json:"count"`
+	Min      int64   `json:"min"`
+	Max      int64   `json:"max"`
+	Mean     float64 `json:"mean"`
+	P50      int64   `json:"p50"`
+	P90      int64   `json:"p90"`
+	P99      int64   `json:"p99"`
+}
+
+type stockKey struct {
+	name string
+	kind string
+}
+
+// BucketTallyLines downsamples tally lines into buckets of width aligned to from. Each
+// stock has a bucket for every width of time from its first tally until the run ends at
+// until, so that tallies which are held show up as well as those which change.
+func BucketTallyLines(lines []TallyLine, from, until int64, width time.Duration) []TallyBucket {
+	byStock := make(map[stockKey][]TallyLine)
+	stocks := make([]stockKey, 0)
+	for _, line := range lines {
+		key := stockKey{name: line.StockName, kind: line.KindStocked}
+		if _, ok := byStock[key]; !ok {
+			stocks = append(stocks, key)
+		}
+		byStock[key] = append(byStock[key], line)
+	}
+
+	buckets := make([]TallyBucket, 0)
+	for _, key := range stocks {
+		buckets = append(buckets, bucketStock(key, byStock[key], from, until, int64(width))...)
+	}
+
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if buckets[i].StartsAt != buckets[j].StartsAt {
+			return buckets[i].StartsAt < buckets[j].StartsAt
+		}
+		if buckets[i].StockName != buckets[j].StockName {
+			return buckets[i].StockName < buckets[j].StockName
+		}
+		return buckets[i].KindStocked < buckets[j].KindStocked
+	})
+
+	return buckets
+}
+
+// bucketStock buckets the tally lines of one stock, which are in the order they occurred.
+func bucketStock(key stockKey, lines []TallyLine, from, until, width int64) []TallyBucket {
+	end := until
+	if last := lines[len(lines)-1].OccursAt; last >= end {
+		end = last + 1
+	}
+
+	buckets := make([]TallyBucket, 0)
+	var held int64
+	holding := false
+	next := 0
+	for start := bucketStart(lines[0].OccursAt, from, width); start < end; start += width {
+		bucket := TallyBucket{StartsAt: start, StockName: key.name, KindStocked: key.kind}
+		if holding {
+			bucket.Min, bucket.Max = held, held
+		}
+
+		stop := start + width
+		if stop > end {
+			stop = end
+		}
+
+		var weighted float64
+		var span int64
+		since := start
+		for ; next < len(lines) && lines[next].OccursAt < start+width; next++ {
+			line := lines[next]
+			if holding {
+				weighted += float64(held) * float64(line.OccursAt-since)
+				span += line.OccursAt - since
+			} else {
+				bucket.Min, bucket.Max = line.Tally, line.Tally
+			}
+
+			held, holding, since = line.Tally, true, line.OccursAt
+			if held < bucket.Min {
+				bucket.Min = held
+			}
+			if held > bucket.Max {
+				bucket.Max = held
+			}
+		}
+		weighted += float64(held) * float64(stop-since)
+		span += stop - since
+
+		bucket.Last = held
+		bucket.Mean = float64(held)
+		if span > 0 {
+			bucket.Mean = weighted / float64(span)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets
+}
+
+// BucketResponseTimes downsamples response times into buckets of width aligned to from,
+// by when each request completed. Buckets in which no request completed are left out.
+func BucketResponseTimes(responseTimes []ResponseTime, from int64, width time.Duration) []ResponseTimeBucket {
+	byBucket := make(map[int64][]time.Duration)
+	starts := make([]int64, 0)
+	for _, rt := range responseTimes {
+		start := bucketStart(rt.CompletedAt, from, int64(width))
+		if _, ok := byBucket[start]; !ok {
+			starts = append(starts, start)
+		}
+		byBucket[start] = append(byBucket[start], time.Duration(rt.ResponseTime))
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	buckets := make([]ResponseTimeBucket, 0, len(starts))
+	for _, start := range starts {
+		durations := byBucket[start]
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+		var total float64
+		for _, d := range durations {
+			total += float64(d)
+		}
+
+		buckets = append(buckets, ResponseTimeBucket{
+			StartsAt: start,
+			Count:    int64(len(durations)),
+			Min:      int64(durations[0]),
+			Max:      int64(durations[len(durations)-1]),
+			Mean:     total / float64(len(durations)),
+			P50:      int64(percentile(durations, 50)),
+			P90:      int64(percentile(durations, 90)),
+			P99:      int64(percentile(durations, 99)),
+		})
+	}
+
+	return buckets
+}
+
+// bucketStart gives the start of the bucket of width, aligned to from, which at falls in.
+func bucketStart(at, from, width int64) int64 {
+	offset := (at - from) % width
+	if offset < 0 {
+		offset += width
+	}
+
+	return at - offset
+}
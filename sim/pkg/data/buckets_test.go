@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuckets(t *testing.T) {
+	spec.Run(t, "Buckets", testBuckets, spec.Report(report.Terminal{}))
+}
+
+func testBuckets(t *testing.T, describe spec.G, it spec.S) {
+	second := int64(time.Second)
+
+	describe("BucketTallyLines()", func() {
+		var buckets []TallyBucket
+
+		it.Before(func() {
+			lines := []TallyLine{
+				{OccursAt: 0, StockName: "ReplicasActive", KindStocked: "Replica", Tally: 1},
+				{OccursAt: second / 2, StockName: "RequestsProcessing", KindStocked: "Request", Tally: 1},
+				{OccursAt: second / 2, StockName: "ReplicasActive", KindStocked: "Replica", Tally: 3},
+				{OccursAt: 3 * second / 4, StockName: "RequestsProcessing", KindStocked: "Request", Tally: 0},
+				{OccursAt: 5 * second / 2, StockName: "ReplicasActive", KindStocked: "Replica", Tally: 2},
+			}
+			buckets = BucketTallyLines(lines, 0, 3*second, time.Second)
+		})
+
+		it("gives a bucket for each stock in each width of time, from its first tally until the run ends", func() {
+			assert.Len(t, buckets, 6)
+			assert.Equal(t, TallyBucket{StartsAt: 0, StockName: "ReplicasActive", KindStocked: "Replica", Min: 1, Max: 3, Mean: 2, Last: 3}, buckets[0])
+			assert.Equal(t, TallyBucket{StartsAt: 0, StockName: "RequestsProcessing", KindStocked: "Request", Min: 0, Max: 1, Mean: 0.5, Last: 0}, buckets[1])
+		})
+
+		it("carries held tallies into buckets in which they don't change", func() {
+			assert.Equal(t, TallyBucket{StartsAt: second, StockName: "ReplicasActive", KindStocked: "Replica", Min: 3, Max: 3, Mean: 3, Last: 3}, buckets[2])
+			assert.Equal(t, TallyBucket{StartsAt: second, StockName: "RequestsProcessing", KindStocked: "Request", Min: 0, Max: 0, Mean: 0, Last: 0}, buckets[3])
+			assert.Equal(t, TallyBucket{StartsAt: 2 * second, StockName: "RequestsProcessing", KindStocked: "Request", Min: 0, Max: 0, Mean: 0, Last: 0}, buckets[5])
+		})
+
+		it("includes the tally held into a bucket in its minimum and maximum", func() {
+			assert.Equal(t, TallyBucket{StartsAt: 2 * second, StockName: "ReplicasActive", KindStocked: "Replica", Min: 2, Max: 3, Mean: 2.5, Last: 2}, buckets[4])
+		})
+
+		it("gives no buckets for no tallies", func() {
+			assert.Empty(t, BucketTallyLines([]TallyLine{}, 0, second, time.Second))
+		})
+	})
+
+	describe("BucketResponseTimes()", func() {
+		var buckets []ResponseTimeBucket
+
+		it.Before(func() {
+			responseTimes := make([]ResponseTime, 0)
+			for i := int64(1); i <= 100; i++ {
+				responseTimes = append(responseTimes, ResponseTime{ArrivedAt: 0, CompletedAt: i * 1000, ResponseTime: i * 1000})
+			}
+			responseTimes = append(responseTimes, ResponseTime{ArrivedAt: 3 * second, CompletedAt: 3*second + 10, ResponseTime: 10})
+			buckets = BucketResponseTimes(responseTimes, 0, time.Second)
+		})
+
+		it("aggregates the response times of requests that completed in each bucket", func() {
+			assert.Equal(t, ResponseTimeBucket{StartsAt: 0, Count: 100, Min: 1000, Max: 100000, Mean: 50500, P50: 50000, P90: 90000, P99: 99000}, buckets[0])
+		})
+
+		it("leaves out buckets in which no request completed", func() {
+			assert.Len(t, buckets, 2)
+			assert.Equal(t, ResponseTimeBucket{StartsAt: 3 * second, Count: 1, Min: 10, Max: 10, Mean: 10, P50: 10, P90: 10, P99: 10}, buckets[1])
+		})
+	})
+}
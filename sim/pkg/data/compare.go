@@ -0,0 +1,265 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"errors"
+	"math"
+)
+
+// SignificanceLevel is the p-value below which a difference between groups of runs is
+// taken to be significant.
+const SignificanceLevel = 0.05
+
+var ErrNoSummary = errors.New("scenario run was recorded without a summary")
+
+type comparedMetric struct {
+	name  string
+	value func(summary RunSummary, cost RunCost) float64
+	// measured, if set, says whether a run has the metric at all. Runs without it are
+	// left out of the metric's stats.
+	measured func(summary RunSummary) bool
+}
+
+// comparedMetrics are the headline numbers of runs that are compared between groups.
+var comparedMetrics = []comparedMetric{
+	{"failure_rate", func(s RunSummary, c RunCost) float64 { return s.FailureRate }, nil},
+	{"response_time_p50", func(s RunSummary, c RunCost) float64 { return float64(s.ResponseTimeP50) }, nil},
+	{"response_time_p95", func(s RunSummary, c RunCost) float64 { return float64(s.ResponseTimeP95) }, nil},
+	{"response_time_p99", func(s RunSummary, c RunCost) float64 { return float64(s.ResponseTimeP99) }, nil},
+	{"slo_attainment", func(s RunSummary, c RunCost) float64 { return *s.SLOAttainment }, func(s RunSummary) bool { return s.SLOAttainment != nil }},
+	{"average_replicas", func(s RunSummary, c RunCost) float64 { return s.AverageReplicas }, nil},
+	{"peak_replicas", func(s RunSummary, c RunCost) float64 { return float64(s.PeakReplicas) }, nil},
+	{"total_cost", func(s RunSummary, c RunCost) float64 { return c.TotalCost }, nil},
+	{"wasted_cost", func(s RunSummary, c RunCost) float64 { return c.WastedCost }, nil},
+}
+
+// MetricStats describes one metric across a group of runs.
+type MetricStats struct {
+	Metric string  `json:"metric"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+}
+
+// GroupStats describes a group of runs, usually repetitions of one configuration with
+// different seeds.
+type GroupStats struct {
+	Group          int           `json:"group"`
+	ScenarioRunIds []int64       `json:"scenario_run_ids"`
+	Metrics        []MetricStats `json:"metrics"`
+}
+
+// MetricDelta compares a metric of a group of runs with the same metric of the baseline
+// group, using Welch's t-test. PValue is nil unless both groups have at least two runs.
+type MetricDelta struct {
+	Metric           string   `json:"metric"`
+	Group            int      `json:"group"`
+	Baseline         float64  `json:"baseline"`
+	Mean             float64  `json:"mean"`
+	Delta            float64  `json:"delta"`
+	RelativeDelta    float64  `json:"relative_delta"`
+	T                float64  `json:"t"`
+	DegreesOfFreedom float64  `json:"degrees_of_freedom"`
+	PValue           *float64 `json:"p_value"`
+	Significant      bool     `json:"significant"`
+}
+
+// CompareGroups compares the headline numbers of each group of runs with those of the
+// first group, which is the baseline.
+func CompareGroups(runs RunReader, groups [][]int64) ([]GroupStats, []MetricDelta, error) {
+	values := make([][][]float64, len(groups)) // by group, then metric, then run
+	stats := make([]GroupStats, len(groups))
+	for g, group := range groups {
+		values[g] = make([][]float64, len(comparedMetrics))
+		for _, scenarioRunId := range group {
+			_, err := runs.LoadRun(scenarioRunId)
+			if err != nil {
+				return nil, nil, err
+			}
+			summary, found, err := runs.LoadSummary(scenarioRunId)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !found {
+				return nil, nil, ErrNoSummary
+			}
+			cost, _, err := runs.LoadCost(scenarioRunId)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for m, metric := range comparedMetrics {
+				if metric.measured != nil && !metric.measured(summary) {
+					continue
+				}
+				values[g][m] = append(values[g][m], metric.value(summary, cost))
+			}
+		}
+
+		stats[g] = GroupStats{Group: g, ScenarioRunIds: group, Metrics: make([]MetricStats, len(comparedMetrics))}
+		for m, metric := range comparedMetrics {
+			mean, variance := meanAndVariance(values[g][m])
+			stats[g].Metrics[m] = MetricStats{Metric: metric.name, Mean: mean, StdDev: math.Sqrt(variance)}
+		}
+	}
+
+	deltas := make([]MetricDelta, 0)
+	for g := 1; g < len(groups); g++ {
+		for m, metric := range comparedMetrics {
+			baseline, mean := stats[0].Metrics[m].Mean, stats[g].Metrics[m].Mean
+			delta := MetricDelta{
+				Metric:   metric.name,
+				Group:    g,
+				Baseline: baseline,
+				Mean:     mean,
+				Delta:    mean - baseline,
+			}
+			if baseline != 0 {
+				delta.RelativeDelta = delta.Delta / math.Abs(baseline)
+			}
+
+			t, df, p, ok := WelchTTest(values[0][m], values[g][m])
+			if ok {
+				delta.T, delta.DegreesOfFreedom, delta.PValue = t, df, &p
+				delta.Significant = p < SignificanceLevel
+			}
+			deltas = append(deltas, delta)
+		}
+	}
+
+	return stats, deltas, nil
+}
+
+// WelchTTest tests whether samples a and b have different means, without assuming that
+// they have the same variance. It gives the t statistic, the Welch-Satterthwaite degrees of
+// freedom and the two-sided p-value, and ok is false unless each sample has at least two
+// values. When neither sample varies, t and df are zero and the samples are different
+// exactly when their means are.
+func WelchTTest(a, b []float64) (t, df, p float64, ok bool) {
+	if len(a) < 2 || len(b) < 2 {
+		return 0, 0, 0, false
+	}
+
+	meanA, varA := meanAndVariance(a)
+	meanB, varB := meanAndVariance(b)
+	seA, seB := varA/float64(len(a)), varB/float64(len(b))
+
+	if seA+seB == 0 {
+		if meanA == meanB {
+			return 0, 0, 1, true
+		}
+		return 0, 0, 0, true
+	}
+
+	t = (meanB - meanA) / math.Sqrt(seA+seB)
+	df = (seA + seB) * (seA + seB) / (seA*seA/float64(len(a)-1) + seB*seB/float64(len(b)-1))
+	p = regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+
+	return t, df, p, true
+}
+
+// meanAndVariance gives the mean and the unbiased sample variance of values.
+func meanAndVariance(values []float64) (mean, variance float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	if len(values) < 2 {
+		return mean, 0
+	}
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+
+	return mean, variance / float64(len(values)-1)
+}
+
+// regularizedIncompleteBeta gives I_x(a, b), evaluated with a continued fraction.
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	}
+
+	lgammaAB, _ := math.Lgamma(a + b)
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	front := math.Exp(lgammaAB - lgammaA - lgammaB + a*math.Log(x) + b*math.Log(1-x))
+
+	// the continued fraction converges quickly only below this point, so use the symmetry
+	// I_x(a, b) = 1 - I_(1-x)(b, a) above it
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaContinuedFraction(1-x, b, a)/b
+	}
+	return front * betaContinuedFraction(x, a, b) / a
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete beta function
+// by the modified Lentz method.
+func betaContinuedFraction(x, a, b float64) float64 {
+	const maxIterations = 300
+	const epsilon = 1e-15
+	const tiny = 1e-300
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		even := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + even*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + even/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		odd := -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + odd*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + odd/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		step := d * c
+		h *= step
+
+		if math.Abs(step-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+)
+
+func TestCompare(t *testing.T) {
+	spec.Run(t, "Compare", testCompare, spec.Report(report.Terminal{}))
+}
+
+func testCompare(t *testing.T, describe spec.G, it spec.S) {
+	describe("WelchTTest()", func() {
+		it("gives the t statistic, degrees of freedom and two-sided p-value", func() {
+			a := []float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4}
+			b := []float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4}
+
+			tStat, df, p, ok := WelchTTest(a, b)
+			require.True(t, ok)
+			assert.InDelta(t, 2.46, tStat, 0.01)
+			assert.InDelta(t, 24.99, df, 0.01)
+			assert.InDelta(t, 0.021, p, 0.001)
+		})
+
+		it("gives a p-value of 1 for identical samples", func() {
+			_, _, p, ok := WelchTTest([]float64{1, 2, 3}, []float64{1, 2, 3})
+			require.True(t, ok)
+			assert.InDelta(t, 1.0, p, 0.0001)
+		})
+
+		it("tells samples without variance apart by their means", func() {
+			_, _, p, ok := WelchTTest([]float64{2, 2}, []float64{3, 3})
+			require.True(t, ok)
+			assert.Equal(t, 0.0, p)
+
+			_, _, p, _ = WelchTTest([]float64{2, 2}, []float64{2, 2})
+			assert.Equal(t, 1.0, p)
+		})
+
+		it("needs at least two values in each sample", func() {
+			_, _, _, ok := WelchTTest([]float64{1}, []float64{1, 2})
+			assert.False(t, ok)
+		})
+	})
+
+	describe("CompareGroups()", func() {
+		var conn *sqlite3.Conn
+		var store RunStore
+		var baseline, changed []int64
+		var unsummarized int64
+
+		saveRun := func(failureRate float64, totalCost float64) int64 {
+			writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, writer.Finish(nil, nil))
+
+			id := writer.ScenarioRunId()
+			if failureRate >= 0 {
+				require.NoError(t, store.SaveSummary(id, RunSummary{FailureRate: failureRate}))
+				require.NoError(t, store.SaveCost(id, RunCost{TotalCost: totalCost}))
+			}
+			return id
+		}
+
+		it.Before(func() {
+			var err error
+			conn, err = sqlite3.Open(":memory:")
+			require.NoError(t, err)
+			store = NewRunStore(conn)
+
+			baseline = []int64{saveRun(0.1, 10), saveRun(0.2, 10)}
+			changed = []int64{saveRun(0.5, 20), saveRun(0.6, 20)}
+			unsummarized = saveRun(-1, 0)
+		})
+
+		it.After(func() {
+			require.NoError(t, conn.Close())
+		})
+
+		it("describes each metric of each group", func() {
+			stats, _, err := CompareGroups(store, [][]int64{baseline, changed})
+			require.NoError(t, err)
+
+			require.Len(t, stats, 2)
+			assert.Equal(t, changed, stats[1].ScenarioRunIds)
+			assert.Equal(t, "failure_rate", stats[1].Metrics[0].Metric)
+			assert.InDelta(t, 0.55, stats[1].Metrics[0].Mean, 0.0001)
+			assert.InDelta(t, 0.0707, stats[1].Metrics[0].StdDev, 0.0001)
+		})
+
+		it("compares each metric of later groups with the first", func() {
+			_, deltas, err := CompareGroups(store, [][]int64{baseline, changed})
+			require.NoError(t, err)
+
+			var failureRate, totalCost MetricDelta
+			for _, d := range deltas {
+				switch d.Metric {
+				case "failure_rate":
+					failureRate = d
+				case "total_cost":
+					totalCost = d
+				}
+			}
+
+			assert.Equal(t, 1, failureRate.Group)
+			assert.InDelta(t, 0.4, failureRate.Delta, 0.0001)
+			assert.InDelta(t, 2.666, failureRate.RelativeDelta, 0.001)
+			require.NotNil(t, failureRate.PValue)
+			assert.True(t, failureRate.Significant)
+
+			assert.InDelta(t, 10.0, totalCost.Delta, 0.0001)
+			assert.Equal(t, 0.0, *totalCost.PValue)
+		})
+
+		it("gives no p-value for single runs", func() {
+			_, deltas, err := CompareGroups(store, [][]int64{baseline[:1], changed[:1]})
+			require.NoError(t, err)
+
+			assert.Nil(t, deltas[0].PValue)
+			assert.False(t, deltas[0].Significant)
+		})
+
+		it("leaves runs without an SLO out of SLO attainment", func() {
+			stats, deltas, err := CompareGroups(store, [][]int64{baseline, changed})
+			require.NoError(t, err)
+
+			for _, d := range deltas {
+				if d.Metric == "slo_attainment" {
+					assert.Equal(t, 0.0, d.Mean)
+					assert.Nil(t, d.PValue)
+				}
+			}
+			assert.Equal(t, "slo_attainment", stats[0].Metrics[4].Metric)
+		})
+
+		it("needs every run to have a summary", func() {
+			_, _, err := CompareGroups(store, [][]int64{baseline, {unsummarized}})
+			assert.Equal(t, ErrNoSummary, err)
+
+			_, _, err = CompareGroups(store, [][]int64{baseline, {99}})
+			assert.Equal(t, ErrNoSuchRun, err)
+		})
+	})
+}
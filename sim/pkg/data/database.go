@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// row is a row of query results.
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+// database runs SQL for the run stores that keep runs in a SQL database, so that SQLite
+// and PostgreSQL share their queries. Parameters are written as ?.
+type database interface {
+	exec(query string, args ...interface{}) error
+	// insert inserts one row, giving its id.
+	insert(query string, args ...interface{}) (int64, error)
+	eachRow(query string, args []interface{}, scan func(r row) error) error
+	// withTx runs fn in a transaction, which is rolled back if fn fails.
+	withTx(fn func() error) error
+}
+
+type sqliteDatabase struct {
+	conn *sqlite3.Conn
+}
+
+func (db sqliteDatabase) exec(query string, args ...interface{}) error {
+	return db.conn.Exec(query, args...)
+}
+
+func (db sqliteDatabase) insert(query string, args ...interface{}) (int64, error) {
+	err := db.conn.Exec(query, args...)
+	if err != nil {
+		return -1, err
+	}
+
+	return db.conn.LastInsertRowID(), nil
+}
+
+func (db sqliteDatabase) eachRow(query string, args []interface{}, scan func(r row) error) error {
+	stmt, err := db.conn.Prepare(query, args...)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return err
+		}
+		if !hasRow {
+			return nil
+		}
+
+		err = scan(stmt)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (db sqliteDatabase) withTx(fn func() error) error {
+	return db.conn.WithTx(fn)
+}
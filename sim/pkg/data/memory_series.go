@@ -0,0 +1,332 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"sort"
+	"strings"
+)
+
+// unaggregatedStocks are left out of tally lines, as they are by the stock_aggregate view.
+var unaggregatedStocks = map[string]bool{
+	"TrafficSource":       true,
+	"RetrySource":         true,
+	"ReplicaSource":       true,
+	"DesiredSource":       true,
+	"DesiredSink":         true,
+	"ReplicasLaunching":   true,
+	"ReplicasTerminating": true,
+	"ReplicasTerminated":  true,
+}
+
+// aggregateStock gives the name and kind that the stock_aggregate view gives a stock, and
+// false if the view leaves the stock out.
+func aggregateStock(stock memoryStock) (memoryStock, bool) {
+	switch stock.kindStocked {
+	case "Request", "Replica":
+	case "Desired":
+		stock.kindStocked = "Replica"
+	default:
+		return stock, false
+	}
+
+	// stocks of further services are named 'service/Stock', so names are matched after any '/'
+	slash := strings.Index(stock.name, "/")
+	name := stock.name[slash+1:]
+	if unaggregatedStocks[name] || strings.HasPrefix(name, "RequestsComplete") {
+		return stock, false
+	}
+	if strings.HasPrefix(name, "RequestsProcessing") {
+		stock.name = stock.name[:slash+1] + "RequestsProcessing"
+	}
+
+	return stock, true
+}
+
+func (m *memoryStore) TallyLines(scenarioRunId int64) ([]TallyLine, error) {
+	var simulatedDuration int64
+	err := m.withRun(scenarioRunId, func(run *memoryRun) error {
+		simulatedDuration = run.record.SimulatedDuration.Nanoseconds()
+		return nil
+	})
+	if err == ErrNoSuchRun {
+		return make([]TallyLine, 0), nil
+	}
+
+	seen := make(map[TallyLine]bool)
+	tallyLines := make([]TallyLine, 0)
+	add := func(line TallyLine) {
+		if !seen[line] {
+			seen[line] = true
+			tallyLines = append(tallyLines, line)
+		}
+	}
+
+	tallies := make(map[string]int64)
+	last := make(map[string]TallyLine)
+	move := func(occursAt int64, stock memoryStock, change int64) {
+		tallies[stock.name] += change
+		line := TallyLine{OccursAt: occursAt, StockName: stock.name, KindStocked: stock.kindStocked, Tally: tallies[stock.name]}
+		last[stock.name] = line
+		add(line)
+	}
+
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		switch mv.kind {
+		case "start_to_running", "autoscaler_tick", "running_to_halted":
+			return
+		}
+
+		from, fromAggregated := aggregateStock(mv.from)
+		to, toAggregated := aggregateStock(mv.to)
+		if mv.from == mv.to {
+			if fromAggregated {
+				move(mv.occursAt, from, 0)
+			}
+			return
+		}
+		if fromAggregated {
+			move(mv.occursAt, from, -1)
+		}
+		if toAggregated {
+			move(mv.occursAt, to, 1)
+		}
+	})
+
+	// fake up final values so that plot of replicas doesn't clip
+	for _, line := range last {
+		if line.KindStocked == "Replica" {
+			line.OccursAt = simulatedDuration
+			add(line)
+		}
+	}
+
+	sort.Slice(tallyLines, func(i, j int) bool {
+		a, b := tallyLines[i], tallyLines[j]
+		if a.OccursAt != b.OccursAt {
+			return a.OccursAt < b.OccursAt
+		}
+		if a.StockName != b.StockName {
+			return a.StockName < b.StockName
+		}
+		if a.KindStocked != b.KindStocked {
+			return a.KindStocked < b.KindStocked
+		}
+		return a.Tally < b.Tally
+	})
+
+	return tallyLines, nil
+}
+
+func (m *memoryStore) ResponseTimes(scenarioRunId int64) ([]ResponseTime, error) {
+	return m.entitySpans(scenarioRunId, func(name, kind string) bool {
+		return kind == "Request"
+	}), nil
+}
+
+// entitySpans gives when each included entity first and last moved in a run, in the order
+// that they first moved.
+func (m *memoryStore) entitySpans(scenarioRunId int64, include func(name, kind string) bool) []ResponseTime {
+	spans := make([]ResponseTime, 0)
+	byEntity := make(map[memoryStock]int)
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		if !include(mv.movedName, mv.movedKind) {
+			return
+		}
+
+		entity := memoryStock{mv.movedName, mv.movedKind}
+		i, ok := byEntity[entity]
+		if !ok {
+			byEntity[entity] = len(spans)
+			spans = append(spans, ResponseTime{ArrivedAt: mv.occursAt, CompletedAt: mv.occursAt})
+			return
+		}
+		spans[i].CompletedAt = mv.occursAt
+	})
+
+	for i := range spans {
+		spans[i].ResponseTime = spans[i].CompletedAt - spans[i].ArrivedAt
+	}
+
+	return spans
+}
+
+func (m *memoryStore) CPUUtilizations(scenarioRunId int64) ([]CPUUtilizationMetric, error) {
+	samples, err := m.serviceCPUUtilizations(scenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+
+	cpuUtilizations := make([]CPUUtilizationMetric, 0)
+	for _, s := range samples {
+		if s.service == "" {
+			cpuUtilizations = append(cpuUtilizations, CPUUtilizationMetric{CPUUtilization: s.utilization, CalculatedAt: s.calculatedAt})
+		}
+	}
+	return cpuUtilizations, nil
+}
+
+// serviceCPUUtilizations gives each service's highest CPU utilization at each autoscaler
+// tick, ordered by service and then by tick, as ServiceCPUUtilizationQuery does.
+func (m *memoryStore) serviceCPUUtilizations(scenarioRunId int64) ([]utilizationSample, error) {
+	type tick struct {
+		service      string
+		calculatedAt int64
+	}
+
+	samples := make([]utilizationSample, 0)
+	err := m.withRun(scenarioRunId, func(run *memoryRun) error {
+		byTick := make(map[tick]int)
+		for _, mu := range run.cpuUtilizations {
+			u := mu.metric
+			i, ok := byTick[tick{mu.service, u.CalculatedAt}]
+			if !ok {
+				byTick[tick{mu.service, u.CalculatedAt}] = len(samples)
+				samples = append(samples, utilizationSample{service: mu.service, calculatedAt: u.CalculatedAt, utilization: u.CPUUtilization})
+			} else if u.CPUUtilization > samples[i].utilization {
+				samples[i].utilization = u.CPUUtilization
+			}
+		}
+		return nil
+	})
+	if err != nil && err != ErrNoSuchRun {
+		return nil, err
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].service != samples[j].service {
+			return samples[i].service < samples[j].service
+		}
+		return samples[i].calculatedAt < samples[j].calculatedAt
+	})
+	return samples, nil
+}
+
+func (m *memoryStore) AutoscalerDecisions(scenarioRunId int64) ([]AutoscalerDecision, error) {
+	decisions := make([]AutoscalerDecision, 0)
+	err := m.withRun(scenarioRunId, func(run *memoryRun) error {
+		decisions = append(decisions, run.decisions...)
+		return nil
+	})
+	if err != nil && err != ErrNoSuchRun {
+		return nil, err
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].DecidedAt < decisions[j].DecidedAt
+	})
+	return decisions, nil
+}
+
+func (m *memoryStore) RequestsPerSecond(scenarioRunId int64) ([]RPS, error) {
+	return m.perSecond("arrive_at_routing_stock", scenarioRunId), nil
+}
+
+func (m *memoryStore) RetriesPerSecond(scenarioRunId int64) ([]RPS, error) {
+	return m.perSecond("retry_request", scenarioRunId), nil
+}
+
+// perSecond counts the movements of one kind in each second.
+func (m *memoryStore) perSecond(kind string, scenarioRunId int64) []RPS {
+	perSecond := make([]RPS, 0)
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		if mv.kind != kind {
+			return
+		}
+
+		second := mv.occursAt / 1000000000
+		if len(perSecond) == 0 || perSecond[len(perSecond)-1].Second != second {
+			perSecond = append(perSecond, RPS{Second: second})
+		}
+		perSecond[len(perSecond)-1].Requests++
+	})
+
+	return perSecond
+}
+
+func (m *memoryStore) IgnoredMovements(scenarioRunId int64) ([]IgnoredMovementLine, []MovementNote, error) {
+	ignored := make([]IgnoredMovementLine, 0)
+	notes := make([]MovementNote, 0)
+	err := m.withRun(scenarioRunId, func(run *memoryRun) error {
+		for _, mv := range inOrder(run.ignored) {
+			line := IgnoredMovementLine{
+				OccursAt:  mv.occursAt,
+				Kind:      mv.kind,
+				FromStock: mv.from.name,
+				ToStock:   mv.to.name,
+				Reason:    mv.reason,
+			}
+			if len(mv.notes) > 0 {
+				line.Notes = append([]string(nil), mv.notes...)
+			}
+			ignored = append(ignored, line)
+		}
+
+		for _, mv := range inOrder(run.completed) {
+			for _, note := range mv.notes {
+				notes = append(notes, MovementNote{OccursAt: mv.occursAt, Kind: mv.kind, Note: note})
+			}
+		}
+		return nil
+	})
+	if err != nil && err != ErrNoSuchRun {
+		return nil, nil, err
+	}
+
+	return ignored, notes, nil
+}
+
+func (m *memoryStore) CompletedCount(scenarioRunId int64) (int64, error) {
+	var completed int64
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		completed++
+	})
+
+	return completed, nil
+}
+
+func (m *memoryStore) IgnoredCounts(scenarioRunId int64) ([]IgnoredCount, error) {
+	counts := make([]IgnoredCount, 0)
+	err := m.withRun(scenarioRunId, func(run *memoryRun) error {
+		byReasonAndKind := make(map[IgnoredCount]int)
+		for _, mv := range run.ignored {
+			key := IgnoredCount{Reason: mv.reason, Kind: mv.kind}
+			i, ok := byReasonAndKind[key]
+			if !ok {
+				byReasonAndKind[key] = len(counts)
+				counts = append(counts, key)
+				i = len(counts) - 1
+			}
+			counts[i].Ignored++
+		}
+		return nil
+	})
+	if err != nil && err != ErrNoSuchRun {
+		return nil, err
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.Ignored != b.Ignored {
+			return a.Ignored > b.Ignored
+		}
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Kind < b.Kind
+	})
+	return counts, nil
+}
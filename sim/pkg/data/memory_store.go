@@ -0,0 +1,460 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+type memoryStock struct {
+	name        string
+	kindStocked string
+}
+
+type memoryMovement struct {
+	id        int64
+	occursAt  int64
+	kind      string
+	movedName string
+	movedKind string
+	from      memoryStock
+	to        memoryStock
+	reason    string
+	notes     []string
+}
+
+type memoryUtilization struct {
+	service string
+	metric  CPUUtilizationMetric
+}
+
+type memoryRun struct {
+	record          RunRecord
+	configuration   *RunConfiguration
+	summary         *RunSummary
+	cost            *RunCost
+	completed       []memoryMovement
+	ignored         []memoryMovement
+	cpuUtilizations []memoryUtilization
+	decisions       []AutoscalerDecision
+	// lastUsed orders runs by when they were last written or read.
+	lastUsed int64
+}
+
+// memoryStore keeps runs in maps and slices, answering queries as the SQL stores do. It is
+// safe to share between goroutines.
+type memoryStore struct {
+	mu             sync.Mutex
+	runs           map[int64]*memoryRun
+	lastRunId      int64
+	lastMovementId int64
+	// maxRuns is how many runs are kept, or zero to keep every run.
+	maxRuns int
+	uses    int64
+}
+
+// NewMemoryRunStore keeps runs in memory for as long as the store is kept, without any
+// database.
+func NewMemoryRunStore() RunStore {
+	return newMemoryStore(0)
+}
+
+// newMemoryStore keeps at most maxRuns runs, dropping the least recently used to make room
+// for a new run. Zero keeps every run.
+func newMemoryStore(maxRuns int) *memoryStore {
+	return &memoryStore{runs: make(map[int64]*memoryRun), maxRuns: maxRuns}
+}
+
+func (m *memoryStore) Store(completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement,
+	clusterConf model.ClusterConfig, asConf model.AutoscalerConfig, origin string, trafficPattern string, ranFor time.Duration,
+	cpuUtilizations []*simulator.CPUUtilization) (scenarioRunId int64, err error) {
+
+	writer, err := m.Writer(clusterConf, asConf, origin, trafficPattern, ranFor)
+	if err != nil {
+		return -1, err
+	}
+
+	return writeAll(writer, completed, ignored, cpuUtilizations)
+}
+
+func (m *memoryStore) Writer(clusterConf model.ClusterConfig, asConf model.AutoscalerConfig, origin string,
+	trafficPattern string, ranFor time.Duration) (RunWriter, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastRunId++
+	m.runs[m.lastRunId] = &memoryRun{
+		record: RunRecord{
+			ScenarioRunId:     m.lastRunId,
+			Recorded:          time.Now().Format(time.RFC3339),
+			Origin:            origin,
+			TrafficPattern:    trafficPattern,
+			SimulatedDuration: ranFor,
+		},
+	}
+	m.run(m.lastRunId)
+	m.evict()
+
+	return newBatchingWriter(&memorySink{store: m, scenarioRunId: m.lastRunId}, m.lastRunId, writeBatchSize), nil
+}
+
+func (m *memoryStore) SaveConfiguration(scenarioRunId int64, config RunConfiguration) error {
+	return m.withRun(scenarioRunId, func(run *memoryRun) error {
+		run.configuration = &config
+		run.record.Seed = config.Seed
+		run.record.InitialNumberOfReplicas = config.InitialNumberOfReplicas
+		run.record.RequestTimeout = config.RequestTimeout
+		run.record.RequestCPUTimeMillis = config.RequestCPUTimeMillis
+		run.record.RequestIOTimeMillis = config.RequestIOTimeMillis
+		run.record.HasConfiguration = true
+		return nil
+	})
+}
+
+func (m *memoryStore) SaveSummary(scenarioRunId int64, summary RunSummary) error {
+	return m.withRun(scenarioRunId, func(run *memoryRun) error {
+		run.summary = &summary
+		return nil
+	})
+}
+
+func (m *memoryStore) SaveCost(scenarioRunId int64, cost RunCost) error {
+	return m.withRun(scenarioRunId, func(run *memoryRun) error {
+		run.cost = &cost
+		return nil
+	})
+}
+
+func (m *memoryStore) DeleteRun(scenarioRunId int64) error {
+	return m.withRun(scenarioRunId, func(run *memoryRun) error {
+		delete(m.runs, scenarioRunId)
+		return nil
+	})
+}
+
+func (m *memoryStore) ListRuns(filter RunFilter) ([]RunRecord, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matching := make([]RunRecord, 0)
+	for _, run := range m.runs {
+		if filter.matches(run.record) {
+			matching = append(matching, run.record)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].ScenarioRunId > matching[j].ScenarioRunId
+	})
+
+	records := make([]RunRecord, 0)
+	if filter.Offset < len(matching) {
+		records = matching[filter.Offset:]
+	}
+	if len(records) > filter.limit() {
+		records = records[:filter.limit()]
+	}
+
+	return records, int64(len(matching)), nil
+}
+
+func (m *memoryStore) LoadRun(scenarioRunId int64) (RunRecord, error) {
+	var record RunRecord
+	err := m.withRun(scenarioRunId, func(run *memoryRun) error {
+		record = run.record
+		return nil
+	})
+
+	return record, err
+}
+
+func (m *memoryStore) LoadConfiguration(scenarioRunId int64) (RunConfiguration, error) {
+	var config RunConfiguration
+	err := m.withRun(scenarioRunId, func(run *memoryRun) error {
+		if run.configuration == nil {
+			return ErrNoConfiguration
+		}
+
+		config = *run.configuration
+		return nil
+	})
+
+	return config, err
+}
+
+func (m *memoryStore) LoadSummary(scenarioRunId int64) (summary RunSummary, found bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.run(scenarioRunId)
+	if !ok || run.summary == nil {
+		return summary, false, nil
+	}
+
+	return *run.summary, true, nil
+}
+
+func (m *memoryStore) LoadCost(scenarioRunId int64) (cost RunCost, found bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.run(scenarioRunId)
+	if !ok || run.cost == nil {
+		return cost, false, nil
+	}
+
+	return *run.cost, true, nil
+}
+
+func (m *memoryStore) LastMovement(scenarioRunId int64) (occursAt int64, halted bool, err error) {
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		if mv.occursAt > occursAt {
+			occursAt = mv.occursAt
+		}
+		if mv.kind == "running_to_halted" {
+			halted = true
+		}
+	})
+
+	return occursAt, halted, nil
+}
+
+func (m *memoryStore) Summarize(scenarioRunId int64, config SummaryConfig) (RunSummary, error) {
+	var failed, timedOut int64
+	changes := make([]replicaChange, 0)
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		// only the main service is summarized
+		switch {
+		case mv.kind == "request_failed" && serviceOfStock(mv.from.name) == "":
+			failed++
+			if strings.Contains(mv.from.name, "RequestsProcessing") {
+				timedOut++
+			}
+		case mv.kind == "begin_launch" && serviceOfStock(mv.to.name) == "":
+			changes = append(changes, replicaChange{occursAt: mv.occursAt, change: 1})
+		case mv.kind == "finish_terminating" && serviceOfStock(mv.to.name) == "":
+			changes = append(changes, replicaChange{occursAt: mv.occursAt, change: -1})
+		}
+	})
+
+	completedRequests := make(map[memoryStock]bool)
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		if mv.kind == "complete_request" && serviceOfStock(mv.to.name) == "" {
+			completedRequests[memoryStock{mv.movedName, mv.movedKind}] = true
+		}
+	})
+	responseTimes := make([]time.Duration, 0)
+	for _, span := range m.entitySpans(scenarioRunId, func(name, kind string) bool {
+		return completedRequests[memoryStock{name, kind}]
+	}) {
+		responseTimes = append(responseTimes, time.Duration(span.ResponseTime))
+	}
+	sort.Slice(responseTimes, func(i, j int) bool {
+		return responseTimes[i] < responseTimes[j]
+	})
+
+	return summarize(responseTimes, failed, timedOut, changes, config), nil
+}
+
+func (m *memoryStore) Cost(scenarioRunId int64, config CostConfig) (RunCost, error) {
+	changes := make([]phaseChange, 0)
+	m.eachCompleted(scenarioRunId, func(mv memoryMovement) {
+		switch mv.kind {
+		case "begin_launch", "finish_launching", "terminate_launch", "terminate_active", "finish_terminating":
+			changes = append(changes, phaseChange{service: serviceOfStock(mv.to.name), occursAt: mv.occursAt, kind: mv.kind})
+		}
+	})
+
+	samples, err := m.serviceCPUUtilizations(scenarioRunId)
+	if err != nil {
+		return RunCost{}, err
+	}
+
+	return costOf(changes, samples, config), nil
+}
+
+func (m *memoryStore) CostFrontier(scenarioRunIds []int64) ([]FrontierPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	points := make([]FrontierPoint, 0)
+	placed := make(map[int64]bool)
+	for _, id := range scenarioRunIds {
+		run, ok := m.run(id)
+		if !ok || run.summary == nil || run.cost == nil || placed[id] {
+			continue
+		}
+
+		placed[id] = true
+		points = append(points, FrontierPoint{
+			ScenarioRunId:   id,
+			TotalCost:       run.cost.TotalCost,
+			ResponseTimeP99: run.summary.ResponseTimeP99,
+			FailureRate:     run.summary.FailureRate,
+			OnFrontier:      run.summary.Completed > 0,
+		})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].TotalCost != points[j].TotalCost {
+			return points[i].TotalCost < points[j].TotalCost
+		}
+		if points[i].ResponseTimeP99 != points[j].ResponseTimeP99 {
+			return points[i].ResponseTimeP99 < points[j].ResponseTimeP99
+		}
+		return points[i].ScenarioRunId < points[j].ScenarioRunId
+	})
+
+	markFrontier(points)
+	return points, nil
+}
+
+// withRun calls fn with a run while holding the store's lock.
+func (m *memoryStore) withRun(scenarioRunId int64, fn func(run *memoryRun) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.run(scenarioRunId)
+	if !ok {
+		return ErrNoSuchRun
+	}
+
+	return fn(run)
+}
+
+// run gives a run, marking it as the most recently used. The store's lock must be held.
+func (m *memoryStore) run(scenarioRunId int64) (*memoryRun, bool) {
+	run, ok := m.runs[scenarioRunId]
+	if ok {
+		m.uses++
+		run.lastUsed = m.uses
+	}
+
+	return run, ok
+}
+
+// evict drops the least recently used runs until no more than maxRuns are kept. The
+// store's lock must be held.
+func (m *memoryStore) evict() {
+	for m.maxRuns > 0 && len(m.runs) > m.maxRuns {
+		var oldest *memoryRun
+		for _, run := range m.runs {
+			if oldest == nil || run.lastUsed < oldest.lastUsed {
+				oldest = run
+			}
+		}
+		delete(m.runs, oldest.record.ScenarioRunId)
+	}
+}
+
+// eachCompleted calls fn with each of a run's completed movements, in the order they
+// occurred. Simultaneous movements are given in the order they were written.
+func (m *memoryStore) eachCompleted(scenarioRunId int64, fn func(mv memoryMovement)) {
+	m.mu.Lock()
+	run, ok := m.run(scenarioRunId)
+	var completed []memoryMovement
+	if ok {
+		completed = inOrder(run.completed)
+	}
+	m.mu.Unlock()
+
+	for _, mv := range completed {
+		fn(mv)
+	}
+}
+
+// inOrder copies movements, sorted by when they occurred and then by when they were written.
+func inOrder(movements []memoryMovement) []memoryMovement {
+	sorted := make([]memoryMovement, len(movements))
+	copy(sorted, movements)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].occursAt < sorted[j].occursAt
+	})
+
+	return sorted
+}
+
+// memorySink writes movements into a run in a memoryStore.
+type memorySink struct {
+	store         *memoryStore
+	scenarioRunId int64
+}
+
+func (s *memorySink) writeBatch(completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement) error {
+	return s.store.withRun(s.scenarioRunId, func(run *memoryRun) error {
+		for _, mv := range completed {
+			s.store.lastMovementId++
+			run.completed = append(run.completed, memoryMovement{
+				id:        s.store.lastMovementId,
+				occursAt:  mv.Movement.OccursAt().UnixNano(),
+				kind:      string(mv.Movement.Kind()),
+				movedName: string(mv.Moved.Name()),
+				movedKind: string(mv.Moved.Kind()),
+				from:      memoryStock{string(mv.Movement.From().Name()), string(mv.Movement.From().KindStocked())},
+				to:        memoryStock{string(mv.Movement.To().Name()), string(mv.Movement.To().KindStocked())},
+				notes:     append([]string(nil), mv.Movement.Notes()...),
+			})
+		}
+
+		for _, mv := range ignored {
+			s.store.lastMovementId++
+			run.ignored = append(run.ignored, memoryMovement{
+				id:       s.store.lastMovementId,
+				occursAt: mv.Movement.OccursAt().UnixNano(),
+				kind:     string(mv.Movement.Kind()),
+				from:     memoryStock{string(mv.Movement.From().Name()), string(mv.Movement.From().KindStocked())},
+				to:       memoryStock{string(mv.Movement.To().Name()), string(mv.Movement.To().KindStocked())},
+				reason:   mv.Reason,
+				notes:    append([]string(nil), mv.Movement.Notes()...),
+			})
+		}
+
+		return nil
+	})
+}
+
+func (s *memorySink) writeCPUUtilizations(cpuUtilizations []*simulator.CPUUtilization) error {
+	return s.store.withRun(s.scenarioRunId, func(run *memoryRun) error {
+		for _, u := range cpuUtilizations {
+			run.cpuUtilizations = append(run.cpuUtilizations, memoryUtilization{
+				service: u.Service,
+				metric: CPUUtilizationMetric{
+					CPUUtilization: u.CPUUtilization,
+					CalculatedAt:   u.CalculatedAt.UnixNano(),
+				},
+			})
+		}
+
+		return nil
+	})
+}
+
+func (s *memorySink) writeAutoscalerDecisions(decisions []*simulator.AutoscalerDecision) error {
+	return s.store.withRun(s.scenarioRunId, func(run *memoryRun) error {
+		for _, d := range decisions {
+			run.decisions = append(run.decisions, newAutoscalerDecision(d))
+		}
+
+		return nil
+	})
+}
+
+func (s *memorySink) close() {}
@@ -0,0 +1,412 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestMemoryRunStore(t *testing.T) {
+	spec.Run(t, "MemoryRunStore", testAgainstSQLite(func(t *testing.T) (RunStore, func()) {
+		return NewMemoryRunStore(), func() {}
+	}), spec.Report(report.Terminal{}))
+}
+
+func TestBoundedMemoryRunStore(t *testing.T) {
+	spec.Run(t, "MemoryRunStore with a run limit", testBoundedMemoryRunStore, spec.Report(report.Terminal{}))
+}
+
+func testBoundedMemoryRunStore(t *testing.T, describe spec.G, it spec.S) {
+	var subject RunStore
+	var first, second, third int64
+
+	record := func() int64 {
+		writer, err := subject.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "bounded_test", "step", time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, writer.Finish(nil, nil))
+		return writer.ScenarioRunId()
+	}
+
+	it.Before(func() {
+		subject = newMemoryStore(2)
+		first = record()
+		second = record()
+	})
+
+	it("drops the oldest run to make room for a new one", func() {
+		third = record()
+
+		_, err := subject.LoadRun(first)
+		assert.Equal(t, ErrNoSuchRun, err)
+		_, err = subject.LoadRun(second)
+		assert.NoError(t, err)
+		_, err = subject.LoadRun(third)
+		assert.NoError(t, err)
+	})
+
+	it("keeps runs that were read since", func() {
+		_, err := subject.LoadRun(first)
+		require.NoError(t, err)
+		third = record()
+
+		_, err = subject.LoadRun(first)
+		assert.NoError(t, err)
+		_, err = subject.LoadRun(second)
+		assert.Equal(t, ErrNoSuchRun, err)
+	})
+}
+
+// synthesizedRun gives the movements of a run with requests arriving, being retried,
+// completing and failing on two replicas and a further service, while replicas launch and
+// terminate. Every request arrives at a different time.
+func synthesizedRun(startAt time.Time, requests int) ([]simulator.CompletedMovement, []simulator.IgnoredMovement, []*simulator.CPUUtilization) {
+	completed := make([]simulator.CompletedMovement, 0)
+	ignored := make([]simulator.IgnoredMovement, 0)
+
+	request := func(name string) simulator.ThroughStock {
+		return simulator.NewThroughStock(simulator.StockName(name), "Request")
+	}
+	replica := func(name string) simulator.ThroughStock {
+		return simulator.NewThroughStock(simulator.StockName(name), "Replica")
+	}
+	trafficSource, retrySource, routing := request("TrafficSource"), request("RetrySource"), request("RequestsRouting")
+	processing := []simulator.ThroughStock{request("RequestsProcessing-1"), request("RequestsProcessing-2"), request("backend/RequestsProcessing-1")}
+	complete, failed := request("RequestsComplete"), request("RequestsFailed")
+	desiredSource := simulator.NewThroughStock("DesiredSource", "Desired")
+	desired := simulator.NewThroughStock("ReplicasDesired", "Desired")
+	replicaSource, launching, active := replica("ReplicaSource"), replica("ReplicasLaunching"), replica("ReplicasActive")
+	terminating, terminated := replica("ReplicasTerminating"), replica("ReplicasTerminated")
+	scenario := simulator.NewThroughStock("Scenario", "Scenario")
+
+	at := func(millis int) time.Time { return startAt.Add(time.Duration(millis) * time.Millisecond) }
+	move := func(kind string, millis int, from, to simulator.ThroughStock, moved simulator.Entity, notes ...string) {
+		mv := simulator.NewMovement(simulator.MovementKind(kind), at(millis), from, to)
+		for _, note := range notes {
+			mv.AddNote(note)
+		}
+		completed = append(completed, simulator.CompletedMovement{Movement: mv, Moved: moved})
+	}
+	ignore := func(kind string, millis int, from, to simulator.ThroughStock, reason string, notes ...string) {
+		mv := simulator.NewMovement(simulator.MovementKind(kind), at(millis), from, to)
+		for _, note := range notes {
+			mv.AddNote(note)
+		}
+		ignored = append(ignored, simulator.IgnoredMovement{Movement: mv, Reason: reason})
+	}
+
+	scenarioEntity := simulator.NewEntity("scenario", "Scenario")
+	move("start_to_running", 0, scenario, scenario, scenarioEntity, "Start scenario")
+
+	for r := 0; r < 2; r++ {
+		name := simulator.EntityName(fmt.Sprintf("replica-%d", r))
+		r1 := simulator.NewEntity(name, "Replica")
+		d := simulator.NewEntity(name+"-desired", "Desired")
+		move("increase_desired", 100+r, desiredSource, desired, d)
+		move("begin_launch", 200+r, replicaSource, launching, r1)
+		move("finish_launching", 1200+r, launching, active, r1, "launched")
+		if r == 1 {
+			move("reduce_desired", 6000, desired, desiredSource, d)
+			move("terminate_active", 6100, active, terminating, r1)
+			move("finish_terminating", 7100, terminating, terminated, r1)
+		}
+	}
+
+	for i := 0; i < requests; i++ {
+		arrival := 1500 + i*137
+		r := simulator.NewEntity(simulator.EntityName(fmt.Sprintf("request-%d", i)), "Request")
+		source := trafficSource
+		if i%4 == 3 {
+			source = retrySource
+			move("retry_request", arrival-1, retrySource, retrySource, r, "retrying")
+		}
+		move("arrive_at_routing_stock", arrival, source, routing, r)
+
+		if i%9 == 8 {
+			move("request_failed", arrival+5, routing, failed, r, "no replica")
+			continue
+		}
+		replica := processing[i%len(processing)]
+		move("send_to_replica", arrival+7, routing, replica, r)
+		switch {
+		case i%5 == 4:
+			move("request_failed", arrival+1000, replica, failed, r, "timed out")
+		default:
+			move("complete_request", arrival+50+(i*31)%400, replica, complete, r)
+		}
+
+		if i%6 == 0 {
+			ignore("complete_request", arrival+2000, replica, complete, "EntityNotFound", fmt.Sprintf("request-%d was already gone", i))
+		}
+		if i%10 == 0 {
+			ignore("autoscaler_tick", arrival+3, scenario, scenario, "OccursAfterHalt")
+		}
+	}
+
+	move("observe_replicas", 8000, active, active, simulator.NewEntity("observer", "Replica"))
+	move("running_to_halted", 9000, scenario, scenario, scenarioEntity, "Halt scenario")
+
+	cpu := make([]*simulator.CPUUtilization, 0)
+	for s := 0; s < 9; s++ {
+		cpu = append(cpu, &simulator.CPUUtilization{CPUUtilization: float64(10 * s), CalculatedAt: at(s * 1000)})
+	}
+	cpu = append(cpu, &simulator.CPUUtilization{CPUUtilization: 95, CalculatedAt: at(3000)})
+	cpu = append(cpu, &simulator.CPUUtilization{Service: "backend", CPUUtilization: 99, CalculatedAt: at(4000)})
+
+	return completed, ignored, cpu
+}
+
+// synthesizedDecisions gives a tick a second of the main service's autoscaler and of a
+// further service's, which fails at its last tick.
+func synthesizedDecisions(startAt time.Time, ticks int) []*simulator.AutoscalerDecision {
+	decisions := make([]*simulator.AutoscalerDecision, 0)
+	for s := 0; s < ticks; s++ {
+		at := startAt.Add(time.Duration(s) * time.Second)
+		stats := []*proto.Stat{
+			{Time: at.UnixNano(), PodName: "RoutingStock", Type: proto.MetricType_CONCURRENT_REQUESTS_MILLIS, Value: int32(1000 * s)},
+			{Time: at.UnixNano(), PodName: "replica-1", Type: proto.MetricType_CPU_MILLIS, Value: int32(50 * s)},
+		}
+		decisions = append(decisions,
+			&simulator.AutoscalerDecision{DecidedAt: at, Stats: stats, Desired: int32(1 + s%3), Recommended: int32(1 + (s+1)%3)},
+			&simulator.AutoscalerDecision{Service: "backend", DecidedAt: at, Desired: 1, Recommended: 1},
+		)
+	}
+	if ticks > 0 {
+		decisions[len(decisions)-1].Err = errors.New("plugin went away")
+	}
+
+	return decisions
+}
+
+// testAgainstSQLite stores the same runs in SQLite and in the store under test, and
+// expects every query to give the same answer from both.
+func testAgainstSQLite(open func(t *testing.T) (RunStore, func())) func(t *testing.T, describe spec.G, it spec.S) {
+	return func(t *testing.T, describe spec.G, it spec.S) {
+		var conn *sqlite3.Conn
+		var expected, subject RunStore
+		var release func()
+		var origin string
+		var expectedIds, subjectIds []int64
+		startAt := time.Unix(0, 0)
+
+		record := func(store RunStore) []int64 {
+			ids := make([]int64, 0)
+			for i, requests := range []int{40, 25, 0} {
+				completed, ignored, cpu := synthesizedRun(startAt, requests)
+				writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, origin, "synthesized", 10*time.Second)
+				require.NoError(t, err)
+				for _, mv := range completed {
+					require.NoError(t, writer.MovementCompleted(mv))
+				}
+				for _, mv := range ignored {
+					require.NoError(t, writer.MovementIgnored(mv))
+				}
+				require.NoError(t, writer.Finish(cpu, synthesizedDecisions(startAt, requests/5)))
+				id := writer.ScenarioRunId()
+				ids = append(ids, id)
+
+				if i == 2 {
+					continue // recorded without configuration, summary or cost
+				}
+				require.NoError(t, store.SaveConfiguration(id, RunConfiguration{Request: []byte(`{}`), Seed: int64(i + 1), RequestCPUTimeMillis: 20}))
+
+				summary, err := store.Summarize(id, SummaryConfig{StartAt: startAt, RanFor: 10 * time.Second, InitialReplicas: 1, SLOLatencyTarget: 200 * time.Millisecond})
+				require.NoError(t, err)
+				require.NoError(t, store.SaveSummary(id, summary))
+
+				cost, err := store.Cost(id, CostConfig{StartAt: startAt, RanFor: 10 * time.Second, InitialActive: map[string]int64{"": 1}, ReplicaCPU: 1, Pricing: Pricing{PerReplicaSecond: 0.01, PerCPUSecond: float64(i + 1)}})
+				require.NoError(t, err)
+				require.NoError(t, store.SaveCost(id, cost))
+			}
+			return ids
+		}
+
+		it.Before(func() {
+			var err error
+			conn, err = sqlite3.Open(":memory:")
+			require.NoError(t, err)
+			expected = NewRunStore(conn)
+			subject, release = open(t)
+
+			origin = fmt.Sprintf("differential_%d", time.Now().UnixNano())
+			expectedIds = record(expected)
+			subjectIds = record(subject)
+		})
+
+		it.After(func() {
+			release()
+			require.NoError(t, conn.Close())
+		})
+
+		queries := []struct {
+			name  string
+			query func(store RunStore, id int64) (interface{}, error)
+		}{
+			{"TallyLines", func(s RunStore, id int64) (interface{}, error) { return s.TallyLines(id) }},
+			{"ResponseTimes", func(s RunStore, id int64) (interface{}, error) { return s.ResponseTimes(id) }},
+			{"CPUUtilizations", func(s RunStore, id int64) (interface{}, error) { return s.CPUUtilizations(id) }},
+			{"AutoscalerDecisions", func(s RunStore, id int64) (interface{}, error) { return s.AutoscalerDecisions(id) }},
+			{"RequestsPerSecond", func(s RunStore, id int64) (interface{}, error) { return s.RequestsPerSecond(id) }},
+			{"RetriesPerSecond", func(s RunStore, id int64) (interface{}, error) { return s.RetriesPerSecond(id) }},
+			{"CompletedCount", func(s RunStore, id int64) (interface{}, error) { return s.CompletedCount(id) }},
+			{"IgnoredCounts", func(s RunStore, id int64) (interface{}, error) { return s.IgnoredCounts(id) }},
+			{"IgnoredMovements", func(s RunStore, id int64) (interface{}, error) {
+				ignored, notes, err := s.IgnoredMovements(id)
+				return []interface{}{ignored, notes}, err
+			}},
+			{"LastMovement", func(s RunStore, id int64) (interface{}, error) {
+				occursAt, halted, err := s.LastMovement(id)
+				return []interface{}{occursAt, halted}, err
+			}},
+			{"LoadSummary", func(s RunStore, id int64) (interface{}, error) {
+				summary, found, err := s.LoadSummary(id)
+				return []interface{}{summary, found}, err
+			}},
+			{"LoadCost", func(s RunStore, id int64) (interface{}, error) {
+				cost, found, err := s.LoadCost(id)
+				return []interface{}{cost, found}, err
+			}},
+			{"LoadConfiguration", func(s RunStore, id int64) (interface{}, error) {
+				config, err := s.LoadConfiguration(id)
+				config.Request = nil // PostgreSQL may reformat the JSON
+				return config, err
+			}},
+		}
+
+		describe("reading each run", func() {
+			for _, q := range queries {
+				q := q
+				it(fmt.Sprintf("gives the same %s", q.name), func() {
+					for i := range expectedIds {
+						want, wantErr := q.query(expected, expectedIds[i])
+						got, gotErr := q.query(subject, subjectIds[i])
+						assert.Equal(t, wantErr, gotErr)
+						assert.Equal(t, want, got, "run %d", i)
+					}
+				})
+			}
+
+			it("gives series with values in them", func() {
+				lines, err := subject.TallyLines(subjectIds[0])
+				require.NoError(t, err)
+				assert.NotEmpty(t, lines)
+
+				decisions, err := subject.AutoscalerDecisions(subjectIds[0])
+				require.NoError(t, err)
+				assert.NotEmpty(t, decisions)
+
+				_, notes, err := subject.IgnoredMovements(subjectIds[0])
+				require.NoError(t, err)
+				assert.NotEmpty(t, notes)
+			})
+		})
+
+		// runs are compared by their position in the order they were recorded, as the
+		// store under test may already hold other runs
+		positions := func(ids, runIds []int64) []int {
+			positions := make([]int, len(runIds))
+			for p, runId := range runIds {
+				positions[p] = -1
+				for i, id := range ids {
+					if id == runId {
+						positions[p] = i
+					}
+				}
+			}
+			return positions
+		}
+
+		describe("ListRuns()", func() {
+			it("lists the same runs", func() {
+				for _, filter := range []RunFilter{{Origin: origin}, {Origin: origin, Seed: 2}, {Origin: origin, Limit: 1, Offset: 1}, {Origin: origin, RequestCPUTimeMillis: 20}} {
+					want, wantTotal, err := expected.ListRuns(filter)
+					require.NoError(t, err)
+					got, gotTotal, err := subject.ListRuns(filter)
+					require.NoError(t, err)
+
+					assert.Equal(t, wantTotal, gotTotal)
+					require.Len(t, got, len(want))
+					for i := range want {
+						assert.Equal(t, positions(expectedIds, []int64{want[i].ScenarioRunId}), positions(subjectIds, []int64{got[i].ScenarioRunId}))
+						want[i].ScenarioRunId, got[i].ScenarioRunId = 0, 0
+						want[i].Recorded, got[i].Recorded = "", ""
+						assert.Equal(t, want[i], got[i])
+					}
+				}
+			})
+		})
+
+		describe("CostFrontier()", func() {
+			it("places the same runs", func() {
+				want, err := expected.CostFrontier(expectedIds)
+				require.NoError(t, err)
+				got, err := subject.CostFrontier(append(subjectIds, subjectIds[0]))
+				require.NoError(t, err)
+
+				require.Len(t, got, len(want))
+				for i := range want {
+					assert.Equal(t, positions(expectedIds, []int64{want[i].ScenarioRunId}), positions(subjectIds, []int64{got[i].ScenarioRunId}))
+					want[i].ScenarioRunId, got[i].ScenarioRunId = 0, 0
+					assert.Equal(t, want[i], got[i])
+				}
+			})
+		})
+
+		describe("DeleteRun()", func() {
+			it("removes the run and everything recorded about it", func() {
+				require.NoError(t, subject.DeleteRun(subjectIds[0]))
+
+				_, err := subject.LoadRun(subjectIds[0])
+				assert.Equal(t, ErrNoSuchRun, err)
+				_, found, err := subject.LoadSummary(subjectIds[0])
+				require.NoError(t, err)
+				assert.False(t, found)
+				count, err := subject.CompletedCount(subjectIds[0])
+				require.NoError(t, err)
+				assert.Equal(t, int64(0), count)
+
+				_, err = subject.LoadRun(subjectIds[1])
+				assert.NoError(t, err)
+			})
+
+			it("needs the run to exist", func() {
+				assert.Equal(t, ErrNoSuchRun, subject.DeleteRun(-1))
+			})
+		})
+
+		describe("LoadConfiguration()", func() {
+			it("tells runs without a configuration from runs that don't exist", func() {
+				_, err := subject.LoadConfiguration(subjectIds[2])
+				assert.Equal(t, ErrNoConfiguration, err)
+
+				_, err = subject.LoadConfiguration(-1)
+				assert.Equal(t, ErrNoSuchRun, err)
+			})
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// language=sql
+var schemaMigrationsTable = `
+create table if not exists schema_migrations
+(
+    version     integer primary key,
+    description text not null,
+    applied     text not null
+);
+`
+
+// Migrate upgrades the database to SchemaVersion, applying each migration it lacks in its
+// own transaction. It refuses to touch a database with a newer schema than it knows.
+func Migrate(conn *sqlite3.Conn) error {
+	return migrate(sqliteDatabase{conn: conn}, migrations, Views)
+}
+
+// migrate applies the migrations a database lacks, then recreates its views.
+func migrate(db database, migrations []migration, views string) error {
+	err := db.exec(schemaMigrationsTable)
+	if err != nil {
+		return err
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema is at version %d, but only versions up to %d are known", version, len(migrations))
+	}
+
+	for v := version + 1; v <= len(migrations); v++ {
+		m := migrations[v-1]
+		err = db.withTx(func() error {
+			err := db.exec(m.sql)
+			if err != nil {
+				return err
+			}
+
+			return db.exec(`insert into schema_migrations(version, description, applied) values (?, ?, ?)`,
+				v, m.description, time.Now().Format(time.RFC3339))
+		})
+		if err != nil {
+			return fmt.Errorf("could not migrate to schema version %d (%s): %s", v, m.description, err.Error())
+		}
+	}
+
+	return db.exec(views)
+}
+
+func schemaVersion(db database) (int, error) {
+	version := 0
+	err := db.eachRow(`select coalesce(max(version), 0) from schema_migrations`, nil, func(r row) error {
+		return r.Scan(&version)
+	})
+
+	return version, err
+}
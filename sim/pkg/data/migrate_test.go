@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	spec.Run(t, "Migrate", testMigrate, spec.Report(report.Terminal{}))
+}
+
+func testMigrate(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var err error
+
+	countOf := func(sql string) int {
+		var count int
+		singleQuery(t, conn, sql, &count)
+		return count
+	}
+
+	it.Before(func() {
+		conn, err = sqlite3.Open(":memory:")
+		require.NoError(t, err)
+	})
+
+	it.After(func() {
+		err = conn.Close()
+		require.NoError(t, err)
+	})
+
+	describe("a new database", func() {
+		it.Before(func() {
+			err = Migrate(conn)
+			require.NoError(t, err)
+		})
+
+		it("applies every migration in order", func() {
+			var version int
+			singleQuery(t, conn, `select max(version) from schema_migrations`, &version)
+			assert.Equal(t, SchemaVersion, version)
+			assert.Equal(t, SchemaVersion, countOf(`select count(1) from schema_migrations`))
+		})
+
+		it("creates the views", func() {
+			assert.Equal(t, 1, countOf(`select count(1) from sqlite_master where type = 'view' and name = 'stock_aggregate'`))
+		})
+
+		it("applies nothing when migrated again", func() {
+			err = Migrate(conn)
+			require.NoError(t, err)
+
+			assert.Equal(t, SchemaVersion, countOf(`select count(1) from schema_migrations`))
+		})
+	})
+
+	describe("a database written before the schema was versioned", func() {
+		it.Before(func() {
+			err = conn.Exec(`
+				create table completed_movements
+				(
+					id              integer primary key,
+					occurs_at       unsigned big integer,
+					kind            text    not null,
+					moved           integer not null,
+					from_stock      integer not null,
+					to_stock        integer not null,
+					scenario_run_id integer not null
+				);
+				create unique index move_once_per_run on completed_movements (occurs_at, scenario_run_id);
+				insert into completed_movements(occurs_at, kind, moved, from_stock, to_stock, scenario_run_id) values (1, 'kept', 1, 1, 2, 1);
+			`)
+			require.NoError(t, err)
+
+			err = Migrate(conn)
+			require.NoError(t, err)
+		})
+
+		it("brings it up to the current version", func() {
+			assert.Equal(t, SchemaVersion, countOf(`select count(1) from schema_migrations`))
+			assert.Equal(t, 1, countOf(`select count(1) from sqlite_master where type = 'table' and name = 'movement_notes'`))
+		})
+
+		it("replaces its unique movement index", func() {
+			assert.Equal(t, 0, countOf(`select count(1) from sqlite_master where name = 'move_once_per_run'`))
+			assert.Equal(t, 1, countOf(`select count(1) from sqlite_master where name = 'completed_movements_run_occurs_at'`))
+		})
+
+		it("keeps its data", func() {
+			assert.Equal(t, 1, countOf(`select count(1) from completed_movements where kind = 'kept'`))
+		})
+	})
+
+	describe("a database with a newer schema", func() {
+		it.Before(func() {
+			err = conn.Exec(schemaMigrationsTable)
+			require.NoError(t, err)
+			err = conn.Exec(`insert into schema_migrations(version, description, applied) values (?, 'from the future', '')`, SchemaVersion+1)
+			require.NoError(t, err)
+		})
+
+		it("refuses to migrate it", func() {
+			err = Migrate(conn)
+			assert.EqualError(t, err, fmt.Sprintf("database schema is at version %d, but only versions up to %d are known", SchemaVersion+1, SchemaVersion))
+		})
+
+		it("can't be stored into", func() {
+			assert.Panics(t, func() {
+				NewRunStore(conn)
+			})
+		})
+	})
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresMigrations build the same schema as migrations, in PostgreSQL's dialect. They
+// are numbered separately, since PostgreSQL databases were never written by older builds.
+var postgresMigrations = []migration{
+	{
+		description: "create scenario runs, movements, summaries and costs",
+		// language=sql
+		sql: `
+create table if not exists scenario_runs
+(
+    id                         bigserial primary key,
+
+    recorded                   text   not null,
+    simulated_duration         bigint not null,
+    origin                     text   not null,
+    traffic_pattern            text   not null,
+
+    cluster_launch_delay       bigint not null,
+    cluster_terminate_delay    bigint not null,
+    cluster_number_of_requests bigint not null,
+    autoscaler_tick_interval   bigint not null,
+
+    configuration              text, -- canonical JSON of the run request
+    seed                       bigint,
+    initial_number_of_replicas bigint,
+    request_timeout            bigint,
+    request_cpu_time_millis    bigint,
+    request_io_time_millis     bigint
+);
+create index if not exists scenario_runs_traffic_pattern on scenario_runs (traffic_pattern);
+create index if not exists scenario_runs_seed on scenario_runs (seed);
+create index if not exists scenario_runs_replicas on scenario_runs (initial_number_of_replicas);
+create index if not exists scenario_runs_request on scenario_runs (request_cpu_time_millis, request_io_time_millis, request_timeout);
+
+create table if not exists stocks
+(
+    id           bigserial primary key,
+    name         text not null,
+    kind_stocked text not null
+);
+create unique index if not exists stocks_names_kind on stocks (name, kind_stocked);
+
+create table if not exists entities
+(
+    id   bigserial primary key,
+    name text not null,
+    kind text not null
+);
+create unique index if not exists entities_names_kind on entities (name, kind);
+
+create table if not exists completed_movements
+(
+    id              bigserial primary key,
+    occurs_at       bigint not null,
+    kind            text   not null,
+
+    moved           bigint not null references entities (id),
+    from_stock      bigint not null references stocks (id),
+    to_stock        bigint not null references stocks (id),
+
+    scenario_run_id bigint not null references scenario_runs (id)
+);
+create index if not exists completed_movements_run_occurs_at on completed_movements (scenario_run_id, occurs_at);
+
+create table if not exists cpu_utilizations
+(
+    id              bigserial primary key,
+    cpu_utilization double precision not null,
+    calculated_at   bigint           not null,
+
+    scenario_run_id bigint not null references scenario_runs (id)
+);
+create index if not exists cpu_utilizations_run on cpu_utilizations (scenario_run_id);
+
+create table if not exists ignored_movements
+(
+    id              bigserial primary key,
+    occurs_at       bigint not null,
+    kind            text   not null,
+
+    from_stock      bigint not null references stocks (id),
+    to_stock        bigint not null references stocks (id),
+    reason          text   not null,
+
+    scenario_run_id bigint not null references scenario_runs (id)
+);
+create index if not exists ignored_movements_run_occurs_at on ignored_movements (scenario_run_id, occurs_at);
+
+create table if not exists movement_notes
+(
+    id                    bigserial primary key,
+    completed_movement_id bigint references completed_movements (id),
+    ignored_movement_id   bigint references ignored_movements (id),
+    position              bigint not null, -- notes are kept in the order they were added
+    note                  text   not null,
+
+    scenario_run_id       bigint not null references scenario_runs (id),
+
+    check ((completed_movement_id is null) != (ignored_movement_id is null))
+);
+create index if not exists movement_notes_run on movement_notes (scenario_run_id);
+
+create table if not exists run_summaries
+(
+    id                 bigserial primary key,
+    requests           bigint           not null,
+    completed          bigint           not null,
+    failed             bigint           not null,
+    timed_out          bigint           not null,
+    failure_rate       double precision not null,
+
+    response_time_p50  bigint           not null,
+    response_time_p90  bigint           not null,
+    response_time_p95  bigint           not null,
+    response_time_p99  bigint           not null,
+    response_time_p999 bigint           not null,
+
+    average_replicas   double precision not null,
+    peak_replicas      bigint           not null,
+    replica_seconds    double precision not null,
+
+    slo_latency_target bigint           not null,
+    slo_attainment     double precision not null,
+
+    scenario_run_id    bigint           not null references scenario_runs (id)
+);
+create unique index if not exists run_summaries_run on run_summaries (scenario_run_id);
+
+create table if not exists run_costs
+(
+    id                  bigserial primary key,
+    per_replica_second  double precision not null,
+    per_cpu_second      double precision not null,
+
+    launching_seconds   double precision not null,
+    active_seconds      double precision not null,
+    terminating_seconds double precision not null,
+    replica_seconds     double precision not null,
+
+    cpu_seconds         double precision not null,
+    used_cpu_seconds    double precision not null,
+    idle_cpu_seconds    double precision not null,
+
+    replica_cost        double precision not null,
+    cpu_cost            double precision not null,
+    total_cost          double precision not null,
+    wasted_cost         double precision not null,
+
+    scenario_run_id     bigint           not null references scenario_runs (id)
+);
+create unique index if not exists run_costs_run on run_costs (scenario_run_id);
+`,
+	},
+	{
+		description: "record autoscaler decisions",
+		// language=sql
+		sql: `
+create table if not exists autoscaler_decisions
+(
+    id              bigserial primary key,
+    decided_at      bigint not null,
+    service         text   not null,
+    stats           text   not null,
+    desired         bigint not null,
+    recommended     bigint not null,
+    error           text,
+
+    scenario_run_id bigint not null references scenario_runs (id)
+);
+create index if not exists autoscaler_decisions_run_decided_at on autoscaler_decisions (scenario_run_id, decided_at);
+`,
+	},
+	{
+		description: "tag CPU utilizations with their service",
+		// language=sql
+		sql: `
+alter table cpu_utilizations add column service text not null default '';
+`,
+	},
+}
+
+// postgresViews are Views in PostgreSQL's dialect, which finds the '/' with strpos.
+// language=sql
+var postgresViews = `
+drop view if exists stock_aggregate;
+create view stock_aggregate as
+select id
+     , (case
+            when substr(name, strpos(name, '/') + 1) like 'RequestsProcessing%'
+                then substr(name, 1, strpos(name, '/')) || 'RequestsProcessing'
+            else name
+    end) as name
+     , (case
+            when kind_stocked = 'Desired' then 'Replica'
+            else kind_stocked
+    end) as kind_stocked
+from stocks
+where kind_stocked in ('Request', 'Desired', 'Replica')
+  and substr(name, strpos(name, '/') + 1) not in ('TrafficSource', 'RetrySource', 'ReplicaSource', 'DesiredSource', 'DesiredSink', 'ReplicasLaunching', 'ReplicasTerminating', 'ReplicasTerminated')
+  and substr(name, strpos(name, '/') + 1) not like 'RequestsComplete%'
+;
+`
+
+// postgresDatabase runs SQL on one connection to a PostgreSQL database, within the
+// transaction that withTx began if there is one.
+type postgresDatabase struct {
+	conn *sql.Conn
+	tx   *sql.Tx
+}
+
+type postgresExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (db *postgresDatabase) executor() postgresExecutor {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.conn
+}
+
+func (db *postgresDatabase) exec(query string, args ...interface{}) error {
+	_, err := db.executor().ExecContext(context.Background(), postgresQuery(query), args...)
+	return err
+}
+
+func (db *postgresDatabase) insert(query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := db.executor().QueryRowContext(context.Background(), postgresQuery(query)+" returning id", args...).Scan(&id)
+	if err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+func (db *postgresDatabase) eachRow(query string, args []interface{}, scan func(r row) error) error {
+	rows, err := db.executor().QueryContext(context.Background(), postgresQuery(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (db *postgresDatabase) withTx(fn func() error) error {
+	if db.tx != nil {
+		return fn()
+	}
+
+	tx, err := db.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+
+	db.tx = tx
+	err = fn()
+	db.tx = nil
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// postgresQuery numbers the ? parameters of a query from $1, as PostgreSQL expects, and
+// drops any trailing semicolon so that the query can be extended.
+func postgresQuery(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return strings.TrimSuffix(strings.TrimSpace(b.String()), ";")
+}
+
+// newPostgresStore keeps runs in a PostgreSQL database through one connection, which must
+// not be shared with other stores.
+func newPostgresStore(conn *sql.Conn) RunStore {
+	db := &postgresDatabase{conn: conn}
+
+	return &storer{
+		db: db,
+		newSink: func(scenarioRunId int64) (movementSink, error) {
+			return &databaseSink{db: db, scenarioRunId: scenarioRunId, written: make(map[string]bool)}, nil
+		},
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRunStore(t *testing.T) {
+	spec.Run(t, "Postgres RunStore", testPostgresRunStore, spec.Report(report.Terminal{}))
+}
+
+func testPostgresRunStore(t *testing.T, describe spec.G, it spec.S) {
+	describe("postgresQuery()", func() {
+		it("numbers placeholders in order", func() {
+			assert.Equal(t, "select * from runs where id = $1 and origin = $2", postgresQuery("select * from runs where id = ? and origin = ?"))
+		})
+
+		it("drops the trailing semicolon", func() {
+			assert.Equal(t, "select 1", postgresQuery("\n\tselect 1;\n"))
+		})
+	})
+
+	describe("against a live database", func() {
+		dataSource := os.Getenv("SKENARIO_TEST_POSTGRES")
+		if dataSource == "" {
+			return
+		}
+
+		var backend Backend
+
+		it.Before(func() {
+			var err error
+			backend, err = OpenBackend(dataSource)
+			require.NoError(t, err)
+		})
+
+		it.After(func() {
+			assert.NoError(t, backend.Close())
+		})
+
+		describe("gives the same answers as SQLite", func() {
+			testAgainstSQLite(func(t *testing.T) (RunStore, func()) {
+				store, release, err := backend.Open()
+				require.NoError(t, err)
+				return store, release
+			})(t, describe, it)
+		})
+	})
+}
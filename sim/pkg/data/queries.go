@@ -28,10 +28,11 @@ select
 		   when to_stock = sa.id then 1
 		 end)
 	  over summation as tally
+	, row_number() over (partition by sa.name order by occurs_at desc, completed_movements.id desc) as from_last
 	from completed_movements join stock_aggregate sa on sa.id in (from_stock, to_stock)
 	where kind not in ('start_to_running', 'autoscaler_tick', 'running_to_halted')
 	and scenario_run_id = ?
-    window summation as (partition by sa.name order by occurs_at asc rows unbounded preceding)
+    window summation as (partition by sa.name order by occurs_at asc, completed_movements.id asc rows unbounded preceding)
 )
 select occurs_at
      , stock_name
@@ -47,9 +48,8 @@ select -- fake up final values so that plot of replicas doesn't clip
 from running_tally, scenario_runs
 where scenario_runs.id = ?
   and kind_stocked = 'Replica'
-group by stock_name
-having max(occurs_at)
-order by occurs_at asc, stock_name asc
+  and from_last = 1
+order by occurs_at asc, stock_name asc, kind_stocked asc, tally asc
 ;
 `
 
@@ -74,11 +74,25 @@ select
   , calculated_at
 from cpu_utilizations
 where scenario_run_id = ?
+  and service = '' -- the main service
 group by calculated_at
 order by calculated_at
 ;
 `
 
+// language=sql
+var ServiceCPUUtilizationQuery = `
+select
+    service
+  , max(cpu_utilization)
+  , calculated_at
+from cpu_utilizations
+where scenario_run_id = ?
+group by service, calculated_at
+order by service, calculated_at
+;
+`
+
 // language=sql
 var RequestsPerSecondQuery = `
 select
@@ -88,5 +102,146 @@ from completed_movements
 where kind = 'arrive_at_routing_stock'
 and scenario_run_id = ?
 group by occurs_at_second
+order by occurs_at_second
+;
+`
+
+// language=sql
+var RetriesPerSecondQuery = `
+select
+    occurs_at / 1000000000        as occurs_at_second
+  , count(occurs_at / 1000000000) as retries
+from completed_movements
+where kind = 'retry_request'
+and scenario_run_id = ?
+group by occurs_at_second
+order by occurs_at_second
+;
+`
+
+// language=sql
+var IgnoredMovementsQuery = `
+select
+    ignored_movements.id
+  , occurs_at
+  , kind
+  , from_stocks.name as from_stock
+  , to_stocks.name   as to_stock
+  , reason
+from ignored_movements
+  join stocks from_stocks on from_stocks.id = ignored_movements.from_stock
+  join stocks to_stocks on to_stocks.id = ignored_movements.to_stock
+where scenario_run_id = ?
+order by occurs_at, ignored_movements.id
+;
+`
+
+// language=sql
+var MovementNotesQuery = `
+select
+    coalesce(completed_movements.occurs_at, ignored_movements.occurs_at) as occurs_at
+  , coalesce(completed_movements.kind, ignored_movements.kind)           as kind
+  , coalesce(movement_notes.ignored_movement_id, 0)                      as ignored_movement_id
+  , note
+from movement_notes
+  left join completed_movements on completed_movements.id = movement_notes.completed_movement_id
+  left join ignored_movements on ignored_movements.id = movement_notes.ignored_movement_id
+where movement_notes.scenario_run_id = ?
+order by occurs_at, coalesce(movement_notes.completed_movement_id, 0), coalesce(movement_notes.ignored_movement_id, 0), position
+;
+`
+
+// language=sql
+var IgnoredCountsQuery = `
+select
+    reason
+  , kind
+  , count(1) as ignored
+from ignored_movements
+where scenario_run_id = ?
+group by reason, kind
+order by ignored desc, reason, kind
+;
+`
+
+// language=sql
+var CompletedCountQuery = `
+select count(1)
+from completed_movements
+where scenario_run_id = ?
+;
+`
+
+// language=sql
+var CompletedResponseTimesQuery = `
+select max(occurs_at) - min(occurs_at) as response_time
+from completed_movements
+where scenario_run_id = ?
+  and moved in (
+    select moved
+    from completed_movements
+      join stocks to_stocks on to_stocks.id = completed_movements.to_stock
+    where kind = 'complete_request'
+      and scenario_run_id = ?
+      and to_stocks.name not like '%/%' -- the main service
+  )
+group by moved
+order by response_time
+;
+`
+
+// language=sql
+var FailedRequestsQuery = `
+select
+    count(1)                                                           as failed
+  , coalesce(sum(case when from_stocks.name like '%RequestsProcessing%' then 1 else 0 end), 0) as timed_out
+from completed_movements
+  join stocks from_stocks on from_stocks.id = completed_movements.from_stock
+where kind = 'request_failed'
+  and scenario_run_id = ?
+  and from_stocks.name not like '%/%' -- the main service
+;
+`
+
+// language=sql
+var ReplicaChangesQuery = `
+select
+    occurs_at
+  , (case kind when 'begin_launch' then 1 else -1 end) as change
+from completed_movements
+  join stocks to_stocks on to_stocks.id = completed_movements.to_stock
+where kind in ('begin_launch', 'finish_terminating')
+  and scenario_run_id = ?
+  and to_stocks.name not like '%/%' -- the main service
+order by occurs_at, completed_movements.id
+;
+`
+
+// language=sql
+var ReplicaPhaseChangesQuery = `
+select
+    occurs_at
+  , kind
+  , to_stocks.name as to_stock
+from completed_movements
+  join stocks to_stocks on to_stocks.id = completed_movements.to_stock
+where kind in ('begin_launch', 'finish_launching', 'terminate_launch', 'terminate_active', 'finish_terminating')
+  and scenario_run_id = ?
+order by occurs_at, completed_movements.id
+;
+`
+
+// language=sql
+var CostFrontierQuery = `
+select
+    run_costs.scenario_run_id
+  , run_costs.total_cost
+  , run_summaries.response_time_p99
+  , run_summaries.completed
+  , run_summaries.failure_rate
+from run_costs
+  join run_summaries on run_summaries.scenario_run_id = run_costs.scenario_run_id
+where run_costs.scenario_run_id in (%s)
+order by run_costs.total_cost, run_summaries.response_time_p99, run_costs.scenario_run_id
 ;
 `
@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RunConfiguration is everything a run was made from. Request holds the whole run request
+// in canonical form, so that the run can be made again exactly, and the fields that runs
+// are most often filtered by are copied out of it to be indexed.
+type RunConfiguration struct {
+	Request json.RawMessage
+
+	Seed                    int64
+	InitialNumberOfReplicas int64
+	RequestTimeout          time.Duration
+	RequestCPUTimeMillis    int64
+	RequestIOTimeMillis     int64
+}
+
+func (s *storer) SaveConfiguration(scenarioRunId int64, config RunConfiguration) error {
+	return s.db.exec(`update scenario_runs
+		set configuration              = ?
+		  , seed                       = ?
+		  , initial_number_of_replicas = ?
+		  , request_timeout            = ?
+		  , request_cpu_time_millis    = ?
+		  , request_io_time_millis     = ?
+		where id = ?`,
+		string(config.Request),
+		config.Seed,
+		config.InitialNumberOfReplicas,
+		config.RequestTimeout.Nanoseconds(),
+		config.RequestCPUTimeMillis,
+		config.RequestIOTimeMillis,
+		scenarioRunId,
+	)
+}
+
+// LoadConfiguration gives the configuration a run was made from. Runs recorded before
+// configurations were stored have none.
+func (s *storer) LoadConfiguration(scenarioRunId int64) (RunConfiguration, error) {
+	var config RunConfiguration
+	var request string
+	var requestTimeout int64
+	found, stored := false, false
+
+	err := s.db.eachRow(`select
+		configuration is not null
+	  , coalesce(configuration, '')
+	  , coalesce(seed, 0)
+	  , coalesce(initial_number_of_replicas, 0)
+	  , coalesce(request_timeout, 0)
+	  , coalesce(request_cpu_time_millis, 0)
+	  , coalesce(request_io_time_millis, 0)
+	from scenario_runs
+	where id = ?`, []interface{}{scenarioRunId}, func(r row) error {
+		found = true
+		return r.Scan(&stored, &request, &config.Seed, &config.InitialNumberOfReplicas, &requestTimeout, &config.RequestCPUTimeMillis, &config.RequestIOTimeMillis)
+	})
+	if err != nil {
+		return config, err
+	}
+	if !found {
+		return config, ErrNoSuchRun
+	}
+	if !stored {
+		return config, ErrNoConfiguration
+	}
+
+	config.Request = json.RawMessage(request)
+	config.RequestTimeout = time.Duration(requestTimeout)
+	return config, nil
+}
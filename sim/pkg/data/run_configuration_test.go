@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+)
+
+func TestRunConfiguration(t *testing.T) {
+	spec.Run(t, "RunConfiguration", testRunConfiguration, spec.Report(report.Terminal{}))
+}
+
+func testRunConfiguration(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var store RunStore
+	var scenarioRunId int64
+	var config RunConfiguration
+	var err error
+
+	it.Before(func() {
+		conn, err = sqlite3.Open(":memory:")
+		require.NoError(t, err)
+		store = NewRunStore(conn)
+
+		writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", time.Minute)
+		require.NoError(t, err)
+		scenarioRunId = writer.ScenarioRunId()
+		require.NoError(t, writer.Finish(nil, nil))
+
+		config = RunConfiguration{
+			Request:                 json.RawMessage(`{"traffic_pattern":"test_pattern","seed":7}`),
+			Seed:                    7,
+			InitialNumberOfReplicas: 3,
+			RequestTimeout:          time.Second,
+			RequestCPUTimeMillis:    200,
+			RequestIOTimeMillis:     50,
+		}
+	})
+
+	it.After(func() {
+		err = conn.Close()
+		require.NoError(t, err)
+	})
+
+	describe("SaveConfiguration()", func() {
+		it.Before(func() {
+			err = store.SaveConfiguration(scenarioRunId, config)
+			require.NoError(t, err)
+		})
+
+		it("stores the key fields in their own columns", func() {
+			var seed, replicas, timeout, cpu, io int64
+			singleQuery(t, conn, `select seed, initial_number_of_replicas, request_timeout, request_cpu_time_millis, request_io_time_millis from scenario_runs`, &seed, &replicas, &timeout, &cpu, &io)
+
+			assert.Equal(t, []int64{7, 3, time.Second.Nanoseconds(), 200, 50}, []int64{seed, replicas, timeout, cpu, io})
+		})
+
+		it("can be loaded again", func() {
+			loaded, err := store.LoadConfiguration(scenarioRunId)
+			require.NoError(t, err)
+
+			assert.Equal(t, config, loaded)
+		})
+	})
+
+	describe("LoadConfiguration()", func() {
+		it("says when a run was recorded without its configuration", func() {
+			_, err = store.LoadConfiguration(scenarioRunId)
+			assert.Equal(t, ErrNoConfiguration, err)
+		})
+
+		it("says when there is no such run", func() {
+			_, err = store.LoadConfiguration(99)
+			assert.Equal(t, ErrNoSuchRun, err)
+		})
+	})
+}
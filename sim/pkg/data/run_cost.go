@@ -0,0 +1,403 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pricing gives what replicas cost to run. Replicas and their CPU are paid for from when
+// they begin launching until they finish terminating, whether or not the CPU is used.
+type Pricing struct {
+	PerReplicaSecond float64 `json:"per_replica_second"`
+	PerCPUSecond     float64 `json:"per_cpu_second"`
+}
+
+// CostConfig gives what Cost needs to know about a run that its movements don't.
+type CostConfig struct {
+	StartAt time.Time
+	RanFor  time.Duration
+	// InitialLaunching and InitialActive are how many replicas each service had before the
+	// first movement, by service name. The main service's name is empty.
+	InitialLaunching map[string]int64
+	InitialActive    map[string]int64
+	// ReplicaCPU is how many CPUs each replica has.
+	ReplicaCPU float64
+	Pricing    Pricing
+}
+
+// RunCost gives what a run cost and how much of that paid for idle CPU. Used CPU is worked
+// out from the CPU utilization of each service's active replicas at each autoscaler tick,
+// so the CPU of launching and terminating replicas is always idle.
+type RunCost struct {
+	Pricing Pricing `json:"pricing"`
+
+	LaunchingSeconds   float64 `json:"launching_seconds"`
+	ActiveSeconds      float64 `json:"active_seconds"`
+	TerminatingSeconds float64 `json:"terminating_seconds"`
+	ReplicaSeconds     float64 `json:"replica_seconds"`
+
+	CPUSeconds     float64 `json:"cpu_seconds"`
+	UsedCPUSeconds float64 `json:"used_cpu_seconds"`
+	IdleCPUSeconds float64 `json:"idle_cpu_seconds"`
+
+	ReplicaCost float64 `json:"replica_cost"`
+	CPUCost     float64 `json:"cpu_cost"`
+	TotalCost   float64 `json:"total_cost"`
+	// WastedCost is the share of TotalCost that paid for idle CPU.
+	WastedCost float64 `json:"wasted_cost"`
+}
+
+// FrontierPoint places a run by what it cost and how quickly it completed requests.
+type FrontierPoint struct {
+	ScenarioRunId   int64         `json:"scenario_run_id"`
+	TotalCost       float64       `json:"total_cost"`
+	ResponseTimeP99 time.Duration `json:"response_time_p99"`
+	FailureRate     float64       `json:"failure_rate"`
+	// OnFrontier is set when no other run was as cheap and as quick, and better at either.
+	// Runs that completed no requests are never on the frontier.
+	OnFrontier bool `json:"on_frontier"`
+}
+
+type phaseChange struct {
+	service  string
+	occursAt int64
+	kind     string
+}
+
+type utilizationSample struct {
+	service      string
+	calculatedAt int64
+	utilization  float64
+}
+
+// serviceOfStock gives the name of the service that a stock belongs to. Stocks of further
+// services are named 'service/Stock'; the main service's stocks, and name, have no '/'.
+func serviceOfStock(name string) string {
+	slash := strings.Index(name, "/")
+	if slash < 0 {
+		return ""
+	}
+
+	return name[:slash]
+}
+
+func (s *storer) Cost(scenarioRunId int64, config CostConfig) (RunCost, error) {
+	changes := make([]phaseChange, 0)
+	var occursAt int64
+	var kind, stock string
+	err := s.db.eachRow(ReplicaPhaseChangesQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&occursAt, &kind, &stock)
+		if err != nil {
+			return err
+		}
+
+		changes = append(changes, phaseChange{service: serviceOfStock(stock), occursAt: occursAt, kind: kind})
+		return nil
+	})
+	if err != nil {
+		return RunCost{}, err
+	}
+
+	samples := make([]utilizationSample, 0)
+	var service string
+	var utilization float64
+	var calculatedAt int64
+	err = s.db.eachRow(ServiceCPUUtilizationQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&service, &utilization, &calculatedAt)
+		if err != nil {
+			return err
+		}
+
+		samples = append(samples, utilizationSample{service: service, calculatedAt: calculatedAt, utilization: utilization})
+		return nil
+	})
+	if err != nil {
+		return RunCost{}, err
+	}
+
+	return costOf(changes, samples, config), nil
+}
+
+// costOf works out what a run cost from the phase changes of its replicas and its CPU
+// utilization samples, each in the order they happened. A service's CPU utilization only
+// says how busy that service's replicas were, so each service's time is summed on its own.
+func costOf(changes []phaseChange, samples []utilizationSample, config CostConfig) RunCost {
+	cost := RunCost{Pricing: config.Pricing}
+
+	services := make([]string, 0)
+	serviceChanges := make(map[string][]phaseChange)
+	serviceSamples := make(map[string][]utilizationSample)
+	addService := func(service string) {
+		if _, ok := serviceChanges[service]; !ok {
+			serviceChanges[service] = make([]phaseChange, 0)
+			services = append(services, service)
+		}
+	}
+	for service := range config.InitialLaunching {
+		addService(service)
+	}
+	for service := range config.InitialActive {
+		addService(service)
+	}
+	for _, c := range changes {
+		addService(c.service)
+		serviceChanges[c.service] = append(serviceChanges[c.service], c)
+	}
+	for _, s := range samples {
+		serviceSamples[s.service] = append(serviceSamples[s.service], s)
+	}
+	// used time is summed as a float, so services are summed in the same order every time
+	sort.Strings(services)
+
+	var total replicaTime
+	for _, service := range services {
+		t := replicaTimeOf(serviceChanges[service], serviceSamples[service], config.InitialLaunching[service], config.InitialActive[service], config)
+		total.launchingNanos += t.launchingNanos
+		total.activeNanos += t.activeNanos
+		total.terminatingNanos += t.terminatingNanos
+		total.usedNanos += t.usedNanos
+	}
+
+	cost.LaunchingSeconds = time.Duration(total.launchingNanos).Seconds()
+	cost.ActiveSeconds = time.Duration(total.activeNanos).Seconds()
+	cost.TerminatingSeconds = time.Duration(total.terminatingNanos).Seconds()
+	cost.ReplicaSeconds = time.Duration(total.launchingNanos + total.activeNanos + total.terminatingNanos).Seconds()
+
+	cost.CPUSeconds = cost.ReplicaSeconds * config.ReplicaCPU
+	cost.UsedCPUSeconds = time.Duration(total.usedNanos).Seconds() * config.ReplicaCPU
+	if cost.UsedCPUSeconds > cost.CPUSeconds {
+		cost.UsedCPUSeconds = cost.CPUSeconds
+	}
+	cost.IdleCPUSeconds = cost.CPUSeconds - cost.UsedCPUSeconds
+
+	cost.ReplicaCost = cost.ReplicaSeconds * config.Pricing.PerReplicaSecond
+	cost.CPUCost = cost.CPUSeconds * config.Pricing.PerCPUSecond
+	cost.TotalCost = cost.ReplicaCost + cost.CPUCost
+	if cost.CPUSeconds > 0 {
+		cost.WastedCost = cost.TotalCost * cost.IdleCPUSeconds / cost.CPUSeconds
+	}
+
+	return cost
+}
+
+// replicaTime is replica time summed in nanoseconds, to avoid rounding on every change.
+type replicaTime struct {
+	launchingNanos   int64
+	activeNanos      int64
+	terminatingNanos int64
+	usedNanos        float64
+}
+
+// replicaTimeOf sums the replica time of one service from its phase changes and CPU
+// utilization samples.
+func replicaTimeOf(changes []phaseChange, samples []utilizationSample, initialLaunching, initialActive int64, config CostConfig) replicaTime {
+	var t replicaTime
+	launching, active, terminating := initialLaunching, initialActive, int64(0)
+	utilization := 0.0
+
+	last := config.StartAt.UnixNano()
+	haltAt := config.StartAt.Add(config.RanFor).UnixNano()
+	advance := func(to int64) {
+		if to > haltAt {
+			to = haltAt
+		}
+		if to <= last {
+			return
+		}
+
+		t.launchingNanos += launching * (to - last)
+		t.activeNanos += active * (to - last)
+		t.terminatingNanos += terminating * (to - last)
+		t.usedNanos += utilization / 100 * float64(active) * float64(to-last)
+		last = to
+	}
+
+	// a tick's utilization holds until the next tick, and is measured after replicas have
+	// changed at the same instant
+	for c, s := 0, 0; c < len(changes) || s < len(samples); {
+		if s == len(samples) || (c < len(changes) && changes[c].occursAt <= samples[s].calculatedAt) {
+			advance(changes[c].occursAt)
+			switch changes[c].kind {
+			case "begin_launch":
+				launching++
+			case "finish_launching":
+				launching--
+				active++
+			case "terminate_launch":
+				launching--
+				terminating++
+			case "terminate_active":
+				active--
+				terminating++
+			case "finish_terminating":
+				terminating--
+			}
+			c++
+		} else {
+			advance(samples[s].calculatedAt)
+			utilization = samples[s].utilization
+			s++
+		}
+	}
+	advance(haltAt)
+
+	return t
+}
+
+func (s *storer) SaveCost(scenarioRunId int64, cost RunCost) error {
+	return s.db.exec(`insert into run_costs(
+		per_replica_second
+	  , per_cpu_second
+	  , launching_seconds
+	  , active_seconds
+	  , terminating_seconds
+	  , replica_seconds
+	  , cpu_seconds
+	  , used_cpu_seconds
+	  , idle_cpu_seconds
+	  , replica_cost
+	  , cpu_cost
+	  , total_cost
+	  , wasted_cost
+	  , scenario_run_id
+	) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	on conflict (scenario_run_id) do update set
+		per_replica_second  = excluded.per_replica_second
+	  , per_cpu_second      = excluded.per_cpu_second
+	  , launching_seconds   = excluded.launching_seconds
+	  , active_seconds      = excluded.active_seconds
+	  , terminating_seconds = excluded.terminating_seconds
+	  , replica_seconds     = excluded.replica_seconds
+	  , cpu_seconds         = excluded.cpu_seconds
+	  , used_cpu_seconds    = excluded.used_cpu_seconds
+	  , idle_cpu_seconds    = excluded.idle_cpu_seconds
+	  , replica_cost        = excluded.replica_cost
+	  , cpu_cost            = excluded.cpu_cost
+	  , total_cost          = excluded.total_cost
+	  , wasted_cost         = excluded.wasted_cost`,
+		cost.Pricing.PerReplicaSecond,
+		cost.Pricing.PerCPUSecond,
+		cost.LaunchingSeconds,
+		cost.ActiveSeconds,
+		cost.TerminatingSeconds,
+		cost.ReplicaSeconds,
+		cost.CPUSeconds,
+		cost.UsedCPUSeconds,
+		cost.IdleCPUSeconds,
+		cost.ReplicaCost,
+		cost.CPUCost,
+		cost.TotalCost,
+		cost.WastedCost,
+		scenarioRunId,
+	)
+}
+
+func (s *storer) LoadCost(scenarioRunId int64) (cost RunCost, found bool, err error) {
+	err = s.db.eachRow(`select
+		per_replica_second
+	  , per_cpu_second
+	  , launching_seconds
+	  , active_seconds
+	  , terminating_seconds
+	  , replica_seconds
+	  , cpu_seconds
+	  , used_cpu_seconds
+	  , idle_cpu_seconds
+	  , replica_cost
+	  , cpu_cost
+	  , total_cost
+	  , wasted_cost
+	from run_costs
+	where scenario_run_id = ?`, []interface{}{scenarioRunId}, func(r row) error {
+		found = true
+		return r.Scan(
+			&cost.Pricing.PerReplicaSecond,
+			&cost.Pricing.PerCPUSecond,
+			&cost.LaunchingSeconds,
+			&cost.ActiveSeconds,
+			&cost.TerminatingSeconds,
+			&cost.ReplicaSeconds,
+			&cost.CPUSeconds,
+			&cost.UsedCPUSeconds,
+			&cost.IdleCPUSeconds,
+			&cost.ReplicaCost,
+			&cost.CPUCost,
+			&cost.TotalCost,
+			&cost.WastedCost,
+		)
+	})
+
+	return cost, found, err
+}
+
+func (s *storer) CostFrontier(scenarioRunIds []int64) ([]FrontierPoint, error) {
+	points := make([]FrontierPoint, 0)
+	if len(scenarioRunIds) == 0 {
+		return points, nil
+	}
+
+	args := make([]interface{}, len(scenarioRunIds))
+	for i, id := range scenarioRunIds {
+		args[i] = id
+	}
+	query := fmt.Sprintf(CostFrontierQuery, strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", "))
+
+	var point FrontierPoint
+	var p99, completed int64
+	err := s.db.eachRow(query, args, func(r row) error {
+		err := r.Scan(&point.ScenarioRunId, &point.TotalCost, &p99, &completed, &point.FailureRate)
+		if err != nil {
+			return err
+		}
+
+		point.ResponseTimeP99 = time.Duration(p99)
+		// runs that completed nothing have no response times, so can't be compared
+		point.OnFrontier = completed > 0
+		points = append(points, point)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	markFrontier(points)
+	return points, nil
+}
+
+// markFrontier takes points ordered by cost then latency, with only those that completed
+// requests marked, and leaves marked only those on the frontier.
+func markFrontier(points []FrontierPoint) {
+	// points are ordered by cost then latency, so a point is on the frontier if it is
+	// quicker than every cheaper point, or ties with the point that was
+	var best *FrontierPoint
+	for i := range points {
+		if !points[i].OnFrontier {
+			continue
+		}
+
+		bettered := best != nil && points[i].ResponseTimeP99 >= best.ResponseTimeP99
+		tied := best != nil && points[i].ResponseTimeP99 == best.ResponseTimeP99 && points[i].TotalCost == best.TotalCost
+		if bettered && !tied {
+			points[i].OnFrontier = false
+		} else if !bettered {
+			best = &points[i]
+		}
+	}
+}
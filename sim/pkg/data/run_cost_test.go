@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestRunCost(t *testing.T) {
+	spec.Run(t, "RunCost", testRunCost, spec.Report(report.Terminal{}))
+}
+
+func testRunCost(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var store RunStore
+	var startAt time.Time
+	var scenarioRunId int64
+	var config CostConfig
+	var cost RunCost
+	var err error
+
+	it.Before(func() {
+		startAt = time.Unix(0, 0)
+		env := simulator.NewEnvironment(context.Background(), startAt, 100*time.Second)
+
+		conn, err = sqlite3.Open(":memory:")
+		require.NoError(t, err)
+		store = NewRunStore(conn)
+
+		desired := simulator.NewThroughStock("ReplicasDesired", "Replica")
+		launching := simulator.NewThroughStock("ReplicasLaunching", "Replica")
+		active := simulator.NewThroughStock("ReplicasActive", "Replica")
+		terminating := simulator.NewThroughStock("ReplicasTerminating", "Replica")
+		terminated := simulator.NewSinkStock("ReplicasTerminated", "Replica")
+		err = desired.Add(simulator.NewEntity("replica-2", "Replica"))
+		require.NoError(t, err)
+		backendDesired := simulator.NewThroughStock("backend/ReplicasDesired", "Replica")
+		backendLaunching := simulator.NewThroughStock("backend/ReplicasLaunching", "Replica")
+		backendActive := simulator.NewThroughStock("backend/ReplicasActive", "Replica")
+		err = backendDesired.Add(simulator.NewEntity("replica-2", "Replica"))
+		require.NoError(t, err)
+
+		// replica-1 is active throughout, replica-2 launches and terminates
+		env.AddToSchedule(simulator.NewMovement("begin_launch", startAt.Add(10*time.Second), desired, launching))
+		env.AddToSchedule(simulator.NewMovement("finish_launching", startAt.Add(20*time.Second), launching, active))
+		env.AddToSchedule(simulator.NewMovement("terminate_active", startAt.Add(70*time.Second), active, terminating))
+		env.AddToSchedule(simulator.NewMovement("finish_terminating", startAt.Add(80*time.Second), terminating, terminated))
+		// the backend's replica-1 is active throughout, its replica-2 launches and stays
+		env.AddToSchedule(simulator.NewMovement("begin_launch", startAt.Add(50*time.Second), backendDesired, backendLaunching))
+		env.AddToSchedule(simulator.NewMovement("finish_launching", startAt.Add(60*time.Second), backendLaunching, backendActive))
+
+		completed, ignored, err := env.Run()
+		require.NoError(t, err)
+
+		utilizations := []*simulator.CPUUtilization{
+			{CPUUtilization: 50, CalculatedAt: startAt},
+			{CPUUtilization: 100, CalculatedAt: startAt.Add(30 * time.Second)},
+			{Service: "backend", CPUUtilization: 100, CalculatedAt: startAt.Add(10 * time.Second)},
+		}
+		scenarioRunId, err = store.Store(completed, ignored, model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", 100*time.Second, utilizations)
+		require.NoError(t, err)
+
+		config = CostConfig{
+			StartAt:       startAt,
+			RanFor:        100 * time.Second,
+			InitialActive: map[string]int64{"": 1, "backend": 1},
+			ReplicaCPU:    0.1,
+			Pricing:       Pricing{PerReplicaSecond: 0.01, PerCPUSecond: 0.1},
+		}
+	})
+
+	it.After(func() {
+		err = conn.Close()
+		require.NoError(t, err)
+	})
+
+	describe("Cost()", func() {
+		it.Before(func() {
+			cost, err = store.Cost(scenarioRunId, config)
+			require.NoError(t, err)
+		})
+
+		it("sums replica lifetimes by phase across services", func() {
+			assert.InDelta(t, 20.0, cost.LaunchingSeconds, 0.0001)
+			assert.InDelta(t, 290.0, cost.ActiveSeconds, 0.0001)
+			assert.InDelta(t, 10.0, cost.TerminatingSeconds, 0.0001)
+			assert.InDelta(t, 320.0, cost.ReplicaSeconds, 0.0001)
+		})
+
+		it("splits provisioned CPU into used and idle by the utilization of each service's active replicas", func() {
+			assert.InDelta(t, 32.0, cost.CPUSeconds, 0.0001)
+			assert.InDelta(t, 26.0, cost.UsedCPUSeconds, 0.0001)
+			assert.InDelta(t, 6.0, cost.IdleCPUSeconds, 0.0001)
+		})
+
+		it("prices replica and CPU time", func() {
+			assert.Equal(t, config.Pricing, cost.Pricing)
+			assert.InDelta(t, 3.2, cost.ReplicaCost, 0.0001)
+			assert.InDelta(t, 3.2, cost.CPUCost, 0.0001)
+			assert.InDelta(t, 6.4, cost.TotalCost, 0.0001)
+		})
+
+		it("gives the share of the cost that paid for idle CPU", func() {
+			assert.InDelta(t, 1.2, cost.WastedCost, 0.0001)
+		})
+	})
+
+	describe("SaveCost()", func() {
+		var totalCost, idle float64
+		var count int
+
+		it.Before(func() {
+			cost, err = store.Cost(scenarioRunId, config)
+			require.NoError(t, err)
+
+			err = store.SaveCost(scenarioRunId, cost)
+			require.NoError(t, err)
+			err = store.SaveCost(scenarioRunId, cost)
+			require.NoError(t, err)
+
+			singleQuery(t, conn, `select total_cost, idle_cpu_seconds from run_costs`, &totalCost, &idle)
+			singleQuery(t, conn, `select count(1) from run_costs`, &count)
+		})
+
+		it("stores the cost against the run", func() {
+			assert.InDelta(t, 6.4, totalCost, 0.0001)
+			assert.InDelta(t, 6.0, idle, 0.0001)
+		})
+
+		it("keeps one cost per run", func() {
+			assert.Equal(t, 1, count)
+		})
+	})
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoSuchRun       = errors.New("there is no such scenario run")
+	ErrNoConfiguration = errors.New("scenario run was recorded without its configuration")
+)
+
+// runTables hold rows for each scenario run, and are emptied of a run before the run
+// itself is deleted.
+var runTables = []string{
+	"movement_notes",
+	"completed_movements",
+	"ignored_movements",
+	"cpu_utilizations",
+	"autoscaler_decisions",
+	"run_summaries",
+	"run_costs",
+}
+
+// MaxRunsListed is the most runs that ListRuns gives at once.
+const MaxRunsListed = 500
+
+// RunFilter picks which runs ListRuns gives. Empty fields match every run. Runs are listed
+// newest first.
+type RunFilter struct {
+	Origin                  string
+	TrafficPattern          string
+	Seed                    int64
+	InitialNumberOfReplicas int64
+	RequestTimeout          time.Duration
+	RequestCPUTimeMillis    int64
+	RequestIOTimeMillis     int64
+
+	Limit  int
+	Offset int
+}
+
+// matches is whether a run is one that the filter picks.
+func (f RunFilter) matches(record RunRecord) bool {
+	return (f.Origin == "" || f.Origin == record.Origin) &&
+		(f.TrafficPattern == "" || f.TrafficPattern == record.TrafficPattern) &&
+		(f.Seed == 0 || f.Seed == record.Seed) &&
+		(f.InitialNumberOfReplicas == 0 || f.InitialNumberOfReplicas == record.InitialNumberOfReplicas) &&
+		(f.RequestTimeout == 0 || f.RequestTimeout == record.RequestTimeout) &&
+		(f.RequestCPUTimeMillis == 0 || f.RequestCPUTimeMillis == record.RequestCPUTimeMillis) &&
+		(f.RequestIOTimeMillis == 0 || f.RequestIOTimeMillis == record.RequestIOTimeMillis)
+}
+
+// limit gives how many runs to list at once.
+func (f RunFilter) limit() int {
+	if f.Limit <= 0 || f.Limit > MaxRunsListed {
+		return MaxRunsListed
+	}
+	return f.Limit
+}
+
+// RunRecord describes a stored run. Runs recorded before configurations were stored have
+// only the fields which scenario_runs has always had.
+type RunRecord struct {
+	ScenarioRunId     int64         `json:"scenario_run_id"`
+	Recorded          string        `json:"recorded"`
+	Origin            string        `json:"origin"`
+	TrafficPattern    string        `json:"traffic_pattern"`
+	SimulatedDuration time.Duration `json:"simulated_duration"`
+
+	Seed                    int64         `json:"seed,omitempty"`
+	InitialNumberOfReplicas int64         `json:"initial_number_of_replicas,omitempty"`
+	RequestTimeout          time.Duration `json:"request_timeout_nanos,omitempty"`
+	RequestCPUTimeMillis    int64         `json:"request_cpu_time_millis,omitempty"`
+	RequestIOTimeMillis     int64         `json:"request_io_time_millis,omitempty"`
+	// HasConfiguration is set when the run's full configuration was stored, so that it can
+	// be run again.
+	HasConfiguration bool `json:"has_configuration"`
+}
+
+// language=sql
+var runRecordColumns = `
+    id
+  , recorded
+  , origin
+  , traffic_pattern
+  , simulated_duration
+  , coalesce(seed, 0)
+  , coalesce(initial_number_of_replicas, 0)
+  , coalesce(request_timeout, 0)
+  , coalesce(request_cpu_time_millis, 0)
+  , coalesce(request_io_time_millis, 0)
+  , configuration is not null
+`
+
+func scanRunRecord(r row) (RunRecord, error) {
+	var record RunRecord
+	var simulatedDuration, requestTimeout int64
+	err := r.Scan(
+		&record.ScenarioRunId,
+		&record.Recorded,
+		&record.Origin,
+		&record.TrafficPattern,
+		&simulatedDuration,
+		&record.Seed,
+		&record.InitialNumberOfReplicas,
+		&requestTimeout,
+		&record.RequestCPUTimeMillis,
+		&record.RequestIOTimeMillis,
+		&record.HasConfiguration,
+	)
+	record.SimulatedDuration = time.Duration(simulatedDuration)
+	record.RequestTimeout = time.Duration(requestTimeout)
+
+	return record, err
+}
+
+func (s *storer) ListRuns(filter RunFilter) ([]RunRecord, int64, error) {
+	where := []string{"1 = 1"}
+	args := make([]interface{}, 0)
+	match := func(column string, value interface{}, empty bool) {
+		if !empty {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	match("origin", filter.Origin, filter.Origin == "")
+	match("traffic_pattern", filter.TrafficPattern, filter.TrafficPattern == "")
+	match("seed", filter.Seed, filter.Seed == 0)
+	match("initial_number_of_replicas", filter.InitialNumberOfReplicas, filter.InitialNumberOfReplicas == 0)
+	match("request_timeout", filter.RequestTimeout.Nanoseconds(), filter.RequestTimeout == 0)
+	match("request_cpu_time_millis", filter.RequestCPUTimeMillis, filter.RequestCPUTimeMillis == 0)
+	match("request_io_time_millis", filter.RequestIOTimeMillis, filter.RequestIOTimeMillis == 0)
+	conditions := strings.Join(where, " and ")
+
+	var total int64
+	err := s.db.eachRow(`select count(1) from scenario_runs where `+conditions, args, func(r row) error {
+		return r.Scan(&total)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`select %s from scenario_runs where %s order by id desc limit ? offset ?`, runRecordColumns, conditions)
+
+	records := make([]RunRecord, 0)
+	err = s.db.eachRow(query, append(args, filter.limit(), filter.Offset), func(r row) error {
+		record, err := scanRunRecord(r)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
+func (s *storer) LoadRun(scenarioRunId int64) (RunRecord, error) {
+	var record RunRecord
+	found := false
+	err := s.db.eachRow(`select `+runRecordColumns+` from scenario_runs where id = ?`, []interface{}{scenarioRunId}, func(r row) error {
+		var err error
+		record, err = scanRunRecord(r)
+		found = true
+		return err
+	})
+	if err != nil {
+		return record, err
+	}
+	if !found {
+		return record, ErrNoSuchRun
+	}
+
+	return record, nil
+}
+
+func (s *storer) LastMovement(scenarioRunId int64) (occursAt int64, halted bool, err error) {
+	err = s.db.eachRow(`select
+		coalesce(max(occurs_at), 0)
+	  , coalesce(sum(case when kind = 'running_to_halted' then 1 else 0 end), 0) > 0
+	from completed_movements
+	where scenario_run_id = ?`, []interface{}{scenarioRunId}, func(r row) error {
+		return r.Scan(&occursAt, &halted)
+	})
+
+	return occursAt, halted, err
+}
+
+// DeleteRun removes a run and everything recorded about it. Stocks and entities are shared
+// between runs, so they are kept.
+func (s *storer) DeleteRun(scenarioRunId int64) error {
+	_, err := s.LoadRun(scenarioRunId)
+	if err != nil {
+		return err
+	}
+
+	return s.db.withTx(func() error {
+		for _, table := range runTables {
+			err := s.db.exec(`delete from `+table+` where scenario_run_id = ?`, scenarioRunId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.db.exec(`delete from scenario_runs where id = ?`, scenarioRunId)
+	})
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestRunHistory(t *testing.T) {
+	spec.Run(t, "RunHistory", testRunHistory, spec.Report(report.Terminal{}))
+}
+
+func testRunHistory(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var store RunStore
+	var first, second, third int64
+	var err error
+
+	record := func(pattern string, seed int64, env simulator.Environment) int64 {
+		writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", pattern, time.Minute)
+		require.NoError(t, err)
+		if env != nil {
+			env.AddObserver(writer)
+			_, _, err = env.Run()
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Finish(nil, nil))
+
+		require.NoError(t, store.SaveConfiguration(writer.ScenarioRunId(), RunConfiguration{Request: []byte(`{}`), Seed: seed}))
+		return writer.ScenarioRunId()
+	}
+
+	it.Before(func() {
+		conn, err = sqlite3.Open(":memory:")
+		require.NoError(t, err)
+		store = NewRunStore(conn)
+
+		env := simulator.NewEnvironment(context.Background(), time.Unix(0, 0), time.Minute)
+		first = record("step", 1, env)
+		second = record("ramp", 2, nil)
+		third = record("step", 3, nil)
+	})
+
+	it.After(func() {
+		err = conn.Close()
+		require.NoError(t, err)
+	})
+
+	describe("ListRuns()", func() {
+		ids := func(records []RunRecord) []int64 {
+			ids := make([]int64, 0)
+			for _, r := range records {
+				ids = append(ids, r.ScenarioRunId)
+			}
+			return ids
+		}
+
+		it("lists runs newest first", func() {
+			runs, total, err := store.ListRuns(RunFilter{})
+			require.NoError(t, err)
+
+			assert.Equal(t, []int64{third, second, first}, ids(runs))
+			assert.Equal(t, int64(3), total)
+		})
+
+		it("filters by the given fields", func() {
+			runs, total, err := store.ListRuns(RunFilter{TrafficPattern: "step", Seed: 3})
+			require.NoError(t, err)
+
+			assert.Equal(t, []int64{third}, ids(runs))
+			assert.Equal(t, int64(1), total)
+		})
+
+		it("gives a page of runs along with how many there are altogether", func() {
+			runs, total, err := store.ListRuns(RunFilter{Limit: 1, Offset: 1})
+			require.NoError(t, err)
+
+			assert.Equal(t, []int64{second}, ids(runs))
+			assert.Equal(t, int64(3), total)
+		})
+	})
+
+	describe("LoadRun()", func() {
+		it("describes the run", func() {
+			run, err := store.LoadRun(second)
+			require.NoError(t, err)
+
+			assert.Equal(t, "ramp", run.TrafficPattern)
+			assert.Equal(t, int64(2), run.Seed)
+			assert.Equal(t, time.Minute, run.SimulatedDuration)
+			assert.True(t, run.HasConfiguration)
+		})
+
+		it("says when there is no such run", func() {
+			_, err := store.LoadRun(99)
+			assert.Equal(t, ErrNoSuchRun, err)
+		})
+	})
+
+	describe("LastMovement()", func() {
+		it("gives when the run halted", func() {
+			occursAt, halted, err := store.LastMovement(first)
+			require.NoError(t, err)
+
+			assert.True(t, halted)
+			assert.Equal(t, time.Minute.Nanoseconds(), occursAt)
+		})
+
+		it("says when a run never halted", func() {
+			_, halted, err := store.LastMovement(second)
+			require.NoError(t, err)
+
+			assert.False(t, halted)
+		})
+	})
+
+	describe("DeleteRun()", func() {
+		it("removes the run and its movements", func() {
+			err = store.DeleteRun(first)
+			require.NoError(t, err)
+
+			_, err = store.LoadRun(first)
+			assert.Equal(t, ErrNoSuchRun, err)
+
+			var movements int
+			singleQuery(t, conn, `select count(1) from completed_movements`, &movements)
+			assert.Equal(t, 0, movements)
+		})
+
+		it("says when there is no such run", func() {
+			assert.Equal(t, ErrNoSuchRun, store.DeleteRun(99))
+		})
+	})
+}
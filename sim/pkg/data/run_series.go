@@ -0,0 +1,208 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+type TallyLine struct {
+	OccursAt    int64  `json:"occurs_at"`
+	StockName   string `json:"stock_name"`
+	KindStocked string `json:"kind_stocked"`
+	Tally       int64  `json:"tally"`
+}
+
+type ResponseTime struct {
+	ArrivedAt    int64 `json:"arrived_at"`
+	CompletedAt  int64 `json:"completed_at"`
+	ResponseTime int64 `json:"response_time"`
+}
+
+// RPS counts one kind of movement, such as request arrivals, in one second of a run.
+type RPS struct {
+	Second   int64 `json:"second"`
+	Requests int64 `json:"requests"`
+}
+
+type CPUUtilizationMetric struct {
+	CPUUtilization float64 `json:"cpu_utilization"`
+	CalculatedAt   int64   `json:"calculated_at"`
+}
+
+type IgnoredMovementLine struct {
+	OccursAt  int64    `json:"occurs_at"`
+	Kind      string   `json:"kind"`
+	FromStock string   `json:"from_stock"`
+	ToStock   string   `json:"to_stock"`
+	Reason    string   `json:"reason"`
+	Notes     []string `json:"notes,omitempty"`
+}
+
+type MovementNote struct {
+	OccursAt int64  `json:"occurs_at"`
+	Kind     string `json:"kind"`
+	Note     string `json:"note"`
+}
+
+type IgnoredCount struct {
+	Reason  string `json:"reason"`
+	Kind    string `json:"kind"`
+	Ignored int64  `json:"ignored"`
+}
+
+func (s *storer) TallyLines(scenarioRunId int64) ([]TallyLine, error) {
+	tallyLines := make([]TallyLine, 0)
+	var line TallyLine
+	err := s.db.eachRow(RunningTallyQuery, []interface{}{scenarioRunId, scenarioRunId}, func(r row) error {
+		err := r.Scan(&line.OccursAt, &line.StockName, &line.KindStocked, &line.Tally)
+		if err != nil {
+			return err
+		}
+
+		tallyLines = append(tallyLines, line)
+		return nil
+	})
+
+	return tallyLines, err
+}
+
+func (s *storer) ResponseTimes(scenarioRunId int64) ([]ResponseTime, error) {
+	responseTimes := make([]ResponseTime, 0)
+	var rt ResponseTime
+	err := s.db.eachRow(ResponseTimesQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&rt.ArrivedAt, &rt.CompletedAt, &rt.ResponseTime)
+		if err != nil {
+			return err
+		}
+
+		responseTimes = append(responseTimes, rt)
+		return nil
+	})
+
+	return responseTimes, err
+}
+
+func (s *storer) CPUUtilizations(scenarioRunId int64) ([]CPUUtilizationMetric, error) {
+	cpuUtilizations := make([]CPUUtilizationMetric, 0)
+	var metric CPUUtilizationMetric
+	err := s.db.eachRow(CPUUtilizationQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&metric.CPUUtilization, &metric.CalculatedAt)
+		if err != nil {
+			return err
+		}
+
+		cpuUtilizations = append(cpuUtilizations, metric)
+		return nil
+	})
+
+	return cpuUtilizations, err
+}
+
+func (s *storer) RequestsPerSecond(scenarioRunId int64) ([]RPS, error) {
+	return s.perSecond(RequestsPerSecondQuery, scenarioRunId)
+}
+
+func (s *storer) RetriesPerSecond(scenarioRunId int64) ([]RPS, error) {
+	return s.perSecond(RetriesPerSecondQuery, scenarioRunId)
+}
+
+// perSecond runs a query which counts some kind of movement in each second.
+func (s *storer) perSecond(query string, scenarioRunId int64) ([]RPS, error) {
+	perSecond := make([]RPS, 0)
+	var rps RPS
+	err := s.db.eachRow(query, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&rps.Second, &rps.Requests)
+		if err != nil {
+			return err
+		}
+
+		perSecond = append(perSecond, rps)
+		return nil
+	})
+
+	return perSecond, err
+}
+
+func (s *storer) IgnoredMovements(scenarioRunId int64) ([]IgnoredMovementLine, []MovementNote, error) {
+	ignored := make([]IgnoredMovementLine, 0)
+	byId := make(map[int64]int)
+
+	var id, occursAt int64
+	var kind, fromStock, toStock, reason string
+	err := s.db.eachRow(IgnoredMovementsQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&id, &occursAt, &kind, &fromStock, &toStock, &reason)
+		if err != nil {
+			return err
+		}
+
+		byId[id] = len(ignored)
+		ignored = append(ignored, IgnoredMovementLine{
+			OccursAt:  occursAt,
+			Kind:      kind,
+			FromStock: fromStock,
+			ToStock:   toStock,
+			Reason:    reason,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notes := make([]MovementNote, 0)
+	var ignoredId int64
+	var note string
+	err = s.db.eachRow(MovementNotesQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&occursAt, &kind, &ignoredId, &note)
+		if err != nil {
+			return err
+		}
+
+		if i, ok := byId[ignoredId]; ok {
+			ignored[i].Notes = append(ignored[i].Notes, note)
+		} else {
+			notes = append(notes, MovementNote{OccursAt: occursAt, Kind: kind, Note: note})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ignored, notes, nil
+}
+
+func (s *storer) CompletedCount(scenarioRunId int64) (int64, error) {
+	var completed int64
+	err := s.db.eachRow(CompletedCountQuery, []interface{}{scenarioRunId}, func(r row) error {
+		return r.Scan(&completed)
+	})
+
+	return completed, err
+}
+
+func (s *storer) IgnoredCounts(scenarioRunId int64) ([]IgnoredCount, error) {
+	counts := make([]IgnoredCount, 0)
+	var count IgnoredCount
+	err := s.db.eachRow(IgnoredCountsQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&count.Reason, &count.Kind, &count.Ignored)
+		if err != nil {
+			return err
+		}
+
+		counts = append(counts, count)
+		return nil
+	})
+
+	return counts, err
+}
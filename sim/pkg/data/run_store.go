@@ -25,7 +25,56 @@ import (
 	"skenario/pkg/simulator"
 )
 
+// RunReader reads back stored runs, and the series and numbers worked out from their
+// movements.
+type RunReader interface {
+	// ListRuns gives a page of the runs matching filter, along with how many runs match it
+	// altogether.
+	ListRuns(filter RunFilter) ([]RunRecord, int64, error)
+	LoadRun(scenarioRunId int64) (RunRecord, error)
+	LoadConfiguration(scenarioRunId int64) (RunConfiguration, error)
+	// LoadSummary gives a run's stored summary. Runs recorded before summaries were stored
+	// have none, and found is false.
+	LoadSummary(scenarioRunId int64) (summary RunSummary, found bool, err error)
+	// LoadCost gives a run's stored cost. Runs recorded before costs were stored have none,
+	// and found is false.
+	LoadCost(scenarioRunId int64) (cost RunCost, found bool, err error)
+	// LastMovement gives when a run's last movement occurred, and whether the run went on
+	// until its scenario halted.
+	LastMovement(scenarioRunId int64) (occursAt int64, halted bool, err error)
+
+	// Summarize works out a run's summary from its completed movements.
+	Summarize(scenarioRunId int64, config SummaryConfig) (RunSummary, error)
+	// Cost works out what a run cost from the lifetimes of its replicas and the main
+	// service's CPU utilization.
+	Cost(scenarioRunId int64, config CostConfig) (RunCost, error)
+	// CostFrontier places each of the given runs which has a saved cost and summary,
+	// cheapest first, marking those on the cost/latency frontier.
+	CostFrontier(scenarioRunIds []int64) ([]FrontierPoint, error)
+
+	TallyLines(scenarioRunId int64) ([]TallyLine, error)
+	ResponseTimes(scenarioRunId int64) ([]ResponseTime, error)
+	// CPUUtilizations gives the main service's CPU utilization at each autoscaler tick.
+	CPUUtilizations(scenarioRunId int64) ([]CPUUtilizationMetric, error)
+	// AutoscalerDecisions gives what each service's autoscaler was told and recommended at
+	// each tick, in the order they ticked.
+	AutoscalerDecisions(scenarioRunId int64) ([]AutoscalerDecision, error)
+	RequestsPerSecond(scenarioRunId int64) ([]RPS, error)
+	RetriesPerSecond(scenarioRunId int64) ([]RPS, error)
+	// IgnoredMovements gives a run's ignored movements, each with its notes. Notes on
+	// completed movements are given separately.
+	IgnoredMovements(scenarioRunId int64) ([]IgnoredMovementLine, []MovementNote, error)
+	CompletedCount(scenarioRunId int64) (int64, error)
+	// IgnoredCounts gives how many movements a run ignored for each reason and kind, most
+	// first.
+	IgnoredCounts(scenarioRunId int64) ([]IgnoredCount, error)
+}
+
+// RunStore keeps runs. Runs are kept in SQLite by NewRunStore, in memory by
+// NewMemoryRunStore, and in PostgreSQL by the stores of a postgres Backend.
 type RunStore interface {
+	RunReader
+
 	Store(
 		completed []simulator.CompletedMovement,
 		ignored []simulator.IgnoredMovement,
@@ -36,50 +85,64 @@ type RunStore interface {
 		ranFor time.Duration,
 		cpuUtilizations []*simulator.CPUUtilization,
 	) (scenarioRunId int64, err error)
+	// Writer records a new run and gives a RunWriter to stream its movements into.
+	Writer(
+		clusterConf model.ClusterConfig,
+		asConf model.AutoscalerConfig,
+		origin string,
+		trafficPattern string,
+		ranFor time.Duration,
+	) (RunWriter, error)
+
+	// SaveConfiguration stores the configuration a run was made from alongside it.
+	SaveConfiguration(scenarioRunId int64, config RunConfiguration) error
+	// SaveSummary stores a run's summary alongside it, replacing any summary it already had.
+	SaveSummary(scenarioRunId int64, summary RunSummary) error
+	// SaveCost stores a run's cost alongside it, replacing any cost it already had.
+	SaveCost(scenarioRunId int64, cost RunCost) error
+	// DeleteRun removes a run and everything recorded about it.
+	DeleteRun(scenarioRunId int64) error
 }
 
+// storer keeps runs in a SQL database.
 type storer struct {
-	conn            *sqlite3.Conn
-	clusterConf     model.ClusterConfig
-	asConf          model.AutoscalerConfig
-	completed       []simulator.CompletedMovement
-	ignored         []simulator.IgnoredMovement
-	origin          string
-	trafficPattern  string
-	ranFor          time.Duration
-	cpuUtilizations []*simulator.CPUUtilization
+	db database
+	// newSink gives somewhere to write the movements of a new run.
+	newSink func(scenarioRunId int64) (movementSink, error)
 }
 
 func (s *storer) Store(completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement,
 	clusterConf model.ClusterConfig, asConf model.AutoscalerConfig, origin string, trafficPattern string, ranFor time.Duration,
 	cpuUtilizations []*simulator.CPUUtilization) (scenarioRunId int64, err error) {
 
-	s.completed = completed
-	s.ignored = ignored
-	s.clusterConf = clusterConf
-	s.asConf = asConf
-	s.origin = origin
-	s.trafficPattern = trafficPattern
-	s.ranFor = ranFor
-	s.cpuUtilizations = cpuUtilizations
+	writer, err := s.Writer(clusterConf, asConf, origin, trafficPattern, ranFor)
+	if err != nil {
+		return -1, err
+	}
 
-	scenarioRunId, err = s.scenarioRun()
+	return writeAll(writer, completed, ignored, cpuUtilizations)
+}
+
+func (s *storer) Writer(clusterConf model.ClusterConfig, asConf model.AutoscalerConfig, origin string,
+	trafficPattern string, ranFor time.Duration) (RunWriter, error) {
+
+	scenarioRunId, err := s.scenarioRun(clusterConf, asConf, origin, trafficPattern, ranFor)
 	if err != nil {
-		return scenarioRunId, err
+		return nil, err
 	}
 
-	err = s.conn.WithTx(func() error {
-		return s.scenarioData(scenarioRunId)
-	})
+	sink, err := s.newSink(scenarioRunId)
 	if err != nil {
-		return scenarioRunId, err
+		return nil, err
 	}
 
-	return scenarioRunId, nil
+	return newBatchingWriter(sink, scenarioRunId, writeBatchSize), nil
 }
 
-func (s *storer) scenarioRun() (scenarioRunId int64, err error) {
-	srStmt, err := s.conn.Prepare(`insert into scenario_runs(
+func (s *storer) scenarioRun(clusterConf model.ClusterConfig, asConf model.AutoscalerConfig, origin string,
+	trafficPattern string, ranFor time.Duration) (scenarioRunId int64, err error) {
+
+	return s.db.insert(`insert into scenario_runs(
 									   recorded
 									 , simulated_duration
 									 , origin
@@ -88,179 +151,54 @@ func (s *storer) scenarioRun() (scenarioRunId int64, err error) {
 									 , cluster_terminate_delay
 									 , cluster_number_of_requests
 									 , autoscaler_tick_interval)
-									values (?, ?, ?, ?, ?, ?, ?, ?);`)
-	if err != nil {
-		return -1, err
-	}
-
-	err = srStmt.Exec(
+									values (?, ?, ?, ?, ?, ?, ?, ?)`,
 		time.Now().Format(time.RFC3339),
-		s.ranFor.Nanoseconds(),
-		s.origin,
-		s.trafficPattern,
-		s.clusterConf.LaunchDelay.Nanoseconds(),
-		s.clusterConf.TerminateDelay.Nanoseconds(),
-		int(s.clusterConf.NumberOfRequests),
-		s.asConf.TickInterval.Nanoseconds(),
+		ranFor.Nanoseconds(),
+		origin,
+		trafficPattern,
+		clusterConf.LaunchDelay.Nanoseconds(),
+		clusterConf.TerminateDelay.Nanoseconds(),
+		int64(clusterConf.NumberOfRequests),
+		asConf.TickInterval.Nanoseconds(),
 	)
-	if err != nil {
-		return -1, err
-	}
-
-	lastId := s.conn.LastInsertRowID()
-
-	return lastId, nil
 }
 
-func (s *storer) scenarioData(scenarioRunId int64) error {
-	entityStmt, err := s.conn.Prepare(`insert into entities(name, kind) values (?, ?) on conflict do nothing`)
-	if err != nil {
-		return err
-	}
-	defer entityStmt.Close()
-
-	stockStmt, err := s.conn.Prepare(`insert into stocks(name, kind_stocked) values (?, ?) on conflict do nothing`)
-	if err != nil {
-		return err
-	}
-	defer stockStmt.Close()
-
-	movementStmt, err := s.conn.Prepare(`insert into completed_movements(
-            occurs_at
-           , kind
-           , moved
-           , from_stock
-           , to_stock
-           , scenario_run_id
-        ) values (
-              ?
-            , ?
-            , (select id from entities where name = ? and kind = ?)
-            , (select id from stocks where name = ? and kind_stocked = ?)
-            , (select id from stocks where name = ? and kind_stocked = ?)
-            , ?)
-    `)
-	if err != nil {
-		panic(err.Error())
-	}
-	defer movementStmt.Close()
-
-	for _, mv := range s.completed {
-		from := mv.Movement.From()
-		to := mv.Movement.To()
-
-		err = entityStmt.Exec(string(mv.Moved.Name()), string(mv.Moved.Kind()))
-		if err != nil {
-			return err
-		}
-
-		err = stockStmt.Exec(string(from.Name()), string(from.KindStocked()))
-		if err != nil {
-			return err
-		}
-
-		err = stockStmt.Exec(string(to.Name()), string(to.KindStocked()))
-		if err != nil {
-			return err
-		}
-
-		err = movementStmt.Exec(
-			mv.Movement.OccursAt().UnixNano(),
-			string(mv.Movement.Kind()),
-			string(mv.Moved.Name()),
-			string(mv.Moved.Kind()),
-			string(from.Name()),
-			string(from.KindStocked()),
-			string(to.Name()),
-			string(to.KindStocked()),
-			scenarioRunId,
-		)
-		if err != nil {
-			return err
-		}
-	}
-
-	ignoredStmt, err := s.conn.Prepare(`insert into ignored_movements(
-		occurs_at
-	  , kind
-	  , from_stock
-	  , to_stock
-	  , reason
-	  , scenario_run_id
-  ) values (
-		 ?
-	   , ?
-	   , (select id from stocks where name = ? and kind_stocked = ?)
-	   , (select id from stocks where name = ? and kind_stocked = ?)
-	   , ?
-	   , ?)
-	`)
-	if err != nil {
-		panic(err.Error())
-	}
-	defer ignoredStmt.Close()
-
-	for _, mv := range s.ignored {
-		from := mv.Movement.From()
-		to := mv.Movement.To()
-
-		err = stockStmt.Exec(string(from.Name()), string(from.KindStocked()))
-		if err != nil {
-			return err
-		}
+// writeAll streams already finished movements through a writer.
+func writeAll(writer RunWriter, completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement,
+	cpuUtilizations []*simulator.CPUUtilization) (int64, error) {
 
-		err = stockStmt.Exec(string(to.Name()), string(to.KindStocked()))
+	for _, mv := range completed {
+		err := writer.MovementCompleted(mv)
 		if err != nil {
-			return err
-		}
-
-		err = ignoredStmt.Exec(
-			mv.Movement.OccursAt().UnixNano(),
-			string(mv.Movement.Kind()),
-			string(from.Name()),
-			string(from.KindStocked()),
-			string(to.Name()),
-			string(to.KindStocked()),
-			mv.Reason,
-			scenarioRunId,
-		)
-		if err != nil {
-			return err
+			return writer.ScenarioRunId(), err
 		}
 	}
 
-	cpuUtilizationStmt, err := s.conn.Prepare(`insert into cpu_utilizations(
-		cpu_utilization
-	  , calculated_at
-	  , scenario_run_id
-  ) values (
-		 ?
-	   , ?
-	   , ?)
-	`)
-
-	for _, mv := range s.cpuUtilizations {
-
-		err = cpuUtilizationStmt.Exec(
-			mv.CPUUtilization,
-			mv.CalculatedAt.UnixNano(),
-			scenarioRunId,
-		)
+	for _, mv := range ignored {
+		err := writer.MovementIgnored(mv)
 		if err != nil {
-			return err
+			return writer.ScenarioRunId(), err
 		}
 	}
 
-	return nil
+	return writer.ScenarioRunId(), writer.Finish(cpuUtilizations, nil)
 }
 
+// NewRunStore keeps runs in a SQLite database, migrating it to SchemaVersion first.
 func NewRunStore(conn *sqlite3.Conn) RunStore {
-	err := conn.Exec(Schema)
+	err := Migrate(conn)
 	if err != nil {
-		panic(fmt.Errorf("could not apply skenario schema: %s", err.Error()))
+		panic(fmt.Errorf("could not migrate skenario schema: %s", err.Error()))
 	}
 
+	return newSQLiteStore(conn)
+}
+
+func newSQLiteStore(conn *sqlite3.Conn) RunStore {
 	return &storer{
-		conn: conn,
+		db: sqliteDatabase{conn: conn},
+		newSink: func(scenarioRunId int64) (movementSink, error) {
+			return newSQLiteSink(conn, scenarioRunId)
+		},
 	}
 }
@@ -17,6 +17,7 @@ package data
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -66,15 +67,13 @@ func testStorer(t *testing.T, describe spec.G, it spec.S) {
 		var scenarioRunId int64
 		var err error
 		var stock1, stock2 simulator.ThroughStock
+		var dir string
 
 		it.Before(func() {
-			var dir string
-			dir, err = os.Getwd()
+			dir, err = ioutil.TempDir("", "skenario_test")
 			require.NoError(t, err)
 			dbPath := filepath.Join(dir, "skenario_test.db")
 
-			os.Remove(dbPath)
-
 			conn, err = sqlite3.Open(dbPath)
 			assert.NoError(t, err)
 			assert.NotNil(t, conn)
@@ -94,6 +93,11 @@ func testStorer(t *testing.T, describe spec.G, it spec.S) {
 			assert.NoError(t, err)
 		})
 
+		it.After(func() {
+			assert.NoError(t, conn.Close())
+			assert.NoError(t, os.RemoveAll(dir))
+		})
+
 		it("returns the scenario_run ID", func() {
 			assert.Equal(t, int64(1), scenarioRunId)
 		})
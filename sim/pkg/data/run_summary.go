@@ -0,0 +1,294 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"math"
+	"time"
+)
+
+// SummaryConfig gives what Summarize needs to know about a run that its movements don't.
+type SummaryConfig struct {
+	StartAt time.Time
+	RanFor  time.Duration
+	// InitialReplicas is how many replicas the main service had before the first movement.
+	InitialReplicas int64
+	// SLOLatencyTarget is zero when the run has no SLO.
+	SLOLatencyTarget time.Duration
+}
+
+// RunSummary gives the headline numbers of a run's main service, leaving out the requests
+// and replicas of any further services. Every attempt at a request counts as a request,
+// and response times are those of completed requests, from arrival to completion.
+// Replicas are counted from when they begin launching until they finish terminating.
+type RunSummary struct {
+	Requests    int64   `json:"requests"`
+	Completed   int64   `json:"completed"`
+	Failed      int64   `json:"failed"`
+	TimedOut    int64   `json:"timed_out"`
+	FailureRate float64 `json:"failure_rate"`
+
+	ResponseTimeP50  time.Duration `json:"response_time_p50"`
+	ResponseTimeP90  time.Duration `json:"response_time_p90"`
+	ResponseTimeP95  time.Duration `json:"response_time_p95"`
+	ResponseTimeP99  time.Duration `json:"response_time_p99"`
+	ResponseTimeP999 time.Duration `json:"response_time_p999"`
+
+	AverageReplicas float64 `json:"average_replicas"`
+	PeakReplicas    int64   `json:"peak_replicas"`
+	ReplicaSeconds  float64 `json:"replica_seconds"`
+
+	// SLOAttainment is the fraction of requests which completed within SLOLatencyTarget.
+	// Failed requests count against it. It is nil when the run has no SLO, which
+	// SLOLatencyTarget then gives as zero.
+	SLOLatencyTarget time.Duration `json:"slo_latency_target"`
+	SLOAttainment    *float64      `json:"slo_attainment"`
+}
+
+// replicaChange is a replica beginning to launch, or finishing terminating.
+type replicaChange struct {
+	occursAt int64
+	change   int64
+}
+
+func (s *storer) Summarize(scenarioRunId int64, config SummaryConfig) (RunSummary, error) {
+	responseTimes := make([]time.Duration, 0)
+	var responseTime int64
+	err := s.db.eachRow(CompletedResponseTimesQuery, []interface{}{scenarioRunId, scenarioRunId}, func(r row) error {
+		err := r.Scan(&responseTime)
+		if err != nil {
+			return err
+		}
+
+		responseTimes = append(responseTimes, time.Duration(responseTime))
+		return nil
+	})
+	if err != nil {
+		return RunSummary{}, err
+	}
+
+	var failed, timedOut int64
+	err = s.db.eachRow(FailedRequestsQuery, []interface{}{scenarioRunId}, func(r row) error {
+		return r.Scan(&failed, &timedOut)
+	})
+	if err != nil {
+		return RunSummary{}, err
+	}
+
+	changes := make([]replicaChange, 0)
+	var occursAt, change int64
+	err = s.db.eachRow(ReplicaChangesQuery, []interface{}{scenarioRunId}, func(r row) error {
+		err := r.Scan(&occursAt, &change)
+		if err != nil {
+			return err
+		}
+
+		changes = append(changes, replicaChange{occursAt: occursAt, change: change})
+		return nil
+	})
+	if err != nil {
+		return RunSummary{}, err
+	}
+
+	return summarize(responseTimes, failed, timedOut, changes, config), nil
+}
+
+// summarize works out a run's summary from the sorted response times of its completed
+// requests, how many requests failed or timed out, and when replicas came and went.
+func summarize(responseTimes []time.Duration, failed, timedOut int64, changes []replicaChange, config SummaryConfig) RunSummary {
+	summary := RunSummary{SLOLatencyTarget: config.SLOLatencyTarget, Failed: failed, TimedOut: timedOut}
+
+	summary.Completed = int64(len(responseTimes))
+	summary.Requests = summary.Completed + summary.Failed
+	if summary.Requests > 0 {
+		summary.FailureRate = float64(summary.Failed) / float64(summary.Requests)
+	}
+
+	if config.SLOLatencyTarget > 0 {
+		withinTarget := int64(0)
+		for _, responseTime := range responseTimes {
+			if responseTime <= config.SLOLatencyTarget {
+				withinTarget++
+			}
+		}
+
+		attainment := 0.0
+		if summary.Requests > 0 {
+			attainment = float64(withinTarget) / float64(summary.Requests)
+		}
+		summary.SLOAttainment = &attainment
+	}
+
+	summary.ResponseTimeP50 = percentile(responseTimes, 50)
+	summary.ResponseTimeP90 = percentile(responseTimes, 90)
+	summary.ResponseTimeP95 = percentile(responseTimes, 95)
+	summary.ResponseTimeP99 = percentile(responseTimes, 99)
+	summary.ResponseTimeP999 = percentile(responseTimes, 99.9)
+
+	// replica time is summed in nanoseconds, to avoid rounding on every change
+	replicas := config.InitialReplicas
+	replicaNanos := int64(0)
+	summary.PeakReplicas = replicas
+	last := config.StartAt.UnixNano()
+	for _, c := range changes {
+		replicaNanos += replicas * (c.occursAt - last)
+		last = c.occursAt
+		replicas += c.change
+		if replicas > summary.PeakReplicas {
+			summary.PeakReplicas = replicas
+		}
+	}
+
+	haltAt := config.StartAt.Add(config.RanFor).UnixNano()
+	if haltAt > last {
+		replicaNanos += replicas * (haltAt - last)
+	}
+	summary.ReplicaSeconds = time.Duration(replicaNanos).Seconds()
+	if config.RanFor > 0 {
+		summary.AverageReplicas = summary.ReplicaSeconds / config.RanFor.Seconds()
+	}
+
+	return summary
+}
+
+func (s *storer) SaveSummary(scenarioRunId int64, summary RunSummary) error {
+	// runs without an SLO are stored with a target of zero, which LoadSummary looks for
+	sloAttainment := 0.0
+	if summary.SLOAttainment != nil {
+		sloAttainment = *summary.SLOAttainment
+	}
+
+	return s.db.exec(`insert into run_summaries(
+		requests
+	  , completed
+	  , failed
+	  , timed_out
+	  , failure_rate
+	  , response_time_p50
+	  , response_time_p90
+	  , response_time_p95
+	  , response_time_p99
+	  , response_time_p999
+	  , average_replicas
+	  , peak_replicas
+	  , replica_seconds
+	  , slo_latency_target
+	  , slo_attainment
+	  , scenario_run_id
+	) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	on conflict (scenario_run_id) do update set
+		requests           = excluded.requests
+	  , completed          = excluded.completed
+	  , failed             = excluded.failed
+	  , timed_out          = excluded.timed_out
+	  , failure_rate       = excluded.failure_rate
+	  , response_time_p50  = excluded.response_time_p50
+	  , response_time_p90  = excluded.response_time_p90
+	  , response_time_p95  = excluded.response_time_p95
+	  , response_time_p99  = excluded.response_time_p99
+	  , response_time_p999 = excluded.response_time_p999
+	  , average_replicas   = excluded.average_replicas
+	  , peak_replicas      = excluded.peak_replicas
+	  , replica_seconds    = excluded.replica_seconds
+	  , slo_latency_target = excluded.slo_latency_target
+	  , slo_attainment     = excluded.slo_attainment`,
+		summary.Requests,
+		summary.Completed,
+		summary.Failed,
+		summary.TimedOut,
+		summary.FailureRate,
+		summary.ResponseTimeP50.Nanoseconds(),
+		summary.ResponseTimeP90.Nanoseconds(),
+		summary.ResponseTimeP95.Nanoseconds(),
+		summary.ResponseTimeP99.Nanoseconds(),
+		summary.ResponseTimeP999.Nanoseconds(),
+		summary.AverageReplicas,
+		summary.PeakReplicas,
+		summary.ReplicaSeconds,
+		summary.SLOLatencyTarget.Nanoseconds(),
+		sloAttainment,
+		scenarioRunId,
+	)
+}
+
+func (s *storer) LoadSummary(scenarioRunId int64) (summary RunSummary, found bool, err error) {
+	var p50, p90, p95, p99, p999, sloTarget int64
+	var sloAttainment float64
+	err = s.db.eachRow(`select
+		requests
+	  , completed
+	  , failed
+	  , timed_out
+	  , failure_rate
+	  , response_time_p50
+	  , response_time_p90
+	  , response_time_p95
+	  , response_time_p99
+	  , response_time_p999
+	  , average_replicas
+	  , peak_replicas
+	  , replica_seconds
+	  , slo_latency_target
+	  , slo_attainment
+	from run_summaries
+	where scenario_run_id = ?`, []interface{}{scenarioRunId}, func(r row) error {
+		found = true
+		return r.Scan(
+			&summary.Requests,
+			&summary.Completed,
+			&summary.Failed,
+			&summary.TimedOut,
+			&summary.FailureRate,
+			&p50,
+			&p90,
+			&p95,
+			&p99,
+			&p999,
+			&summary.AverageReplicas,
+			&summary.PeakReplicas,
+			&summary.ReplicaSeconds,
+			&sloTarget,
+			&sloAttainment,
+		)
+	})
+
+	summary.ResponseTimeP50 = time.Duration(p50)
+	summary.ResponseTimeP90 = time.Duration(p90)
+	summary.ResponseTimeP95 = time.Duration(p95)
+	summary.ResponseTimeP99 = time.Duration(p99)
+	summary.ResponseTimeP999 = time.Duration(p999)
+	summary.SLOLatencyTarget = time.Duration(sloTarget)
+	if sloTarget > 0 {
+		summary.SLOAttainment = &sloAttainment
+	}
+
+	return summary, found, err
+}
+
+// percentile gives the nearest-rank percentile of sorted durations, or zero if there are
+// none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
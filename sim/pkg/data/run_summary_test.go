@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestRunSummary(t *testing.T) {
+	spec.Run(t, "RunSummary", testRunSummary, spec.Report(report.Terminal{}))
+}
+
+func testRunSummary(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var store RunStore
+	var startAt time.Time
+	var scenarioRunId int64
+	var config SummaryConfig
+	var summary RunSummary
+	var err error
+
+	it.Before(func() {
+		startAt = time.Unix(0, 0)
+		env := simulator.NewEnvironment(context.Background(), startAt, 10*time.Minute)
+
+		conn, err = sqlite3.Open(":memory:")
+		require.NoError(t, err)
+		store = NewRunStore(conn)
+
+		arrivals := simulator.NewThroughStock("Arrivals", "Request")
+		processing := simulator.NewThroughStock("RequestsProcessing", "Request")
+		finished := simulator.NewSinkStock("RequestsFinished", "Request")
+		failed := simulator.NewSinkStock("RequestsFailed", "Request")
+		for _, name := range []simulator.EntityName{"request-1", "request-2", "request-3"} {
+			err = arrivals.Add(simulator.NewEntity(name, "Request"))
+			require.NoError(t, err)
+		}
+
+		launching := simulator.NewThroughStock("ReplicaSource", "Replica")
+		active := simulator.NewThroughStock("ReplicasActive", "Replica")
+		terminated := simulator.NewSinkStock("ReplicasTerminated", "Replica")
+		err = launching.Add(simulator.NewEntity("replica-1", "Replica"))
+		require.NoError(t, err)
+
+		// a further service's requests and replicas, which are not summarized
+		backendProcessing := simulator.NewThroughStock("backend/RequestsProcessing", "Request")
+		backendFinished := simulator.NewSinkStock("backend/RequestsFinished", "Request")
+		backendFailed := simulator.NewSinkStock("backend/RequestsFailed", "Request")
+		backendLaunching := simulator.NewThroughStock("backend/ReplicaSource", "Replica")
+		backendActive := simulator.NewThroughStock("backend/ReplicasActive", "Replica")
+		for _, name := range []simulator.EntityName{"backend-request-1", "backend-request-2"} {
+			err = backendProcessing.Add(simulator.NewEntity(name, "Request"))
+			require.NoError(t, err)
+		}
+		err = backendLaunching.Add(simulator.NewEntity("backend-replica-1", "Replica"))
+		require.NoError(t, err)
+		env.AddToSchedule(simulator.NewMovement("complete_request", startAt.Add(6*time.Second), backendProcessing, backendFinished))
+		env.AddToSchedule(simulator.NewMovement("request_failed", startAt.Add(7*time.Second), backendProcessing, backendFailed))
+		env.AddToSchedule(simulator.NewMovement("begin_launch", startAt.Add(8*time.Second), backendLaunching, backendActive))
+
+		for _, at := range []time.Duration{1 * time.Second, 2 * time.Second, 3 * time.Second} {
+			env.AddToSchedule(simulator.NewMovement("arrive_at_processing", startAt.Add(at), arrivals, processing))
+		}
+		env.AddToSchedule(simulator.NewMovement("complete_request", startAt.Add(1500*time.Millisecond), processing, finished))
+		env.AddToSchedule(simulator.NewMovement("complete_request", startAt.Add(4*time.Second), processing, finished))
+		env.AddToSchedule(simulator.NewMovement("request_failed", startAt.Add(5*time.Second), processing, failed))
+		env.AddToSchedule(simulator.NewMovement("begin_launch", startAt.Add(10*time.Second), launching, active))
+		env.AddToSchedule(simulator.NewMovement("finish_terminating", startAt.Add(70*time.Second), active, terminated))
+
+		completed, ignored, err := env.Run()
+		require.NoError(t, err)
+
+		scenarioRunId, err = store.Store(completed, ignored, model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", 10*time.Minute, env.CPUUtilizations())
+		require.NoError(t, err)
+
+		config = SummaryConfig{
+			StartAt:          startAt,
+			RanFor:           10 * time.Minute,
+			InitialReplicas:  1,
+			SLOLatencyTarget: time.Second,
+		}
+	})
+
+	it.After(func() {
+		err = conn.Close()
+		require.NoError(t, err)
+	})
+
+	describe("Summarize()", func() {
+		it.Before(func() {
+			summary, err = store.Summarize(scenarioRunId, config)
+			require.NoError(t, err)
+		})
+
+		it("counts completed and failed requests", func() {
+			assert.Equal(t, int64(3), summary.Requests)
+			assert.Equal(t, int64(2), summary.Completed)
+			assert.Equal(t, int64(1), summary.Failed)
+			assert.InDelta(t, 1.0/3.0, summary.FailureRate, 0.0001)
+		})
+
+		it("counts failures out of processing as timeouts", func() {
+			assert.Equal(t, int64(1), summary.TimedOut)
+		})
+
+		it("gives nearest-rank response time percentiles of completed requests", func() {
+			assert.Equal(t, 500*time.Millisecond, summary.ResponseTimeP50)
+			assert.Equal(t, 2*time.Second, summary.ResponseTimeP90)
+			assert.Equal(t, 2*time.Second, summary.ResponseTimeP999)
+		})
+
+		it("gives the share of all requests that completed within the SLO latency target", func() {
+			assert.Equal(t, time.Second, summary.SLOLatencyTarget)
+			require.NotNil(t, summary.SLOAttainment)
+			assert.InDelta(t, 1.0/3.0, *summary.SLOAttainment, 0.0001)
+		})
+
+		it("integrates replicas over the run", func() {
+			assert.InDelta(t, 660.0, summary.ReplicaSeconds, 0.0001)
+			assert.InDelta(t, 1.1, summary.AverageReplicas, 0.0001)
+			assert.Equal(t, int64(2), summary.PeakReplicas)
+		})
+
+		describe("when the run has no SLO", func() {
+			var loaded RunSummary
+
+			it.Before(func() {
+				config.SLOLatencyTarget = 0
+				summary, err = store.Summarize(scenarioRunId, config)
+				require.NoError(t, err)
+
+				err = store.SaveSummary(scenarioRunId, summary)
+				require.NoError(t, err)
+				loaded, _, err = store.LoadSummary(scenarioRunId)
+				require.NoError(t, err)
+			})
+
+			it("gives no SLO attainment", func() {
+				assert.Equal(t, time.Duration(0), summary.SLOLatencyTarget)
+				assert.Nil(t, summary.SLOAttainment)
+			})
+
+			it("loads the summary without an SLO attainment", func() {
+				assert.Nil(t, loaded.SLOAttainment)
+			})
+		})
+	})
+
+	describe("SaveSummary()", func() {
+		var completed, peak int64
+		var p50 int64
+		var count int
+
+		it.Before(func() {
+			summary, err = store.Summarize(scenarioRunId, config)
+			require.NoError(t, err)
+
+			err = store.SaveSummary(scenarioRunId, summary)
+			require.NoError(t, err)
+			err = store.SaveSummary(scenarioRunId, summary)
+			require.NoError(t, err)
+
+			singleQuery(t, conn, `select completed, peak_replicas, response_time_p50 from run_summaries`, &completed, &peak, &p50)
+			singleQuery(t, conn, `select count(1) from run_summaries`, &count)
+		})
+
+		it("stores the summary against the run", func() {
+			assert.Equal(t, int64(2), completed)
+			assert.Equal(t, int64(2), peak)
+			assert.Equal(t, (500 * time.Millisecond).Nanoseconds(), p50)
+		})
+
+		it("keeps one summary per run", func() {
+			assert.Equal(t, 1, count)
+		})
+	})
+}
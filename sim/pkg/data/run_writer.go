@@ -0,0 +1,469 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/simulator"
+)
+
+// writeBatchSize is the most movements a RunWriter holds before writing them out.
+const writeBatchSize = 10000
+
+// RunWriter stores a run's movements while it happens. It observes an Environment, holding
+// movements until a batch is full and then writing the batch in one transaction, so that
+// memory use is bounded by the batch size rather than by the length of the run.
+type RunWriter interface {
+	simulator.Observer
+	ScenarioRunId() int64
+	// Finish writes any movements still held, along with the CPU utilizations and the
+	// autoscaler decisions.
+	Finish(cpuUtilizations []*simulator.CPUUtilization, decisions []*simulator.AutoscalerDecision) error
+}
+
+// movementSink writes batches of a run's movements to wherever the run is kept.
+type movementSink interface {
+	writeBatch(completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement) error
+	writeCPUUtilizations(cpuUtilizations []*simulator.CPUUtilization) error
+	writeAutoscalerDecisions(decisions []*simulator.AutoscalerDecision) error
+	close()
+}
+
+type runWriter struct {
+	sink          movementSink
+	scenarioRunId int64
+	batchSize     int
+	completed     []simulator.CompletedMovement
+	ignored       []simulator.IgnoredMovement
+}
+
+func (rw *runWriter) ScenarioRunId() int64 {
+	return rw.scenarioRunId
+}
+
+func (rw *runWriter) MovementCompleted(completed simulator.CompletedMovement) error {
+	rw.completed = append(rw.completed, completed)
+	return rw.flushIfFull()
+}
+
+func (rw *runWriter) MovementIgnored(ignored simulator.IgnoredMovement) error {
+	rw.ignored = append(rw.ignored, ignored)
+	return rw.flushIfFull()
+}
+
+func (rw *runWriter) Finish(cpuUtilizations []*simulator.CPUUtilization, decisions []*simulator.AutoscalerDecision) error {
+	defer rw.sink.close()
+
+	err := rw.flush()
+	if err != nil {
+		return err
+	}
+
+	err = rw.sink.writeCPUUtilizations(cpuUtilizations)
+	if err != nil {
+		return err
+	}
+
+	return rw.sink.writeAutoscalerDecisions(decisions)
+}
+
+func (rw *runWriter) flushIfFull() error {
+	if len(rw.completed)+len(rw.ignored) < rw.batchSize {
+		return nil
+	}
+
+	return rw.flush()
+}
+
+func (rw *runWriter) flush() error {
+	err := rw.sink.writeBatch(rw.completed, rw.ignored)
+	if err != nil {
+		return err
+	}
+
+	rw.completed = rw.completed[:0]
+	rw.ignored = rw.ignored[:0]
+
+	return nil
+}
+
+func newBatchingWriter(sink movementSink, scenarioRunId int64, batchSize int) *runWriter {
+	return &runWriter{
+		sink:          sink,
+		scenarioRunId: scenarioRunId,
+		batchSize:     batchSize,
+		completed:     make([]simulator.CompletedMovement, 0, batchSize),
+		ignored:       make([]simulator.IgnoredMovement, 0),
+	}
+}
+
+// language=sql
+var (
+	insertEntity = `insert into entities(name, kind) values (?, ?) on conflict do nothing`
+	insertStock  = `insert into stocks(name, kind_stocked) values (?, ?) on conflict do nothing`
+
+	insertCompletedMovement = `insert into completed_movements(
+            occurs_at
+           , kind
+           , moved
+           , from_stock
+           , to_stock
+           , scenario_run_id
+        ) values (
+              ?
+            , ?
+            , (select id from entities where name = ? and kind = ?)
+            , (select id from stocks where name = ? and kind_stocked = ?)
+            , (select id from stocks where name = ? and kind_stocked = ?)
+            , ?)
+    `
+
+	insertIgnoredMovement = `insert into ignored_movements(
+		occurs_at
+	  , kind
+	  , from_stock
+	  , to_stock
+	  , reason
+	  , scenario_run_id
+  ) values (
+		 ?
+	   , ?
+	   , (select id from stocks where name = ? and kind_stocked = ?)
+	   , (select id from stocks where name = ? and kind_stocked = ?)
+	   , ?
+	   , ?)
+	`
+
+	insertMovementNote = `insert into movement_notes(
+		completed_movement_id
+	  , ignored_movement_id
+	  , position
+	  , note
+	  , scenario_run_id
+  ) values (?, ?, ?, ?, ?)
+	`
+
+	insertCPUUtilization = `insert into cpu_utilizations(
+		cpu_utilization
+	  , calculated_at
+	  , service
+	  , scenario_run_id
+  ) values (
+		 ?
+	   , ?
+	   , ?
+	   , ?)
+	`
+)
+
+// completedArgs gives the parameters of insertCompletedMovement.
+func completedArgs(mv simulator.CompletedMovement, scenarioRunId int64) []interface{} {
+	from := mv.Movement.From()
+	to := mv.Movement.To()
+
+	return []interface{}{
+		mv.Movement.OccursAt().UnixNano(),
+		string(mv.Movement.Kind()),
+		string(mv.Moved.Name()),
+		string(mv.Moved.Kind()),
+		string(from.Name()),
+		string(from.KindStocked()),
+		string(to.Name()),
+		string(to.KindStocked()),
+		scenarioRunId,
+	}
+}
+
+// ignoredArgs gives the parameters of insertIgnoredMovement.
+func ignoredArgs(mv simulator.IgnoredMovement, scenarioRunId int64) []interface{} {
+	from := mv.Movement.From()
+	to := mv.Movement.To()
+
+	return []interface{}{
+		mv.Movement.OccursAt().UnixNano(),
+		string(mv.Movement.Kind()),
+		string(from.Name()),
+		string(from.KindStocked()),
+		string(to.Name()),
+		string(to.KindStocked()),
+		mv.Reason,
+		scenarioRunId,
+	}
+}
+
+// sqliteSink writes movements to SQLite through statements prepared once for the whole run.
+type sqliteSink struct {
+	conn          *sqlite3.Conn
+	scenarioRunId int64
+
+	entityStmt   *sqlite3.Stmt
+	stockStmt    *sqlite3.Stmt
+	movementStmt *sqlite3.Stmt
+	ignoredStmt  *sqlite3.Stmt
+	noteStmt     *sqlite3.Stmt
+}
+
+func (s *sqliteSink) writeBatch(completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement) error {
+	return s.conn.WithTx(func() error {
+		for _, mv := range completed {
+			err := s.writeCompleted(mv)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, mv := range ignored {
+			err := s.writeIgnored(mv)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *sqliteSink) writeCPUUtilizations(cpuUtilizations []*simulator.CPUUtilization) error {
+	cpuUtilizationStmt, err := s.conn.Prepare(insertCPUUtilization)
+	if err != nil {
+		return err
+	}
+	defer cpuUtilizationStmt.Close()
+
+	return s.conn.WithTx(func() error {
+		for _, mv := range cpuUtilizations {
+			err = cpuUtilizationStmt.Exec(
+				mv.CPUUtilization,
+				mv.CalculatedAt.UnixNano(),
+				mv.Service,
+				s.scenarioRunId,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *sqliteSink) writeAutoscalerDecisions(decisions []*simulator.AutoscalerDecision) error {
+	return writeAutoscalerDecisions(sqliteDatabase{conn: s.conn}, s.scenarioRunId, decisions)
+}
+
+func (s *sqliteSink) writeCompleted(mv simulator.CompletedMovement) error {
+	err := s.entityStmt.Exec(string(mv.Moved.Name()), string(mv.Moved.Kind()))
+	if err != nil {
+		return err
+	}
+
+	err = s.writeStocks(mv.Movement.From(), mv.Movement.To())
+	if err != nil {
+		return err
+	}
+
+	err = s.movementStmt.Exec(completedArgs(mv, s.scenarioRunId)...)
+	if err != nil {
+		return err
+	}
+
+	return s.writeNotes(mv.Movement.Notes(), s.conn.LastInsertRowID(), nil)
+}
+
+func (s *sqliteSink) writeIgnored(mv simulator.IgnoredMovement) error {
+	err := s.writeStocks(mv.Movement.From(), mv.Movement.To())
+	if err != nil {
+		return err
+	}
+
+	err = s.ignoredStmt.Exec(ignoredArgs(mv, s.scenarioRunId)...)
+	if err != nil {
+		return err
+	}
+
+	return s.writeNotes(mv.Movement.Notes(), nil, s.conn.LastInsertRowID())
+}
+
+// writeNotes writes a movement's notes against either the completed or the ignored
+// movement just written; the other id is nil.
+func (s *sqliteSink) writeNotes(notes []string, completedId, ignoredId interface{}) error {
+	for i, note := range notes {
+		err := s.noteStmt.Exec(completedId, ignoredId, i, note, s.scenarioRunId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqliteSink) writeStocks(from simulator.SourceStock, to simulator.SinkStock) error {
+	err := s.stockStmt.Exec(string(from.Name()), string(from.KindStocked()))
+	if err != nil {
+		return err
+	}
+
+	return s.stockStmt.Exec(string(to.Name()), string(to.KindStocked()))
+}
+
+func (s *sqliteSink) close() {
+	for _, stmt := range []*sqlite3.Stmt{s.entityStmt, s.stockStmt, s.movementStmt, s.ignoredStmt, s.noteStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+func newSQLiteSink(conn *sqlite3.Conn, scenarioRunId int64) (*sqliteSink, error) {
+	s := &sqliteSink{conn: conn, scenarioRunId: scenarioRunId}
+
+	statements := []struct {
+		stmt  **sqlite3.Stmt
+		query string
+	}{
+		{&s.entityStmt, insertEntity},
+		{&s.stockStmt, insertStock},
+		{&s.movementStmt, insertCompletedMovement},
+		{&s.ignoredStmt, insertIgnoredMovement},
+		{&s.noteStmt, insertMovementNote},
+	}
+	for _, st := range statements {
+		var err error
+		*st.stmt, err = conn.Prepare(st.query)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// databaseSink writes movements through a database, one statement at a time. Stocks
+// already written by the run are not written again; there are few of them, whereas a run
+// can move a great many entities, which are left to the insert's conflict clause instead.
+type databaseSink struct {
+	db            database
+	scenarioRunId int64
+	written       map[string]bool
+}
+
+func (s *databaseSink) writeBatch(completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement) error {
+	return s.db.withTx(func() error {
+		for _, mv := range completed {
+			err := s.db.exec(insertEntity, string(mv.Moved.Name()), string(mv.Moved.Kind()))
+			if err != nil {
+				return err
+			}
+			err = s.writeStocks(mv.Movement.From(), mv.Movement.To())
+			if err != nil {
+				return err
+			}
+
+			id, err := s.db.insert(insertCompletedMovement, completedArgs(mv, s.scenarioRunId)...)
+			if err != nil {
+				return err
+			}
+			err = s.writeNotes(mv.Movement.Notes(), id, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, mv := range ignored {
+			err := s.writeStocks(mv.Movement.From(), mv.Movement.To())
+			if err != nil {
+				return err
+			}
+
+			id, err := s.db.insert(insertIgnoredMovement, ignoredArgs(mv, s.scenarioRunId)...)
+			if err != nil {
+				return err
+			}
+			err = s.writeNotes(mv.Movement.Notes(), nil, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *databaseSink) writeCPUUtilizations(cpuUtilizations []*simulator.CPUUtilization) error {
+	return s.db.withTx(func() error {
+		for _, mv := range cpuUtilizations {
+			err := s.db.exec(insertCPUUtilization, mv.CPUUtilization, mv.CalculatedAt.UnixNano(), mv.Service, s.scenarioRunId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *databaseSink) writeAutoscalerDecisions(decisions []*simulator.AutoscalerDecision) error {
+	return writeAutoscalerDecisions(s.db, s.scenarioRunId, decisions)
+}
+
+func (s *databaseSink) writeNotes(notes []string, completedId, ignoredId interface{}) error {
+	for i, note := range notes {
+		err := s.db.exec(insertMovementNote, completedId, ignoredId, i, note, s.scenarioRunId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *databaseSink) writeStocks(from simulator.SourceStock, to simulator.SinkStock) error {
+	err := s.writeStock(string(from.Name()), string(from.KindStocked()))
+	if err != nil {
+		return err
+	}
+
+	return s.writeStock(string(to.Name()), string(to.KindStocked()))
+}
+
+// writeStock inserts a stock unless the run has already written it.
+func (s *databaseSink) writeStock(name, kind string) error {
+	key := name + "\x00" + kind
+	if s.written[key] {
+		return nil
+	}
+
+	err := s.db.exec(insertStock, name, kind)
+	if err != nil {
+		return err
+	}
+
+	s.written[key] = true
+	return nil
+}
+
+func (s *databaseSink) close() {}
+
+func newRunWriter(conn *sqlite3.Conn, scenarioRunId int64, batchSize int) (*runWriter, error) {
+	sink, err := newSQLiteSink(conn, scenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBatchingWriter(sink, scenarioRunId, batchSize), nil
+}
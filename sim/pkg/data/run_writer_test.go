@@ -0,0 +1,222 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestRunWriter(t *testing.T) {
+	spec.Run(t, "RunWriter", testRunWriter, spec.Report(report.Terminal{}))
+}
+
+func testRunWriter(t *testing.T, describe spec.G, it spec.S) {
+	var subject RunWriter
+	var store RunStore
+	var conn *sqlite3.Conn
+	var env simulator.Environment
+	var startAt time.Time
+	var stock1, stock2 simulator.ThroughStock
+
+	countOf := func(table string) int {
+		stmt, err := conn.Prepare(`select count(1) from `+table+` where scenario_run_id = ?`, subject.ScenarioRunId())
+		require.NoError(t, err)
+		defer stmt.Close()
+
+		_, err = stmt.Step()
+		require.NoError(t, err)
+		count, _, err := stmt.ColumnInt(0)
+		require.NoError(t, err)
+
+		return count
+	}
+
+	it.Before(func() {
+		var err error
+		conn, err = sqlite3.Open("file::memory:")
+		require.NoError(t, err)
+
+		store = NewRunStore(conn)
+		scenarioRunId, err := store.(*storer).scenarioRun(model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", time.Minute)
+		require.NoError(t, err)
+
+		subject, err = newRunWriter(conn, scenarioRunId, 2)
+		require.NoError(t, err)
+
+		startAt = time.Unix(0, 0)
+		env = simulator.NewEnvironment(context.Background(), startAt, time.Minute)
+		env.AddObserver(subject)
+		env.DiscardMovements()
+
+		stock1 = simulator.NewThroughStock("stock 1", "test entity")
+		stock2 = simulator.NewThroughStock("stock 2", "test entity")
+	})
+
+	it.After(func() {
+		conn.Close()
+	})
+
+	describe("while the run is in progress", func() {
+		it("writes each full batch of movements", func() {
+			env.AddToSchedule(simulator.NewMovement("stock 1 -> stock 2", startAt.Add(time.Second), stock1, stock2))
+			env.AddToSchedule(simulator.NewMovement("stock 1 -> stock 2", startAt.Add(2*time.Second), stock1, stock2))
+			env.AddToSchedule(simulator.NewMovement("Ignored", startAt.Add(time.Hour), stock1, stock2))
+			env.AddToSchedule(simulator.NewMovement("Ignored", startAt.Add(2*time.Hour), stock1, stock2))
+
+			assert.Equal(t, 2, countOf("ignored_movements"))
+			assert.Equal(t, 0, countOf("completed_movements"))
+		})
+
+		it("holds movements until a batch is full", func() {
+			env.AddToSchedule(simulator.NewMovement("Ignored", startAt.Add(time.Hour), stock1, stock2))
+
+			assert.Equal(t, 0, countOf("ignored_movements"))
+		})
+	})
+
+	describe("Finish()", func() {
+		it.Before(func() {
+			require.NoError(t, stock1.Add(simulator.NewEntity("entity", "test entity")))
+			completed := simulator.NewMovement("stock 1 -> stock 2", startAt.Add(time.Second), stock1, stock2)
+			completed.AddNote("first note")
+			completed.AddNote("second note")
+			env.AddToSchedule(completed)
+			ignored := simulator.NewMovement("Ignored", startAt.Add(time.Hour), stock1, stock2)
+			ignored.AddNote("ignored note")
+			env.AddToSchedule(ignored)
+
+			_, _, err := env.Run()
+			require.NoError(t, err)
+
+			err = subject.Finish(
+				[]*simulator.CPUUtilization{
+					{CPUUtilization: 50, CalculatedAt: startAt},
+					{Service: "backend", CPUUtilization: 90, CalculatedAt: startAt},
+				},
+				[]*simulator.AutoscalerDecision{
+					{
+						DecidedAt:   startAt,
+						Stats:       []*proto.Stat{{Time: startAt.UnixNano(), PodName: "RoutingStock", Type: proto.MetricType_CONCURRENT_REQUESTS_MILLIS, Value: 2000}},
+						Desired:     1,
+						Recommended: 3,
+					},
+					{Service: "backend", DecidedAt: startAt.Add(time.Second), Desired: 3, Err: errors.New("plugin went away")},
+				},
+			)
+			require.NoError(t, err)
+		})
+
+		it("writes the remaining movements", func() {
+			assert.Equal(t, 3, countOf("completed_movements")) // includes start and halt
+			assert.Equal(t, 1, countOf("ignored_movements"))
+		})
+
+		it("writes the CPU utilizations", func() {
+			assert.Equal(t, 2, countOf("cpu_utilizations"))
+		})
+
+		it("gives back only the main service's CPU utilizations", func() {
+			utilizations, err := store.CPUUtilizations(subject.ScenarioRunId())
+			require.NoError(t, err)
+			assert.Equal(t, []CPUUtilizationMetric{{CPUUtilization: 50, CalculatedAt: startAt.UnixNano()}}, utilizations)
+		})
+
+		it("writes the autoscaler decisions, with their stats and any error", func() {
+			decisions, err := store.AutoscalerDecisions(subject.ScenarioRunId())
+			require.NoError(t, err)
+			assert.Equal(t, []AutoscalerDecision{
+				{
+					DecidedAt:   startAt.UnixNano(),
+					Stats:       []AutoscalerStat{{Time: startAt.UnixNano(), PodName: "RoutingStock", Type: "CONCURRENT_REQUESTS_MILLIS", Value: 2000}},
+					Desired:     1,
+					Recommended: 3,
+				},
+				{Service: "backend", DecidedAt: startAt.Add(time.Second).UnixNano(), Stats: []AutoscalerStat{}, Desired: 3, Error: "plugin went away"},
+			}, decisions)
+		})
+
+		it("writes the notes of completed and ignored movements", func() {
+			assert.Equal(t, 5, countOf("movement_notes")) // includes start and halt
+
+			stmt, err := conn.Prepare(MovementNotesQuery, subject.ScenarioRunId())
+			require.NoError(t, err)
+			defer stmt.Close()
+
+			var occursAt, ignoredId int64
+			var kind, note string
+			notes := make([]string, 0)
+			for {
+				hasRow, err := stmt.Step()
+				require.NoError(t, err)
+				if !hasRow {
+					break
+				}
+
+				require.NoError(t, stmt.Scan(&occursAt, &kind, &ignoredId, &note))
+				if ignoredId != 0 {
+					note = "ignored: " + note
+				}
+				notes = append(notes, note)
+			}
+
+			assert.Equal(t, []string{"Start scenario", "first note", "second note", "Halt scenario", "ignored: ignored note"}, notes)
+		})
+	})
+
+	describe("a database sink", func() {
+		var sink *databaseSink
+
+		it.Before(func() {
+			sink = &databaseSink{db: sqliteDatabase{conn: conn}, scenarioRunId: subject.ScenarioRunId(), written: make(map[string]bool)}
+
+			entity := simulator.NewEntity("entity", "test entity")
+			for i := 1; i <= 2; i++ {
+				mv := simulator.NewMovement("stock 1 -> stock 2", startAt.Add(time.Duration(i)*time.Second), stock1, stock2)
+				err := sink.writeBatch([]simulator.CompletedMovement{{Movement: mv, Moved: entity}}, nil)
+				require.NoError(t, err)
+			}
+		})
+
+		it("writes each entity once", func() {
+			stmt, err := conn.Prepare(`select count(1) from entities where name = 'entity'`)
+			require.NoError(t, err)
+			defer stmt.Close()
+
+			_, err = stmt.Step()
+			require.NoError(t, err)
+			count, _, err := stmt.ColumnInt(0)
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+		})
+
+		it("remembers only the stocks it has written", func() {
+			assert.Len(t, sink.written, 2)
+		})
+	})
+}
@@ -15,8 +15,24 @@
 
 package data
 
-// language=sql
-var Schema = `create table if not exists scenario_runs
+// migration upgrades the schema by one version.
+type migration struct {
+	description string
+	sql         string
+}
+
+// migrations are applied in order, each at most once, and a database's schema version is
+// how many have been applied to it. Add new migrations to the end and never change one
+// that has been released.
+//
+// Databases written before the schema was versioned are at version 0, but may already have
+// any of the first five migrations applied, so those are all safe to apply again.
+var migrations = []migration{
+	{
+		description: "create scenario runs, stocks, entities and movements",
+		// language=sql
+		sql: `
+create table if not exists scenario_runs
 (
     id                                       integer primary key, -- aliases to rowid
 
@@ -73,8 +89,6 @@ create table if not exists cpu_utilizations
 	scenario_run_id 	integer not null references scenario_runs (id)
 );
 
-create unique index if not exists move_once_per_run on completed_movements (occurs_at, scenario_run_id);
-
 create table if not exists ignored_movements
 (
     id              integer primary key,  -- aliases to rowid
@@ -87,12 +101,156 @@ create table if not exists ignored_movements
 
     scenario_run_id integer not null references scenario_runs (id)
 );
-create unique index if not exists ignore_once_per_run on ignored_movements (occurs_at, scenario_run_id);
+`,
+	},
+	{
+		description: "index movements by run and time without uniqueness",
+		// language=sql
+		sql: `
+-- movements may occur simultaneously, so runs are indexed by time without uniqueness
+drop index if exists move_once_per_run;
+create index if not exists completed_movements_run_occurs_at on completed_movements (scenario_run_id, occurs_at);
+drop index if exists ignore_once_per_run;
+create index if not exists ignored_movements_run_occurs_at on ignored_movements (scenario_run_id, occurs_at);
+`,
+	},
+	{
+		description: "create movement notes",
+		// language=sql
+		sql: `
+create table if not exists movement_notes
+(
+    id                    integer primary key, -- aliases to rowid
+    completed_movement_id integer references completed_movements (id),
+    ignored_movement_id   integer references ignored_movements (id),
+    position              integer not null,    -- notes are kept in the order they were added
+    note                  text    not null,
+
+    scenario_run_id       integer not null references scenario_runs (id),
+
+    check ((completed_movement_id is null) != (ignored_movement_id is null))
+);
+create index if not exists movement_notes_run on movement_notes (scenario_run_id);
+`,
+	},
+	{
+		description: "create run summaries",
+		// language=sql
+		sql: `
+create table if not exists run_summaries
+(
+    id                 integer primary key, -- aliases to rowid
+    requests           big integer not null,
+    completed          big integer not null,
+    failed             big integer not null,
+    timed_out          big integer not null,
+    failure_rate       real        not null,
+
+    response_time_p50  big integer not null,
+    response_time_p90  big integer not null,
+    response_time_p95  big integer not null,
+    response_time_p99  big integer not null,
+    response_time_p999 big integer not null,
+
+    average_replicas   real        not null,
+    peak_replicas      big integer not null,
+    replica_seconds    real        not null,
+
+    slo_latency_target big integer not null,
+    slo_attainment     real        not null,
+
+    scenario_run_id    integer     not null references scenario_runs (id)
+);
+create unique index if not exists run_summaries_run on run_summaries (scenario_run_id);
+`,
+	},
+	{
+		description: "create run costs",
+		// language=sql
+		sql: `
+create table if not exists run_costs
+(
+    id                  integer primary key, -- aliases to rowid
+    per_replica_second  real    not null,
+    per_cpu_second      real    not null,
+
+    launching_seconds   real    not null,
+    active_seconds      real    not null,
+    terminating_seconds real    not null,
+    replica_seconds     real    not null,
+
+    cpu_seconds         real    not null,
+    used_cpu_seconds    real    not null,
+    idle_cpu_seconds    real    not null,
+
+    replica_cost        real    not null,
+    cpu_cost            real    not null,
+    total_cost          real    not null,
+    wasted_cost         real    not null,
+
+    scenario_run_id     integer not null references scenario_runs (id)
+);
+create unique index if not exists run_costs_run on run_costs (scenario_run_id);
+`,
+	},
+	{
+		description: "store the full configuration of runs",
+		// language=sql
+		sql: `
+alter table scenario_runs add column configuration text; -- canonical JSON of the run request
+alter table scenario_runs add column seed big integer;
+alter table scenario_runs add column initial_number_of_replicas big integer;
+alter table scenario_runs add column request_timeout big integer;
+alter table scenario_runs add column request_cpu_time_millis big integer;
+alter table scenario_runs add column request_io_time_millis big integer;
+
+create index scenario_runs_traffic_pattern on scenario_runs (traffic_pattern);
+create index scenario_runs_seed on scenario_runs (seed);
+create index scenario_runs_replicas on scenario_runs (initial_number_of_replicas);
+create index scenario_runs_request on scenario_runs (request_cpu_time_millis, request_io_time_millis, request_timeout);
+`,
+	},
+	{
+		description: "record autoscaler decisions",
+		// language=sql
+		sql: `
+create table if not exists autoscaler_decisions
+(
+    id              integer primary key, -- aliases to rowid
+    decided_at      integer not null,
+    service         text    not null,    -- empty for the main service
+    stats           text    not null,    -- JSON array of the stats sent before scaling
+    desired         integer not null,
+    recommended     integer not null,
+    error           text,                -- null unless the plugin failed
+
+    scenario_run_id integer not null references scenario_runs (id)
+);
+create index if not exists autoscaler_decisions_run_decided_at on autoscaler_decisions (scenario_run_id, decided_at);
+`,
+	},
+	{
+		description: "tag CPU utilizations with their service",
+		// language=sql
+		sql: `
+alter table cpu_utilizations add column service text not null default ''; -- empty for the main service
+`,
+	},
+}
+
+// SchemaVersion is the schema version that this build of skenario writes.
+var SchemaVersion = len(migrations)
 
-create view if not exists stock_aggregate as
+// Views hold no data, so they are recreated after migrating to pick up any changes.
+// language=sql
+var Views = `
+drop view if exists stock_aggregate;
+-- stocks of further services are named 'service/Stock', so names are matched after any '/'
+create view stock_aggregate as
 select id
      , (case
-            when name like 'RequestsProcessing%' then 'RequestsProcessing'
+            when substr(name, instr(name, '/') + 1) like 'RequestsProcessing%'
+                then substr(name, 1, instr(name, '/')) || 'RequestsProcessing'
             else name
     end) as name
      , (case
@@ -101,7 +259,7 @@ select id
     end) as kind_stocked
 from stocks
 where kind_stocked in ('Request', 'Desired', 'Replica')
-  and name not in ('TrafficSource', 'ReplicaSource', 'DesiredSource', 'DesiredSink', 'ReplicasLaunching', 'ReplicasTerminating', 'ReplicasTerminated')
-  and name not like 'RequestsComplete%'
+  and substr(name, instr(name, '/') + 1) not in ('TrafficSource', 'RetrySource', 'ReplicaSource', 'DesiredSource', 'DesiredSink', 'ReplicasLaunching', 'ReplicasTerminating', 'ReplicasTerminated')
+  and substr(name, instr(name, '/') + 1) not like 'RequestsComplete%'
 ;
 `
@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// WriteCSV writes a series as CSV, with a header row of column names.
+func WriteCSV(w io.Writer, series Series) error {
+	err := series.validate()
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+
+	record := make([]string, len(series.Columns))
+	for i, c := range series.Columns {
+		record[i] = c.Name
+	}
+	err = cw.Write(record)
+	if err != nil {
+		return err
+	}
+
+	for row := 0; row < series.Rows(); row++ {
+		for i, c := range series.Columns {
+			record[i] = c.format(row)
+		}
+		err = cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
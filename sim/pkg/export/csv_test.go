@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSV(t *testing.T) {
+	spec.Run(t, "CSV", testCSV, spec.Report(report.Terminal{}))
+}
+
+func testCSV(t *testing.T, describe spec.G, it spec.S) {
+	describe("WriteCSV()", func() {
+		var buf *bytes.Buffer
+
+		it.Before(func() {
+			buf = &bytes.Buffer{}
+		})
+
+		it("writes a header row, then a row for each value", func() {
+			err := WriteCSV(buf, Series{Name: "test", Columns: []Column{
+				Int64s("occurs_at", []int64{1, 2}),
+				Strings("stock_name", []string{"ReplicasActive", "Requests, Buffered"}),
+				Float64s("utilization", []float64{12.5, 0}),
+			}})
+			require.NoError(t, err)
+
+			assert.Equal(t, "occurs_at,stock_name,utilization\n1,ReplicasActive,12.5\n2,\"Requests, Buffered\",0\n", buf.String())
+		})
+
+		it("rejects columns of different lengths", func() {
+			err := WriteCSV(buf, Series{Name: "test", Columns: []Column{
+				Int64s("occurs_at", []int64{1, 2}),
+				Int64s("tally", []int64{1}),
+			}})
+			assert.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MetricType string
+
+const (
+	Gauge     MetricType = "gauge"
+	Counter   MetricType = "counter"
+	Histogram MetricType = "histogram"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Bucket counts the observations of a histogram that were no greater than its upper bound.
+// The +Inf bucket is written from the point's count.
+type Bucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// MetricPoint is the value of a metric, with a set of labels, at an instant. Histogram
+// points have buckets, a count and a sum instead of a value.
+type MetricPoint struct {
+	Labels    []Label
+	Timestamp time.Time
+	Value     float64
+
+	Buckets []Bucket
+	Count   float64
+	Sum     float64
+}
+
+type MetricFamily struct {
+	Name   string
+	Type   MetricType
+	Unit   string
+	Help   string
+	Points []MetricPoint
+}
+
+// WriteOpenMetrics writes metric families as OpenMetrics text. The points of each set of
+// labels are written together, in order of time. Timestamps are written to the millisecond,
+// as Prometheus stores them, so where a set of labels has several points in the same
+// millisecond only the last is written.
+func WriteOpenMetrics(w io.Writer, families []MetricFamily) error {
+	bw := bufio.NewWriter(w)
+
+	for _, family := range families {
+		fmt.Fprintf(bw, "# TYPE %s %s\n", family.Name, family.Type)
+		if family.Unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", family.Name, family.Unit)
+		}
+		if family.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", family.Name, escapeHelp(family.Help))
+		}
+
+		for _, points := range pointsByLabels(family.Points) {
+			for i, point := range points {
+				if i+1 < len(points) && millis(points[i+1].Timestamp) == millis(point.Timestamp) {
+					continue
+				}
+				writePoint(bw, family, point)
+			}
+		}
+	}
+
+	_, err := bw.WriteString("# EOF\n")
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writePoint(w io.Writer, family MetricFamily, point MetricPoint) {
+	ts := timestamp(point.Timestamp)
+	labels := formatLabels(point.Labels)
+
+	switch family.Type {
+	case Counter:
+		fmt.Fprintf(w, "%s_total%s %s %s\n", family.Name, labels, formatValue(point.Value), ts)
+	case Histogram:
+		for _, bucket := range point.Buckets {
+			le := formatLabels(append(append([]Label{}, point.Labels...), Label{Name: "le", Value: formatValue(bucket.UpperBound)}))
+			fmt.Fprintf(w, "%s_bucket%s %s %s\n", family.Name, le, formatValue(bucket.Count), ts)
+		}
+		inf := formatLabels(append(append([]Label{}, point.Labels...), Label{Name: "le", Value: "+Inf"}))
+		fmt.Fprintf(w, "%s_bucket%s %s %s\n", family.Name, inf, formatValue(point.Count), ts)
+		fmt.Fprintf(w, "%s_count%s %s %s\n", family.Name, labels, formatValue(point.Count), ts)
+		fmt.Fprintf(w, "%s_sum%s %s %s\n", family.Name, labels, formatValue(point.Sum), ts)
+	default:
+		fmt.Fprintf(w, "%s%s %s %s\n", family.Name, labels, formatValue(point.Value), ts)
+	}
+}
+
+// pointsByLabels groups points by their labels, in the order each set of labels first
+// appears, and orders each group by time.
+func pointsByLabels(points []MetricPoint) [][]MetricPoint {
+	groups := make([][]MetricPoint, 0)
+	index := make(map[string]int)
+	for _, point := range points {
+		key := formatLabels(point.Labels)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, make([]MetricPoint, 0))
+		}
+		groups[i] = append(groups[i], point)
+	}
+
+	for _, group := range groups {
+		group := group
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Timestamp.Before(group[j].Timestamp)
+		})
+	}
+
+	return groups
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	formatted := make([]string, len(labels))
+	for i, l := range labels {
+		formatted[i] = fmt.Sprintf(`%s="%s"`, l.Name, escapeLabelValue(l.Value))
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// timestamp gives seconds since the epoch, to the millisecond.
+func timestamp(t time.Time) string {
+	ms := millis(t)
+	return fmt.Sprintf("%d.%03d", ms/1000, ms%1000)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
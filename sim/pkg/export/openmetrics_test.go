@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenMetrics(t *testing.T) {
+	spec.Run(t, "OpenMetrics", testOpenMetrics, spec.Report(report.Terminal{}))
+}
+
+func testOpenMetrics(t *testing.T, describe spec.G, it spec.S) {
+	describe("WriteOpenMetrics()", func() {
+		var buf *bytes.Buffer
+		at := func(millis int64) time.Time {
+			return time.Unix(0, millis*int64(time.Millisecond))
+		}
+
+		it.Before(func() {
+			buf = &bytes.Buffer{}
+		})
+
+		it("writes the points of each set of labels together, in order of time", func() {
+			err := WriteOpenMetrics(buf, []MetricFamily{{
+				Name: "skenario_stock_tally",
+				Type: Gauge,
+				Help: "Entities in a stock.",
+				Points: []MetricPoint{
+					{Labels: []Label{{"stock", "ReplicasActive"}}, Timestamp: at(2000), Value: 2},
+					{Labels: []Label{{"stock", "Requests"}}, Timestamp: at(1500), Value: 7},
+					{Labels: []Label{{"stock", "ReplicasActive"}}, Timestamp: at(1000), Value: 1},
+				},
+			}})
+			require.NoError(t, err)
+
+			assert.Equal(t, `# TYPE skenario_stock_tally gauge
+# HELP skenario_stock_tally Entities in a stock.
+skenario_stock_tally{stock="ReplicasActive"} 1 1.000
+skenario_stock_tally{stock="ReplicasActive"} 2 2.000
+skenario_stock_tally{stock="Requests"} 7 1.500
+# EOF
+`, buf.String())
+		})
+
+		it("keeps only the last point of a set of labels in any millisecond", func() {
+			err := WriteOpenMetrics(buf, []MetricFamily{{
+				Name: "skenario_stock_tally",
+				Type: Gauge,
+				Points: []MetricPoint{
+					{Timestamp: time.Unix(0, 1000), Value: 1},
+					{Timestamp: time.Unix(0, 2000), Value: 2},
+					{Timestamp: at(1), Value: 3},
+				},
+			}})
+			require.NoError(t, err)
+
+			assert.Equal(t, "# TYPE skenario_stock_tally gauge\nskenario_stock_tally 2 0.000\nskenario_stock_tally 3 0.001\n# EOF\n", buf.String())
+		})
+
+		it("writes counters with a _total suffix", func() {
+			err := WriteOpenMetrics(buf, []MetricFamily{{
+				Name:   "skenario_requests",
+				Type:   Counter,
+				Points: []MetricPoint{{Timestamp: at(1000), Value: 12}},
+			}})
+			require.NoError(t, err)
+
+			assert.Contains(t, buf.String(), "skenario_requests_total 12 1.000\n")
+		})
+
+		it("writes histograms as buckets, a count and a sum", func() {
+			err := WriteOpenMetrics(buf, []MetricFamily{{
+				Name: "skenario_response_time_seconds",
+				Type: Histogram,
+				Unit: "seconds",
+				Points: []MetricPoint{{
+					Labels:    []Label{{"run", "1"}},
+					Timestamp: at(1000),
+					Buckets:   []Bucket{{UpperBound: 0.5, Count: 1}, {UpperBound: 1, Count: 2}},
+					Count:     3,
+					Sum:       2.25,
+				}},
+			}})
+			require.NoError(t, err)
+
+			assert.Equal(t, `# TYPE skenario_response_time_seconds histogram
+# UNIT skenario_response_time_seconds seconds
+skenario_response_time_seconds_bucket{run="1",le="0.5"} 1 1.000
+skenario_response_time_seconds_bucket{run="1",le="1"} 2 1.000
+skenario_response_time_seconds_bucket{run="1",le="+Inf"} 3 1.000
+skenario_response_time_seconds_count{run="1"} 3 1.000
+skenario_response_time_seconds_sum{run="1"} 2.25 1.000
+# EOF
+`, buf.String())
+		})
+
+		it("escapes label values and help", func() {
+			err := WriteOpenMetrics(buf, []MetricFamily{{
+				Name:   "skenario_stock_tally",
+				Type:   Gauge,
+				Help:   "back\\slash\nnewline",
+				Points: []MetricPoint{{Labels: []Label{{"stock", `"quoted"`}}, Timestamp: at(0), Value: 1}},
+			}})
+			require.NoError(t, err)
+
+			assert.Contains(t, buf.String(), "# HELP skenario_stock_tally back\\\\slash\\nnewline\n")
+			assert.Contains(t, buf.String(), `skenario_stock_tally{stock="\"quoted\""} 1 0.000`)
+		})
+	})
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types, repetition types, encodings and codecs, as numbered by the
+// format's Thrift definitions.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired     = 0
+	parquetUTF8         = 0
+	parquetDataPage     = 0
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+)
+
+// WriteParquet writes a series as an Apache Parquet file. Every column is required and
+// plainly encoded, without compression, in a single row group with one data page per
+// column. Strings are written as UTF-8 byte arrays.
+func WriteParquet(w io.Writer, series Series) error {
+	err := series.validate()
+	if err != nil {
+		return err
+	}
+
+	pw := &positionWriter{w: w}
+	pw.write([]byte(parquetMagic))
+
+	chunks := make([]parquetChunk, len(series.Columns))
+	for i, c := range series.Columns {
+		values := plainValues(c)
+		header := pageHeader(len(values), c.Len())
+
+		chunks[i] = parquetChunk{offset: pw.position, size: int64(len(header) + len(values))}
+		pw.write(header)
+		pw.write(values)
+	}
+
+	footer := fileMetaData(series, chunks)
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(footer)))
+
+	pw.write(footer)
+	pw.write(length)
+	pw.write([]byte(parquetMagic))
+
+	return pw.err
+}
+
+type parquetChunk struct {
+	offset int64
+	size   int64
+}
+
+func parquetType(c Column) int32 {
+	switch c.Type {
+	case Int64Column:
+		return parquetInt64
+	case Float64Column:
+		return parquetDouble
+	default:
+		return parquetByteArray
+	}
+}
+
+func plainValues(c Column) []byte {
+	buf := &bytes.Buffer{}
+	scratch := make([]byte, 8)
+
+	switch c.Type {
+	case Int64Column:
+		for _, v := range c.Int64s {
+			binary.LittleEndian.PutUint64(scratch, uint64(v))
+			buf.Write(scratch)
+		}
+	case Float64Column:
+		for _, v := range c.Float64s {
+			binary.LittleEndian.PutUint64(scratch, math.Float64bits(v))
+			buf.Write(scratch)
+		}
+	default:
+		for _, v := range c.Strings {
+			binary.LittleEndian.PutUint32(scratch, uint32(len(v)))
+			buf.Write(scratch[:4])
+			buf.WriteString(v)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func pageHeader(size, values int) []byte {
+	cw := newCompactWriter()
+	cw.i32(1, parquetDataPage)
+	cw.i32(2, int32(size))
+	cw.i32(3, int32(size))
+	cw.structField(5, func() {
+		cw.i32(1, int32(values))
+		cw.i32(2, parquetPlain)
+		cw.i32(3, parquetRLE)
+		cw.i32(4, parquetRLE)
+	})
+	return cw.end()
+}
+
+func fileMetaData(series Series, chunks []parquetChunk) []byte {
+	rows := int64(series.Rows())
+	total := int64(0)
+	for _, chunk := range chunks {
+		total += chunk.size
+	}
+
+	cw := newCompactWriter()
+	cw.i32(1, 1)
+	cw.listField(2, compactStruct, len(series.Columns)+1)
+	cw.element(func() {
+		cw.str(4, "schema")
+		cw.i32(5, int32(len(series.Columns)))
+	})
+	for _, c := range series.Columns {
+		c := c
+		cw.element(func() {
+			cw.i32(1, parquetType(c))
+			cw.i32(3, parquetRequired)
+			cw.str(4, c.Name)
+			if c.Type == StringColumn {
+				cw.i32(6, parquetUTF8)
+			}
+		})
+	}
+	cw.i64(3, rows)
+	cw.listField(4, compactStruct, 1)
+	cw.element(func() {
+		cw.listField(1, compactStruct, len(series.Columns))
+		for i, c := range series.Columns {
+			c, chunk := c, chunks[i]
+			cw.element(func() {
+				cw.i64(2, chunk.offset)
+				cw.structField(3, func() {
+					cw.i32(1, parquetType(c))
+					cw.listField(2, compactI32, 1)
+					cw.i32Element(parquetPlain)
+					cw.listField(3, compactBinary, 1)
+					cw.strElement(c.Name)
+					cw.i32(4, parquetUncompressed)
+					cw.i64(5, rows)
+					cw.i64(6, chunk.size)
+					cw.i64(7, chunk.size)
+					cw.i64(9, chunk.offset)
+				})
+			})
+		}
+		cw.i64(2, total)
+		cw.i64(3, rows)
+	})
+	cw.str(6, "skenario")
+	return cw.end()
+}
+
+type positionWriter struct {
+	w        io.Writer
+	position int64
+	err      error
+}
+
+func (pw *positionWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+
+	n, err := pw.w.Write(b)
+	pw.position += int64(n)
+	pw.err = err
+}
+
+// Thrift compact protocol types.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes a Thrift struct with the compact protocol, which Parquet uses for
+// its page headers and footer. Fields must be written in increasing order of id.
+type compactWriter struct {
+	buf        bytes.Buffer
+	lastFields []int16
+}
+
+func newCompactWriter() *compactWriter {
+	return &compactWriter{lastFields: []int16{0}}
+}
+
+func (cw *compactWriter) end() []byte {
+	cw.buf.WriteByte(0)
+	return cw.buf.Bytes()
+}
+
+func (cw *compactWriter) fieldHeader(id int16, typ byte) {
+	last := &cw.lastFields[len(cw.lastFields)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		cw.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		cw.buf.WriteByte(typ)
+		cw.varint(int64(id))
+	}
+	*last = id
+}
+
+func (cw *compactWriter) uvarint(v uint64) {
+	scratch := make([]byte, binary.MaxVarintLen64)
+	cw.buf.Write(scratch[:binary.PutUvarint(scratch, v)])
+}
+
+// varint writes a zigzag encoded integer.
+func (cw *compactWriter) varint(v int64) {
+	cw.uvarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (cw *compactWriter) i32(id int16, v int32) {
+	cw.fieldHeader(id, compactI32)
+	cw.varint(int64(v))
+}
+
+func (cw *compactWriter) i64(id int16, v int64) {
+	cw.fieldHeader(id, compactI64)
+	cw.varint(v)
+}
+
+func (cw *compactWriter) str(id int16, s string) {
+	cw.fieldHeader(id, compactBinary)
+	cw.strElement(s)
+}
+
+func (cw *compactWriter) structField(id int16, fields func()) {
+	cw.fieldHeader(id, compactStruct)
+	cw.element(fields)
+}
+
+func (cw *compactWriter) listField(id int16, elementType byte, size int) {
+	cw.fieldHeader(id, compactList)
+	if size < 15 {
+		cw.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		cw.buf.WriteByte(0xf0 | elementType)
+		cw.uvarint(uint64(size))
+	}
+}
+
+// element writes a struct that is an element of a list, or the value of a field.
+func (cw *compactWriter) element(fields func()) {
+	cw.lastFields = append(cw.lastFields, 0)
+	fields()
+	cw.buf.WriteByte(0)
+	cw.lastFields = cw.lastFields[:len(cw.lastFields)-1]
+}
+
+func (cw *compactWriter) i32Element(v int32) {
+	cw.varint(int64(v))
+}
+
+func (cw *compactWriter) strElement(s string) {
+	cw.uvarint(uint64(len(s)))
+	cw.buf.WriteString(s)
+}
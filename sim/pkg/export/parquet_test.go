@@ -0,0 +1,190 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParquet(t *testing.T) {
+	spec.Run(t, "Parquet", testParquet, spec.Report(report.Terminal{}))
+}
+
+func testParquet(t *testing.T, describe spec.G, it spec.S) {
+	describe("WriteParquet()", func() {
+		var file []byte
+		var footer map[int16]interface{}
+
+		it.Before(func() {
+			buf := &bytes.Buffer{}
+			err := WriteParquet(buf, Series{Name: "test", Columns: []Column{
+				Int64s("occurs_at", []int64{1, -2, 3}),
+				Strings("stock_name", []string{"ReplicasActive", "", "Requests"}),
+				Float64s("utilization", []float64{12.5, 0, math.MaxFloat64}),
+			}})
+			require.NoError(t, err)
+			file = buf.Bytes()
+
+			footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+			footerReader := &compactReader{buf: file[len(file)-8-footerLength : len(file)-8]}
+			footer = footerReader.readStruct()
+			require.Empty(t, footerReader.buf)
+		})
+
+		it("starts and ends with the magic number", func() {
+			assert.Equal(t, "PAR1", string(file[:4]))
+			assert.Equal(t, "PAR1", string(file[len(file)-4:]))
+		})
+
+		it("describes the schema", func() {
+			assert.Equal(t, int64(3), footer[3])
+
+			schema := footer[2].([]interface{})
+			require.Len(t, schema, 4)
+			assert.Equal(t, []byte("schema"), schema[0].(map[int16]interface{})[4])
+			assert.Equal(t, int64(3), schema[0].(map[int16]interface{})[5])
+
+			names := make([]string, 0)
+			types := make([]int64, 0)
+			for _, element := range schema[1:] {
+				names = append(names, string(element.(map[int16]interface{})[4].([]byte)))
+				types = append(types, element.(map[int16]interface{})[1].(int64))
+				assert.Equal(t, int64(parquetRequired), element.(map[int16]interface{})[3])
+			}
+			assert.Equal(t, []string{"occurs_at", "stock_name", "utilization"}, names)
+			assert.Equal(t, []int64{parquetInt64, parquetByteArray, parquetDouble}, types)
+			assert.Equal(t, int64(parquetUTF8), schema[2].(map[int16]interface{})[6])
+		})
+
+		it("writes each column's values into a plain data page", func() {
+			rowGroups := footer[4].([]interface{})
+			require.Len(t, rowGroups, 1)
+			chunks := rowGroups[0].(map[int16]interface{})[1].([]interface{})
+			require.Len(t, chunks, 3)
+
+			pages := make([][]byte, 0)
+			for _, chunk := range chunks {
+				meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+				assert.Equal(t, int64(3), meta[5])
+
+				offset := meta[9].(int64)
+				headerReader := &compactReader{buf: file[offset:]}
+				header := headerReader.readStruct()
+				assert.Equal(t, int64(parquetDataPage), header[1])
+				assert.Equal(t, int64(3), header[5].(map[int16]interface{})[1])
+				assert.Equal(t, int64(parquetPlain), header[5].(map[int16]interface{})[2])
+
+				size := header[3].(int64)
+				pageStart := len(file[offset:]) - len(headerReader.buf)
+				assert.Equal(t, meta[7], int64(pageStart)+size)
+
+				pages = append(pages, headerReader.buf[:size])
+			}
+
+			assert.Equal(t, int64(-2), int64(binary.LittleEndian.Uint64(pages[0][8:])))
+			assert.Equal(t, append(append(
+				[]byte{14, 0, 0, 0}, "ReplicasActive"...),
+				append([]byte{0, 0, 0, 0, 8, 0, 0, 0}, "Requests"...)...,
+			), pages[1])
+			assert.Equal(t, math.MaxFloat64, math.Float64frombits(binary.LittleEndian.Uint64(pages[2][16:])))
+		})
+
+		it("rejects columns of different lengths", func() {
+			err := WriteParquet(&bytes.Buffer{}, Series{Name: "test", Columns: []Column{
+				Int64s("occurs_at", []int64{1, 2}),
+				Int64s("tally", []int64{1}),
+			}})
+			assert.Error(t, err)
+		})
+	})
+}
+
+// compactReader decodes Thrift compact protocol structs into maps of field ids to values.
+// Integers are decoded as int64, binaries as []byte, lists as []interface{} and structs as
+// maps.
+type compactReader struct {
+	buf []byte
+}
+
+func (cr *compactReader) readByte() byte {
+	b := cr.buf[0]
+	cr.buf = cr.buf[1:]
+	return b
+}
+
+func (cr *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(cr.buf)
+	cr.buf = cr.buf[n:]
+	return v
+}
+
+func (cr *compactReader) varint() int64 {
+	v := cr.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (cr *compactReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	last := int16(0)
+	for {
+		header := cr.readByte()
+		if header == 0 {
+			return fields
+		}
+
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(cr.varint())
+		}
+		fields[id] = cr.readValue(header & 0x0f)
+		last = id
+	}
+}
+
+func (cr *compactReader) readValue(typ byte) interface{} {
+	switch typ {
+	case compactI32, compactI64:
+		return cr.varint()
+	case compactBinary:
+		n := cr.uvarint()
+		v := cr.buf[:n]
+		cr.buf = cr.buf[n:]
+		return v
+	case compactList:
+		header := cr.readByte()
+		size := uint64(header >> 4)
+		if size == 15 {
+			size = cr.uvarint()
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = cr.readValue(header & 0x0f)
+		}
+		return list
+	case compactStruct:
+		return cr.readStruct()
+	default:
+		panic("unexpected compact type")
+	}
+}
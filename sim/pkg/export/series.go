@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package export
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type ColumnType int
+
+const (
+	Int64Column ColumnType = iota
+	Float64Column
+	StringColumn
+)
+
+// Column holds the values of one column of a series. Only the values of its type are set.
+type Column struct {
+	Name     string
+	Type     ColumnType
+	Int64s   []int64
+	Float64s []float64
+	Strings  []string
+}
+
+func Int64s(name string, values []int64) Column {
+	return Column{Name: name, Type: Int64Column, Int64s: values}
+}
+
+func Float64s(name string, values []float64) Column {
+	return Column{Name: name, Type: Float64Column, Float64s: values}
+}
+
+func Strings(name string, values []string) Column {
+	return Column{Name: name, Type: StringColumn, Strings: values}
+}
+
+func (c Column) Len() int {
+	switch c.Type {
+	case Int64Column:
+		return len(c.Int64s)
+	case Float64Column:
+		return len(c.Float64s)
+	default:
+		return len(c.Strings)
+	}
+}
+
+// format gives the i-th value as text.
+func (c Column) format(i int) string {
+	switch c.Type {
+	case Int64Column:
+		return strconv.FormatInt(c.Int64s[i], 10)
+	case Float64Column:
+		return strconv.FormatFloat(c.Float64s[i], 'g', -1, 64)
+	default:
+		return c.Strings[i]
+	}
+}
+
+// Series is a table of results, such as the tally lines or response times of a run. Every
+// column has a value for every row.
+type Series struct {
+	Name    string
+	Columns []Column
+}
+
+func (s Series) Rows() int {
+	if len(s.Columns) == 0 {
+		return 0
+	}
+	return s.Columns[0].Len()
+}
+
+func (s Series) validate() error {
+	for _, c := range s.Columns {
+		if c.Len() != s.Rows() {
+			return fmt.Errorf("column '%s' of series '%s' has %d values, but the series has %d rows", c.Name, s.Name, c.Len(), s.Rows())
+		}
+	}
+
+	return nil
+}
@@ -27,15 +27,18 @@ import (
 
 type AutoscalerConfig struct {
 	TickInterval time.Duration
+	Yaml         string
 }
 
 type AutoscalerModel interface {
 	Model
+	Reconfigure(config AutoscalerConfig)
 }
 
 type autoscaler struct {
 	env      simulator.Environment
-	tickTock AutoscalerTicktockStock
+	tickTock *autoscalerTicktockStock
+	config   AutoscalerConfig
 }
 
 func (a *autoscaler) Env() simulator.Environment {
@@ -49,41 +52,67 @@ func (c *stubCluster) ListPods() ([]*skplug.Pod, error) {
 	return nil, nil
 }
 
-func NewAutoscaler(env simulator.Environment, startAt time.Time, cluster ClusterModel, config AutoscalerConfig) AutoscalerModel {
+// Reconfigure replaces the autoscaler's configuration partway through a run. A changed
+// Yaml deletes the autoscaler from the plugin and creates it again, losing whatever state
+// the plugin kept. A changed TickInterval applies after the tick already scheduled.
+func (a *autoscaler) Reconfigure(config AutoscalerConfig) {
+	if config.Yaml == "" {
+		config.Yaml = hpaYaml
+	}
 
-	autoscalerEntity := simulator.NewEntity("Autoscaler", "Autoscaler")
+	if config.Yaml != a.config.Yaml {
+		now := a.env.CurrentMovementTime().UnixNano()
+
+		err := a.env.Plugin().Event(now, proto.EventType_DELETE, &skplug.Autoscaler{})
+		if err != nil {
+			panic(err)
+		}
+
+		createAutoscaler(a.env, now, config.Yaml)
+	}
+
+	a.tickTock.tickInterval = config.TickInterval
+	a.config = config
+}
 
-	err := env.Plugin().Event(startAt.UnixNano(), proto.EventType_CREATE, &skplug.Autoscaler{
+func createAutoscaler(env simulator.Environment, at int64, yaml string) {
+	err := env.Plugin().Event(at, proto.EventType_CREATE, &skplug.Autoscaler{
 		// TODO: select type and plugin based on the scenario.
 		Type: "hpa.v2beta2.autoscaling.k8s.io",
-		Yaml: hpaYaml,
+		Yaml: yaml,
 	})
 	if err != nil {
 		panic(err)
 	}
 	log.Printf("Created autoscaler.")
+}
+
+func NewAutoscaler(env simulator.Environment, startAt time.Time, cluster ClusterModel, config AutoscalerConfig) AutoscalerModel {
+	if config.Yaml == "" {
+		config.Yaml = hpaYaml
+	}
+
+	autoscalerEntity := simulator.NewEntity("Autoscaler", "Autoscaler")
+
+	createAutoscaler(env, startAt.UnixNano(), config.Yaml)
 
 	// TODO: create initial replicas config.
 	// Create the first pod since HPA can't scale from zero.
 	cm := cluster.(*clusterModel)
-	err = cm.replicasActive.Add(cm.replicaSource.Remove())
+	err := cm.replicasActive.Add(cm.replicaSource.Remove())
 	if err != nil {
 		panic(err)
 	}
 
 	as := &autoscaler{
 		env:      env,
-		tickTock: NewAutoscalerTicktockStock(env, autoscalerEntity, cluster),
+		tickTock: NewAutoscalerTicktockStock(env, autoscalerEntity, cluster).(*autoscalerTicktockStock),
+		config:   config,
 	}
+	as.tickTock.tickInterval = config.TickInterval
 
-	for theTime := startAt.Add(config.TickInterval).Add(1 * time.Nanosecond); theTime.Before(env.HaltTime()); theTime = theTime.Add(config.TickInterval) {
-		as.env.AddToSchedule(simulator.NewMovement(
-			"autoscaler_tick",
-			theTime,
-			as.tickTock,
-			as.tickTock,
-		))
-	}
+	// Each tick schedules the next, so only the first is scheduled here.
+	as.tickTock.scheduleNextTick(startAt.Add(1 * time.Nanosecond))
 
 	return as
 }
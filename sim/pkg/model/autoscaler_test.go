@@ -64,9 +64,14 @@ func testAutoscaler(t *testing.T, describe spec.G, it spec.S) {
 				tickInterval = 1 * time.Minute
 				tickMovements = []simulator.Movement{}
 
-				for _, mv := range envFake.Movements {
+				// each tick schedules the next one, so run them as they appear
+				for i := 0; i < len(envFake.Movements); i++ {
+					mv := envFake.Movements[i]
 					if mv.Kind() == "autoscaler_tick" {
 						tickMovements = append(tickMovements, mv)
+						envFake.TheTime = mv.OccursAt()
+						err := mv.To().Add(mv.From().Remove())
+						assert.NoError(t, err)
 					}
 				}
 			})
@@ -91,5 +96,34 @@ func testAutoscaler(t *testing.T, describe spec.G, it spec.S) {
 			assert.NotNil(t, rawSubject.tickTock)
 			assert.Equal(t, simulator.StockName("Autoscaler Ticktock"), rawSubject.tickTock.Name())
 		})
+
+		it("uses the default HPA yaml when none is given", func() {
+			assert.Equal(t, hpaYaml, rawSubject.config.Yaml)
+		})
+	})
+
+	describe("Reconfigure()", func() {
+		it.Before(func() {
+			subject = NewAutoscaler(envFake, startAt, cluster, AutoscalerConfig{TickInterval: 60 * time.Second})
+			rawSubject = subject.(*autoscaler)
+
+			subject.Reconfigure(AutoscalerConfig{TickInterval: 30 * time.Second, Yaml: "kind: Other"})
+		})
+
+		it("changes the interval for the ticks that follow", func() {
+			assert.Equal(t, 30*time.Second, rawSubject.tickTock.tickInterval)
+
+			envFake.TheTime = startAt.Add(time.Minute)
+			err := rawSubject.tickTock.Add(rawSubject.tickTock.Remove())
+			assert.NoError(t, err)
+
+			next := envFake.Movements[len(envFake.Movements)-1]
+			assert.Equal(t, simulator.MovementKind("autoscaler_tick"), next.Kind())
+			assert.Equal(t, startAt.Add(90*time.Second), next.OccursAt())
+		})
+
+		it("keeps the new configuration", func() {
+			assert.Equal(t, "kind: Other", rawSubject.config.Yaml)
+		})
 	})
 }
@@ -32,10 +32,11 @@ type autoscalerTicktockStock struct {
 	autoscalerEntity simulator.Entity
 	desiredSource    simulator.ThroughStock
 	desiredSink      simulator.ThroughStock
+	tickInterval     time.Duration
 }
 
 func (asts *autoscalerTicktockStock) Name() simulator.StockName {
-	return "Autoscaler Ticktock"
+	return simulator.ServiceStockName(asts.env, "Autoscaler Ticktock")
 }
 
 func (asts *autoscalerTicktockStock) KindStocked() simulator.EntityKind {
@@ -61,13 +62,13 @@ func (asts *autoscalerTicktockStock) Add(entity simulator.Entity) error {
 
 	currentTime := asts.env.CurrentMovementTime()
 
-	asts.cluster.RecordToAutoscaler(&currentTime)
-	autoscalerDesired, err := asts.env.Plugin().Scale(currentTime.UnixNano())
-	if err != nil {
-		panic(err)
+	decision := asts.decide(currentTime)
+	asts.env.AppendAutoscalerDecision(decision)
+	if decision.Err != nil {
+		return decision.Err
 	}
 
-	delta := autoscalerDesired - int32(asts.cluster.Desired().Count())
+	delta := decision.Recommended - decision.Desired
 
 	if delta > 0 {
 		for i := int32(0); i < delta; i++ {
@@ -99,9 +100,47 @@ func (asts *autoscalerTicktockStock) Add(entity simulator.Entity) error {
 	//calculate CPU utilization
 	asts.calculateCPUUtilization()
 
+	asts.scheduleNextTick(currentTime)
+
 	return nil
 }
 
+// decide sends the cluster's stats to the autoscaler and asks it how many replicas are
+// desired. A plugin failure is recorded in the decision, which stops the run once it is
+// appended to the environment.
+func (asts *autoscalerTicktockStock) decide(tickAt time.Time) *simulator.AutoscalerDecision {
+	decision := &simulator.AutoscalerDecision{
+		Service:   simulator.ServiceName(asts.env),
+		DecidedAt: tickAt,
+		Desired:   int32(asts.cluster.Desired().Count()),
+	}
+
+	decision.Stats, decision.Err = asts.cluster.RecordToAutoscaler(&tickAt)
+	if decision.Err != nil {
+		return decision
+	}
+
+	decision.Recommended, decision.Err = asts.env.Plugin().Scale(tickAt.UnixNano())
+
+	return decision
+}
+
+// scheduleNextTick schedules the tick after the one at tickAt, so that a change to the
+// tick interval applies from the next tick onwards. Without a tick interval, nothing is
+// scheduled.
+func (asts *autoscalerTicktockStock) scheduleNextTick(tickAt time.Time) {
+	if asts.tickInterval <= 0 {
+		return
+	}
+
+	next := tickAt.Add(asts.tickInterval)
+	if !next.Before(asts.env.HaltTime()) {
+		return
+	}
+
+	asts.env.AddToSchedule(simulator.NewMovement("autoscaler_tick", next, asts, asts))
+}
+
 func (asts *autoscalerTicktockStock) calculateCPUUtilization() {
 	countActiveReplicas := 0.0
 	totalCPUUtilization := 0.0 // total cpuUtilization for all active replicas in percentage
@@ -112,18 +151,24 @@ func (asts *autoscalerTicktockStock) calculateCPUUtilization() {
 		countActiveReplicas++
 	}
 	if countActiveReplicas > 0 {
-		averageCPUUtilizationPerReplica := simulator.CPUUtilization{CPUUtilization: totalCPUUtilization / countActiveReplicas,
-			CalculatedAt: asts.env.CurrentMovementTime()}
+		averageCPUUtilizationPerReplica := simulator.CPUUtilization{Service: simulator.ServiceName(asts.env),
+			CPUUtilization: totalCPUUtilization / countActiveReplicas, CalculatedAt: asts.env.CurrentMovementTime()}
 		asts.env.AppendCPUUtilization(&averageCPUUtilizationPerReplica)
 	}
 }
 
 func NewAutoscalerTicktockStock(env simulator.Environment, scalerEntity simulator.Entity, cluster ClusterModel) AutoscalerTicktockStock {
-	return &autoscalerTicktockStock{
+	asts := &autoscalerTicktockStock{
 		env:              env,
 		cluster:          cluster,
 		autoscalerEntity: scalerEntity,
-		desiredSource:    simulator.NewThroughStock("DesiredSource", "Desired"),
-		desiredSink:      simulator.NewThroughStock("DesiredSink", "Desired"),
+		desiredSource:    simulator.NewThroughStock(simulator.ServiceStockName(env, "DesiredSource"), "Desired"),
+		desiredSink:      simulator.NewThroughStock(simulator.ServiceStockName(env, "DesiredSink"), "Desired"),
 	}
+
+	env.AddStock(asts)
+	env.AddStock(asts.desiredSource)
+	env.AddStock(asts.desiredSink)
+
+	return asts
 }
@@ -16,6 +16,7 @@
 package model
 
 import (
+	"errors"
 	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
 	"math"
 	"testing"
@@ -24,6 +25,7 @@ import (
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"skenario/pkg/simulator"
 )
@@ -156,6 +158,16 @@ func testAutoscalerTicktock(t *testing.T, describe spec.G, it spec.S) {
 						assert.Equal(t, simulator.StockName("DesiredSource"), envFake.Movements[8].From().Name())
 						assert.Equal(t, simulator.StockName("ReplicasDesired"), envFake.Movements[8].To().Name())
 					})
+
+					it("records the decision with the stats it was based on", func() {
+						require.Len(t, envFake.TheAutoscalerDecisions, 1)
+						decision := envFake.TheAutoscalerDecisions[0]
+						assert.Equal(t, time.Unix(0, 0), decision.DecidedAt)
+						assert.Equal(t, int32(1), decision.Desired)
+						assert.Equal(t, int32(8), decision.Recommended)
+						assert.Equal(t, envFake.ThePlugin.(*FakePluginPartition).stats, decision.Stats)
+						assert.NoError(t, decision.Err)
+					})
 				})
 
 				describe("to scale down", func() {
@@ -178,6 +190,36 @@ func testAutoscalerTicktock(t *testing.T, describe spec.G, it spec.S) {
 					})
 				})
 			})
+			describe("the autoscaler failed", func() {
+				it.Before(func() {
+					envFake.ThePlugin.(*FakePluginPartition).scaleTo = 8
+					envFake.ThePlugin.(*FakePluginPartition).scaleErr = errors.New("plugin went away")
+					envFake.TheHaltTime = envFake.TheTime.Add(time.Hour)
+					rawSubject.tickInterval = time.Minute
+
+					ent := subject.Remove()
+					err := subject.Add(ent)
+					assert.EqualError(t, err, "plugin went away")
+				})
+
+				it("records the error", func() {
+					require.Len(t, envFake.TheAutoscalerDecisions, 1)
+					assert.EqualError(t, envFake.TheAutoscalerDecisions[0].Err, "plugin went away")
+				})
+
+				it("leaves the desired replicas alone", func() {
+					for _, mv := range envFake.Movements {
+						assert.NotEqual(t, simulator.MovementKind("increase_desired"), mv.Kind())
+					}
+				})
+
+				it("schedules no further tick", func() {
+					for _, mv := range envFake.Movements {
+						assert.NotEqual(t, simulator.MovementKind("autoscaler_tick"), mv.Kind())
+					}
+				})
+			})
+
 			it("cpu utilization list is empty in environment", func() {
 				assert.Equal(t, 0, len(envFake.TheCPUUtilizations))
 			})
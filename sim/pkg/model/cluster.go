@@ -34,7 +34,8 @@ type ClusterModel interface {
 	Desired() ReplicasDesiredStock
 	CurrentLaunching() uint64
 	CurrentActive() uint64
-	RecordToAutoscaler(atTime *time.Time)
+	// RecordToAutoscaler sends the cluster's stats to the autoscaler, giving the stats sent.
+	RecordToAutoscaler(atTime *time.Time) ([]*proto.Stat, error)
 	RoutingStock() RequestsRoutingStock
 	ActiveStock() simulator.ThroughStock
 }
@@ -68,7 +69,7 @@ func (cm *clusterModel) CurrentActive() uint64 {
 	return cm.replicasActive.Count()
 }
 
-func (cm *clusterModel) RecordToAutoscaler(atTime *time.Time) {
+func (cm *clusterModel) RecordToAutoscaler(atTime *time.Time) ([]*proto.Stat, error) {
 	// first report for the RoutingStock
 	stats := make([]*proto.Stat, 0)
 	stats = append(stats, &proto.Stat{
@@ -84,10 +85,8 @@ func (cm *clusterModel) RecordToAutoscaler(atTime *time.Time) {
 		r := (*e).(ReplicaEntity)
 		stats = append(stats, r.Stats()...)
 	}
-	err := cm.env.Plugin().Stat(stats)
-	if err != nil {
-		panic(err)
-	}
+
+	return stats, cm.env.Plugin().Stat(stats)
 }
 
 func (cm *clusterModel) RoutingStock() RequestsRoutingStock {
@@ -99,19 +98,34 @@ func (cm *clusterModel) ActiveStock() simulator.ThroughStock {
 }
 
 func NewCluster(env simulator.Environment, config ClusterConfig, replicasConfig ReplicasConfig) ClusterModel {
+	replicaSource := NewReplicaSource(env, replicasConfig.MaxRPS).(*replicaSource)
 	replicasActive := NewReplicasActiveStock(env)
-	requestsFailed := simulator.NewSinkStock("RequestsFailed", "Request")
+	requestsFailed := NewRequestsFailedStock(env, "RequestsFailed")
 	routingStock := NewRequestsRoutingStock(env, replicasActive, requestsFailed)
-	replicasTerminated := simulator.NewSinkStock("ReplicasTerminated", simulator.EntityKind("Replica"))
+	replicasLaunching := &replicasStock{
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, "ReplicasLaunching"), "Replica", simulator.StockConfig{}),
+		source:       replicaSource,
+	}
+	replicasTerminated := &replicasStock{
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, "ReplicasTerminated"), "Replica", simulator.StockConfig{}),
+		source:       replicaSource,
+	}
+	replicasTerminating := NewReplicasTerminatingStock(env, replicasConfig, replicasTerminated)
+
+	// Replicas are restored from snapshots through the source, and their requests through
+	// the routing stock.
+	replicaSource.routingStock = routingStock
+	replicasActive.(*replicasActiveStock).source = replicaSource
+	replicasTerminating.(*replicasTerminatingStock).source = replicaSource
 
 	cm := &clusterModel{
 		env:                 env,
 		config:              config,
 		replicasConfig:      replicasConfig,
-		replicaSource:       NewReplicaSource(env, replicasConfig.MaxRPS),
-		replicasLaunching:   simulator.NewThroughStock("ReplicasLaunching", simulator.EntityKind("Replica")),
+		replicaSource:       replicaSource,
+		replicasLaunching:   replicasLaunching,
 		replicasActive:      replicasActive,
-		replicasTerminating: NewReplicasTerminatingStock(env, replicasConfig, replicasTerminated),
+		replicasTerminating: replicasTerminating,
 		replicasTerminated:  replicasTerminated,
 		requestsInRouting:   routingStock,
 		requestsFailed:      requestsFailed,
@@ -124,5 +138,19 @@ func NewCluster(env simulator.Environment, config ClusterConfig, replicasConfig
 
 	cm.replicasDesired = NewReplicasDesiredStock(env, desiredConf, cm.replicaSource, cm.replicasLaunching, cm.replicasActive, cm.replicasTerminating)
 
+	for _, stock := range []simulator.Stock{
+		cm.replicasDesired,
+		replicaSource,
+		replicaSource.failedSink,
+		replicasLaunching,
+		replicasActive,
+		replicasTerminating,
+		replicasTerminated,
+		routingStock,
+		requestsFailed,
+	} {
+		env.AddStock(stock)
+	}
+
 	return cm
 }
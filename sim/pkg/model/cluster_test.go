@@ -39,6 +39,7 @@ func testCluster(t *testing.T, describe spec.G, it spec.S) {
 	var replicasConfig ReplicasConfig
 
 	it.Before(func() {
+		envFake = NewFakeEnvironment()
 		config = ClusterConfig{}
 		config.NumberOfRequests = 10
 		replicasConfig = ReplicasConfig{time.Second, time.Second, 100}
@@ -50,8 +51,6 @@ func testCluster(t *testing.T, describe spec.G, it spec.S) {
 	})
 
 	describe("NewCluster()", func() {
-		envFake = NewFakeEnvironment()
-
 		it("sets an environment", func() {
 			assert.Equal(t, envFake, subject.Env())
 		})
@@ -147,6 +146,48 @@ func testCluster(t *testing.T, describe spec.G, it spec.S) {
 		})
 	})
 
+	describe("when replicas are saved and restored", func() {
+		var restored *clusterModel
+		var processing *requestsProcessingStock
+
+		it.Before(func() {
+			source := NewTrafficSource(envFake, subject.RoutingStock(), RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
+			replica := rawSubject.replicaSource.Remove().(*replicaEntity)
+			err := rawSubject.replicasActive.Add(replica)
+			assert.NoError(t, err)
+			err = replica.RequestsProcessing().Add(source.Remove())
+			assert.NoError(t, err)
+
+			savedReplicas := rawSubject.replicasActive.(*replicasActiveStock).SaveState()
+			savedRequests := replica.requestsProcessing.(*requestsProcessingStock).SaveState()
+
+			otherEnv := NewFakeEnvironment()
+			restored = NewCluster(otherEnv, config, replicasConfig).(*clusterModel)
+			NewTrafficSource(otherEnv, restored.RoutingStock(), RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
+			err = restored.replicasActive.(*replicasActiveStock).RestoreState(savedReplicas)
+			assert.NoError(t, err)
+
+			processing = (*restored.replicasActive.EntitiesInStock()[0]).(*replicaEntity).requestsProcessing.(*requestsProcessingStock)
+			err = processing.RestoreState(savedRequests)
+			assert.NoError(t, err)
+		})
+
+		it("gives back replicas with the same names and occupied CPU", func() {
+			original := (*rawSubject.replicasActive.EntitiesInStock()[0]).(*replicaEntity)
+			replica := (*restored.replicasActive.EntitiesInStock()[0]).(*replicaEntity)
+
+			assert.Equal(t, original.Name(), replica.Name())
+			assert.Equal(t, original.occupiedCPUCapacityMillisPerSecond, replica.occupiedCPUCapacityMillisPerSecond)
+		})
+
+		it("gives back the requests each replica is processing", func() {
+			assert.Equal(t, uint64(1), processing.Count())
+			request := (*processing.EntitiesInStock()[0]).(*requestEntity)
+			assert.Equal(t, simulator.EntityName("request-1"), request.Name())
+			assert.Equal(t, restored.RoutingStock(), request.routingStock)
+		})
+	})
+
 	describe("requestsInRouting", func() {
 		it("returns the configured routing stock", func() {
 			assert.Equal(t, rawSubject.requestsInRouting, subject.RoutingStock())
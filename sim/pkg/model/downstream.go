@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// DownstreamConfig describes the calls one service makes to another for each request it
+// receives. Calls are made without waiting for them to finish, so a slow downstream
+// service does not slow the upstream one.
+type DownstreamConfig struct {
+	// CallsPerRequest is the mean number of calls made for each request. The fraction is
+	// made up by chance, so that 1.5 makes one call and half of the time a second.
+	CallsPerRequest float64 `json:"calls_per_request"`
+	// Delay is how long after a request arrives that its calls are made.
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+type downstreamCall struct {
+	source  TrafficSource
+	routing RequestsRoutingStock
+	config  DownstreamConfig
+}
+
+// AddDownstream makes every request arriving at upstream, including retries, call the
+// service whose requests come from source and are routed by routing.
+func AddDownstream(upstream ClusterModel, source TrafficSource, routing RequestsRoutingStock, config DownstreamConfig) {
+	if config.CallsPerRequest < 0 {
+		panic(fmt.Errorf("calls per request must not be negative, but was %f", config.CallsPerRequest))
+	}
+
+	rbs := upstream.RoutingStock().(*requestsRoutingStock)
+	rbs.downstream = append(rbs.downstream, downstreamCall{
+		source:  source,
+		routing: routing,
+		config:  config,
+	})
+}
+
+func (rbs *requestsRoutingStock) callDownstream() {
+	for _, call := range rbs.downstream {
+		whole, fraction := math.Modf(call.config.CallsPerRequest)
+		calls := int(whole)
+		if fraction > 0 && rbs.env.Rand("downstream").Float64() < fraction {
+			calls++
+		}
+
+		delay := call.config.Delay
+		if delay <= 0 {
+			delay = 1 * time.Nanosecond
+		}
+
+		for i := 0; i < calls; i++ {
+			rbs.env.AddToSchedule(simulator.NewMovement(
+				"call_downstream",
+				rbs.env.CurrentMovementTime().Add(delay),
+				call.source,
+				call.routing,
+			))
+		}
+	}
+}
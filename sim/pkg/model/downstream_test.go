@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestDownstream(t *testing.T) {
+	spec.Run(t, "Downstream calls", testDownstream, spec.Report(report.Terminal{}))
+}
+
+func testDownstream(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var upstream, downstream ClusterModel
+	var source TrafficSource
+
+	callsScheduled := func() []simulator.Movement {
+		calls := make([]simulator.Movement, 0)
+		for _, mv := range envFake.Movements {
+			if mv.Kind() == "call_downstream" {
+				calls = append(calls, mv)
+			}
+		}
+		return calls
+	}
+
+	it.Before(func() {
+		envFake = NewFakeEnvironment()
+		envFake.TheTime = time.Unix(0, 100)
+		upstream = NewCluster(envFake, ClusterConfig{}, ReplicasConfig{})
+		downstream = NewCluster(envFake, ClusterConfig{}, ReplicasConfig{})
+		source = NewTrafficSource(envFake, downstream.RoutingStock(), RequestConfig{})
+	})
+
+	describe("AddDownstream()", func() {
+		it("panics for a negative number of calls", func() {
+			assert.Panics(t, func() {
+				AddDownstream(upstream, source, downstream.RoutingStock(), DownstreamConfig{CallsPerRequest: -1})
+			})
+		})
+	})
+
+	describe("when a request arrives upstream", func() {
+		it("schedules the calls after the delay", func() {
+			AddDownstream(upstream, source, downstream.RoutingStock(), DownstreamConfig{CallsPerRequest: 2, Delay: time.Millisecond})
+			require.NoError(t, upstream.RoutingStock().Add(simulator.NewEntity("request-1", "Request")))
+
+			calls := callsScheduled()
+			require.Len(t, calls, 2)
+			assert.Equal(t, time.Unix(0, 100).Add(time.Millisecond), calls[0].OccursAt())
+			assert.Equal(t, source, calls[0].From())
+			assert.Equal(t, downstream.RoutingStock(), calls[0].To())
+		})
+
+		it("calls straight away without a delay", func() {
+			AddDownstream(upstream, source, downstream.RoutingStock(), DownstreamConfig{CallsPerRequest: 1})
+			require.NoError(t, upstream.RoutingStock().Add(simulator.NewEntity("request-1", "Request")))
+
+			assert.Equal(t, time.Unix(0, 101), callsScheduled()[0].OccursAt())
+		})
+
+		it("makes up fractional calls by chance", func() {
+			AddDownstream(upstream, source, downstream.RoutingStock(), DownstreamConfig{CallsPerRequest: 0.5})
+			for i := 0; i < 1000; i++ {
+				require.NoError(t, upstream.RoutingStock().Add(simulator.NewEntity("request", "Request")))
+			}
+
+			assert.InDelta(t, 500, len(callsScheduled()), 60)
+		})
+	})
+}
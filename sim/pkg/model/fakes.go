@@ -19,6 +19,7 @@ import (
 	"context"
 	"github.com/josephburnett/sk-plugin/pkg/skplug"
 	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+	"math/rand"
 	"time"
 
 	"skenario/pkg/plugin"
@@ -26,11 +27,17 @@ import (
 )
 
 type FakeEnvironment struct {
-	Movements          []simulator.Movement
-	TheTime            time.Time
-	TheHaltTime        time.Time
-	TheCPUUtilizations []*simulator.CPUUtilization
-	ThePlugin          plugin.PluginPartition
+	Movements              []simulator.Movement
+	TheTime                time.Time
+	TheHaltTime            time.Time
+	TheCPUUtilizations     []*simulator.CPUUtilization
+	TheAutoscalerDecisions []*simulator.AutoscalerDecision
+	ThePlugin              plugin.PluginPartition
+	TheRandStreams         *simulator.RandStreams
+	TheNumbers             map[string]int
+	TheObservers           []simulator.Observer
+	TheSamplers            []simulator.Sampler
+	TheStocks              []simulator.Stock
 }
 
 func (fe *FakeEnvironment) Plugin() plugin.PluginPartition {
@@ -46,6 +53,26 @@ func (fe *FakeEnvironment) Run() (completed []simulator.CompletedMovement, ignor
 	return nil, nil, nil
 }
 
+func (fe *FakeEnvironment) RunUntil(until time.Time) (completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement, err error) {
+	return nil, nil, nil
+}
+
+func (fe *FakeEnvironment) RunUntilKind(kind simulator.MovementKind) (completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement, err error) {
+	return nil, nil, nil
+}
+
+func (fe *FakeEnvironment) Step() (stepped bool, err error) {
+	return false, nil
+}
+
+func (fe *FakeEnvironment) Snapshot() simulator.Snapshot {
+	return simulator.Snapshot{TakenAt: fe.TheTime, HaltAt: fe.TheHaltTime, Seed: fe.Seed(), Rand: fe.TheRandStreams.State()}
+}
+
+func (fe *FakeEnvironment) Restore(snapshot simulator.Snapshot) error {
+	return nil
+}
+
 func (fe *FakeEnvironment) CurrentMovementTime() time.Time {
 	return fe.TheTime
 }
@@ -66,9 +93,49 @@ func (fe *FakeEnvironment) AppendCPUUtilization(cpu *simulator.CPUUtilization) {
 	fe.TheCPUUtilizations = append(fe.TheCPUUtilizations, cpu)
 }
 
+func (fe *FakeEnvironment) AutoscalerDecisions() []*simulator.AutoscalerDecision {
+	return fe.TheAutoscalerDecisions
+}
+
+func (fe *FakeEnvironment) AppendAutoscalerDecision(decision *simulator.AutoscalerDecision) {
+	fe.TheAutoscalerDecisions = append(fe.TheAutoscalerDecisions, decision)
+}
+
+func (fe *FakeEnvironment) Seed() int64 {
+	return fe.TheRandStreams.Seed()
+}
+
+func (fe *FakeEnvironment) Rand(stream string) *rand.Rand {
+	return fe.TheRandStreams.Stream(stream)
+}
+
+func (fe *FakeEnvironment) NextNumber(sequence string) int {
+	if fe.TheNumbers == nil {
+		fe.TheNumbers = make(map[string]int)
+	}
+	fe.TheNumbers[sequence]++
+	return fe.TheNumbers[sequence]
+}
+
+func (fe *FakeEnvironment) AddObserver(observer simulator.Observer) {
+	fe.TheObservers = append(fe.TheObservers, observer)
+}
+
+func (fe *FakeEnvironment) AddSampler(interval time.Duration, sampler simulator.Sampler) {
+	fe.TheSamplers = append(fe.TheSamplers, sampler)
+}
+
+func (fe *FakeEnvironment) AddStock(stock simulator.Stock) {
+	fe.TheStocks = append(fe.TheStocks, stock)
+}
+
+func (fe *FakeEnvironment) DiscardMovements() {
+}
+
 func NewFakeEnvironment() *FakeEnvironment {
 	return &FakeEnvironment{
-		ThePlugin: NewFakePluginPartition(),
+		ThePlugin:      NewFakePluginPartition(),
+		TheRandStreams: simulator.NewRandStreams(1),
 	}
 }
 
@@ -123,6 +190,7 @@ type FakePluginPartition struct {
 	scaleTimes []int64
 	stats      []*proto.Stat
 	scaleTo    int32
+	scaleErr   error
 }
 
 func (fp *FakePluginPartition) Event(time int64, typ proto.EventType, object skplug.Object) error {
@@ -136,7 +204,7 @@ func (fp *FakePluginPartition) Stat(stat []*proto.Stat) error {
 
 func (fp *FakePluginPartition) Scale(time int64) (rec int32, err error) {
 	fp.scaleTimes = append(fp.scaleTimes, time)
-	return fp.scaleTo, nil
+	return fp.scaleTo, fp.scaleErr
 }
 
 func NewFakePluginPartition() *FakePluginPartition {
@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+
+	"skenario/pkg/simulator"
+)
+
+// ClusterInvariants gives the conservation laws that hold for a cluster throughout a run,
+// for use with a simulator.Validator. It must be called once the cluster's autoscaler has
+// been created, since the autoscaler places the first replica directly.
+func ClusterInvariants(cluster ClusterModel) []simulator.Invariant {
+	cm := cluster.(*clusterModel)
+
+	return []simulator.Invariant{
+		{Name: "requests_conserved", Observer: &requestConservation{cluster: cm, seen: make(map[simulator.Entity]bool)}},
+		{Name: "replicas_match_desired", Observer: newReplicaConservation(cm)},
+	}
+}
+
+// requestConservation checks that every request which has moved is in exactly one of the
+// routing, processing, complete or failed stocks.
+type requestConservation struct {
+	cluster *clusterModel
+	seen    map[simulator.Entity]bool
+}
+
+func (rc *requestConservation) MovementCompleted(completed simulator.CompletedMovement) error {
+	if completed.Moved.Kind() != "Request" {
+		return nil
+	}
+
+	// Every request arrives at routing first. Requests which have not are another service's.
+	if completed.Movement.To().Name() == rc.cluster.requestsInRouting.Name() {
+		rc.seen[completed.Moved] = true
+	}
+	if !rc.seen[completed.Moved] {
+		return nil
+	}
+
+	cm := rc.cluster
+	routing := cm.requestsInRouting.Count()
+	failed := cm.requestsFailed.Count() + cm.replicaSource.(*replicaSource).failedSink.Count()
+
+	var processing, complete uint64
+	for _, replicas := range []simulator.Stock{cm.replicasLaunching, cm.replicasActive, cm.replicasTerminating, cm.replicasTerminated} {
+		for _, e := range replicas.EntitiesInStock() {
+			replica := (*e).(*replicaEntity)
+			processing += replica.requestsProcessing.Count()
+			complete += replica.requestsComplete.Count()
+		}
+	}
+
+	held := routing + processing + complete + failed
+	if uint64(len(rc.seen)) != held {
+		return fmt.Errorf(
+			"%d requests have been created but %d are held (%d routing, %d processing, %d complete, %d failed)",
+			len(rc.seen), held, routing, processing, complete, failed,
+		)
+	}
+
+	return nil
+}
+
+func (rc *requestConservation) MovementIgnored(ignored simulator.IgnoredMovement) error {
+	return nil
+}
+
+// replicaConservation checks that the launching and active replicas make up the desired
+// number, once launches and terminations that have been scheduled but not yet happened are
+// allowed for. Replicas placed directly rather than through ReplicasDesired are counted
+// when the check is created and allowed for too.
+type replicaConservation struct {
+	cluster             *clusterModel
+	undesired           int64
+	pendingLaunches     int64
+	pendingTerminations int64
+}
+
+func (rc *replicaConservation) MovementCompleted(completed simulator.CompletedMovement) error {
+	if !rc.involves(completed.Movement) {
+		return nil
+	}
+
+	switch completed.Movement.Kind() {
+	case "increase_desired":
+		rc.pendingLaunches++
+	case "reduce_desired":
+		rc.pendingTerminations++
+	case "begin_launch":
+		rc.pendingLaunches--
+	case "terminate_launch", "terminate_active":
+		rc.pendingTerminations--
+	default:
+		return nil
+	}
+
+	cm := rc.cluster
+	launching := int64(cm.replicasLaunching.Count())
+	active := int64(cm.replicasActive.Count())
+	desired := int64(cm.replicasDesired.Count())
+
+	expected := desired + rc.undesired - rc.pendingLaunches + rc.pendingTerminations
+	if launching+active != expected {
+		return fmt.Errorf(
+			"%d replicas are launching and %d active, but %d desired with %d launches and %d terminations pending",
+			launching, active, desired, rc.pendingLaunches, rc.pendingTerminations,
+		)
+	}
+
+	return nil
+}
+
+// MovementIgnored leaves launches and terminations scheduled after the halt as pending,
+// since that is when they would have happened. Those which found their stock empty are
+// caught by the Validator itself.
+func (rc *replicaConservation) MovementIgnored(ignored simulator.IgnoredMovement) error {
+	return nil
+}
+
+// involves is whether a movement is to or from this cluster's desired, launching or active
+// replicas, rather than another service's.
+func (rc *replicaConservation) involves(movement simulator.Movement) bool {
+	cm := rc.cluster
+	for _, stock := range []simulator.Stock{cm.replicasDesired, cm.replicasLaunching, cm.replicasActive} {
+		if movement.From().Name() == stock.Name() || movement.To().Name() == stock.Name() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newReplicaConservation(cm *clusterModel) *replicaConservation {
+	return &replicaConservation{
+		cluster:   cm,
+		undesired: int64(cm.replicasLaunching.Count()+cm.replicasActive.Count()) - int64(cm.replicasDesired.Count()),
+	}
+}
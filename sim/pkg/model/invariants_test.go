@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestInvariants(t *testing.T) {
+	spec.Run(t, "Cluster invariants", testInvariants, spec.Report(report.Terminal{}))
+}
+
+func testInvariants(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var cluster ClusterModel
+	var rawCluster *clusterModel
+	var subject []simulator.Invariant
+	var elsewhere simulator.ThroughStock
+
+	it.Before(func() {
+		envFake = NewFakeEnvironment()
+		cluster = NewCluster(envFake, ClusterConfig{}, ReplicasConfig{time.Second, time.Second, 100})
+		rawCluster = cluster.(*clusterModel)
+		subject = ClusterInvariants(cluster)
+		elsewhere = simulator.NewThroughStock("elsewhere", "Anything")
+	})
+
+	invariant := func(name string) simulator.Observer {
+		for _, inv := range subject {
+			if inv.Name == name {
+				return inv.Observer
+			}
+		}
+		t.Fatalf("no invariant named '%s'", name)
+		return nil
+	}
+
+	describe("requests_conserved", func() {
+		var request simulator.Entity
+
+		it.Before(func() {
+			request = simulator.NewEntity("request-1", "Request")
+			require.NoError(t, rawCluster.requestsInRouting.Add(request))
+		})
+
+		it("holds when every request seen is in a stock", func() {
+			err := invariant("requests_conserved").MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("arrive_at_routing", envFake.TheTime, elsewhere, rawCluster.requestsInRouting),
+				Moved:    request,
+			})
+			assert.NoError(t, err)
+		})
+
+		it("is broken when a request seen has gone missing", func() {
+			observer := invariant("requests_conserved")
+			require.NoError(t, observer.MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("arrive_at_routing", envFake.TheTime, elsewhere, rawCluster.requestsInRouting),
+				Moved:    request,
+			}))
+
+			missing := simulator.NewEntity("request-2", "Request")
+			err := observer.MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("arrive_at_routing", envFake.TheTime, elsewhere, rawCluster.requestsInRouting),
+				Moved:    missing,
+			})
+			assert.EqualError(t, err, "2 requests have been created but 1 are held (1 routing, 0 processing, 0 complete, 0 failed)")
+		})
+
+		it("ignores requests which have not arrived at this cluster", func() {
+			err := invariant("requests_conserved").MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("arrive_at_routing", envFake.TheTime, elsewhere, elsewhere),
+				Moved:    simulator.NewEntity("request-2", "Request"),
+			})
+			assert.NoError(t, err)
+		})
+
+		it("ignores movements of other kinds of entity", func() {
+			err := invariant("requests_conserved").MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("begin_launch", envFake.TheTime, elsewhere, rawCluster.replicasLaunching),
+				Moved:    simulator.NewEntity("replica-1", "Replica"),
+			})
+			assert.NoError(t, err)
+		})
+	})
+
+	describe("replicas_match_desired", func() {
+		var desired simulator.Entity
+
+		it.Before(func() {
+			desired = simulator.NewEntity("desired-1", "Desired")
+			require.NoError(t, rawCluster.replicasDesired.Add(desired))
+		})
+
+		it("allows for launches that are scheduled but have not happened", func() {
+			err := invariant("replicas_match_desired").MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("increase_desired", envFake.TheTime, elsewhere, rawCluster.replicasDesired),
+				Moved:    desired,
+			})
+			assert.NoError(t, err)
+		})
+
+		it("ignores movements of another cluster's replicas", func() {
+			err := invariant("replicas_match_desired").MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("begin_launch", envFake.TheTime, elsewhere, elsewhere),
+				Moved:    simulator.NewEntity("replica-1", "Replica"),
+			})
+			assert.NoError(t, err)
+		})
+
+		it("is broken when a launch happens without a replica launching", func() {
+			observer := invariant("replicas_match_desired")
+			require.NoError(t, observer.MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("increase_desired", envFake.TheTime, elsewhere, rawCluster.replicasDesired),
+				Moved:    desired,
+			}))
+
+			err := observer.MovementCompleted(simulator.CompletedMovement{
+				Movement: simulator.NewMovement("begin_launch", envFake.TheTime, elsewhere, rawCluster.replicasLaunching),
+				Moved:    simulator.NewEntity("replica-1", "Replica"),
+			})
+			assert.EqualError(t, err, "0 replicas are launching and 0 active, but 1 desired with 0 launches and 0 terminations pending")
+		})
+	})
+}
@@ -15,8 +15,22 @@
 
 package model
 
-import "skenario/pkg/simulator"
+import (
+	"encoding/json"
+
+	"skenario/pkg/simulator"
+)
 
 type Model interface {
 	Env() simulator.Environment
 }
+
+// mustMarshal encodes the state saved by a stock, which is always possible.
+func mustMarshal(state interface{}) json.RawMessage {
+	data, err := json.Marshal(state)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
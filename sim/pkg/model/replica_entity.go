@@ -16,6 +16,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/josephburnett/sk-plugin/pkg/skplug"
 
@@ -47,8 +48,6 @@ type replicaEntity struct {
 	occupiedCPUCapacityMillisPerSecond float64
 }
 
-var replicaNum int
-
 func (re *replicaEntity) Activate() {
 	now := re.env.CurrentMovementTime().UnixNano()
 	err := re.env.Plugin().Event(now, proto.EventType_CREATE, &skplug.Pod{
@@ -113,18 +112,90 @@ func (re *replicaEntity) GetCPUCapacity() float64 {
 	return re.totalCPUCapacityMillisPerSecond
 }
 
+// OwnedStocks gives the replica's own stocks of requests, so that snapshots include them.
+func (re *replicaEntity) OwnedStocks() []simulator.Stock {
+	return []simulator.Stock{re.requestsProcessing, re.requestsComplete}
+}
+
+// ReplicaCPUCapacityMillisPerSecond is the CPU capacity of every replica.
+const ReplicaCPUCapacityMillisPerSecond = 100
+
 func NewReplicaEntity(env simulator.Environment, failedSink *simulator.SinkStock) ReplicaEntity {
-	replicaNum++
+	return newReplicaEntity(env, env.NextNumber("replica"), failedSink)
+}
 
+func newReplicaEntity(env simulator.Environment, number int, failedSink *simulator.SinkStock) *replicaEntity {
 	re := &replicaEntity{
 		env:                                env,
-		number:                             replicaNum,
-		totalCPUCapacityMillisPerSecond:    100,
+		number:                             number,
+		totalCPUCapacityMillisPerSecond:    ReplicaCPUCapacityMillisPerSecond,
 		occupiedCPUCapacityMillisPerSecond: 0,
 	}
 
-	re.requestsComplete = simulator.NewSinkStock(simulator.StockName(fmt.Sprintf("RequestsComplete [%d]", re.number)), "Request")
+	re.requestsComplete = NewRequestsFinishedStock(env, simulator.StockName(fmt.Sprintf("RequestsComplete [%d]", re.number)))
 	re.requestsProcessing = NewRequestsProcessingStock(env, re.number, re.requestsComplete, failedSink, &re.totalCPUCapacityMillisPerSecond, &re.occupiedCPUCapacityMillisPerSecond)
 
 	return re
 }
+
+// replicaState is what a stock saves of each replica it holds. The requests a replica is
+// processing or has completed are saved by its own stocks.
+type replicaState struct {
+	Number            int     `json:"number"`
+	OccupiedCPU       float64 `json:"occupied_cpu,omitempty"`
+	RequestsSinceStat int32   `json:"requests_since_stat,omitempty"`
+}
+
+// replicasStock is a plain stock of replicas, which saves them so that they can be
+// restored with their stocks.
+type replicasStock struct {
+	simulator.BoundedStock
+
+	source *replicaSource
+}
+
+func (rs *replicasStock) SaveState() json.RawMessage {
+	return saveReplicas(rs.EntitiesInStock())
+}
+
+func (rs *replicasStock) RestoreState(data json.RawMessage) error {
+	return restoreReplicas(rs.BoundedStock, rs.source, data)
+}
+
+func saveReplicas(entities []*simulator.Entity) json.RawMessage {
+	states := make([]replicaState, len(entities))
+	for i, e := range entities {
+		re := (*e).(*replicaEntity)
+		states[i] = replicaState{
+			Number:            re.number,
+			OccupiedCPU:       re.occupiedCPUCapacityMillisPerSecond,
+			RequestsSinceStat: re.numRequestsSinceStat,
+		}
+	}
+
+	return mustMarshal(states)
+}
+
+// restoreReplicas replaces the replicas in stock with new ones made by source. Their
+// stocks are empty until they are restored in turn.
+func restoreReplicas(stock simulator.BoundedStock, source *replicaSource, data json.RawMessage) error {
+	if source == nil {
+		return fmt.Errorf("replicas cannot be restored without a replica source")
+	}
+
+	var states []replicaState
+	err := json.Unmarshal(data, &states)
+	if err != nil {
+		return err
+	}
+
+	replicas := make([]simulator.Entity, len(states))
+	for i, state := range states {
+		re := source.replica(state.Number)
+		re.occupiedCPUCapacityMillisPerSecond = state.OccupiedCPU
+		re.numRequestsSinceStat = state.RequestsSinceStat
+		replicas[i] = re
+	}
+
+	return stock.RestoreEntities(replicas, 0)
+}
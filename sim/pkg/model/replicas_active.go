@@ -16,6 +16,8 @@
 package model
 
 import (
+	"encoding/json"
+
 	"skenario/pkg/simulator"
 )
 
@@ -24,28 +26,24 @@ type ReplicasActiveStock interface {
 }
 
 type replicasActiveStock struct {
-	env      simulator.Environment
-	delegate simulator.ThroughStock
-}
-
-func (ras *replicasActiveStock) Name() simulator.StockName {
-	return ras.delegate.Name()
-}
+	simulator.BoundedStock
 
-func (ras *replicasActiveStock) KindStocked() simulator.EntityKind {
-	return ras.delegate.KindStocked()
+	env    simulator.Environment
+	source *replicaSource // restores replicas held here
 }
 
-func (ras *replicasActiveStock) Count() uint64 {
-	return ras.delegate.Count()
+func (ras *replicasActiveStock) SaveState() json.RawMessage {
+	return saveReplicas(ras.EntitiesInStock())
 }
 
-func (ras *replicasActiveStock) EntitiesInStock() []*simulator.Entity {
-	return ras.delegate.EntitiesInStock()
+// RestoreState gives back the active replicas without activating them again, since the
+// plugin is restored separately.
+func (ras *replicasActiveStock) RestoreState(data json.RawMessage) error {
+	return restoreReplicas(ras.BoundedStock, ras.source, data)
 }
 
 func (ras *replicasActiveStock) Remove() simulator.Entity {
-	entity := ras.delegate.Remove()
+	entity := ras.BoundedStock.Remove()
 	if entity == nil {
 		return nil
 	}
@@ -59,12 +57,12 @@ func (ras *replicasActiveStock) Remove() simulator.Entity {
 func (ras *replicasActiveStock) Add(entity simulator.Entity) error {
 	replica := entity.(Replica)
 	replica.Activate()
-	return ras.delegate.Add(entity)
+	return ras.BoundedStock.Add(entity)
 }
 
 func NewReplicasActiveStock(env simulator.Environment) ReplicasActiveStock {
 	return &replicasActiveStock{
-		env:      env,
-		delegate: simulator.NewThroughStock("ReplicasActive", "Replica"),
+		env:          env,
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, "ReplicasActive"), "Replica", simulator.StockConfig{}),
 	}
 }
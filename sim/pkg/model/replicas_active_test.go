@@ -43,10 +43,10 @@ func testReplicasActive(t *testing.T, describe spec.G, it spec.S) {
 	})
 
 	describe("NewReplicasActiveStock()", func() {
-		it("creates a delegate ThroughStock", func() {
-			assert.NotNil(t, rawSubject.delegate)
-			assert.Equal(t, simulator.StockName("ReplicasActive"), rawSubject.delegate.Name())
-			assert.Equal(t, simulator.EntityKind("Replica"), rawSubject.delegate.KindStocked())
+		it("creates a BoundedStock", func() {
+			assert.NotNil(t, rawSubject.BoundedStock)
+			assert.Equal(t, simulator.StockName("ReplicasActive"), rawSubject.BoundedStock.Name())
+			assert.Equal(t, simulator.EntityKind("Replica"), rawSubject.BoundedStock.KindStocked())
 		})
 	})
 
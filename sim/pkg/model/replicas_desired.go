@@ -31,6 +31,7 @@ type RequestConfig struct {
 	CPUTimeMillis int
 	IOTimeMillis  int
 	Timeout       time.Duration
+	Retry         RetryConfig
 }
 
 type ReplicasDesiredStock interface {
@@ -38,9 +39,10 @@ type ReplicasDesiredStock interface {
 }
 
 type replicasDesiredStock struct {
+	simulator.BoundedStock
+
 	env                 simulator.Environment
 	config              ReplicasConfig
-	delegate            simulator.ThroughStock
 	replicaSource       ReplicaSource
 	replicasLaunching   simulator.ThroughStock
 	replicasActive      simulator.ThroughStock
@@ -48,24 +50,8 @@ type replicasDesiredStock struct {
 	launchingCount      uint64
 }
 
-func (rds *replicasDesiredStock) Name() simulator.StockName {
-	return rds.delegate.Name()
-}
-
-func (rds *replicasDesiredStock) KindStocked() simulator.EntityKind {
-	return rds.delegate.KindStocked()
-}
-
-func (rds *replicasDesiredStock) Count() uint64 {
-	return rds.delegate.Count()
-}
-
-func (rds *replicasDesiredStock) EntitiesInStock() []*simulator.Entity {
-	return rds.delegate.EntitiesInStock()
-}
-
 func (rds *replicasDesiredStock) Remove() simulator.Entity {
-	ent := rds.delegate.Remove()
+	ent := rds.BoundedStock.Remove()
 	if ent == nil {
 		return nil
 	}
@@ -91,7 +77,7 @@ func (rds *replicasDesiredStock) Remove() simulator.Entity {
 }
 
 func (rds *replicasDesiredStock) Add(entity simulator.Entity) error {
-	err := rds.delegate.Add(entity)
+	err := rds.BoundedStock.Add(entity)
 	if err != nil {
 		return err
 	}
@@ -117,7 +103,7 @@ func NewReplicasDesiredStock(env simulator.Environment, config ReplicasConfig, r
 	return &replicasDesiredStock{
 		env:                 env,
 		config:              config,
-		delegate:            simulator.NewThroughStock("ReplicasDesired", "Desired"),
+		BoundedStock:        simulator.NewBoundedStock(simulator.ServiceStockName(env, "ReplicasDesired"), "Desired", simulator.StockConfig{}),
 		replicaSource:       replicaSource,
 		replicasLaunching:   replicasLaunching,
 		replicasActive:      replicasActive,
@@ -106,7 +106,7 @@ func testReplicasDesired(t *testing.T, describe spec.G, it spec.S) {
 
 	describe("Remove()", func() {
 		it.Before(func() {
-			rawSubject.delegate.Add(simulator.NewEntity("Removeable", "Desired"))
+			rawSubject.BoundedStock.Add(simulator.NewEntity("Removeable", "Desired"))
 		})
 
 		describe("there are launching replicas but no active replicas", func() {
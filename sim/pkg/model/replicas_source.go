@@ -27,10 +27,11 @@ type replicaSource struct {
 	env           simulator.Environment
 	maxReplicaRPS int64
 	failedSink    simulator.SinkStock
+	routingStock  RequestsRoutingStock
 }
 
 func (rs *replicaSource) Name() simulator.StockName {
-	return "ReplicaSource"
+	return simulator.ServiceStockName(rs.env, "ReplicaSource")
 }
 
 func (rs *replicaSource) KindStocked() simulator.EntityKind {
@@ -46,13 +47,23 @@ func (rs *replicaSource) EntitiesInStock() []*simulator.Entity {
 }
 
 func (rs *replicaSource) Remove() simulator.Entity {
-	return NewReplicaEntity(rs.env, &rs.failedSink)
+	return rs.replica(rs.env.NextNumber("replica"))
+}
+
+// replica creates a replica whose requests can be restored through the routing stock.
+func (rs *replicaSource) replica(number int) *replicaEntity {
+	re := newReplicaEntity(rs.env, number, &rs.failedSink)
+	if rps, ok := re.requestsProcessing.(*requestsProcessingStock); ok {
+		rps.routingStock = rs.routingStock
+	}
+
+	return re
 }
 
 func NewReplicaSource(env simulator.Environment, maxReplicaRPS int64) ReplicaSource {
 	return &replicaSource{
 		env:           env,
 		maxReplicaRPS: maxReplicaRPS,
-		failedSink:    simulator.NewSinkStock("RequestsFailed", "Request"),
+		failedSink:    NewRequestsFailedStock(env, "RequestsFailed"),
 	}
 }
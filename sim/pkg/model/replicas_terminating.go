@@ -16,6 +16,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"skenario/pkg/simulator"
 	"time"
@@ -26,34 +27,24 @@ type ReplicasTerminatingStock interface {
 }
 
 type replicasTerminatingStock struct {
+	simulator.BoundedStock
+
 	env                simulator.Environment
 	config             ReplicasConfig
-	delegate           simulator.ThroughStock
 	replicasTerminated simulator.SinkStock
+	source             *replicaSource // restores replicas held here
 }
 
-func (rts *replicasTerminatingStock) Name() simulator.StockName {
-	return rts.delegate.Name()
-}
-
-func (rts *replicasTerminatingStock) KindStocked() simulator.EntityKind {
-	return rts.delegate.KindStocked()
-}
-
-func (rts *replicasTerminatingStock) Count() uint64 {
-	return rts.delegate.Count()
-}
-
-func (rts *replicasTerminatingStock) EntitiesInStock() []*simulator.Entity {
-	return rts.delegate.EntitiesInStock()
+func (rts *replicasTerminatingStock) SaveState() json.RawMessage {
+	return saveReplicas(rts.EntitiesInStock())
 }
 
-func (rts *replicasTerminatingStock) Remove() simulator.Entity {
-	return rts.delegate.Remove()
+func (rts *replicasTerminatingStock) RestoreState(data json.RawMessage) error {
+	return restoreReplicas(rts.BoundedStock, rts.source, data)
 }
 
 func (rts *replicasTerminatingStock) Add(entity simulator.Entity) error {
-	err := rts.delegate.Add(entity)
+	err := rts.BoundedStock.Add(entity)
 	if err != nil {
 		return fmt.Errorf("could not add entity (%+v) to ReplicasTerminating stock: %s", entity, err.Error())
 	}
@@ -66,7 +57,7 @@ func (rts *replicasTerminatingStock) Add(entity simulator.Entity) error {
 	rts.env.AddToSchedule(simulator.NewMovement(
 		"finish_terminating",
 		terminateAt,
-		rts.delegate,
+		rts,
 		rts.replicasTerminated,
 	))
 
@@ -77,7 +68,7 @@ func NewReplicasTerminatingStock(env simulator.Environment, config ReplicasConfi
 	return &replicasTerminatingStock{
 		env:                env,
 		config:             config,
-		delegate:           simulator.NewThroughStock("ReplicasTerminating", "Replica"),
+		BoundedStock:       simulator.NewBoundedStock(simulator.ServiceStockName(env, "ReplicasTerminating"), "Replica", simulator.StockConfig{}),
 		replicasTerminated: replicasTerminated,
 	}
 }
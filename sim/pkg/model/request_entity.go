@@ -36,11 +36,16 @@ type requestEntity struct {
 	routingStock                         RequestsRoutingStock
 	utilizationForRequestMillisPerSecond *float64
 	startTime                            *time.Time
+	users                                UsersWaitingStock // set when sent by a closed-loop user
+	retrier                              *retrier          // set when failed attempts may be retried
+	attempt                              int
 }
 
-var reqNumber int
-
 func (re *requestEntity) Name() simulator.EntityName {
+	if re.attempt > 1 {
+		return simulator.EntityName(fmt.Sprintf("request-%d-attempt-%d", re.number, re.attempt))
+	}
+
 	return simulator.EntityName(fmt.Sprintf("request-%d", re.number))
 }
 
@@ -48,14 +53,100 @@ func (re *requestEntity) Kind() simulator.EntityKind {
 	return "Request"
 }
 
+// nextAttempt creates a retry of this request, sharing its number so that every
+// attempt can be traced back to the original.
+func (re *requestEntity) nextAttempt() *requestEntity {
+	utilizationForRequest := 0.0
+	return &requestEntity{
+		env:                                  re.env,
+		number:                               re.number,
+		routingStock:                         re.routingStock,
+		requestConfig:                        re.requestConfig,
+		utilizationForRequestMillisPerSecond: &utilizationForRequest,
+		users:                                re.users,
+		retrier:                              re.retrier,
+		attempt:                              re.attempt + 1,
+	}
+}
+
 func NewRequestEntity(env simulator.Environment, routingStock RequestsRoutingStock, requestConfig RequestConfig) RequestEntity {
-	reqNumber++
 	utilizationForRequest := 0.0
 	return &requestEntity{
 		env:                                  env,
-		number:                               reqNumber,
+		number:                               env.NextNumber("request"),
 		routingStock:                         routingStock,
 		requestConfig:                        requestConfig,
 		utilizationForRequestMillisPerSecond: &utilizationForRequest,
+		attempt:                              1,
+	}
+}
+
+// requestState is what a stock saves of each request it holds. Requests are restored by
+// the routing stock that they were sent to, which gives them their configuration.
+type requestState struct {
+	Number      int        `json:"number"`
+	Attempt     int        `json:"attempt"`
+	Utilization float64    `json:"utilization,omitempty"`
+	StartTime   *time.Time `json:"start_time,omitempty"`
+	User        bool       `json:"user,omitempty"`
+}
+
+func saveRequests(entities []*simulator.Entity) []requestState {
+	states := make([]requestState, len(entities))
+	for i, e := range entities {
+		re := (*e).(*requestEntity)
+		states[i] = requestState{
+			Number:      re.number,
+			Attempt:     re.attempt,
+			Utilization: *re.utilizationForRequestMillisPerSecond,
+			User:        re.users != nil,
+		}
+		if re.startTime != nil {
+			startTime := re.startTime.UTC()
+			states[i].StartTime = &startTime
+		}
 	}
+
+	return states
+}
+
+// restoreRequest recreates a request that was sent to routingStock.
+func restoreRequest(routingStock RequestsRoutingStock, state requestState) (*requestEntity, error) {
+	rbs, ok := routingStock.(*requestsRoutingStock)
+	if !ok || rbs.source == nil {
+		return nil, fmt.Errorf("request-%d cannot be restored without the traffic source of its routing stock", state.Number)
+	}
+
+	utilizationForRequest := state.Utilization
+	re := &requestEntity{
+		env:                                  rbs.env,
+		number:                               state.Number,
+		routingStock:                         rbs,
+		requestConfig:                        rbs.source.requestConfig,
+		utilizationForRequestMillisPerSecond: &utilizationForRequest,
+		startTime:                            state.StartTime,
+		retrier:                              rbs.source.retrier,
+		attempt:                              state.Attempt,
+	}
+	if state.User {
+		if rbs.source.users == nil {
+			return nil, fmt.Errorf("request-%d was sent by a user, but its traffic source has none", state.Number)
+		}
+		re.users = rbs.source.users
+	}
+
+	return re, nil
+}
+
+func restoreRequests(routingStock RequestsRoutingStock, states []requestState) ([]simulator.Entity, error) {
+	entities := make([]simulator.Entity, len(states))
+	for i, state := range states {
+		re, err := restoreRequest(routingStock, state)
+		if err != nil {
+			return nil, err
+		}
+		entities[i] = re
+	}
+
+	return entities, nil
 }
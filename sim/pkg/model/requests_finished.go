@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"skenario/pkg/simulator"
+)
+
+// RequestsFinishedStock is where requests end up once they have completed or failed.
+// Failed requests may be retried according to their RetryConfig. Otherwise, requests
+// sent on behalf of a closed-loop user are reported back to that user.
+type RequestsFinishedStock interface {
+	simulator.SinkStock
+}
+
+type requestsFinishedStock struct {
+	simulator.BoundedStock
+
+	env    simulator.Environment
+	failed bool
+}
+
+func (rfs *requestsFinishedStock) Add(entity simulator.Entity) error {
+	err := rfs.BoundedStock.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	req, ok := entity.(*requestEntity)
+	if !ok {
+		return nil
+	}
+
+	if rfs.failed && req.retrier != nil && req.retrier.retry(req) {
+		return nil
+	}
+
+	if req.users != nil {
+		req.users.RequestFinished()
+	}
+
+	return nil
+}
+
+func NewRequestsFinishedStock(env simulator.Environment, name simulator.StockName) RequestsFinishedStock {
+	return &requestsFinishedStock{
+		env:          env,
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, name), "Request", simulator.StockConfig{}),
+	}
+}
+
+func NewRequestsFailedStock(env simulator.Environment, name simulator.StockName) RequestsFinishedStock {
+	return &requestsFinishedStock{
+		env:          env,
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, name), "Request", simulator.StockConfig{}),
+		failed:       true,
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+
+	"skenario/pkg/simulator"
+)
+
+func TestRequestsFinished(t *testing.T) {
+	spec.Run(t, "RequestsFinished stock", testRequestsFinished, spec.Report(report.Terminal{}))
+}
+
+func testRequestsFinished(t *testing.T, describe spec.G, it spec.S) {
+	var subject RequestsFinishedStock
+	var envFake *FakeEnvironment
+	var routingStock RequestsRoutingStock
+	var request RequestEntity
+
+	it.Before(func() {
+		envFake = NewFakeEnvironment()
+		routingStock = NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), simulator.NewSinkStock("RequestsFailed", "Request"))
+		request = NewRequestEntity(envFake, routingStock, RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
+		subject = NewRequestsFinishedStock(envFake, "RequestsComplete [1]")
+	})
+
+	describe("Name()", func() {
+		it("uses the name it was given", func() {
+			assert.Equal(t, simulator.StockName("RequestsComplete [1]"), subject.Name())
+		})
+	})
+
+	describe("KindStocked()", func() {
+		it("stocks Requests", func() {
+			assert.Equal(t, simulator.EntityKind("Request"), subject.KindStocked())
+		})
+	})
+
+	describe("Add()", func() {
+		describe("when the request was not sent by a virtual user", func() {
+			it.Before(func() {
+				err := subject.Add(request)
+				assert.NoError(t, err)
+			})
+
+			it("adds the request", func() {
+				assert.Equal(t, uint64(1), subject.Count())
+			})
+
+			it("does not schedule any movements", func() {
+				assert.Len(t, envFake.Movements, 0)
+			})
+		})
+
+		describe("when the request was sent by a virtual user", func() {
+			var waiting UsersWaitingStock
+
+			it.Before(func() {
+				_, waiting = NewVirtualUsers(envFake, NewTrafficSource(envFake, routingStock, RequestConfig{}), routingStock, func() time.Duration { return time.Second })
+				request.(*requestEntity).users = waiting
+
+				err := subject.Add(request)
+				assert.NoError(t, err)
+			})
+
+			it("adds the request", func() {
+				assert.Equal(t, uint64(1), subject.Count())
+			})
+
+			it("tells the user to stop waiting", func() {
+				assert.Len(t, envFake.Movements, 1)
+				assert.Equal(t, simulator.MovementKind("finish_waiting"), envFake.Movements[0].Kind())
+				assert.Equal(t, waiting, envFake.Movements[0].From())
+			})
+		})
+
+		describe("when given something other than a request", func() {
+			it("returns an error", func() {
+				err := subject.Add(simulator.NewEntity("replica", "Replica"))
+				assert.Error(t, err)
+			})
+		})
+	})
+}
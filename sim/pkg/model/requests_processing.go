@@ -16,6 +16,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
@@ -30,35 +31,55 @@ type RequestsProcessingStock interface {
 }
 
 type requestsProcessingStock struct {
+	simulator.BoundedStock
+
 	env                                simulator.Environment
-	delegate                           simulator.ThroughStock
 	replicaNumber                      int
 	requestsComplete                   simulator.SinkStock
 	requestsFailed                     *simulator.SinkStock
 	numRequestsSinceLast               int32
 	totalCPUCapacityMillisPerSecond    *float64
 	occupiedCPUCapacityMillisPerSecond *float64
+	routingStock                       RequestsRoutingStock // restores requests held here
 }
 
-func (rps *requestsProcessingStock) Name() simulator.StockName {
-	name := fmt.Sprintf("%s [%d]", rps.delegate.Name(), rps.replicaNumber)
-	return simulator.StockName(name)
+type processingState struct {
+	RequestsSinceLast int32          `json:"requests_since_last,omitempty"`
+	Requests          []requestState `json:"requests,omitempty"`
 }
 
-func (rps *requestsProcessingStock) KindStocked() simulator.EntityKind {
-	return rps.delegate.KindStocked()
+func (rps *requestsProcessingStock) SaveState() json.RawMessage {
+	return mustMarshal(processingState{
+		RequestsSinceLast: rps.numRequestsSinceLast,
+		Requests:          saveRequests(rps.EntitiesInStock()),
+	})
 }
 
-func (rps *requestsProcessingStock) Count() uint64 {
-	return rps.delegate.Count()
+// RestoreState gives back the requests being processed. The CPU they occupy is restored
+// with their replica.
+func (rps *requestsProcessingStock) RestoreState(data json.RawMessage) error {
+	var state processingState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	requests, err := restoreRequests(rps.routingStock, state.Requests)
+	if err != nil {
+		return err
+	}
+	rps.numRequestsSinceLast = state.RequestsSinceLast
+
+	return rps.BoundedStock.RestoreEntities(requests, 0)
 }
 
-func (rps *requestsProcessingStock) EntitiesInStock() []*simulator.Entity {
-	return rps.delegate.EntitiesInStock()
+func (rps *requestsProcessingStock) Name() simulator.StockName {
+	name := fmt.Sprintf("%s [%d]", rps.BoundedStock.Name(), rps.replicaNumber)
+	return simulator.StockName(name)
 }
 
 func (rps *requestsProcessingStock) Remove() simulator.Entity {
-	request := rps.delegate.Remove().(*requestEntity)
+	request := rps.BoundedStock.Remove().(*requestEntity)
 	*rps.occupiedCPUCapacityMillisPerSecond -= *request.utilizationForRequestMillisPerSecond
 	return request
 }
@@ -97,7 +118,7 @@ func (rps *requestsProcessingStock) Add(entity simulator.Entity) error {
 		))
 	}
 
-	return rps.delegate.Add(entity)
+	return rps.BoundedStock.Add(entity)
 }
 
 func (rps *requestsProcessingStock) calculateCPUUtilizationForRequest(request requestEntity, totalTime *time.Duration, isRequestSuccessful *bool) {
@@ -120,7 +141,7 @@ func (rps *requestsProcessingStock) calculateCPUUtilizationForRequest(request re
 		//step 5 Add  this utilization to occupied cpu capacity, we'll subtract it Remove() method
 		*rps.occupiedCPUCapacityMillisPerSecond += utilizationForRequestMillisPerSecond
 
-		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		rng := rps.env.Rand("requests_processing")
 
 		//step 6 Calculate currentUtilization in percentage
 		currentUtilization := *rps.occupiedCPUCapacityMillisPerSecond * 100 / *rps.totalCPUCapacityMillisPerSecond
@@ -144,7 +165,7 @@ func NewRequestsProcessingStock(env simulator.Environment, replicaNumber int, re
 	requestFailed *simulator.SinkStock, totalCPUCapacityMillisPerSecond *float64, occupiedCPUCapacityMillisPerSecond *float64) RequestsProcessingStock {
 	return &requestsProcessingStock{
 		env:                                env,
-		delegate:                           simulator.NewThroughStock("RequestsProcessing", "Request"),
+		BoundedStock:                       simulator.NewBoundedStock(simulator.ServiceStockName(env, "RequestsProcessing"), "Request", simulator.StockConfig{}),
 		replicaNumber:                      replicaNumber,
 		requestsComplete:                   requestComplete,
 		requestsFailed:                     requestFailed,
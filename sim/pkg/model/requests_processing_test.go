@@ -57,10 +57,10 @@ func testRequestsProcessing(t *testing.T, describe spec.G, it spec.S) {
 			assert.Equal(t, simulator.EntityKind("Request"), rawSubject.requestsComplete.KindStocked())
 		})
 
-		it("creates a delegate ThroughStock", func() {
-			assert.NotNil(t, rawSubject.delegate)
-			assert.Equal(t, simulator.StockName("RequestsProcessing"), rawSubject.delegate.Name())
-			assert.Equal(t, simulator.EntityKind("Request"), rawSubject.delegate.KindStocked())
+		it("creates a BoundedStock", func() {
+			assert.NotNil(t, rawSubject.BoundedStock)
+			assert.Equal(t, simulator.StockName("RequestsProcessing"), rawSubject.BoundedStock.Name())
+			assert.Equal(t, simulator.EntityKind("Request"), rawSubject.BoundedStock.KindStocked())
 		})
 	})
 
@@ -16,6 +16,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"skenario/pkg/simulator"
@@ -26,37 +27,49 @@ type RequestsRoutingStock interface {
 }
 
 type requestsRoutingStock struct {
+	simulator.BoundedStock
+
 	env            simulator.Environment
-	delegate       simulator.ThroughStock
 	replicas       ReplicasActiveStock
 	requestsFailed simulator.SinkStock
 	countRequests  int
+	downstream     []downstreamCall
+	source         *trafficSource // restores requests sent here
 }
 
-func (rbs *requestsRoutingStock) Name() simulator.StockName {
-	return rbs.delegate.Name()
+type routingState struct {
+	CountRequests int            `json:"count_requests"`
+	Requests      []requestState `json:"requests,omitempty"`
 }
 
-func (rbs *requestsRoutingStock) KindStocked() simulator.EntityKind {
-	return rbs.delegate.KindStocked()
+func (rbs *requestsRoutingStock) SaveState() json.RawMessage {
+	return mustMarshal(routingState{
+		CountRequests: rbs.countRequests,
+		Requests:      saveRequests(rbs.EntitiesInStock()),
+	})
 }
 
-func (rbs *requestsRoutingStock) Count() uint64 {
-	return rbs.delegate.Count()
-}
+func (rbs *requestsRoutingStock) RestoreState(data json.RawMessage) error {
+	var state routingState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
 
-func (rbs *requestsRoutingStock) EntitiesInStock() []*simulator.Entity {
-	return rbs.delegate.EntitiesInStock()
-}
+	requests, err := restoreRequests(rbs, state.Requests)
+	if err != nil {
+		return err
+	}
+	rbs.countRequests = state.CountRequests
 
-func (rbs *requestsRoutingStock) Remove() simulator.Entity {
-	return rbs.delegate.Remove()
+	return rbs.BoundedStock.RestoreEntities(requests, 0)
 }
 
 func (rbs *requestsRoutingStock) Add(entity simulator.Entity) error {
-	addResult := rbs.delegate.Add(entity)
+	addResult := rbs.BoundedStock.Add(entity)
 
 	rbs.countRequests++
+	rbs.callDownstream()
 
 	countReplicas := rbs.replicas.Count()
 	if countReplicas > 0 {
@@ -84,7 +97,7 @@ func (rbs *requestsRoutingStock) Add(entity simulator.Entity) error {
 func NewRequestsRoutingStock(env simulator.Environment, replicas ReplicasActiveStock, requestsFailed simulator.SinkStock) RequestsRoutingStock {
 	return &requestsRoutingStock{
 		env:            env,
-		delegate:       simulator.NewThroughStock("RequestsRouting", "Request"),
+		BoundedStock:   simulator.NewBoundedStock(simulator.ServiceStockName(env, "RequestsRouting"), "Request", simulator.StockConfig{}),
 		replicas:       replicas,
 		requestsFailed: requestsFailed,
 		countRequests:  0,
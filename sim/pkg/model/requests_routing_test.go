@@ -49,10 +49,10 @@ func testRequestsRouting(t *testing.T, describe spec.G, it spec.S) {
 			rawSubject = subject.(*requestsRoutingStock)
 		})
 
-		it("creates a delegate ThroughStock", func() {
-			assert.NotNil(t, rawSubject.delegate)
-			assert.Equal(t, simulator.StockName("RequestsRouting"), rawSubject.delegate.Name())
-			assert.Equal(t, simulator.EntityKind("Request"), rawSubject.delegate.KindStocked())
+		it("creates a BoundedStock", func() {
+			assert.NotNil(t, rawSubject.BoundedStock)
+			assert.Equal(t, simulator.StockName("RequestsRouting"), rawSubject.BoundedStock.Name())
+			assert.Equal(t, simulator.EntityKind("Request"), rawSubject.BoundedStock.KindStocked())
 		})
 	})
 
@@ -0,0 +1,218 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// RetryConfig describes how clients retry failed requests. MaxAttempts includes the
+// first attempt, so values below 2 disable retries.
+//
+// Backoff is either "fixed" (the default), which waits InitialBackoff before every retry,
+// or "exponential", which doubles the wait after each attempt up to MaxBackoff (if set).
+// Jitter randomly lengthens or shortens each wait by up to that fraction of itself.
+// BudgetRatio limits retries to a fraction of first attempts made so far; zero means
+// that retries are unlimited.
+//
+// Each attempt is its own request entity, so response times are per-attempt latencies
+// measured from when that attempt was sent, not from when the original request was.
+type RetryConfig struct {
+	MaxAttempts    int           `json:"max_attempts"`
+	Backoff        string        `json:"backoff,omitempty"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff,omitempty"`
+	Jitter         float64       `json:"jitter,omitempty"`
+	BudgetRatio    float64       `json:"budget_ratio,omitempty"`
+}
+
+type retrier struct {
+	env           simulator.Environment
+	config        RetryConfig
+	routingStock  RequestsRoutingStock
+	source        *retrySource
+	firstAttempts int
+	retries       int
+}
+
+// retry schedules a new attempt for a failed request, returning false if the policy
+// or the retry budget does not allow one.
+func (r *retrier) retry(failed *requestEntity) bool {
+	if failed.attempt >= r.config.MaxAttempts {
+		return false
+	}
+
+	if r.config.BudgetRatio > 0 && float64(r.retries+1) > r.config.BudgetRatio*float64(r.firstAttempts) {
+		return false
+	}
+	r.retries++
+
+	dueAt := r.env.CurrentMovementTime().Add(r.backoff(failed.attempt))
+	if r.env.AddToSchedule(simulator.NewMovement("retry_request", dueAt, r.source, r.routingStock)) {
+		r.source.hold(failed.nextAttempt(), dueAt)
+	}
+
+	return true
+}
+
+func (r *retrier) backoff(failedAttempt int) time.Duration {
+	wait := float64(r.config.InitialBackoff)
+
+	if r.config.Backoff == "exponential" {
+		wait = wait * math.Pow(2, float64(failedAttempt-1))
+		if r.config.MaxBackoff > 0 && wait > float64(r.config.MaxBackoff) {
+			wait = float64(r.config.MaxBackoff)
+		}
+	}
+
+	if r.config.Jitter > 0 {
+		wait = wait * (1 + r.config.Jitter*(2*r.env.Rand("retries").Float64()-1))
+	}
+
+	if wait < 1 {
+		return 1 * time.Nanosecond
+	}
+
+	return time.Duration(wait)
+}
+
+func newRetrier(env simulator.Environment, config RetryConfig, routingStock RequestsRoutingStock) *retrier {
+	if config.MaxAttempts < 2 {
+		return nil
+	}
+
+	r := &retrier{
+		env:          env,
+		config:       config,
+		routingStock: routingStock,
+	}
+	r.source = &retrySource{env: env, retrier: r}
+
+	return r
+}
+
+// retrySource holds attempts waiting out their backoff. Backoffs vary, so attempts
+// are not due in the order that they were held; Remove gives the one due soonest,
+// which is the one whose retry_request movement is being run.
+type retrySource struct {
+	env     simulator.Environment
+	retrier *retrier
+	waiting []waitingAttempt
+}
+
+type waitingAttempt struct {
+	attempt *requestEntity
+	dueAt   time.Time
+}
+
+func (rs *retrySource) Name() simulator.StockName {
+	return simulator.ServiceStockName(rs.env, "RetrySource")
+}
+
+func (rs *retrySource) KindStocked() simulator.EntityKind {
+	return "Request"
+}
+
+func (rs *retrySource) Count() uint64 {
+	return uint64(len(rs.waiting))
+}
+
+func (rs *retrySource) EntitiesInStock() []*simulator.Entity {
+	entities := make([]*simulator.Entity, len(rs.waiting))
+	for i := range rs.waiting {
+		var e simulator.Entity = rs.waiting[i].attempt
+		entities[i] = &e
+	}
+	return entities
+}
+
+func (rs *retrySource) Remove() simulator.Entity {
+	if len(rs.waiting) == 0 {
+		return nil
+	}
+
+	next := rs.waiting[0]
+	rs.waiting = rs.waiting[1:]
+	return next.attempt
+}
+
+// hold keeps an attempt until it is due. Attempts due at the same time keep the order
+// that they were held in, as their movements do.
+func (rs *retrySource) hold(attempt *requestEntity, dueAt time.Time) {
+	i := sort.Search(len(rs.waiting), func(i int) bool {
+		return rs.waiting[i].dueAt.After(dueAt)
+	})
+
+	rs.waiting = append(rs.waiting, waitingAttempt{})
+	copy(rs.waiting[i+1:], rs.waiting[i:])
+	rs.waiting[i] = waitingAttempt{attempt: attempt, dueAt: dueAt}
+}
+
+// retryState is what a retrySource saves: the attempts it holds and its retrier's budget.
+type retryState struct {
+	FirstAttempts int              `json:"first_attempts"`
+	Retries       int              `json:"retries"`
+	Waiting       []waitingRequest `json:"waiting,omitempty"`
+}
+
+type waitingRequest struct {
+	Request requestState `json:"request"`
+	DueAt   time.Time    `json:"due_at"`
+}
+
+func (rs *retrySource) SaveState() json.RawMessage {
+	state := retryState{
+		FirstAttempts: rs.retrier.firstAttempts,
+		Retries:       rs.retrier.retries,
+	}
+	for _, w := range rs.waiting {
+		var e simulator.Entity = w.attempt
+		state.Waiting = append(state.Waiting, waitingRequest{
+			Request: saveRequests([]*simulator.Entity{&e})[0],
+			DueAt:   w.dueAt.UTC(),
+		})
+	}
+
+	return mustMarshal(state)
+}
+
+func (rs *retrySource) RestoreState(data json.RawMessage) error {
+	var state retryState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	waiting := make([]waitingAttempt, len(state.Waiting))
+	for i, w := range state.Waiting {
+		attempt, err := restoreRequest(rs.retrier.routingStock, w.Request)
+		if err != nil {
+			return err
+		}
+		waiting[i] = waitingAttempt{attempt: attempt, dueAt: w.DueAt}
+	}
+
+	rs.waiting = waiting
+	rs.retrier.firstAttempts = state.FirstAttempts
+	rs.retrier.retries = state.Retries
+
+	return nil
+}
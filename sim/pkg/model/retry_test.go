@@ -0,0 +1,272 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+
+	"skenario/pkg/simulator"
+)
+
+func TestRetry(t *testing.T) {
+	spec.Run(t, "Retrying failed requests", testRetry, spec.Report(report.Terminal{}))
+}
+
+func testRetry(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var routingStock RequestsRoutingStock
+	var source TrafficSource
+	var failedStock RequestsFinishedStock
+	var config RetryConfig
+
+	var newSource = func() {
+		source = NewTrafficSource(envFake, routingStock, RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second, Retry: config})
+	}
+
+	var retries = func() []simulator.Movement {
+		rs := make([]simulator.Movement, 0)
+		for _, mv := range envFake.Movements {
+			if mv.Kind() == "retry_request" {
+				rs = append(rs, mv)
+			}
+		}
+		return rs
+	}
+
+	it.Before(func() {
+		envFake = NewFakeEnvironment()
+		envFake.TheTime = time.Unix(0, 0)
+		routingStock = NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), simulator.NewSinkStock("RequestsFailed", "Request"))
+		failedStock = NewRequestsFailedStock(envFake, "RequestsFailed")
+		config = RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: 100 * time.Millisecond,
+		}
+	})
+
+	describe("when retries are disabled", func() {
+		it.Before(func() {
+			config.MaxAttempts = 1
+			newSource()
+			err := failedStock.Add(source.Remove())
+			assert.NoError(t, err)
+		})
+
+		it("does not retry", func() {
+			assert.Len(t, retries(), 0)
+		})
+	})
+
+	describe("when a first attempt fails", func() {
+		var retry simulator.Movement
+
+		it.Before(func() {
+			newSource()
+			err := failedStock.Add(source.Remove())
+			assert.NoError(t, err)
+			retry = retries()[0]
+		})
+
+		it("keeps the failed attempt", func() {
+			assert.Equal(t, uint64(1), failedStock.Count())
+		})
+
+		it("schedules a retry into the routing stock after the backoff", func() {
+			assert.Equal(t, envFake.TheTime.Add(100*time.Millisecond), retry.OccursAt())
+			assert.Equal(t, routingStock, retry.To())
+		})
+
+		it("retries with a new attempt linked to the original", func() {
+			original := (*failedStock.EntitiesInStock()[0]).(*requestEntity)
+			attempt := retry.From().Remove().(*requestEntity)
+
+			assert.Equal(t, 2, attempt.attempt)
+			assert.Equal(t, original.number, attempt.number)
+			assert.Equal(t, simulator.EntityName(fmt.Sprintf("request-%d-attempt-2", original.number)), attempt.Name())
+		})
+	})
+
+	describe("when the final attempt fails", func() {
+		it.Before(func() {
+			newSource()
+			request := source.Remove().(*requestEntity)
+			err := failedStock.Add(request.nextAttempt().nextAttempt())
+			assert.NoError(t, err)
+		})
+
+		it("gives up", func() {
+			assert.Len(t, retries(), 0)
+		})
+	})
+
+	describe("exponential backoff", func() {
+		it.Before(func() {
+			config.MaxAttempts = 10
+			config.Backoff = "exponential"
+			config.MaxBackoff = 500 * time.Millisecond
+			newSource()
+			request := source.Remove().(*requestEntity)
+
+			err := failedStock.Add(request)
+			assert.NoError(t, err)
+			err = failedStock.Add(request.nextAttempt())
+			assert.NoError(t, err)
+			err = failedStock.Add(request.nextAttempt().nextAttempt().nextAttempt())
+			assert.NoError(t, err)
+		})
+
+		it("doubles the backoff for each attempt, up to the maximum", func() {
+			assert.Equal(t, envFake.TheTime.Add(100*time.Millisecond), retries()[0].OccursAt())
+			assert.Equal(t, envFake.TheTime.Add(200*time.Millisecond), retries()[1].OccursAt())
+			assert.Equal(t, envFake.TheTime.Add(500*time.Millisecond), retries()[2].OccursAt())
+		})
+	})
+
+	describe("when attempts with different backoffs are waiting", func() {
+		var first, second *requestEntity
+
+		it.Before(func() {
+			config.MaxAttempts = 10
+			config.Backoff = "exponential"
+			newSource()
+			first = source.Remove().(*requestEntity)
+			second = source.Remove().(*requestEntity)
+
+			err := failedStock.Add(first.nextAttempt().nextAttempt())
+			assert.NoError(t, err)
+			err = failedStock.Add(second)
+			assert.NoError(t, err)
+		})
+
+		it("retries from a single source for the service", func() {
+			assert.Len(t, retries(), 2)
+			assert.Equal(t, retries()[0].From(), retries()[1].From())
+			assert.Equal(t, simulator.StockName("RetrySource"), retries()[0].From().Name())
+			assert.Equal(t, uint64(2), retries()[0].From().Count())
+		})
+
+		it("gives the attempt that is due soonest first", func() {
+			from := retries()[0].From()
+
+			assert.Equal(t, second.number, from.Remove().(*requestEntity).number)
+			assert.Equal(t, first.number, from.Remove().(*requestEntity).number)
+			assert.Equal(t, uint64(0), from.Count())
+		})
+	})
+
+	describe("when the waiting attempts are saved and restored", func() {
+		var restored *retrySource
+
+		it.Before(func() {
+			config.MaxAttempts = 10
+			newSource()
+			first := source.Remove().(*requestEntity)
+			err := failedStock.Add(first)
+			assert.NoError(t, err)
+			err = failedStock.Add(source.Remove())
+			assert.NoError(t, err)
+
+			saved := retries()[0].From().(*retrySource).SaveState()
+
+			envFake = NewFakeEnvironment()
+			routingStock = NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), simulator.NewSinkStock("RequestsFailed", "Request"))
+			newSource()
+			restored = source.(*trafficSource).retrier.source
+			err = restored.RestoreState(saved)
+			assert.NoError(t, err)
+		})
+
+		it("gives back the attempts in the order they are due", func() {
+			assert.Equal(t, uint64(2), restored.Count())
+			assert.Equal(t, simulator.EntityName("request-1-attempt-2"), restored.Remove().Name())
+			assert.Equal(t, simulator.EntityName("request-2-attempt-2"), restored.Remove().Name())
+		})
+
+		it("gives back the retry budget", func() {
+			assert.Equal(t, 2, restored.retrier.firstAttempts)
+			assert.Equal(t, 2, restored.retrier.retries)
+		})
+
+		it("restores attempts which can be retried again", func() {
+			attempt := restored.Remove().(*requestEntity)
+			assert.Equal(t, restored.retrier, attempt.retrier)
+			assert.Equal(t, routingStock, attempt.routingStock)
+		})
+	})
+
+	describe("jitter", func() {
+		it.Before(func() {
+			config.Jitter = 0.5
+			newSource()
+			for i := 0; i < 20; i++ {
+				err := failedStock.Add(source.Remove())
+				assert.NoError(t, err)
+			}
+		})
+
+		it("varies the backoff within the jitter fraction", func() {
+			for _, r := range retries() {
+				assert.WithinDuration(t, envFake.TheTime.Add(100*time.Millisecond), r.OccursAt(), 50*time.Millisecond)
+			}
+		})
+	})
+
+	describe("retry budget", func() {
+		it.Before(func() {
+			config.BudgetRatio = 0.5
+			newSource()
+
+			requests := make([]simulator.Entity, 0)
+			for i := 0; i < 10; i++ {
+				requests = append(requests, source.Remove())
+			}
+			for _, r := range requests {
+				err := failedStock.Add(r)
+				assert.NoError(t, err)
+			}
+		})
+
+		it("limits retries to a fraction of first attempts", func() {
+			assert.Len(t, retries(), 5)
+		})
+	})
+
+	describe("when a closed-loop user's request is retried", func() {
+		var waiting UsersWaitingStock
+
+		it.Before(func() {
+			newSource()
+			_, waiting = NewVirtualUsers(envFake, source, routingStock, func() time.Duration { return time.Second })
+			request := source.Remove().(*requestEntity)
+			request.users = waiting
+
+			err := failedStock.Add(request)
+			assert.NoError(t, err)
+		})
+
+		it("keeps the user waiting for the retry", func() {
+			assert.Len(t, envFake.Movements, 1)
+			assert.Equal(t, simulator.MovementKind("retry_request"), envFake.Movements[0].Kind())
+			assert.Equal(t, waiting, envFake.Movements[0].From().Remove().(*requestEntity).users)
+		})
+	})
+}
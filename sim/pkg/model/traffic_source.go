@@ -27,10 +27,12 @@ type trafficSource struct {
 	env             simulator.Environment
 	requestsRouting RequestsRoutingStock
 	requestConfig   RequestConfig
+	retrier         *retrier
+	users           UsersWaitingStock // set when requests are sent by closed-loop users
 }
 
 func (ts *trafficSource) Name() simulator.StockName {
-	return "TrafficSource"
+	return simulator.ServiceStockName(ts.env, "TrafficSource")
 }
 
 func (ts *trafficSource) KindStocked() simulator.EntityKind {
@@ -46,13 +48,31 @@ func (ts *trafficSource) EntitiesInStock() []*simulator.Entity {
 }
 
 func (ts *trafficSource) Remove() simulator.Entity {
-	return NewRequestEntity(ts.env, ts.requestsRouting, ts.requestConfig)
+	request := NewRequestEntity(ts.env, ts.requestsRouting, ts.requestConfig)
+	if ts.retrier != nil {
+		ts.retrier.firstAttempts++
+		request.(*requestEntity).retrier = ts.retrier
+	}
+
+	return request
 }
 
 func NewTrafficSource(env simulator.Environment, requestsRouting RequestsRoutingStock, requestConfig RequestConfig) TrafficSource {
-	return &trafficSource{
+	ts := &trafficSource{
 		env:             env,
 		requestsRouting: requestsRouting,
 		requestConfig:   requestConfig,
+		retrier:         newRetrier(env, requestConfig.Retry, requestsRouting),
+	}
+
+	if rbs, ok := requestsRouting.(*requestsRoutingStock); ok {
+		rbs.source = ts
 	}
+
+	env.AddStock(ts)
+	if ts.retrier != nil {
+		env.AddStock(ts.retrier.source)
+	}
+
+	return ts
 }
@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package trafficpatterns
+
+import (
+	"fmt"
+	"time"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+type closedLoop struct {
+	env                   simulator.Environment
+	source                model.TrafficSource
+	routingStock          model.RequestsRoutingStock
+	numberOfUsers         int
+	thinkTime             time.Duration
+	thinkTimeDistribution string
+}
+
+// ClosedLoopConfig describes a fixed population of virtual users. Each user sends a
+// request, waits for it to complete or fail, then thinks before sending the next.
+//
+// ThinkTimeDistribution may be "exponential" (the default), "uniform" (between zero and
+// twice ThinkTime) or "constant". In each case ThinkTime is the mean.
+type ClosedLoopConfig struct {
+	NumberOfUsers         int           `json:"number_of_users" description:"Number of users"`
+	ThinkTime             time.Duration `json:"think_time" description:"Mean think time"`
+	ThinkTimeDistribution string        `json:"think_time_distribution,omitempty" description:"Think time distribution" enum:"exponential,uniform,constant"`
+}
+
+func (*closedLoop) Name() string {
+	return "closed_loop"
+}
+
+func (cl *closedLoop) Generate() {
+	thinking, _ := model.NewVirtualUsers(cl.env, cl.source, cl.routingStock, cl.sampleThinkTime)
+
+	for i := 1; i <= cl.numberOfUsers; i++ {
+		err := thinking.Add(simulator.NewEntity(simulator.EntityName(fmt.Sprintf("user-%d", i)), "User"))
+		if err != nil {
+			panic(fmt.Errorf("could not add virtual user: %s", err.Error()))
+		}
+	}
+}
+
+func (cl *closedLoop) sampleThinkTime() time.Duration {
+	mean := float64(cl.thinkTime)
+	rng := cl.env.Rand("traffic")
+
+	switch cl.thinkTimeDistribution {
+	case "constant":
+		return cl.thinkTime
+	case "uniform":
+		return time.Duration(rng.Float64() * 2 * mean)
+	default:
+		return time.Duration(rng.ExpFloat64() * mean)
+	}
+}
+
+func NewClosedLoop(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config ClosedLoopConfig) Pattern {
+	return &closedLoop{
+		env:                   env,
+		source:                source,
+		routingStock:          routingStock,
+		numberOfUsers:         config.NumberOfUsers,
+		thinkTime:             config.ThinkTime,
+		thinkTimeDistribution: config.ThinkTimeDistribution,
+	}
+}
+
+func init() {
+	MustRegister(Registration{
+		Name:          "closed_loop",
+		Description:   "Closed loop",
+		ExampleConfig: ClosedLoopConfig{NumberOfUsers: 10, ThinkTime: time.Second, ThinkTimeDistribution: "exponential"},
+		New: func(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config interface{}) Pattern {
+			return NewClosedLoop(env, source, routingStock, *config.(*ClosedLoopConfig))
+		},
+	})
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package trafficpatterns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestClosedLoop(t *testing.T) {
+	spec.Run(t, "Closed loop traffic pattern", testClosedLoop, spec.Report(report.Terminal{}))
+}
+
+func testClosedLoop(t *testing.T, describe spec.G, it spec.S) {
+	var subject Pattern
+	var config ClosedLoopConfig
+	var envFake *model.FakeEnvironment
+	var trafficSource model.TrafficSource
+	var routingStock model.RequestsRoutingStock
+
+	it.Before(func() {
+		envFake = model.NewFakeEnvironment()
+		envFake.TheTime = time.Unix(0, 0)
+		envFake.TheHaltTime = envFake.TheTime.Add(30 * time.Second)
+
+		routingStock = model.NewRequestsRoutingStock(envFake, model.NewReplicasActiveStock(envFake), simulator.NewSinkStock("Failed", "Request"))
+		trafficSource = model.NewTrafficSource(envFake, routingStock, model.RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
+		config = ClosedLoopConfig{
+			NumberOfUsers: 7,
+			ThinkTime:     2 * time.Second,
+		}
+	})
+
+	describe("Name()", func() {
+		it.Before(func() {
+			subject = NewClosedLoop(envFake, trafficSource, routingStock, config)
+		})
+
+		it("calls itself 'closed_loop'", func() {
+			assert.Equal(t, "closed_loop", subject.Name())
+		})
+	})
+
+	describe("Generate()", func() {
+		describe("with constant think times", func() {
+			it.Before(func() {
+				config.ThinkTimeDistribution = "constant"
+				subject = NewClosedLoop(envFake, trafficSource, routingStock, config)
+				subject.Generate()
+			})
+
+			it("schedules each user to finish thinking once", func() {
+				assert.Len(t, envFake.Movements, 7)
+				for _, mv := range envFake.Movements {
+					assert.Equal(t, simulator.MovementKind("finish_thinking"), mv.Kind())
+					assert.Equal(t, envFake.TheTime.Add(2*time.Second), mv.OccursAt())
+				}
+			})
+		})
+
+		describe("with uniform think times", func() {
+			it.Before(func() {
+				config.ThinkTimeDistribution = "uniform"
+				subject = NewClosedLoop(envFake, trafficSource, routingStock, config)
+				subject.Generate()
+			})
+
+			it("thinks for up to twice the mean think time", func() {
+				for _, mv := range envFake.Movements {
+					assert.WithinDuration(t, envFake.TheTime.Add(2*time.Second), mv.OccursAt(), 2*time.Second)
+				}
+			})
+		})
+
+		describe("with exponential think times", func() {
+			it.Before(func() {
+				subject = NewClosedLoop(envFake, trafficSource, routingStock, config)
+				subject.Generate()
+			})
+
+			it("staggers the users", func() {
+				assert.Len(t, envFake.Movements, 7)
+				assert.NotEqual(t, envFake.Movements[0].OccursAt(), envFake.Movements[1].OccursAt())
+			})
+		})
+	})
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package trafficpatterns
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+// generationWindow is how much simulated time each call of a window func covers.
+const generationWindow = 1 * time.Second
+
+// windowFunc schedules arrivals for [start, start+window). It returns false once the
+// pattern has no more arrivals to give.
+type windowFunc func(start time.Time, window time.Duration) (more bool)
+
+// GeneratorStock holds a single entity which cycles back into the stock once per window.
+// Each time it arrives, the arrivals for the next window are scheduled. This keeps at most
+// two windows' worth of arrivals in the movement queue, no matter how long the scenario.
+type GeneratorStock interface {
+	simulator.ThroughStock
+}
+
+type generatorStock struct {
+	simulator.BoundedStock
+
+	env       simulator.Environment
+	window    time.Duration
+	nextStart time.Time
+	generate  windowFunc
+	state     interface{}
+}
+
+type generatorState struct {
+	NextStart time.Time       `json:"next_start"`
+	Pattern   json.RawMessage `json:"pattern,omitempty"`
+}
+
+func (gs *generatorStock) SaveState() json.RawMessage {
+	state := generatorState{NextStart: gs.nextStart.UTC()}
+	if gs.state != nil {
+		state.Pattern = mustMarshal(gs.state)
+	}
+
+	return mustMarshal(state)
+}
+
+// RestoreState gives back where the generator had reached. The generator entity itself is
+// always in the stock between windows.
+func (gs *generatorStock) RestoreState(data json.RawMessage) error {
+	var state generatorState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	if gs.state != nil && len(state.Pattern) > 0 {
+		err = json.Unmarshal(state.Pattern, gs.state)
+		if err != nil {
+			return err
+		}
+	}
+	gs.nextStart = state.NextStart
+
+	return nil
+}
+
+func (gs *generatorStock) Add(entity simulator.Entity) error {
+	err := gs.BoundedStock.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	start := gs.nextStart
+	gs.nextStart = start.Add(gs.window)
+
+	if !start.Before(gs.env.HaltTime()) || !gs.generate(start, gs.window) {
+		return nil
+	}
+
+	// Generate the following window a window ahead of time, so that none of its arrivals
+	// can fall before the generator movement itself.
+	at := start
+	if !at.After(gs.env.CurrentMovementTime()) {
+		at = gs.env.CurrentMovementTime().Add(1 * time.Nanosecond)
+	}
+
+	gs.env.AddToSchedule(simulator.NewMovement("generate_traffic", at, gs, gs))
+
+	return nil
+}
+
+// startGenerating immediately generates the window beginning at firstWindow, then leaves
+// the remaining windows to be generated as the simulation progresses. State points to
+// whatever generate keeps from one window to the next, so that it is saved in snapshots;
+// it is nil if generate keeps nothing.
+func startGenerating(env simulator.Environment, firstWindow time.Time, state interface{}, generate windowFunc) {
+	gs := &generatorStock{
+		env:          env,
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, "TrafficGenerator"), "TrafficGenerator", simulator.StockConfig{}),
+		window:       generationWindow,
+		nextStart:    firstWindow,
+		generate:     generate,
+		state:        state,
+	}
+	env.AddStock(gs)
+
+	err := gs.Add(simulator.NewEntity("generator", "TrafficGenerator"))
+	if err != nil {
+		panic(fmt.Errorf("could not start traffic generator: %s", err.Error()))
+	}
+}
+
+// scheduleArrivals schedules count arrivals at uniformly random times in [start, start+window).
+func scheduleArrivals(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, count int, start time.Time, window time.Duration) {
+	rng := env.Rand("traffic")
+
+	for i := 0; i < count; i++ {
+		r := rng.Int63n(window.Nanoseconds())
+
+		env.AddToSchedule(simulator.NewMovement(
+			"arrive_at_routing_stock",
+			start.Add(time.Duration(r)*time.Nanosecond),
+			source,
+			routingStock,
+		))
+	}
+}
+
+// mustMarshal encodes a generator's state, which is always possible.
+func mustMarshal(state interface{}) json.RawMessage {
+	data, err := json.Marshal(state)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// binomial samples the number of successes in n trials with probability p. Small cases
+// are sampled exactly; large ones are approximated, by Poisson for rare successes and by
+// the normal distribution otherwise.
+func binomial(rng *rand.Rand, n int, p float64) int {
+	if n <= 0 || p <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return n
+	}
+
+	if n <= 100 {
+		successes := 0
+		for i := 0; i < n; i++ {
+			if rng.Float64() < p {
+				successes++
+			}
+		}
+		return successes
+	}
+
+	mean := float64(n) * p
+	var k int
+	if mean < 30 {
+		limit := math.Exp(-mean)
+		product := rng.Float64()
+		for product > limit {
+			k++
+			product *= rng.Float64()
+		}
+	} else {
+		k = int(math.Round(mean + math.Sqrt(mean*(1-p))*rng.NormFloat64()))
+	}
+
+	if k < 0 {
+		return 0
+	}
+	if k > n {
+		return n
+	}
+	return k
+}
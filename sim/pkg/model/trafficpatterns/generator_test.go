@@ -0,0 +1,244 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package trafficpatterns
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+// generate runs a pattern to completion against a fake environment, by performing each
+// generator movement in turn. Afterwards only the arrival movements are left in the fake.
+func generate(subject Pattern, envFake *model.FakeEnvironment) {
+	start := envFake.TheTime
+	subject.Generate()
+
+	for i := 0; i < len(envFake.Movements); i++ {
+		mv := envFake.Movements[i]
+		if mv.Kind() != "generate_traffic" {
+			continue
+		}
+
+		envFake.TheTime = mv.OccursAt()
+		err := mv.To().Add(mv.From().Remove())
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	arrivals := make([]simulator.Movement, 0, len(envFake.Movements))
+	for _, mv := range envFake.Movements {
+		if mv.Kind() != "generate_traffic" {
+			arrivals = append(arrivals, mv)
+		}
+	}
+
+	envFake.Movements = arrivals
+	envFake.TheTime = start
+}
+
+func TestGenerator(t *testing.T) {
+	spec.Run(t, "Lazy traffic generation", testGenerator, spec.Report(report.Terminal{}))
+}
+
+func testGenerator(t *testing.T, describe spec.G, it spec.S) {
+	var subject Pattern
+	var envFake *model.FakeEnvironment
+	var trafficSource model.TrafficSource
+	var routingStock model.RequestsRoutingStock
+
+	it.Before(func() {
+		envFake = model.NewFakeEnvironment()
+		envFake.TheTime = time.Unix(0, 0)
+		envFake.TheHaltTime = envFake.TheTime.Add(100 * time.Second)
+		routingStock = model.NewRequestsRoutingStock(envFake, model.NewReplicasActiveStock(envFake), simulator.NewSinkStock("Failed", "Request"))
+		trafficSource = model.NewTrafficSource(envFake, routingStock, model.RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
+		subject = NewStep(envFake, trafficSource, routingStock, StepConfig{RPS: 10})
+	})
+
+	describe("Generate()", func() {
+		it.Before(func() {
+			subject.Generate()
+		})
+
+		it("schedules only the first window of arrivals", func() {
+			arrivals := 0
+			for _, mv := range envFake.Movements {
+				if mv.Kind() == "arrive_at_routing_stock" {
+					arrivals++
+					assert.True(t, mv.OccursAt().Before(envFake.TheTime.Add(time.Second)))
+				}
+			}
+			assert.Equal(t, 10, arrivals)
+		})
+
+		it("schedules a generator movement for the following window", func() {
+			last := envFake.Movements[len(envFake.Movements)-1]
+			assert.Equal(t, simulator.MovementKind("generate_traffic"), last.Kind())
+			assert.Equal(t, simulator.StockName("TrafficGenerator"), last.From().Name())
+			assert.Equal(t, simulator.StockName("TrafficGenerator"), last.To().Name())
+			assert.True(t, last.OccursAt().After(envFake.TheTime))
+		})
+	})
+
+	describe("when the generator movement occurs", func() {
+		var generated []simulator.Movement
+
+		it.Before(func() {
+			subject.Generate()
+			mv := envFake.Movements[len(envFake.Movements)-1]
+			envFake.Movements = nil
+			envFake.TheTime = mv.OccursAt()
+
+			mv.To().Add(mv.From().Remove())
+			generated = envFake.Movements
+		})
+
+		it("schedules arrivals for the next window", func() {
+			assert.Len(t, generated, 11)
+			for _, mv := range generated[:10] {
+				assert.Equal(t, simulator.MovementKind("arrive_at_routing_stock"), mv.Kind())
+				assert.WithinDuration(t, time.Unix(1, 500000000), mv.OccursAt(), 500*time.Millisecond)
+			}
+		})
+
+		it("schedules itself again", func() {
+			assert.Equal(t, simulator.MovementKind("generate_traffic"), generated[10].Kind())
+		})
+	})
+
+	describe("when the generator is saved and restored", func() {
+		var original, restored *generatorStock
+
+		it.Before(func() {
+			subject = NewRamp(envFake, trafficSource, routingStock, RampConfig{DeltaV: 2, MaxRPS: 10})
+			subject.Generate()
+			for i := 0; i < 3; i++ {
+				mv := envFake.Movements[len(envFake.Movements)-1]
+				envFake.TheTime = mv.OccursAt()
+				assert.NoError(t, mv.To().Add(mv.From().Remove()))
+			}
+			original = envFake.Movements[len(envFake.Movements)-1].From().(*generatorStock)
+
+			otherEnv := model.NewFakeEnvironment()
+			otherEnv.TheTime = time.Unix(0, 0)
+			otherEnv.TheHaltTime = envFake.TheHaltTime
+			NewRamp(otherEnv, trafficSource, routingStock, RampConfig{DeltaV: 2, MaxRPS: 10}).Generate()
+			restored = otherEnv.Movements[len(otherEnv.Movements)-1].From().(*generatorStock)
+
+			assert.NoError(t, restored.RestoreState(original.SaveState()))
+		})
+
+		it("carries on from the window it had reached", func() {
+			assert.True(t, original.nextStart.Equal(restored.nextStart))
+		})
+
+		it("keeps the state of its pattern", func() {
+			assert.Equal(t, &rampState{RPS: 10, RampingUp: true}, original.state)
+			assert.Equal(t, original.state, restored.state)
+		})
+	})
+
+	describe("when the scenario halts", func() {
+		it("stops generating", func() {
+			generate(subject, envFake)
+			assert.Len(t, envFake.Movements, 1000)
+		})
+	})
+
+	describe("seeding", func() {
+		it("gives the same arrivals for the same seed", func() {
+			other := model.NewFakeEnvironment()
+			other.TheTime = envFake.TheTime
+			other.TheHaltTime = envFake.TheHaltTime
+
+			generate(subject, envFake)
+			generate(NewStep(other, trafficSource, routingStock, StepConfig{RPS: 10}), other)
+
+			assert.Equal(t, len(envFake.Movements), len(other.Movements))
+			for i := range envFake.Movements {
+				assert.Equal(t, envFake.Movements[i].OccursAt(), other.Movements[i].OccursAt())
+			}
+		})
+	})
+
+	describe("binomial()", func() {
+		var rng *rand.Rand
+
+		it.Before(func() {
+			rng = rand.New(rand.NewSource(1))
+		})
+
+		it("gives zero or n at the extremes", func() {
+			assert.Equal(t, 0, binomial(rng, 100, 0))
+			assert.Equal(t, 100, binomial(rng, 100, 1))
+			assert.Equal(t, 0, binomial(rng, 0, 0.5))
+		})
+
+		it("never gives more than n", func() {
+			for _, n := range []int{10, 1000, 1000000} {
+				for i := 0; i < 100; i++ {
+					k := binomial(rng, n, 0.9)
+					assert.True(t, k >= 0 && k <= n)
+				}
+			}
+		})
+
+		it("approximates the binomial's spread above 100 trials", func() {
+			for _, c := range []struct {
+				n int
+				p float64
+			}{{1000, 0.01}, {1000, 0.5}} {
+				samples := make([]float64, 5000)
+				sum := 0.0
+				for i := range samples {
+					samples[i] = float64(binomial(rng, c.n, c.p))
+					sum += samples[i]
+				}
+				mean := sum / float64(len(samples))
+
+				squares := 0.0
+				for _, s := range samples {
+					squares += (s - mean) * (s - mean)
+				}
+				variance := squares / float64(len(samples)-1)
+
+				expectedMean := float64(c.n) * c.p
+				expectedVariance := expectedMean * (1 - c.p)
+				assert.InDelta(t, expectedMean, mean, expectedMean*0.02)
+				assert.InDelta(t, expectedVariance, variance, expectedVariance*0.1)
+			}
+		})
+
+		it("gives roughly n*p on average", func() {
+			for _, n := range []int{50, 1000, 1000000} {
+				total := 0
+				for i := 0; i < 1000; i++ {
+					total += binomial(rng, n, 0.01)
+				}
+				assert.InDelta(t, float64(n)*0.01, float64(total)/1000, float64(n)*0.01*0.1+0.1)
+			}
+		})
+	})
+}
@@ -32,8 +32,8 @@ type ramp struct {
 }
 
 type RampConfig struct {
-	DeltaV int `json:"delta_v"`
-	MaxRPS int `json:"max_rps"`
+	DeltaV int `json:"delta_v" description:"Ramp delta V"`
+	MaxRPS int `json:"max_rps" description:"Ramp max RPS"`
 }
 
 func (*ramp) Name() string {
@@ -41,29 +41,35 @@ func (*ramp) Name() string {
 }
 
 func (r *ramp) Generate() {
-	var t time.Time
-	nextRPS := r.deltaV
-	startAt := r.env.CurrentMovementTime()
-
-	for t = startAt; nextRPS <= r.maxRPS; t = t.Add(1 * time.Second) {
-		uniRand := NewUniformRandom(r.env, r.source, r.routingStock, UniformConfig{
-			NumberOfRequests: nextRPS,
-			StartAt:          t,
-			RunFor:           time.Second,
-		})
-		uniRand.Generate()
-		nextRPS = nextRPS + r.deltaV
+	if r.deltaV <= 0 {
+		return
 	}
 
-	for ; nextRPS > 0; t = t.Add(1 * time.Second) {
-		nextRPS = nextRPS - r.deltaV
-		uniRand := NewUniformRandom(r.env, r.source, r.routingStock, UniformConfig{
-			NumberOfRequests: nextRPS,
-			StartAt:          t,
-			RunFor:           time.Second,
-		})
-		uniRand.Generate()
-	}
+	state := &rampState{RPS: r.deltaV, RampingUp: true}
+
+	// Rises by deltaV each second up to maxRPS, then falls back by deltaV each second to zero.
+	startGenerating(r.env, r.env.CurrentMovementTime(), state, func(start time.Time, window time.Duration) bool {
+		if state.RampingUp && state.RPS > r.maxRPS {
+			state.RampingUp = false
+			state.RPS -= r.deltaV
+		}
+
+		scheduleArrivals(r.env, r.source, r.routingStock, state.RPS, start, window)
+
+		if state.RampingUp {
+			state.RPS += r.deltaV
+			return true
+		}
+
+		state.RPS -= r.deltaV
+		return state.RPS >= 0
+	})
+}
+
+// rampState is the rate a ramp pattern has reached, and whether it is still rising.
+type rampState struct {
+	RPS       int  `json:"rps"`
+	RampingUp bool `json:"ramping_up"`
 }
 
 func NewRamp(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config RampConfig) Pattern {
@@ -75,3 +81,14 @@ func NewRamp(env simulator.Environment, source model.TrafficSource, routingStock
 		maxRPS:       config.MaxRPS,
 	}
 }
+
+func init() {
+	MustRegister(Registration{
+		Name:          "ramp",
+		Description:   "Ramp",
+		ExampleConfig: RampConfig{DeltaV: 1, MaxRPS: 50},
+		New: func(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config interface{}) Pattern {
+			return NewRamp(env, source, routingStock, *config.(*RampConfig))
+		},
+	})
+}
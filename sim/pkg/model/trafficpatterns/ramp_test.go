@@ -39,7 +39,7 @@ func testRamp(t *testing.T, describe spec.G, it spec.S) {
 	var routingStock model.RequestsRoutingStock
 
 	it.Before(func() {
-		envFake = new(model.FakeEnvironment)
+		envFake = model.NewFakeEnvironment()
 		envFake.TheHaltTime = envFake.TheTime.Add(15 * time.Second)
 		routingStock = model.NewRequestsRoutingStock(envFake, model.NewReplicasActiveStock(envFake), simulator.NewSinkStock("Failed", "Request"))
 		trafficSource = model.NewTrafficSource(envFake, routingStock, model.RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
@@ -49,7 +49,7 @@ func testRamp(t *testing.T, describe spec.G, it spec.S) {
 			MaxRPS: 3,
 		}
 		subject = NewRamp(envFake, trafficSource, routingStock, config)
-		subject.Generate()
+		generate(subject, envFake)
 	})
 
 	describe("Name()", func() {
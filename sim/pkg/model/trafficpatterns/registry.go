@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package trafficpatterns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+// Constructor builds a pattern. The config it receives is always a pointer to a value of
+// the same type as the registration's ExampleConfig.
+type Constructor func(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config interface{}) Pattern
+
+// Registration describes a traffic pattern to the HTTP API and CLI. ExampleConfig is a
+// config struct value; its type determines how configs are decoded and described, and its
+// field values are offered as defaults in the UI. Config fields may carry "description"
+// and "enum" struct tags, which are included in the schema.
+type Registration struct {
+	Name          string
+	Description   string
+	ExampleConfig interface{}
+	New           Constructor
+}
+
+// Schema is a small subset of JSON Schema, sufficient to describe pattern configs.
+// Durations are integers with the "duration" format, counted in nanoseconds.
+type Schema struct {
+	Type          string             `json:"type"`
+	Format        string             `json:"format,omitempty"`
+	Description   string             `json:"description,omitempty"`
+	Default       interface{}        `json:"default,omitempty"`
+	Enum          []string           `json:"enum,omitempty"`
+	Properties    map[string]*Schema `json:"properties,omitempty"`
+	PropertyOrder []string           `json:"property_order,omitempty"`
+	Items         *Schema            `json:"items,omitempty"`
+}
+
+var registry = make(map[string]Registration)
+
+// Register makes a pattern available by name. It gives an error if the name is taken or
+// the registration is incomplete.
+func Register(registration Registration) error {
+	if registration.Name == "" || registration.New == nil {
+		return fmt.Errorf("traffic pattern registration '%s' needs a name and a constructor", registration.Name)
+	}
+	if registration.ExampleConfig == nil {
+		return fmt.Errorf("traffic pattern '%s' needs an example config", registration.Name)
+	}
+	if reflect.TypeOf(registration.ExampleConfig).Kind() != reflect.Struct {
+		return fmt.Errorf("traffic pattern '%s' must have a struct config, not %T", registration.Name, registration.ExampleConfig)
+	}
+	if _, exists := registry[registration.Name]; exists {
+		return fmt.Errorf("traffic pattern '%s' is already registered", registration.Name)
+	}
+
+	registry[registration.Name] = registration
+	return nil
+}
+
+// MustRegister is Register for use during init, where a bad registration is a programming
+// error. It panics if the pattern can't be registered.
+func MustRegister(registration Registration) {
+	err := Register(registration)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func Lookup(name string) (Registration, bool) {
+	registration, ok := registry[name]
+	return registration, ok
+}
+
+// Registered gives every registered pattern, ordered by name.
+func Registered() []Registration {
+	registrations := make([]Registration, 0, len(registry))
+	for _, r := range registry {
+		registrations = append(registrations, r)
+	}
+
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].Name < registrations[j].Name
+	})
+
+	return registrations
+}
+
+// DecodeConfig decodes a JSON config for this pattern. Missing fields are left as zero
+// values and unknown fields are an error. An empty config decodes to the zero config.
+func (r Registration) DecodeConfig(raw json.RawMessage) (interface{}, error) {
+	config := reflect.New(reflect.TypeOf(r.ExampleConfig)).Interface()
+
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return config, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode config for traffic pattern '%s': %s", r.Name, err.Error())
+	}
+
+	return config, nil
+}
+
+func (r Registration) ConfigSchema() *Schema {
+	return schemaOf(reflect.ValueOf(r.ExampleConfig))
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+func schemaOf(v reflect.Value) *Schema {
+	t := v.Type()
+
+	switch {
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "duration"}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Ptr:
+		// optional fields are described by what they point to
+		return schemaOf(reflect.Zero(t.Elem()))
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(reflect.Zero(t.Elem()))}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if field.PkgPath != "" || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			fieldSchema := schemaOf(v.Field(i))
+			fieldSchema.Description = field.Tag.Get("description")
+			if enum := field.Tag.Get("enum"); enum != "" {
+				fieldSchema.Enum = strings.Split(enum, ",")
+			}
+			zero := reflect.Zero(v.Field(i).Type()).Interface()
+			if !reflect.DeepEqual(v.Field(i).Interface(), zero) && fieldSchema.Type != "object" && fieldSchema.Type != "array" {
+				fieldSchema.Default = v.Field(i).Interface()
+			}
+
+			schema.Properties[name] = fieldSchema
+			schema.PropertyOrder = append(schema.PropertyOrder, name)
+		}
+
+		return schema
+	}
+
+	panic(fmt.Errorf("cannot describe config field of type %s", t))
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package trafficpatterns
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestRegistry(t *testing.T) {
+	spec.Run(t, "Traffic pattern registry", testRegistry, spec.Report(report.Terminal{}))
+}
+
+func testRegistry(t *testing.T, describe spec.G, it spec.S) {
+	describe("Registered()", func() {
+		it("includes every built-in pattern, ordered by name", func() {
+			names := make([]string, 0)
+			for _, r := range Registered() {
+				names = append(names, r.Name)
+			}
+
+			assert.Equal(t, []string{"closed_loop", "golang_rand_uniform", "ramp", "sinusoidal", "step"}, names)
+		})
+	})
+
+	describe("Lookup()", func() {
+		it("finds registered patterns", func() {
+			r, ok := Lookup("step")
+			assert.True(t, ok)
+			assert.Equal(t, "step", r.Name)
+		})
+
+		it("does not find unknown patterns", func() {
+			_, ok := Lookup("nonexistent")
+			assert.False(t, ok)
+		})
+	})
+
+	describe("Register()", func() {
+		newPattern := func(simulator.Environment, model.TrafficSource, model.RequestsRoutingStock, interface{}) Pattern {
+			return nil
+		}
+
+		it("refuses a duplicate name", func() {
+			r, _ := Lookup("step")
+			assert.EqualError(t, Register(r), "traffic pattern 'step' is already registered")
+		})
+
+		it("refuses a registration without a config", func() {
+			err := Register(Registration{Name: "bad", New: newPattern})
+			assert.EqualError(t, err, "traffic pattern 'bad' needs an example config")
+		})
+
+		it("refuses a config that isn't a struct", func() {
+			err := Register(Registration{Name: "bad", ExampleConfig: 1, New: newPattern})
+			assert.EqualError(t, err, "traffic pattern 'bad' must have a struct config, not int")
+		})
+	})
+
+	describe("MustRegister()", func() {
+		it("panics when the pattern can't be registered", func() {
+			r, _ := Lookup("step")
+			assert.Panics(t, func() { MustRegister(r) })
+		})
+	})
+
+	describe("DecodeConfig()", func() {
+		var registration Registration
+
+		it.Before(func() {
+			registration, _ = Lookup("step")
+		})
+
+		it("decodes into a pointer to the config type", func() {
+			config, err := registration.DecodeConfig(json.RawMessage(`{"rps": 5, "step_after": 1000000000}`))
+			require.NoError(t, err)
+			assert.Equal(t, &StepConfig{RPS: 5, StepAfter: time.Second}, config)
+		})
+
+		it("decodes an empty config to the zero config", func() {
+			config, err := registration.DecodeConfig(nil)
+			require.NoError(t, err)
+			assert.Equal(t, &StepConfig{}, config)
+		})
+
+		it("rejects unknown fields", func() {
+			_, err := registration.DecodeConfig(json.RawMessage(`{"rsp": 5}`))
+			assert.Error(t, err)
+		})
+	})
+
+	describe("ConfigSchema()", func() {
+		var schema *Schema
+
+		it.Before(func() {
+			registration, _ := Lookup("sinusoidal")
+			schema = registration.ConfigSchema()
+		})
+
+		it("describes an object with properties in field order", func() {
+			assert.Equal(t, "object", schema.Type)
+			assert.Equal(t, []string{"amplitude", "period", "phase", "offset", "harmonics", "noise"}, schema.PropertyOrder)
+		})
+
+		it("describes durations as nanosecond integers", func() {
+			assert.Equal(t, "integer", schema.Properties["period"].Type)
+			assert.Equal(t, "duration", schema.Properties["period"].Format)
+		})
+
+		it("describes optional fields by the type they point to", func() {
+			assert.Equal(t, "integer", schema.Properties["offset"].Type)
+		})
+
+		it("describes nested arrays of objects", func() {
+			harmonics := schema.Properties["harmonics"]
+			assert.Equal(t, "array", harmonics.Type)
+			assert.Equal(t, "object", harmonics.Items.Type)
+			assert.Contains(t, harmonics.Items.Properties, "amplitude")
+		})
+
+		it("uses the example config for defaults", func() {
+			assert.Equal(t, 1, schema.Properties["amplitude"].Default)
+			assert.Nil(t, schema.Properties["offset"].Default)
+		})
+
+		it("includes descriptions and enums from struct tags", func() {
+			assert.Equal(t, "Amplitude (RPS)", schema.Properties["amplitude"].Description)
+
+			registration, _ := Lookup("closed_loop")
+			distribution := registration.ConfigSchema().Properties["think_time_distribution"]
+			assert.Equal(t, []string{"exponential", "uniform", "constant"}, distribution.Enum)
+		})
+	})
+}
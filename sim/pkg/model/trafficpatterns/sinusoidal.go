@@ -25,15 +25,35 @@ import (
 
 type sinusoidal struct {
 	env          simulator.Environment
-	amplitude    int
-	period       time.Duration
+	harmonics    []Harmonic
+	offset       int
+	noise        float64
 	source       model.TrafficSource
 	routingStock model.RequestsRoutingStock
 }
 
+// Harmonic is a single sine wave contributing to a sinusoidal pattern. Phase shifts the
+// wave along the time axis, so that a Period of 24h with a Phase of 6h peaks at the start.
+type Harmonic struct {
+	Amplitude int           `json:"amplitude" description:"Amplitude (RPS)"`
+	Period    time.Duration `json:"period" description:"Period"`
+	Phase     time.Duration `json:"phase" description:"Phase"`
+}
+
+// SinusoidalConfig describes a baseline rate of requests, around which one or more
+// harmonics oscillate. Amplitude, Period and Phase describe the fundamental wave; further
+// Harmonics (eg. an hourly cycle on top of a daily cycle) are summed with it.
+//
+// When Offset is not set, it defaults to the sum of all amplitudes, so that the lowest
+// possible trough is zero RPS. An Offset of zero centres the waves on zero RPS. Noise is the standard deviation, in RPS, of normally
+// distributed noise added to each second. The rate is never allowed to fall below zero.
 type SinusoidalConfig struct {
-	Amplitude int           `json:"amplitude"`
-	Period    time.Duration `json:"period"`
+	Amplitude int           `json:"amplitude" description:"Amplitude (RPS)"`
+	Period    time.Duration `json:"period" description:"Period"`
+	Phase     time.Duration `json:"phase,omitempty" description:"Phase"`
+	Offset    *int          `json:"offset,omitempty" description:"Offset (RPS, sum of amplitudes if unset)"`
+	Harmonics []Harmonic    `json:"harmonics,omitempty" description:"Further harmonics"`
+	Noise     float64       `json:"noise,omitempty" description:"Noise (RPS std. dev.)"`
 }
 
 func (*sinusoidal) Name() string {
@@ -41,32 +61,77 @@ func (*sinusoidal) Name() string {
 }
 
 func (s *sinusoidal) Generate() {
-	var t time.Time
 	startAt := s.env.CurrentMovementTime()
+
+	startGenerating(s.env, startAt, nil, func(start time.Time, window time.Duration) bool {
+		rps := s.rpsAt(start.Sub(startAt))
+		if s.noise > 0 {
+			rps += s.env.Rand("traffic").NormFloat64() * s.noise
+		}
+		roundedRPS := int(math.Round(math.Max(rps, 0)))
+
+		scheduleArrivals(s.env, s.source, s.routingStock, roundedRPS, start, window)
+		return true
+	})
+}
+
+// rpsAt gives the noiseless rate of requests at some time since the pattern began.
+// Using elapsed time rather than wall time keeps the curve independent of when the
+// scenario happens to start.
+func (s *sinusoidal) rpsAt(elapsed time.Duration) float64 {
 	twoPi := 2.0 * math.Pi
-	for t = startAt; t.Before(s.env.HaltTime()); t = t.Add(1 * time.Second) {
-		ampl := float64(s.amplitude)
-		perd := float64(s.period.Seconds())
-		tsec := float64(t.Unix())
-
-		rps := ampl*math.Sin(twoPi*(tsec/perd)) + ampl
-		roundedRPS := int(math.Round(rps))
-
-		uniRand := NewUniformRandom(s.env, s.source, s.routingStock, UniformConfig{
-			NumberOfRequests: roundedRPS,
-			StartAt:          t,
-			RunFor:           time.Second,
-		})
-		uniRand.Generate()
+	rps := float64(s.offset)
+
+	for _, h := range s.harmonics {
+		if h.Period <= 0 {
+			continue
+		}
+
+		ampl := float64(h.Amplitude)
+		perd := h.Period.Seconds()
+		tsec := (elapsed + h.Phase).Seconds()
+
+		rps += ampl * math.Sin(twoPi*(tsec/perd))
 	}
+
+	return rps
 }
 
 func NewSinusoidal(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config SinusoidalConfig) Pattern {
+	harmonics := make([]Harmonic, 0, len(config.Harmonics)+1)
+	harmonics = append(harmonics, Harmonic{
+		Amplitude: config.Amplitude,
+		Period:    config.Period,
+		Phase:     config.Phase,
+	})
+	harmonics = append(harmonics, config.Harmonics...)
+
+	offset := 0
+	if config.Offset != nil {
+		offset = *config.Offset
+	} else {
+		for _, h := range harmonics {
+			offset += h.Amplitude
+		}
+	}
+
 	return &sinusoidal{
 		env:          env,
-		amplitude:    config.Amplitude,
-		period:       config.Period,
+		harmonics:    harmonics,
+		offset:       offset,
+		noise:        config.Noise,
 		source:       source,
 		routingStock: routingStock,
 	}
 }
+
+func init() {
+	MustRegister(Registration{
+		Name:          "sinusoidal",
+		Description:   "Sinusoidal",
+		ExampleConfig: SinusoidalConfig{Amplitude: 1, Period: 50 * time.Second},
+		New: func(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config interface{}) Pattern {
+			return NewSinusoidal(env, source, routingStock, *config.(*SinusoidalConfig))
+		},
+	})
+}
@@ -44,7 +44,7 @@ func testSinusoidal(t *testing.T, describe spec.G, it spec.S) {
 		amplitude = 20
 		period = 20 * time.Second
 
-		envFake = new(model.FakeEnvironment)
+		envFake = model.NewFakeEnvironment()
 		envFake.TheTime = time.Unix(0, 0)
 		envFake.TheHaltTime = envFake.TheTime.Add(30 * time.Second)
 
@@ -70,7 +70,7 @@ func testSinusoidal(t *testing.T, describe spec.G, it spec.S) {
 		}
 
 		it.Before(func() {
-			subject.Generate()
+			generate(subject, envFake)
 		})
 
 		it("produces 726 requests in total", func() {
@@ -90,4 +90,106 @@ func testSinusoidal(t *testing.T, describe spec.G, it spec.S) {
 			}
 		})
 	})
+
+	describe("configuring offset, phase and harmonics", func() {
+		var rpsEachSecond = func() []int {
+			counts := make([]int, 30)
+			for _, mv := range envFake.Movements {
+				counts[mv.OccursAt().Sub(envFake.TheTime)/time.Second]++
+			}
+			return counts
+		}
+
+		describe("with an offset", func() {
+			it.Before(func() {
+				offset := 50
+				config.Offset = &offset
+				subject = NewSinusoidal(envFake, trafficSource, routingStock, config)
+				generate(subject, envFake)
+			})
+
+			it("oscillates around the offset instead of the amplitude", func() {
+				counts := rpsEachSecond()
+				assert.Equal(t, 50, counts[0])
+				assert.Equal(t, 70, counts[5])
+				assert.Equal(t, 30, counts[15])
+			})
+		})
+
+		describe("with an offset of zero", func() {
+			it.Before(func() {
+				offset := 0
+				config.Offset = &offset
+				subject = NewSinusoidal(envFake, trafficSource, routingStock, config)
+				generate(subject, envFake)
+			})
+
+			it("oscillates around zero, with no requests in the troughs", func() {
+				counts := rpsEachSecond()
+				assert.Equal(t, 0, counts[0])
+				assert.Equal(t, 20, counts[5])
+				assert.Equal(t, 0, counts[15])
+			})
+		})
+
+		describe("with a phase", func() {
+			it.Before(func() {
+				config.Phase = 5 * time.Second
+				subject = NewSinusoidal(envFake, trafficSource, routingStock, config)
+				generate(subject, envFake)
+			})
+
+			it("shifts the curve along the time axis", func() {
+				counts := rpsEachSecond()
+				assert.Equal(t, 40, counts[0])
+				assert.Equal(t, 0, counts[10])
+			})
+		})
+
+		describe("with harmonics", func() {
+			it.Before(func() {
+				config.Harmonics = []Harmonic{{Amplitude: 10, Period: 4 * time.Second}}
+				subject = NewSinusoidal(envFake, trafficSource, routingStock, config)
+				generate(subject, envFake)
+			})
+
+			it("defaults the offset to the sum of amplitudes", func() {
+				assert.Equal(t, 30, rpsEachSecond()[0])
+			})
+
+			it("sums the harmonics", func() {
+				assert.Equal(t, 30+6+10, rpsEachSecond()[1])
+			})
+		})
+
+		describe("with noise", func() {
+			it.Before(func() {
+				offset := 1
+				config.Offset = &offset
+				config.Noise = 100
+				subject = NewSinusoidal(envFake, trafficSource, routingStock, config)
+				generate(subject, envFake)
+			})
+
+			it("never produces a negative rate", func() {
+				for _, c := range rpsEachSecond() {
+					assert.True(t, c >= 0)
+				}
+			})
+		})
+
+		describe("when the scenario does not start at the epoch", func() {
+			it.Before(func() {
+				envFake.TheTime = time.Unix(7, 0)
+				envFake.TheHaltTime = envFake.TheTime.Add(30 * time.Second)
+				subject = NewSinusoidal(envFake, trafficSource, routingStock, config)
+				generate(subject, envFake)
+			})
+
+			it("begins the curve at the start of the scenario", func() {
+				assert.Equal(t, 20, rpsEachSecond()[0])
+				assert.Equal(t, 40, rpsEachSecond()[5])
+			})
+		})
+	})
 }
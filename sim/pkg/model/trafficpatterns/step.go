@@ -31,8 +31,8 @@ type step struct {
 }
 
 type StepConfig struct {
-	RPS       int           `json:"rps"`
-	StepAfter time.Duration `json:"step_after"`
+	RPS       int           `json:"rps" description:"Step to RPS"`
+	StepAfter time.Duration `json:"step_after" description:"Step after"`
 }
 
 func (*step) Name() string {
@@ -40,17 +40,12 @@ func (*step) Name() string {
 }
 
 func (s *step) Generate() {
-	var t time.Time
 	startAt := s.env.CurrentMovementTime().Add(s.stepAfter)
 
-	for t = startAt; t.Before(s.env.HaltTime()); t = t.Add(1 * time.Second) {
-		uniRand := NewUniformRandom(s.env, s.source, s.routingStock, UniformConfig{
-			NumberOfRequests: s.rps,
-			StartAt:          t,
-			RunFor:           time.Second,
-		})
-		uniRand.Generate()
-	}
+	startGenerating(s.env, startAt, nil, func(start time.Time, window time.Duration) bool {
+		scheduleArrivals(s.env, s.source, s.routingStock, s.rps, start, window)
+		return true
+	})
 }
 
 func NewStep(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config StepConfig) Pattern {
@@ -62,3 +57,14 @@ func NewStep(env simulator.Environment, source model.TrafficSource, routingStock
 		routingStock: routingStock,
 	}
 }
+
+func init() {
+	MustRegister(Registration{
+		Name:          "step",
+		Description:   "Step",
+		ExampleConfig: StepConfig{RPS: 10, StepAfter: 10 * time.Second},
+		New: func(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config interface{}) Pattern {
+			return NewStep(env, source, routingStock, *config.(*StepConfig))
+		},
+	})
+}
@@ -39,7 +39,7 @@ func testStep(t *testing.T, describe spec.G, it spec.S) {
 	var routingStock model.RequestsRoutingStock
 
 	it.Before(func() {
-		envFake = new(model.FakeEnvironment)
+		envFake = model.NewFakeEnvironment()
 		envFake.TheHaltTime = envFake.TheTime.Add(20 * time.Second)
 		routingStock = model.NewRequestsRoutingStock(envFake, model.NewReplicasActiveStock(envFake), simulator.NewSinkStock("Failed", "Request"))
 		trafficSource = model.NewTrafficSource(envFake, routingStock, model.RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
@@ -59,7 +59,7 @@ func testStep(t *testing.T, describe spec.G, it spec.S) {
 
 	describe("Generate()", func() {
 		it.Before(func() {
-			subject.Generate()
+			generate(subject, envFake)
 		})
 
 		describe("constant RPS", func() {
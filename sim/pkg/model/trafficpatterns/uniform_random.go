@@ -16,7 +16,6 @@
 package trafficpatterns
 
 import (
-	"math/rand"
 	"time"
 
 	"skenario/pkg/model"
@@ -32,10 +31,12 @@ type uniformRandom struct {
 	runFor           time.Duration
 }
 
+// UniformConfig spreads NumberOfRequests uniformly at random over RunFor, beginning at
+// StartAt. When they are not set, StartAt and RunFor default to the whole scenario.
 type UniformConfig struct {
-	NumberOfRequests int           `json:"number_of_requests"`
-	StartAt          time.Time     `json:"start_at"`
-	RunFor           time.Duration `json:"run_for"`
+	NumberOfRequests int           `json:"number_of_requests" description:"Number of requests"`
+	StartAt          time.Time     `json:"start_at" description:"Start at (defaults to scenario start)"`
+	RunFor           time.Duration `json:"run_for" description:"Run for (defaults to whole scenario)"`
 }
 
 func (ur *uniformRandom) Name() string {
@@ -43,16 +44,41 @@ func (ur *uniformRandom) Name() string {
 }
 
 func (ur *uniformRandom) Generate() {
-	for i := 0; i < ur.numberOfRequests; i++ {
-		r := rand.Int63n(ur.runFor.Nanoseconds())
-
-		ur.env.AddToSchedule(simulator.NewMovement(
-			"arrive_at_routing_stock",
-			ur.startAt.Add(time.Duration(r)*time.Nanosecond),
-			ur.source,
-			ur.routingStock,
-		))
+	startAt := ur.startAt
+	if startAt.IsZero() {
+		startAt = ur.env.CurrentMovementTime()
+	}
+	runFor := ur.runFor
+	if runFor <= 0 {
+		runFor = ur.env.HaltTime().Sub(startAt)
 	}
+	endAt := startAt.Add(runFor)
+	state := &uniformState{Remaining: ur.numberOfRequests}
+
+	// Each window takes its binomial share of the requests not yet placed. While at most
+	// 100 remain, the share is sampled exactly, giving the same distribution as placing
+	// every request in one go; above that, binomial approximates it. The last window
+	// always takes whatever remains, so every request is placed either way.
+	startGenerating(ur.env, startAt, state, func(start time.Time, window time.Duration) bool {
+		if state.Remaining <= 0 || !start.Before(endAt) {
+			return false
+		}
+
+		if start.Add(window).After(endAt) {
+			window = endAt.Sub(start)
+		}
+
+		count := binomial(ur.env.Rand("traffic"), state.Remaining, float64(window)/float64(endAt.Sub(start)))
+		scheduleArrivals(ur.env, ur.source, ur.routingStock, count, start, window)
+		state.Remaining -= count
+
+		return state.Remaining > 0
+	})
+}
+
+// uniformState is the number of requests that a uniform pattern has still to place.
+type uniformState struct {
+	Remaining int `json:"remaining"`
 }
 
 func NewUniformRandom(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config UniformConfig) Pattern {
@@ -65,3 +91,14 @@ func NewUniformRandom(env simulator.Environment, source model.TrafficSource, rou
 		runFor:           config.RunFor,
 	}
 }
+
+func init() {
+	MustRegister(Registration{
+		Name:          "golang_rand_uniform",
+		Description:   "Uniform",
+		ExampleConfig: UniformConfig{NumberOfRequests: 100},
+		New: func(env simulator.Environment, source model.TrafficSource, routingStock model.RequestsRoutingStock, config interface{}) Pattern {
+			return NewUniformRandom(env, source, routingStock, *config.(*UniformConfig))
+		},
+	})
+}
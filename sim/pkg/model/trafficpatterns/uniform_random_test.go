@@ -41,7 +41,8 @@ func testUniformRandom(t *testing.T, describe spec.G, it spec.S) {
 	var runFor time.Duration
 
 	it.Before(func() {
-		envFake = new(model.FakeEnvironment)
+		envFake = model.NewFakeEnvironment()
+		envFake.TheTime = time.Unix(0, 0)
 		envFake.TheHaltTime = envFake.TheTime.Add(10 * time.Second)
 		routingStock = model.NewRequestsRoutingStock(envFake, model.NewReplicasActiveStock(envFake), simulator.NewSinkStock("Failed", "Request"))
 		trafficSource = model.NewTrafficSource(envFake, routingStock, model.RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
@@ -55,7 +56,7 @@ func testUniformRandom(t *testing.T, describe spec.G, it spec.S) {
 		}
 
 		subject = NewUniformRandom(envFake, trafficSource, routingStock, config)
-		subject.Generate()
+		generate(subject, envFake)
 	})
 
 	describe("Name()", func() {
@@ -88,5 +89,45 @@ func testUniformRandom(t *testing.T, describe spec.G, it spec.S) {
 				assert.WithinDuration(t, startAt, mv.OccursAt(), runFor)
 			}
 		})
+
+		describe("with more requests than are split exactly", func() {
+			it.Before(func() {
+				envFake.Movements = nil
+				subject = NewUniformRandom(envFake, trafficSource, routingStock, UniformConfig{NumberOfRequests: 100000})
+				generate(subject, envFake)
+			})
+
+			it("places every request", func() {
+				assert.Len(t, envFake.Movements, 100000)
+			})
+
+			it("spreads them evenly across the scenario", func() {
+				perSecond := make([]int, 10)
+				for _, mv := range envFake.Movements {
+					perSecond[mv.OccursAt().Sub(envFake.TheTime)/time.Second]++
+				}
+
+				// the standard deviation of each second's count is about 95
+				for _, count := range perSecond {
+					assert.InDelta(t, 10000, count, 500)
+				}
+			})
+		})
+
+		describe("when no start time or duration is given", func() {
+			it.Before(func() {
+				envFake.Movements = nil
+				subject = NewUniformRandom(envFake, trafficSource, routingStock, UniformConfig{NumberOfRequests: 1000})
+				generate(subject, envFake)
+			})
+
+			it("spreads requests across the whole scenario", func() {
+				assert.Len(t, envFake.Movements, 1000)
+				for _, mv := range envFake.Movements {
+					assert.False(t, mv.OccursAt().Before(envFake.TheTime))
+					assert.True(t, mv.OccursAt().Before(envFake.TheHaltTime))
+				}
+			})
+		})
 	})
 }
@@ -0,0 +1,164 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// Virtual users form a closed loop: each user sends a request, waits for it to complete
+// or fail, then thinks for a while before sending the next one. Unlike open-loop traffic,
+// slower responses lower the offered load.
+
+type UsersThinkingStock interface {
+	simulator.ThroughStock
+}
+
+type UsersWaitingStock interface {
+	simulator.ThroughStock
+	RequestFinished()
+}
+
+type usersThinkingStock struct {
+	simulator.BoundedStock
+
+	env       simulator.Environment
+	waiting   UsersWaitingStock
+	thinkTime func() time.Duration
+}
+
+func (uts *usersThinkingStock) Add(entity simulator.Entity) error {
+	err := uts.BoundedStock.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	think := uts.thinkTime()
+	if think < time.Nanosecond {
+		think = time.Nanosecond
+	}
+
+	uts.env.AddToSchedule(simulator.NewMovement(
+		"finish_thinking",
+		uts.env.CurrentMovementTime().Add(think),
+		uts,
+		uts.waiting,
+	))
+
+	return nil
+}
+
+type usersWaitingStock struct {
+	simulator.BoundedStock
+
+	env           simulator.Environment
+	thinking      UsersThinkingStock
+	requestSource simulator.SourceStock
+	routingStock  RequestsRoutingStock
+}
+
+func (uws *usersWaitingStock) Add(entity simulator.Entity) error {
+	err := uws.BoundedStock.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	uws.env.AddToSchedule(simulator.NewMovement(
+		"arrive_at_routing_stock",
+		uws.env.CurrentMovementTime().Add(1*time.Nanosecond),
+		uws.requestSource,
+		uws.routingStock,
+	))
+
+	return nil
+}
+
+// RequestFinished is called when a request sent by a waiting user completes or fails.
+// Users are interchangeable, so whichever user has waited longest goes back to thinking.
+func (uws *usersWaitingStock) RequestFinished() {
+	uws.env.AddToSchedule(simulator.NewMovement(
+		"finish_waiting",
+		uws.env.CurrentMovementTime().Add(1*time.Nanosecond),
+		uws,
+		uws.thinking,
+	))
+}
+
+// closedLoopSource creates requests on behalf of waiting users. It shares its name with
+// the open-loop TrafficSource so that results are reported in the same way.
+type closedLoopSource struct {
+	source TrafficSource
+	users  UsersWaitingStock
+}
+
+func (cls *closedLoopSource) Name() simulator.StockName {
+	return cls.source.Name()
+}
+
+func (cls *closedLoopSource) KindStocked() simulator.EntityKind {
+	return cls.source.KindStocked()
+}
+
+func (cls *closedLoopSource) Count() uint64 {
+	return 0
+}
+
+func (cls *closedLoopSource) EntitiesInStock() []*simulator.Entity {
+	return []*simulator.Entity{}
+}
+
+func (cls *closedLoopSource) Remove() simulator.Entity {
+	entity := cls.source.Remove()
+	if req, ok := entity.(*requestEntity); ok {
+		req.users = cls.users
+	}
+
+	return entity
+}
+
+// NewVirtualUsers creates the pair of stocks which virtual users cycle between. Users
+// added to the thinking stock will begin sending requests after their first think time.
+func NewVirtualUsers(env simulator.Environment, source TrafficSource, routingStock RequestsRoutingStock, thinkTime func() time.Duration) (UsersThinkingStock, UsersWaitingStock) {
+	thinking := &usersThinkingStock{
+		env:          env,
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, "UsersThinking"), "User", simulator.StockConfig{}),
+		thinkTime:    thinkTime,
+	}
+
+	waiting := &usersWaitingStock{
+		env:          env,
+		BoundedStock: simulator.NewBoundedStock(simulator.ServiceStockName(env, "UsersWaiting"), "User", simulator.StockConfig{}),
+		thinking:     thinking,
+		routingStock: routingStock,
+	}
+	waiting.requestSource = &closedLoopSource{
+		source: source,
+		users:  waiting,
+	}
+	thinking.waiting = waiting
+
+	if ts, ok := source.(*trafficSource); ok {
+		ts.users = waiting
+	}
+
+	env.AddStock(thinking)
+	env.AddStock(waiting)
+	env.AddStock(waiting.requestSource)
+
+	return thinking, waiting
+}
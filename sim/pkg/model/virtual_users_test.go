@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+
+	"skenario/pkg/simulator"
+)
+
+func TestVirtualUsers(t *testing.T) {
+	spec.Run(t, "Virtual users", testVirtualUsers, spec.Report(report.Terminal{}))
+}
+
+func testVirtualUsers(t *testing.T, describe spec.G, it spec.S) {
+	var thinking UsersThinkingStock
+	var waiting UsersWaitingStock
+	var envFake *FakeEnvironment
+	var routingStock RequestsRoutingStock
+	var thinkTime time.Duration
+
+	it.Before(func() {
+		envFake = NewFakeEnvironment()
+		envFake.TheTime = time.Unix(0, 0)
+		thinkTime = 3 * time.Second
+		routingStock = NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), simulator.NewSinkStock("RequestsFailed", "Request"))
+		source := NewTrafficSource(envFake, routingStock, RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
+		thinking, waiting = NewVirtualUsers(envFake, source, routingStock, func() time.Duration { return thinkTime })
+	})
+
+	describe("NewVirtualUsers()", func() {
+		it("creates a UsersThinking stock", func() {
+			assert.Equal(t, simulator.StockName("UsersThinking"), thinking.Name())
+			assert.Equal(t, simulator.EntityKind("User"), thinking.KindStocked())
+		})
+
+		it("creates a UsersWaiting stock", func() {
+			assert.Equal(t, simulator.StockName("UsersWaiting"), waiting.Name())
+			assert.Equal(t, simulator.EntityKind("User"), waiting.KindStocked())
+		})
+	})
+
+	describe("adding a user to UsersThinking", func() {
+		it.Before(func() {
+			err := thinking.Add(simulator.NewEntity("user-1", "User"))
+			assert.NoError(t, err)
+		})
+
+		it("stocks the user", func() {
+			assert.Equal(t, uint64(1), thinking.Count())
+		})
+
+		it("schedules the user to finish thinking after the think time", func() {
+			assert.Len(t, envFake.Movements, 1)
+			assert.Equal(t, simulator.MovementKind("finish_thinking"), envFake.Movements[0].Kind())
+			assert.Equal(t, envFake.TheTime.Add(thinkTime), envFake.Movements[0].OccursAt())
+			assert.Equal(t, thinking, envFake.Movements[0].From())
+			assert.Equal(t, waiting, envFake.Movements[0].To())
+		})
+
+		describe("when the think time is zero", func() {
+			it.Before(func() {
+				thinkTime = 0
+				envFake.Movements = nil
+				err := thinking.Add(simulator.NewEntity("user-2", "User"))
+				assert.NoError(t, err)
+			})
+
+			it("still schedules the movement in the future", func() {
+				assert.Equal(t, envFake.TheTime.Add(time.Nanosecond), envFake.Movements[0].OccursAt())
+			})
+		})
+	})
+
+	describe("adding a user to UsersWaiting", func() {
+		var arrival simulator.Movement
+
+		it.Before(func() {
+			err := waiting.Add(simulator.NewEntity("user-1", "User"))
+			assert.NoError(t, err)
+			arrival = envFake.Movements[0]
+		})
+
+		it("schedules a request to arrive at the routing stock", func() {
+			assert.Equal(t, simulator.MovementKind("arrive_at_routing_stock"), arrival.Kind())
+			assert.Equal(t, envFake.TheTime.Add(time.Nanosecond), arrival.OccursAt())
+			assert.Equal(t, routingStock, arrival.To())
+		})
+
+		it("sends requests from a source named TrafficSource", func() {
+			assert.Equal(t, simulator.StockName("TrafficSource"), arrival.From().Name())
+		})
+
+		it("ties requests back to the waiting users", func() {
+			req := arrival.From().Remove().(*requestEntity)
+			assert.Equal(t, waiting, req.users)
+		})
+	})
+
+	describe("RequestFinished()", func() {
+		it.Before(func() {
+			waiting.RequestFinished()
+		})
+
+		it("schedules a waiting user to go back to thinking", func() {
+			assert.Len(t, envFake.Movements, 1)
+			assert.Equal(t, simulator.MovementKind("finish_waiting"), envFake.Movements[0].Kind())
+			assert.Equal(t, waiting, envFake.Movements[0].From())
+			assert.Equal(t, thinking, envFake.Movements[0].To())
+		})
+	})
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"skenario/pkg/data"
+)
+
+// comparisonPoints is about how many points each aligned series of a comparison has.
+const comparisonPoints = 500
+
+// responseTimeBuckets is how many buckets response times are counted into.
+const responseTimeBuckets = 20
+
+// AlignedValue is a value of a run at a point in simulated time shared by every compared run.
+type AlignedValue struct {
+	At    int64   `json:"at"`
+	Value float64 `json:"value"`
+}
+
+type ComparedRun struct {
+	ScenarioRunId  int64          `json:"scenario_run_id"`
+	Group          int            `json:"group"`
+	Seed           int64          `json:"seed"`
+	RanFor         time.Duration  `json:"ran_for"`
+	ActiveReplicas []AlignedValue `json:"active_replicas"`
+	CPUUtilization []AlignedValue `json:"cpu_utilization"`
+	// ResponseTimeCounts counts completed requests into the comparison's response time
+	// buckets.
+	ResponseTimeCounts []int64 `json:"response_time_counts"`
+}
+
+// Comparison lays runs side by side. Every run's series are sampled at the same steps of
+// simulated time, and response times are counted into the same buckets, so that runs can
+// be overlaid. Groups are compared with the first group.
+type Comparison struct {
+	Step time.Duration `json:"step"`
+	// ResponseTimeBuckets are the upper bounds of equal-width buckets of response times.
+	ResponseTimeBuckets []time.Duration    `json:"response_time_buckets"`
+	Runs                []ComparedRun      `json:"runs"`
+	Groups              []data.GroupStats  `json:"groups"`
+	Deltas              []data.MetricDelta `json:"deltas"`
+}
+
+// CompareHandler compares groups of runs. Each "group" parameter is a comma-separated list
+// of runs, usually repetitions of one configuration with different seeds, and each "run"
+// parameter is a group of its own. At least two groups are needed.
+func (ss *SkenarioServer) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	groups, err := comparedGroups(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, release := ss.historyStore(r)
+	defer release()
+
+	stats, deltas, err := data.CompareGroups(store, groups)
+	switch err {
+	case nil:
+	case data.ErrNoSuchRun:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case data.ErrNoSummary:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		panic(fmt.Errorf("could not compare scenario runs: %s", err.Error()))
+	}
+
+	responses := make([]*SkenarioRunResponse, 0)
+	runs := make([]ComparedRun, 0)
+	var longest time.Duration
+	for g, group := range groups {
+		for _, scenarioRunId := range group {
+			record, err := store.LoadRun(scenarioRunId)
+			if err != nil {
+				panic(fmt.Errorf("could not load scenario run %d: %s", scenarioRunId, err.Error()))
+			}
+			vds, err := storedRunResponse(store, record)
+			if err != nil {
+				panic(fmt.Errorf("could not load scenario run %d: %s", scenarioRunId, err.Error()))
+			}
+
+			responses = append(responses, vds)
+			runs = append(runs, ComparedRun{ScenarioRunId: scenarioRunId, Group: g, Seed: vds.Seed, RanFor: vds.RanFor})
+			if vds.RanFor > longest {
+				longest = vds.RanFor
+			}
+		}
+	}
+
+	comparison := Comparison{
+		Step:                comparisonStep(longest),
+		ResponseTimeBuckets: responseTimeBucketBounds(responses),
+		Runs:                runs,
+		Groups:              stats,
+		Deltas:              deltas,
+	}
+	for i, vds := range responses {
+		comparison.Runs[i].ActiveReplicas = alignedActiveReplicas(vds.TallyLines, comparison.Step, vds.RanFor)
+		comparison.Runs[i].CPUUtilization = alignedCPUUtilization(vds.CPUUtilizations, comparison.Step, vds.RanFor)
+		comparison.Runs[i].ResponseTimeCounts = responseTimeCounts(vds.ResponseTimes, comparison.ResponseTimeBuckets)
+	}
+
+	writeJSON(w, http.StatusOK, comparison)
+}
+
+func comparedGroups(r *http.Request) ([][]int64, error) {
+	query := r.URL.Query()
+	lists := append(append([]string{}, query["group"]...), query["run"]...)
+
+	groups := make([][]int64, 0)
+	for _, list := range lists {
+		group := make([]int64, 0)
+		for _, run := range strings.Split(list, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(run), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("run '%s' is not a scenario run id", run)
+			}
+			group = append(group, id)
+		}
+		groups = append(groups, group)
+	}
+
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("at least two groups of runs are needed to compare, got %d", len(groups))
+	}
+
+	return groups, nil
+}
+
+// comparisonStep gives a whole number of seconds that divides the longest run into about
+// comparisonPoints steps.
+func comparisonStep(longest time.Duration) time.Duration {
+	step := longest / comparisonPoints
+	if step < time.Second {
+		return time.Second
+	}
+
+	return step.Round(time.Second)
+}
+
+// alignedActiveReplicas gives the number of active replicas of every service at each step.
+func alignedActiveReplicas(lines []TallyLine, step, ranFor time.Duration) []AlignedValue {
+	aligned := make([]AlignedValue, 0)
+	current := make(map[string]int64)
+	next := 0
+	for at := time.Duration(0); at <= ranFor; at += step {
+		for ; next < len(lines) && lines[next].OccursAt <= startAt.Add(at).UnixNano(); next++ {
+			name := lines[next].StockName
+			if name[strings.LastIndex(name, "/")+1:] == "ReplicasActive" {
+				current[name] = lines[next].Tally
+			}
+		}
+
+		active := int64(0)
+		for _, tally := range current {
+			active += tally
+		}
+		aligned = append(aligned, AlignedValue{At: at.Nanoseconds(), Value: float64(active)})
+	}
+
+	return aligned
+}
+
+// alignedCPUUtilization gives the CPU utilization most recently calculated at each step.
+func alignedCPUUtilization(utilizations []CPUUtilizationMetric, step, ranFor time.Duration) []AlignedValue {
+	aligned := make([]AlignedValue, 0)
+	current := 0.0
+	next := 0
+	for at := time.Duration(0); at <= ranFor; at += step {
+		for ; next < len(utilizations) && utilizations[next].CalculatedAt <= startAt.Add(at).UnixNano(); next++ {
+			current = utilizations[next].CPUUtilization
+		}
+
+		aligned = append(aligned, AlignedValue{At: at.Nanoseconds(), Value: current})
+	}
+
+	return aligned
+}
+
+// responseTimeBucketBounds divides the response times of every run into equal buckets, up to
+// the slowest response.
+func responseTimeBucketBounds(responses []*SkenarioRunResponse) []time.Duration {
+	slowest := int64(0)
+	for _, vds := range responses {
+		for _, rt := range vds.ResponseTimes {
+			if rt.ResponseTime > slowest {
+				slowest = rt.ResponseTime
+			}
+		}
+	}
+
+	width := slowest / responseTimeBuckets
+	if slowest%responseTimeBuckets != 0 || width == 0 {
+		width++
+	}
+
+	bounds := make([]time.Duration, responseTimeBuckets)
+	for i := range bounds {
+		bounds[i] = time.Duration(width * int64(i+1))
+	}
+
+	return bounds
+}
+
+func responseTimeCounts(responseTimes []ResponseTime, bounds []time.Duration) []int64 {
+	counts := make([]int64, len(bounds))
+	for _, rt := range responseTimes {
+		for i, bound := range bounds {
+			if time.Duration(rt.ResponseTime) <= bound {
+				counts[i]++
+				break
+			}
+		}
+	}
+
+	return counts
+}
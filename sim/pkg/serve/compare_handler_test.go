@@ -0,0 +1,202 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/data"
+	"skenario/pkg/model"
+)
+
+func testCompareHandler(t *testing.T, describe spec.G, it spec.S) {
+	describe("comparedGroups()", func() {
+		it("treats each group parameter as a group and each run parameter as a group of one", func() {
+			req, err := http.NewRequest("GET", "/compare?group=1,2,3&group=4, 5&run=6", nil)
+			require.NoError(t, err)
+
+			groups, err := comparedGroups(req)
+			require.NoError(t, err)
+			assert.Equal(t, [][]int64{{1, 2, 3}, {4, 5}, {6}}, groups)
+		})
+
+		it("needs at least two groups", func() {
+			req, err := http.NewRequest("GET", "/compare?group=1,2,3", nil)
+			require.NoError(t, err)
+
+			_, err = comparedGroups(req)
+			assert.Error(t, err)
+		})
+
+		it("rejects runs that are not scenario run ids", func() {
+			req, err := http.NewRequest("GET", "/compare?group=1,latest&run=2", nil)
+			require.NoError(t, err)
+
+			_, err = comparedGroups(req)
+			assert.Error(t, err)
+		})
+	})
+
+	describe("comparisonStep()", func() {
+		it("is at least a second", func() {
+			assert.Equal(t, time.Second, comparisonStep(10*time.Second))
+		})
+
+		it("is a whole number of seconds dividing the longest run into about comparisonPoints steps", func() {
+			assert.Equal(t, 2*time.Second, comparisonStep(1000*time.Second))
+			assert.Equal(t, 7*time.Second, comparisonStep(3600*time.Second))
+		})
+	})
+
+	describe("alignedActiveReplicas()", func() {
+		it("sums the active replicas of every service at each step", func() {
+			lines := []TallyLine{
+				{OccursAt: startAt.Add(500 * time.Millisecond).UnixNano(), StockName: "ReplicasActive", Tally: 1},
+				{OccursAt: startAt.Add(1500 * time.Millisecond).UnixNano(), StockName: "ReplicasLaunching", Tally: 3},
+				{OccursAt: startAt.Add(1500 * time.Millisecond).UnixNano(), StockName: "other/ReplicasActive", Tally: 2},
+				{OccursAt: startAt.Add(2500 * time.Millisecond).UnixNano(), StockName: "ReplicasActive", Tally: 0},
+			}
+
+			assert.Equal(t, []AlignedValue{
+				{At: 0, Value: 0},
+				{At: time.Second.Nanoseconds(), Value: 1},
+				{At: (2 * time.Second).Nanoseconds(), Value: 3},
+				{At: (3 * time.Second).Nanoseconds(), Value: 2},
+			}, alignedActiveReplicas(lines, time.Second, 3*time.Second))
+		})
+	})
+
+	describe("alignedCPUUtilization()", func() {
+		it("holds the most recently calculated utilization until the next one", func() {
+			utilizations := []CPUUtilizationMetric{
+				{CalculatedAt: startAt.Add(time.Second).UnixNano(), CPUUtilization: 40},
+				{CalculatedAt: startAt.Add(3 * time.Second).UnixNano(), CPUUtilization: 80},
+			}
+
+			assert.Equal(t, []AlignedValue{
+				{At: 0, Value: 0},
+				{At: (2 * time.Second).Nanoseconds(), Value: 40},
+				{At: (4 * time.Second).Nanoseconds(), Value: 80},
+			}, alignedCPUUtilization(utilizations, 2*time.Second, 4*time.Second))
+		})
+	})
+
+	describe("response time buckets", func() {
+		var responses []*SkenarioRunResponse
+
+		it.Before(func() {
+			responses = []*SkenarioRunResponse{
+				{ResponseTimes: []ResponseTime{{ResponseTime: int64(100 * time.Millisecond)}, {ResponseTime: int64(2 * time.Second)}}},
+				{ResponseTimes: []ResponseTime{{ResponseTime: int64(time.Second)}}},
+			}
+		})
+
+		it("divides response times into equal buckets up to the slowest response", func() {
+			bounds := responseTimeBucketBounds(responses)
+			require.Len(t, bounds, responseTimeBuckets)
+			assert.Equal(t, 100*time.Millisecond, bounds[0])
+			assert.Equal(t, 2*time.Second, bounds[responseTimeBuckets-1])
+		})
+
+		it("counts each response into the first bucket it fits", func() {
+			bounds := responseTimeBucketBounds(responses)
+			counts := responseTimeCounts(responses[0].ResponseTimes, bounds)
+
+			assert.Equal(t, int64(1), counts[0])
+			assert.Equal(t, int64(1), counts[responseTimeBuckets-1])
+			assert.Equal(t, int64(2), counts[0]+counts[responseTimeBuckets-1])
+		})
+	})
+
+	describe("CompareHandler()", func() {
+		var server *SkenarioServer
+		var release func()
+		var store data.RunStore
+		var recorder *httptest.ResponseRecorder
+
+		saveRun := func(failureRate float64) int64 {
+			writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, writer.Finish(nil, nil))
+
+			id := writer.ScenarioRunId()
+			if failureRate >= 0 {
+				require.NoError(t, store.SaveSummary(id, data.RunSummary{FailureRate: failureRate}))
+			}
+			return id
+		}
+
+		get := func(url string) {
+			req, err := http.NewRequest("GET", url, nil)
+			require.NoError(t, err)
+
+			recorder = httptest.NewRecorder()
+			server.CompareHandler(recorder, req)
+		}
+
+		it.Before(func() {
+			var err error
+			server = newTestServer()
+			store, release, err = server.InMemoryBackend.Open()
+			require.NoError(t, err)
+		})
+
+		it.After(func() {
+			release()
+		})
+
+		it("compares each group with the first", func() {
+			baseline, other := saveRun(0.1), saveRun(0.6)
+
+			get(fmt.Sprintf("/compare?in_memory_database=true&run=%d&run=%d", baseline, other))
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var comparison Comparison
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&comparison))
+			assert.Equal(t, time.Second, comparison.Step)
+			require.Len(t, comparison.Runs, 2)
+			assert.Equal(t, 1, comparison.Runs[1].Group)
+			assert.Len(t, comparison.Groups, 2)
+			require.NotEmpty(t, comparison.Deltas)
+			assert.Equal(t, "failure_rate", comparison.Deltas[0].Metric)
+			assert.InDelta(t, 0.5, comparison.Deltas[0].Delta, 0.0001)
+		})
+
+		it("rejects fewer than two groups", func() {
+			get("/compare?in_memory_database=true&group=1,2")
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+
+		it("gives 404 for runs that do not exist", func() {
+			get(fmt.Sprintf("/compare?in_memory_database=true&run=%d&run=999999", saveRun(0.1)))
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+		})
+
+		it("gives 409 for runs that were never summarized", func() {
+			get(fmt.Sprintf("/compare?in_memory_database=true&run=%d&run=%d", saveRun(0.1), saveRun(-1)))
+			assert.Equal(t, http.StatusConflict, recorder.Code)
+		})
+	})
+}
@@ -0,0 +1,440 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"skenario/pkg/simulator"
+)
+
+const (
+	debugRecentMovements = 20
+	debugPendingShown    = 20
+
+	// debugSessionIdle is how long a session may go unused before it is closed, as
+	// clients can go away without closing their sessions.
+	debugSessionIdle = 30 * time.Minute
+	// debugSweepInterval is how often sessions are checked for having gone idle.
+	debugSweepInterval = time.Minute
+)
+
+// ErrDebugSessionClosed is given for commands to a session that has been closed.
+var ErrDebugSessionClosed = errors.New("debugger session is closed")
+
+// DebugCommand is one instruction to a DebugSession. Action is one of "step", "run_until",
+// "run_until_kind" or "inspect"; the other fields are used by the actions that need them.
+type DebugCommand struct {
+	Action string                 `json:"action"`
+	Steps  int                    `json:"steps,omitempty"`
+	At     time.Duration          `json:"at,omitempty"`
+	Kind   simulator.MovementKind `json:"kind,omitempty"`
+
+	// Stock limits the stocks shown to those whose names contain it.
+	Stock string `json:"stock,omitempty"`
+	// Pending is how many pending movements to show. It defaults to debugPendingShown.
+	Pending int `json:"pending,omitempty"`
+}
+
+// SteppedMovement is a movement made by a debug session, completed or ignored.
+type SteppedMovement struct {
+	Kind     simulator.MovementKind `json:"kind"`
+	OccursAt time.Duration          `json:"occurs_at"`
+	From     simulator.StockName    `json:"from"`
+	To       simulator.StockName    `json:"to"`
+	Moved    simulator.EntityName   `json:"moved,omitempty"`
+	Ignored  string                 `json:"ignored,omitempty"`
+}
+
+// DebugState is what a debug session shows after each command. Recent holds the last
+// movements made by the latest command that ran any.
+type DebugState struct {
+	SessionId     string                      `json:"session_id"`
+	CurrentTime   time.Duration               `json:"current_time"`
+	Halted        bool                        `json:"halted"`
+	MovementCount int                         `json:"movement_count"`
+	Recent        []SteppedMovement           `json:"recent"`
+	PendingCount  int                         `json:"pending_count"`
+	Pending       []simulator.PendingMovement `json:"pending"`
+	Stocks        []simulator.StockContents   `json:"stocks"`
+}
+
+// DebugSession holds a scenario part way through its run, so that it can be run a little
+// at a time and inspected in between. Nothing is recorded in the database.
+type DebugSession struct {
+	lastUsed int64 // in Unix nanoseconds, accessed atomically, so it comes first to be aligned
+
+	id      string
+	env     simulator.Environment
+	ctx     *commandContext
+	onClose func()
+
+	mu     sync.Mutex
+	recent []SteppedMovement
+	halted bool
+	closed bool
+}
+
+// NewDebugSession builds the scenario in runReq, ready to be stepped through from its
+// start, stopping early if ctx is done. Close must be called when the session is finished
+// with.
+func NewDebugSession(ctx context.Context, runReq *SkenarioRunRequest) (*DebugSession, error) {
+	commands := newCommandContext(ctx)
+	s, err := newScenario(commands, runReq)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := newDebugSession(s.env, commands, s.deleteAutoscalers)
+	s.build()
+
+	return ds, nil
+}
+
+var debugSessionSequence int32 = 0
+
+// newDebugSession steps through env, which must have been created with ctx.
+func newDebugSession(env simulator.Environment, ctx *commandContext, onClose func()) *DebugSession {
+	ds := &DebugSession{
+		id:      strconv.Itoa(int(atomic.AddInt32(&debugSessionSequence, 1))),
+		env:     env,
+		ctx:     ctx,
+		onClose: onClose,
+		recent:  make([]SteppedMovement, 0, debugRecentMovements),
+	}
+	ds.touch(time.Now())
+	env.AddObserver(simulator.ObserverFuncs{
+		OnCompleted: func(c simulator.CompletedMovement) error {
+			ds.remember(c.Movement, c.Moved, "")
+			// movements held back by a full stock are still pending once the scenario halts
+			if c.Movement.Kind() == "running_to_halted" {
+				ds.halted = true
+			}
+			return nil
+		},
+		OnIgnored: func(i simulator.IgnoredMovement) error {
+			ds.remember(i.Movement, i.Moved, i.Reason)
+			return nil
+		},
+	})
+	env.DiscardMovements()
+
+	return ds
+}
+
+func (ds *DebugSession) Id() string {
+	return ds.id
+}
+
+// Do carries out a command and gives the state of the scenario afterwards. Running stops
+// early if ctx is done. Once the session is closed, Do gives ErrDebugSessionClosed.
+func (ds *DebugSession) Do(ctx context.Context, cmd DebugCommand) (DebugState, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.closed {
+		return DebugState{}, ErrDebugSessionClosed
+	}
+	ds.touch(time.Now())
+	ds.ctx.use(ctx)
+
+	if cmd.Action != "inspect" {
+		ds.recent = ds.recent[:0]
+	}
+
+	var err error
+	switch cmd.Action {
+	case "step":
+		steps := cmd.Steps
+		if steps <= 0 {
+			steps = 1
+		}
+		for i := 0; i < steps; i++ {
+			var stepped bool
+			stepped, err = ds.env.Step()
+			if !stepped || err != nil {
+				break
+			}
+		}
+	case "run_until":
+		_, _, err = ds.env.RunUntil(startAt.Add(cmd.At))
+	case "run_until_kind":
+		if cmd.Kind == "" {
+			return DebugState{}, fmt.Errorf("run_until_kind needs a movement kind")
+		}
+		_, _, err = ds.env.RunUntilKind(cmd.Kind)
+	case "inspect":
+	default:
+		return DebugState{}, fmt.Errorf("unknown debugger action '%s'", cmd.Action)
+	}
+	if err != nil {
+		return DebugState{}, err
+	}
+
+	return ds.state(cmd), nil
+}
+
+// Close cleans up the scenario, waiting for any command being carried out to finish. It
+// can be called more than once.
+func (ds *DebugSession) Close() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.closed {
+		return
+	}
+	ds.closed = true
+	ds.onClose()
+}
+
+func (ds *DebugSession) touch(at time.Time) {
+	atomic.StoreInt64(&ds.lastUsed, at.UnixNano())
+}
+
+// idleAt gives how long the session had gone unused at a time.
+func (ds *DebugSession) idleAt(at time.Time) time.Duration {
+	return at.Sub(time.Unix(0, atomic.LoadInt64(&ds.lastUsed)))
+}
+
+func (ds *DebugSession) state(cmd DebugCommand) DebugState {
+	snapshot := ds.env.Snapshot()
+
+	shown := cmd.Pending
+	if shown <= 0 {
+		shown = debugPendingShown
+	}
+	if shown > len(snapshot.Pending) {
+		shown = len(snapshot.Pending)
+	}
+
+	stocks := make([]simulator.StockContents, 0, len(snapshot.Stocks))
+	for _, s := range snapshot.Stocks {
+		if strings.Contains(string(s.Name), cmd.Stock) {
+			stocks = append(stocks, s)
+		}
+	}
+
+	recent := make([]SteppedMovement, len(ds.recent))
+	copy(recent, ds.recent)
+
+	return DebugState{
+		SessionId:     ds.id,
+		CurrentTime:   snapshot.TakenAt.Sub(startAt),
+		Halted:        ds.halted,
+		MovementCount: snapshot.MovementsSoFar,
+		Recent:        recent,
+		PendingCount:  len(snapshot.Pending),
+		Pending:       snapshot.Pending[:shown],
+		Stocks:        stocks,
+	}
+}
+
+// remember keeps the most recent movements, oldest first.
+func (ds *DebugSession) remember(movement simulator.Movement, moved simulator.Entity, ignored string) {
+	sm := SteppedMovement{
+		Kind:     movement.Kind(),
+		OccursAt: movement.OccursAt().Sub(startAt),
+		Ignored:  ignored,
+	}
+	if movement.From() != nil {
+		sm.From = movement.From().Name()
+	}
+	if movement.To() != nil {
+		sm.To = movement.To().Name()
+	}
+	if moved != nil {
+		sm.Moved = moved.Name()
+	}
+
+	if len(ds.recent) == debugRecentMovements {
+		copy(ds.recent, ds.recent[1:])
+		ds.recent = ds.recent[:len(ds.recent)-1]
+	}
+	ds.recent = append(ds.recent, sm)
+}
+
+// commandContext is the context of a debug session's environment. A session outlives the
+// request that starts it, so rather than having a context of its own, it is done when the
+// context of the command being carried out is.
+type commandContext struct {
+	mu      sync.Mutex
+	current context.Context
+}
+
+func newCommandContext(ctx context.Context) *commandContext {
+	return &commandContext{current: ctx}
+}
+
+func (cc *commandContext) use(ctx context.Context) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.current = ctx
+}
+
+func (cc *commandContext) get() context.Context {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.current
+}
+
+func (cc *commandContext) Deadline() (time.Time, bool) {
+	return cc.get().Deadline()
+}
+
+func (cc *commandContext) Done() <-chan struct{} {
+	return cc.get().Done()
+}
+
+func (cc *commandContext) Err() error {
+	return cc.get().Err()
+}
+
+func (cc *commandContext) Value(key interface{}) interface{} {
+	return cc.get().Value(key)
+}
+
+var debugSessions = struct {
+	sync.Mutex
+	byId map[string]*DebugSession
+}{byId: make(map[string]*DebugSession)}
+
+// DebuggerStartHandler builds the scenario in a run request and gives a session to step
+// through it with DebuggerCommandHandler.
+func DebuggerStartHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	runReq := &SkenarioRunRequest{}
+	err := json.NewDecoder(r.Body).Decode(runReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ds, err := NewDebugSession(r.Context(), runReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	debugSessions.Lock()
+	debugSessions.byId[ds.Id()] = ds
+	debugSessions.Unlock()
+
+	writeDebugState(w, r, ds, DebugCommand{Action: "inspect"})
+}
+
+func DebuggerCommandHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ds, ok := debugSession(chi.URLParam(r, "sessionId"))
+	if !ok {
+		http.Error(w, "no such debugger session", http.StatusNotFound)
+		return
+	}
+
+	cmd := DebugCommand{}
+	err := json.NewDecoder(r.Body).Decode(&cmd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeDebugState(w, r, ds, cmd)
+}
+
+func DebuggerCloseHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "sessionId")
+	ds, ok := debugSession(id)
+	if !ok {
+		http.Error(w, "no such debugger session", http.StatusNotFound)
+		return
+	}
+
+	debugSessions.Lock()
+	delete(debugSessions.byId, id)
+	debugSessions.Unlock()
+
+	ds.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sweepDebugSessions closes the sessions that have gone unused for debugSessionIdle.
+func sweepDebugSessions(now time.Time) {
+	idle := make([]*DebugSession, 0)
+
+	debugSessions.Lock()
+	for id, ds := range debugSessions.byId {
+		if ds.idleAt(now) >= debugSessionIdle {
+			delete(debugSessions.byId, id)
+			idle = append(idle, ds)
+		}
+	}
+	debugSessions.Unlock()
+
+	for _, ds := range idle {
+		ds.Close()
+	}
+}
+
+// sweepDebugSessionsEvery sweeps idle sessions at every interval, until stop is closed.
+func sweepDebugSessionsEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			sweepDebugSessions(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func debugSession(id string) (*DebugSession, bool) {
+	debugSessions.Lock()
+	defer debugSessions.Unlock()
+
+	ds, ok := debugSessions.byId[id]
+	return ds, ok
+}
+
+func writeDebugState(w http.ResponseWriter, r *http.Request, ds *DebugSession, cmd DebugCommand) {
+	state, err := ds.Do(r.Context(), cmd)
+	if err == ErrDebugSessionClosed {
+		// the session was closed after it was looked up
+		http.Error(w, "no such debugger session", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
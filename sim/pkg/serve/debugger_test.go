@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+
+	"skenario/pkg/simulator"
+)
+
+func testDebugger(t *testing.T, describe spec.G, it spec.S) {
+	var subject *DebugSession
+	var env simulator.Environment
+	var closed int
+
+	it.Before(func() {
+		closed = 0
+		commands := newCommandContext(context.Background())
+		env = simulator.NewEnvironment(commands, startAt, 10*time.Second)
+
+		source := simulator.NewThroughStock("Source", "Thing")
+		sink := simulator.NewSinkStock("Sink", "Thing")
+		for i := 1; i <= 3; i++ {
+			err := source.Add(simulator.NewEntity("thing", "Thing"))
+			assert.NoError(t, err)
+			env.AddToSchedule(simulator.NewMovement("move_thing", startAt.Add(time.Duration(i)*time.Second), source, sink))
+		}
+		env.AddToSchedule(simulator.NewMovement("last_thing", startAt.Add(5*time.Second), source, sink))
+
+		subject = newDebugSession(env, commands, func() { closed++ })
+	})
+
+	describe("Do()", func() {
+		it("inspects without running anything", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "inspect"})
+			assert.NoError(t, err)
+			assert.Equal(t, 0, state.MovementCount)
+			assert.Equal(t, 6, state.PendingCount)
+			assert.Equal(t, simulator.MovementKind("start_to_running"), state.Pending[0].Kind)
+		})
+
+		it("steps one movement at a time by default", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "step"})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, state.MovementCount)
+			assert.Equal(t, simulator.MovementKind("start_to_running"), state.Recent[0].Kind)
+		})
+
+		it("steps several movements", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "step", Steps: 3})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, state.MovementCount)
+			assert.Equal(t, 2*time.Second, state.CurrentTime)
+		})
+
+		it("shows only the movements made by the latest command", func() {
+			_, err := subject.Do(context.Background(), DebugCommand{Action: "step", Steps: 3})
+			assert.NoError(t, err)
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "step"})
+			assert.NoError(t, err)
+			assert.Len(t, state.Recent, 1)
+
+			state, err = subject.Do(context.Background(), DebugCommand{Action: "inspect"})
+			assert.NoError(t, err)
+			assert.Len(t, state.Recent, 1)
+		})
+
+		it("runs until a simulated time", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "run_until", At: 2500 * time.Millisecond})
+			assert.NoError(t, err)
+			assert.Equal(t, 2500*time.Millisecond, state.CurrentTime)
+			assert.Equal(t, 3, state.MovementCount)
+		})
+
+		it("runs until the next movement is of a kind", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "run_until_kind", Kind: "last_thing"})
+			assert.NoError(t, err)
+			assert.Equal(t, simulator.MovementKind("last_thing"), state.Pending[0].Kind)
+		})
+
+		it("shows movements that were ignored and why", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "run_until", At: 10 * time.Second})
+			assert.NoError(t, err)
+			assert.Equal(t, simulator.FromStockIsEmpty, state.Recent[len(state.Recent)-1].Ignored)
+		})
+
+		it("says when the scenario has halted", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "step", Steps: 100})
+			assert.NoError(t, err)
+			assert.True(t, state.Halted)
+			assert.Empty(t, state.Pending)
+		})
+
+		it("is not halted before the scenario halts", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "run_until", At: 10 * time.Second})
+			assert.NoError(t, err)
+			assert.False(t, state.Halted)
+		})
+
+		it("says when the scenario has halted with movements still held back", func() {
+			full := simulator.NewBoundedStock("Full", "Thing", simulator.StockConfig{Capacity: 1, Overflow: simulator.OverflowBlock})
+			assert.NoError(t, full.Add(simulator.NewEntity("blocker", "Thing")))
+			source := simulator.NewThroughStock("Blocked", "Thing")
+			assert.NoError(t, source.Add(simulator.NewEntity("held", "Thing")))
+			env.AddToSchedule(simulator.NewMovement("held_back", startAt.Add(time.Second), source, full))
+
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "step", Steps: 100})
+			assert.NoError(t, err)
+			assert.True(t, state.Halted)
+			assert.True(t, state.Pending[0].Blocked)
+		})
+
+		it("limits the pending movements and stocks shown", func() {
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "inspect", Pending: 2, Stock: "Sink"})
+			assert.NoError(t, err)
+			assert.Len(t, state.Pending, 2)
+			assert.Len(t, state.Stocks, 1)
+			assert.Equal(t, simulator.StockName("Sink"), state.Stocks[0].Name)
+		})
+
+		it("rejects unknown actions", func() {
+			_, err := subject.Do(context.Background(), DebugCommand{Action: "jump"})
+			assert.EqualError(t, err, "unknown debugger action 'jump'")
+		})
+
+		it("stops running when the command's context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := subject.Do(ctx, DebugCommand{Action: "run_until", At: 10 * time.Second})
+			assert.Equal(t, simulator.ErrRunTruncated, err)
+
+			state, err := subject.Do(context.Background(), DebugCommand{Action: "run_until", At: 10 * time.Second})
+			assert.NoError(t, err)
+			assert.Equal(t, 10*time.Second, state.CurrentTime)
+		})
+	})
+
+	describe("Close()", func() {
+		it("cleans up the scenario once", func() {
+			subject.Close()
+			subject.Close()
+			assert.Equal(t, 1, closed)
+		})
+
+		it("refuses commands afterwards", func() {
+			subject.Close()
+			_, err := subject.Do(context.Background(), DebugCommand{Action: "step"})
+			assert.Equal(t, ErrDebugSessionClosed, err)
+		})
+	})
+
+	describe("sweepDebugSessions()", func() {
+		it.Before(func() {
+			debugSessions.Lock()
+			debugSessions.byId[subject.Id()] = subject
+			debugSessions.Unlock()
+		})
+
+		it.After(func() {
+			debugSessions.Lock()
+			delete(debugSessions.byId, subject.Id())
+			debugSessions.Unlock()
+		})
+
+		it("keeps sessions that have been used recently", func() {
+			sweepDebugSessions(time.Now().Add(debugSessionIdle / 2))
+			_, ok := debugSession(subject.Id())
+			assert.True(t, ok)
+			assert.Equal(t, 0, closed)
+		})
+
+		it("closes sessions that have gone unused", func() {
+			sweepDebugSessions(time.Now().Add(debugSessionIdle))
+			_, ok := debugSession(subject.Id())
+			assert.False(t, ok)
+			assert.Equal(t, 1, closed)
+		})
+	})
+
+	describe("sweepDebugSessionsEvery()", func() {
+		it("sweeps until it is stopped", func() {
+			subject.touch(time.Now().Add(-debugSessionIdle))
+			debugSessions.Lock()
+			debugSessions.byId[subject.Id()] = subject
+			debugSessions.Unlock()
+
+			stop := make(chan struct{})
+			stopped := make(chan struct{})
+			go func() {
+				sweepDebugSessionsEvery(time.Millisecond, stop)
+				close(stopped)
+			}()
+
+			deadline := time.Now().Add(time.Second)
+			for time.Now().Before(deadline) {
+				if _, ok := debugSession(subject.Id()); !ok {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			close(stop)
+			<-stopped
+
+			_, ok := debugSession(subject.Id())
+			assert.False(t, ok)
+			assert.Equal(t, 1, closed)
+		})
+	})
+}
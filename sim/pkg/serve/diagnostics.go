@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"fmt"
+
+	"skenario/pkg/data"
+)
+
+type IgnoredMovementLine = data.IgnoredMovementLine
+
+type MovementNote = data.MovementNote
+
+type IgnoredCount = data.IgnoredCount
+
+// RunDiagnostics summarises how many movements a run completed and why the rest were
+// ignored.
+type RunDiagnostics struct {
+	Completed      int64            `json:"completed"`
+	Ignored        int64            `json:"ignored"`
+	IgnoredReasons map[string]int64 `json:"ignored_reasons"`
+	IgnoredCounts  []IgnoredCount   `json:"ignored_counts"`
+}
+
+// ignoredMovements gives a run's ignored movements, each with its notes. Notes on
+// completed movements are given separately.
+func ignoredMovements(store data.RunReader, scenarioRunId int64) ([]IgnoredMovementLine, []MovementNote) {
+	ignored, notes, err := store.IgnoredMovements(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not read ignored movements: %s", err.Error()))
+	}
+
+	return ignored, notes
+}
+
+func runDiagnostics(store data.RunReader, scenarioRunId int64) RunDiagnostics {
+	diagnostics := RunDiagnostics{
+		IgnoredReasons: make(map[string]int64),
+		IgnoredCounts:  make([]IgnoredCount, 0),
+	}
+
+	completed, err := store.CompletedCount(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not count completed movements: %s", err.Error()))
+	}
+	diagnostics.Completed = completed
+
+	counts, err := store.IgnoredCounts(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not count ignored movements: %s", err.Error()))
+	}
+	for _, count := range counts {
+		diagnostics.Ignored += count.Ignored
+		diagnostics.IgnoredReasons[count.Reason] += count.Ignored
+		diagnostics.IgnoredCounts = append(diagnostics.IgnoredCounts, count)
+	}
+
+	return diagnostics
+}
+
+// runSummary works out a run's summary and stores it alongside the run.
+func runSummary(store data.RunStore, scenarioRunId int64, config data.SummaryConfig) data.RunSummary {
+	summary, err := store.Summarize(scenarioRunId, config)
+	if err != nil {
+		panic(fmt.Errorf("could not summarize scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	err = store.SaveSummary(scenarioRunId, summary)
+	if err != nil {
+		panic(fmt.Errorf("could not save summary of scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	return summary
+}
+
+// runCost works out what a run cost and stores it alongside the run.
+func runCost(store data.RunStore, scenarioRunId int64, config data.CostConfig) data.RunCost {
+	cost, err := store.Cost(scenarioRunId, config)
+	if err != nil {
+		panic(fmt.Errorf("could not work out the cost of scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	err = store.SaveCost(scenarioRunId, cost)
+	if err != nil {
+		panic(fmt.Errorf("could not save cost of scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	return cost
+}
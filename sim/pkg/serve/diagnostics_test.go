@@ -0,0 +1,115 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/data"
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func testDiagnostics(t *testing.T, describe spec.G, it spec.S) {
+	const dbFileName = "file::memory:?cache=shared"
+	var conn *sqlite3.Conn
+	var store data.RunStore
+	var scenarioRunId int64
+
+	it.Before(func() {
+		var err error
+		conn, err = sqlite3.Open(dbFileName)
+		require.NoError(t, err)
+		store = data.NewRunStore(conn)
+
+		writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", time.Minute)
+		require.NoError(t, err)
+		scenarioRunId = writer.ScenarioRunId()
+
+		env := simulator.NewEnvironment(context.Background(), startAt, time.Minute)
+		env.AddObserver(writer)
+
+		source := simulator.NewThroughStock("Source", "Thing")
+		sink := simulator.NewThroughStock("Sink", "Thing")
+		require.NoError(t, source.Add(simulator.NewEntity("thing", "Thing")))
+
+		moved := simulator.NewMovement("move_thing", startAt.Add(time.Second), source, sink)
+		moved.AddNote("moved the only thing")
+		env.AddToSchedule(moved)
+		empty := simulator.NewMovement("move_thing", startAt.Add(2*time.Second), source, sink)
+		empty.AddNote("nothing left to move")
+		env.AddToSchedule(empty)
+		env.AddToSchedule(simulator.NewMovement("move_thing", startAt.Add(time.Hour), source, sink))
+		env.AddToSchedule(simulator.NewMovement("late_thing", startAt.Add(time.Hour), source, sink))
+
+		_, _, err = env.Run()
+		require.NoError(t, err)
+		require.NoError(t, writer.Finish(nil, nil))
+	})
+
+	it.After(func() {
+		conn.Close()
+	})
+
+	describe("ignoredMovements()", func() {
+		it("gives the ignored movements in time order, with their notes", func() {
+			ignored, _ := ignoredMovements(store, scenarioRunId)
+
+			assert.Len(t, ignored, 3)
+			assert.Equal(t, IgnoredMovementLine{
+				OccursAt:  startAt.Add(2 * time.Second).UnixNano(),
+				Kind:      "move_thing",
+				FromStock: "Source",
+				ToStock:   "Sink",
+				Reason:    simulator.FromStockIsEmpty,
+				Notes:     []string{"nothing left to move"},
+			}, ignored[0])
+		})
+
+		it("gives the notes of completed movements", func() {
+			_, notes := ignoredMovements(store, scenarioRunId)
+
+			assert.Contains(t, notes, MovementNote{OccursAt: startAt.Add(time.Second).UnixNano(), Kind: "move_thing", Note: "moved the only thing"})
+		})
+	})
+
+	describe("runDiagnostics()", func() {
+		it("counts completed and ignored movements", func() {
+			diagnostics := runDiagnostics(store, scenarioRunId)
+
+			assert.Equal(t, int64(3), diagnostics.Completed) // includes start and halt
+			assert.Equal(t, int64(3), diagnostics.Ignored)
+		})
+
+		it("counts ignored movements by reason and kind", func() {
+			diagnostics := runDiagnostics(store, scenarioRunId)
+
+			assert.Equal(t, map[string]int64{simulator.OccursAfterHalt: 2, simulator.FromStockIsEmpty: 1}, diagnostics.IgnoredReasons)
+			assert.Equal(t, []IgnoredCount{
+				{Reason: simulator.FromStockIsEmpty, Kind: "move_thing", Ignored: 1},
+				{Reason: simulator.OccursAfterHalt, Kind: "late_thing", Ignored: 1},
+				{Reason: simulator.OccursAfterHalt, Kind: "move_thing", Ignored: 1},
+			}, diagnostics.IgnoredCounts)
+		})
+	})
+}
@@ -0,0 +1,375 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"skenario/pkg/data"
+	"skenario/pkg/export"
+)
+
+const (
+	CSVExport         = "csv"
+	ParquetExport     = "parquet"
+	OpenMetricsExport = "openmetrics"
+)
+
+// responseTimeBucketSeconds are the upper bounds of the buckets of exported response time
+// histograms. They are the default buckets of Prometheus clients, so that dashboards built
+// for them can be reused.
+var responseTimeBucketSeconds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// runExport is a stored run's results, ready to be written in an export format.
+type runExport struct {
+	fileName    string
+	contentType string
+	write       func(w io.Writer) error
+}
+
+func (re *runExport) writeTo(w io.Writer) error {
+	return re.write(w)
+}
+
+// newRunExport exports one series of a run, or every series when series is empty. CSV and
+// Parquet have a file per series, zipped together when there is more than one. OpenMetrics
+// has every series in one file, with simulated time starting at start.
+func newRunExport(vds *SkenarioRunResponse, format, series string, start time.Time) (*runExport, error) {
+	all := runSeries(vds)
+	selected := make([]export.Series, 0)
+	for _, s := range all {
+		if series == "" || s.Name == series {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("there is no series '%s'", series)
+	}
+
+	name := fmt.Sprintf("skenario-run-%d", vds.ScenarioRunId)
+	if series != "" {
+		name = fmt.Sprintf("%s-%s", name, series)
+	}
+
+	var extension, contentType string
+	var writeSeries func(w io.Writer, s export.Series) error
+	switch format {
+	case CSVExport:
+		extension, contentType, writeSeries = "csv", "text/csv; charset=utf-8", export.WriteCSV
+	case ParquetExport:
+		extension, contentType, writeSeries = "parquet", "application/vnd.apache.parquet", export.WriteParquet
+	case OpenMetricsExport:
+		families := make([]export.MetricFamily, 0)
+		for _, s := range selected {
+			families = append(families, runMetrics(vds, s.Name, start)...)
+		}
+		return &runExport{
+			fileName:    name + ".txt",
+			contentType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			write: func(w io.Writer) error {
+				return export.WriteOpenMetrics(w, families)
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("'%s' is not an export format, expected one of '%s', '%s' or '%s'", format, CSVExport, ParquetExport, OpenMetricsExport)
+	}
+
+	if len(selected) == 1 {
+		return &runExport{
+			fileName:    name + "." + extension,
+			contentType: contentType,
+			write: func(w io.Writer) error {
+				return writeSeries(w, selected[0])
+			},
+		}, nil
+	}
+
+	return &runExport{
+		fileName:    name + "-" + extension + ".zip",
+		contentType: "application/zip",
+		write: func(w io.Writer) error {
+			zw := zip.NewWriter(w)
+			for _, s := range selected {
+				f, err := zw.Create(s.Name + "." + extension)
+				if err != nil {
+					return err
+				}
+				err = writeSeries(f, s)
+				if err != nil {
+					return err
+				}
+			}
+			return zw.Close()
+		},
+	}, nil
+}
+
+// ExportRun writes a run kept in a backend, as newRunExport exports it.
+func ExportRun(w io.Writer, backend data.Backend, scenarioRunId int64, format, series string, start time.Time) error {
+	store, release, err := backend.Open()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	record, err := store.LoadRun(scenarioRunId)
+	if err != nil {
+		return err
+	}
+	vds, err := storedRunResponse(store, record)
+	if err != nil {
+		return err
+	}
+
+	re, err := newRunExport(vds, format, series, start)
+	if err != nil {
+		return err
+	}
+	return re.writeTo(w)
+}
+
+// ExportHandler exports a stored run. The "format" parameter is csv (the default), parquet
+// or openmetrics, and "series" picks one series of results. OpenMetrics timestamps start
+// from the "start" parameter, an RFC 3339 time, or else from the epoch.
+func (ss *SkenarioServer) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	scenarioRunId, ok := scenarioRunIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = CSVExport
+	}
+	start := startAt
+	if raw := query.Get("start"); raw != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("start '%s' is not an RFC 3339 time", raw), http.StatusBadRequest)
+			return
+		}
+	}
+
+	store, release := ss.historyStore(r)
+	defer release()
+
+	record, err := store.LoadRun(scenarioRunId)
+	if err == data.ErrNoSuchRun {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(fmt.Errorf("could not load scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	vds, err := storedRunResponse(store, record)
+	if err != nil {
+		panic(fmt.Errorf("could not load scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	re, err := newRunExport(vds, format, query.Get("series"), start)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The export is written out in full first, so that a failure can still be reported
+	// with an Internal Server Error status.
+	var body bytes.Buffer
+	err = re.writeTo(&body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not export scenario run %d: %s", scenarioRunId, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", re.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, re.fileName))
+	body.WriteTo(w)
+}
+
+func runSeries(vds *SkenarioRunResponse) []export.Series {
+	occursAt, stockNames, kinds, tallies := make([]int64, 0), make([]string, 0), make([]string, 0), make([]int64, 0)
+	for _, tl := range vds.TallyLines {
+		occursAt = append(occursAt, tl.OccursAt)
+		stockNames = append(stockNames, tl.StockName)
+		kinds = append(kinds, tl.KindStocked)
+		tallies = append(tallies, tl.Tally)
+	}
+
+	arrivedAt, completedAt, responseTimes := make([]int64, 0), make([]int64, 0), make([]int64, 0)
+	for _, rt := range vds.ResponseTimes {
+		arrivedAt = append(arrivedAt, rt.ArrivedAt)
+		completedAt = append(completedAt, rt.CompletedAt)
+		responseTimes = append(responseTimes, rt.ResponseTime)
+	}
+
+	calculatedAt, utilizations := make([]int64, 0), make([]float64, 0)
+	for _, cpu := range vds.CPUUtilizations {
+		calculatedAt = append(calculatedAt, cpu.CalculatedAt)
+		utilizations = append(utilizations, cpu.CPUUtilization)
+	}
+
+	perSecondSeries := func(name, counted string, rps []RPS) export.Series {
+		seconds, counts := make([]int64, 0), make([]int64, 0)
+		for _, r := range rps {
+			seconds = append(seconds, r.Second)
+			counts = append(counts, r.Requests)
+		}
+		return export.Series{Name: name, Columns: []export.Column{export.Int64s("second", seconds), export.Int64s(counted, counts)}}
+	}
+
+	return []export.Series{
+		{Name: "tally_lines", Columns: []export.Column{
+			export.Int64s("occurs_at", occursAt),
+			export.Strings("stock_name", stockNames),
+			export.Strings("kind_stocked", kinds),
+			export.Int64s("tally", tallies),
+		}},
+		{Name: "response_times", Columns: []export.Column{
+			export.Int64s("arrived_at", arrivedAt),
+			export.Int64s("completed_at", completedAt),
+			export.Int64s("response_time", responseTimes),
+		}},
+		perSecondSeries("requests_per_second", "requests", vds.RequestsPerSecond),
+		perSecondSeries("retries_per_second", "retries", vds.RetriesPerSecond),
+		{Name: "cpu_utilizations", Columns: []export.Column{
+			export.Int64s("calculated_at", calculatedAt),
+			export.Float64s("cpu_utilization", utilizations),
+		}},
+	}
+}
+
+// runMetrics gives the metric families of one series of a run. Simulated times are moved
+// to start from start, and every point is labelled with the run.
+func runMetrics(vds *SkenarioRunResponse, series string, start time.Time) []export.MetricFamily {
+	run := export.Label{Name: "run", Value: strconv.FormatInt(vds.ScenarioRunId, 10)}
+	at := func(simulatedNanos int64) time.Time {
+		return start.Add(time.Unix(0, simulatedNanos).Sub(startAt))
+	}
+	seconds := int64((vds.RanFor + time.Second - 1) / time.Second)
+
+	switch series {
+	case "tally_lines":
+		family := export.MetricFamily{Name: "skenario_stock_tally", Type: export.Gauge, Help: "Entities in a stock of the simulation."}
+		for _, tl := range vds.TallyLines {
+			family.Points = append(family.Points, export.MetricPoint{
+				Labels:    []export.Label{run, {Name: "stock", Value: tl.StockName}, {Name: "kind", Value: tl.KindStocked}},
+				Timestamp: at(tl.OccursAt),
+				Value:     float64(tl.Tally),
+			})
+		}
+		return []export.MetricFamily{family}
+	case "response_times":
+		return []export.MetricFamily{responseTimeHistogram(vds.ResponseTimes, run, at, seconds)}
+	case "requests_per_second":
+		return []export.MetricFamily{perSecondCounter("skenario_requests", "Requests that have arrived.", vds.RequestsPerSecond, run, at, seconds)}
+	case "retries_per_second":
+		return []export.MetricFamily{perSecondCounter("skenario_retries", "Requests that have been retried.", vds.RetriesPerSecond, run, at, seconds)}
+	case "cpu_utilizations":
+		family := export.MetricFamily{
+			Name: "skenario_cpu_utilization_percent",
+			Type: export.Gauge,
+			Unit: "percent",
+			Help: "Average CPU utilization of active replicas, as calculated by the autoscaler.",
+		}
+		for _, cpu := range vds.CPUUtilizations {
+			family.Points = append(family.Points, export.MetricPoint{
+				Labels:    []export.Label{run},
+				Timestamp: at(cpu.CalculatedAt),
+				Value:     cpu.CPUUtilization,
+			})
+		}
+		return []export.MetricFamily{family}
+	default:
+		return nil
+	}
+}
+
+// perSecondCounter gives, at the end of each simulated second, how many were counted in the
+// seconds before.
+func perSecondCounter(name, help string, rps []RPS, run export.Label, at func(int64) time.Time, seconds int64) export.MetricFamily {
+	family := export.MetricFamily{Name: name, Type: export.Counter, Help: help}
+
+	total := int64(0)
+	next := 0
+	for second := int64(1); second <= seconds; second++ {
+		for ; next < len(rps) && rps[next].Second < second; next++ {
+			total += rps[next].Requests
+		}
+		family.Points = append(family.Points, export.MetricPoint{
+			Labels:    []export.Label{run},
+			Timestamp: at(startAt.UnixNano() + second*int64(time.Second)),
+			Value:     float64(total),
+		})
+	}
+
+	return family
+}
+
+// responseTimeHistogram gives, at the end of each simulated second, a histogram of the
+// response times of requests completed by then.
+func responseTimeHistogram(responseTimes []ResponseTime, run export.Label, at func(int64) time.Time, seconds int64) export.MetricFamily {
+	family := export.MetricFamily{
+		Name: "skenario_response_time_seconds",
+		Type: export.Histogram,
+		Unit: "seconds",
+		Help: "Response times of completed requests.",
+	}
+
+	completed := append([]ResponseTime{}, responseTimes...)
+	sort.SliceStable(completed, func(i, j int) bool {
+		return completed[i].CompletedAt < completed[j].CompletedAt
+	})
+
+	counts := make([]float64, len(responseTimeBucketSeconds))
+	count, sum := 0.0, 0.0
+	next := 0
+	for second := int64(1); second <= seconds; second++ {
+		end := startAt.UnixNano() + second*int64(time.Second)
+		for ; next < len(completed) && completed[next].CompletedAt <= end; next++ {
+			rt := time.Duration(completed[next].ResponseTime).Seconds()
+			for i, bound := range responseTimeBucketSeconds {
+				if rt <= bound {
+					counts[i]++
+				}
+			}
+			count++
+			sum += rt
+		}
+
+		buckets := make([]export.Bucket, len(counts))
+		for i, bound := range responseTimeBucketSeconds {
+			buckets[i] = export.Bucket{UpperBound: bound, Count: counts[i]}
+		}
+		family.Points = append(family.Points, export.MetricPoint{
+			Labels:    []export.Label{run},
+			Timestamp: at(end),
+			Buckets:   buckets,
+			Count:     count,
+			Sum:       sum,
+		})
+	}
+
+	return family
+}
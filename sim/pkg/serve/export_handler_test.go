@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/data"
+	"skenario/pkg/model"
+)
+
+func testExportHandler(t *testing.T, describe spec.G, it spec.S) {
+	var vds *SkenarioRunResponse
+	var buf *bytes.Buffer
+
+	it.Before(func() {
+		buf = &bytes.Buffer{}
+		vds = &SkenarioRunResponse{
+			ScenarioRunId: 3,
+			RanFor:        2500 * time.Millisecond,
+			TallyLines: []TallyLine{
+				{OccursAt: startAt.Add(time.Second).UnixNano(), StockName: "ReplicasActive", KindStocked: "Replica", Tally: 1},
+			},
+			ResponseTimes: []ResponseTime{
+				{CompletedAt: startAt.Add(500 * time.Millisecond).UnixNano(), ResponseTime: int64(200 * time.Millisecond)},
+				{CompletedAt: startAt.Add(1500 * time.Millisecond).UnixNano(), ResponseTime: int64(3 * time.Second)},
+			},
+			RequestsPerSecond: []RPS{{Second: 0, Requests: 4}, {Second: 2, Requests: 6}},
+		}
+	})
+
+	describe("newRunExport()", func() {
+		it("exports one series as a file", func() {
+			re, err := newRunExport(vds, CSVExport, "tally_lines", startAt)
+			require.NoError(t, err)
+			assert.Equal(t, "skenario-run-3-tally_lines.csv", re.fileName)
+
+			require.NoError(t, re.writeTo(buf))
+			assert.Equal(t, "occurs_at,stock_name,kind_stocked,tally\n1000000000,ReplicasActive,Replica,1\n", buf.String())
+		})
+
+		it("zips a file for every series when no series is chosen", func() {
+			re, err := newRunExport(vds, ParquetExport, "", startAt)
+			require.NoError(t, err)
+			assert.Equal(t, "application/zip", re.contentType)
+
+			require.NoError(t, re.writeTo(buf))
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			require.NoError(t, err)
+
+			names := make([]string, 0)
+			for _, f := range zr.File {
+				names = append(names, f.Name)
+			}
+			assert.Equal(t, []string{"tally_lines.parquet", "response_times.parquet", "requests_per_second.parquet", "retries_per_second.parquet", "cpu_utilizations.parquet"}, names)
+		})
+
+		it("rejects unknown formats and series", func() {
+			_, err := newRunExport(vds, "xml", "", startAt)
+			assert.Error(t, err)
+
+			_, err = newRunExport(vds, CSVExport, "nope", startAt)
+			assert.Error(t, err)
+		})
+
+		describe("as OpenMetrics", func() {
+			it.Before(func() {
+				re, err := newRunExport(vds, OpenMetricsExport, "", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+				require.NoError(t, err)
+				require.NoError(t, re.writeTo(buf))
+			})
+
+			it("moves simulated time to start from the start time", func() {
+				assert.Contains(t, buf.String(), `skenario_stock_tally{run="3",stock="ReplicasActive",kind="Replica"} 1 1767225601.000`)
+			})
+
+			it("counts requests cumulatively at the end of each simulated second", func() {
+				assert.Contains(t, buf.String(), "skenario_requests_total{run=\"3\"} 4 1767225601.000\n"+
+					"skenario_requests_total{run=\"3\"} 4 1767225602.000\n"+
+					"skenario_requests_total{run=\"3\"} 10 1767225603.000\n")
+			})
+
+			it("gives a histogram of the response times completed by the end of each simulated second", func() {
+				assert.Contains(t, buf.String(), `skenario_response_time_seconds_bucket{run="3",le="0.25"} 1 1767225601.000`)
+				assert.Contains(t, buf.String(), `skenario_response_time_seconds_bucket{run="3",le="2.5"} 1 1767225602.000`)
+				assert.Contains(t, buf.String(), `skenario_response_time_seconds_bucket{run="3",le="5"} 2 1767225602.000`)
+				assert.Contains(t, buf.String(), `skenario_response_time_seconds_sum{run="3"} 3.2 1767225602.000`)
+			})
+		})
+	})
+
+	describe("ExportHandler()", func() {
+		var server *SkenarioServer
+		var release func()
+		var store data.RunStore
+		var router chi.Router
+		var recorder *httptest.ResponseRecorder
+		var scenarioRunId int64
+
+		get := func(path string) {
+			req, err := http.NewRequest("GET", path, nil)
+			require.NoError(t, err)
+
+			recorder = httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+		}
+
+		it.Before(func() {
+			var err error
+			server = newTestServer()
+			store, release, err = server.InMemoryBackend.Open()
+			require.NoError(t, err)
+
+			writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "export_test", "step", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, writer.Finish(nil, nil))
+			scenarioRunId = writer.ScenarioRunId()
+
+			router = chi.NewRouter()
+			router.Get("/runs/{scenarioRunId}/export", server.ExportHandler)
+		})
+
+		it.After(func() {
+			release()
+		})
+
+		it("exports a stored run as an attachment", func() {
+			get(fmt.Sprintf("/runs/%d/export?in_memory_database=true&series=requests_per_second", scenarioRunId))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, fmt.Sprintf(`attachment; filename="skenario-run-%d-requests_per_second.csv"`, scenarioRunId), recorder.Header().Get("Content-Disposition"))
+			assert.Equal(t, "second,requests\n", recorder.Body.String())
+		})
+
+		it("ends OpenMetrics exports with an EOF marker", func() {
+			get(fmt.Sprintf("/runs/%d/export?in_memory_database=true&format=openmetrics&start=2026-01-01T00:00:00Z", scenarioRunId))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.True(t, strings.HasSuffix(recorder.Body.String(), "# EOF\n"))
+		})
+
+		it("rejects bad formats and start times", func() {
+			get(fmt.Sprintf("/runs/%d/export?in_memory_database=true&format=xml", scenarioRunId))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			get(fmt.Sprintf("/runs/%d/export?in_memory_database=true&format=openmetrics&start=yesterday", scenarioRunId))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+
+		it("gives 404 for runs that do not exist", func() {
+			get("/runs/999999/export?in_memory_database=true")
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// FrontierHandler compares the runs given by repeated "run" parameters on cost and
+// latency. Runs are looked up in the in-memory database when "in_memory_database" is set.
+func (ss *SkenarioServer) FrontierHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	scenarioRunIds := make([]int64, 0)
+	for _, run := range query["run"] {
+		id, err := strconv.ParseInt(run, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("run '%s' is not a scenario run id", run), http.StatusBadRequest)
+			return
+		}
+		scenarioRunIds = append(scenarioRunIds, id)
+	}
+
+	store, release := ss.historyStore(r)
+	defer release()
+
+	points, err := store.CostFrontier(scenarioRunIds)
+	if err != nil {
+		panic(fmt.Errorf("could not place scenario runs on the cost frontier: %s", err.Error()))
+	}
+
+	writeJSON(w, http.StatusOK, points)
+}
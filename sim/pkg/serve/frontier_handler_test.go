@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/data"
+	"skenario/pkg/model"
+)
+
+func testFrontierHandler(t *testing.T, describe spec.G, it spec.S) {
+	var server *SkenarioServer
+	var release func()
+	var store data.RunStore
+	var recorder *httptest.ResponseRecorder
+	var cheap, quick, dominated, idle int64
+
+	saveRun := func(totalCost float64, p99 time.Duration, completed int64) int64 {
+		writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "test_origin", "test_pattern", time.Minute)
+		require.NoError(t, err)
+		id := writer.ScenarioRunId()
+
+		require.NoError(t, store.SaveSummary(id, data.RunSummary{Requests: 10, Completed: completed, ResponseTimeP99: p99}))
+		require.NoError(t, store.SaveCost(id, data.RunCost{TotalCost: totalCost}))
+		return id
+	}
+
+	get := func(url string) {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+
+		recorder = httptest.NewRecorder()
+		server.FrontierHandler(recorder, req)
+	}
+
+	it.Before(func() {
+		var err error
+		server = newTestServer()
+		store, release, err = server.InMemoryBackend.Open()
+		require.NoError(t, err)
+
+		cheap = saveRun(10, 2*time.Second, 5)
+		quick = saveRun(20, time.Second, 5)
+		dominated = saveRun(30, 1500*time.Millisecond, 5)
+		idle = saveRun(5, 0, 0)
+	})
+
+	it.After(func() {
+		release()
+	})
+
+	describe("FrontierHandler()", func() {
+		it("places the runs cheapest first, marking those on the frontier", func() {
+			get(fmt.Sprintf("/frontier?in_memory_database=true&run=%d&run=%d&run=%d&run=%d", dominated, quick, cheap, idle))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var points []data.FrontierPoint
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&points))
+			require.Len(t, points, 4)
+
+			ids := make([]int64, 0)
+			onFrontier := make([]bool, 0)
+			for _, p := range points {
+				ids = append(ids, p.ScenarioRunId)
+				onFrontier = append(onFrontier, p.OnFrontier)
+			}
+			assert.Equal(t, []int64{idle, cheap, quick, dominated}, ids)
+			assert.Equal(t, []bool{false, true, true, false}, onFrontier)
+		})
+
+		it("rejects run parameters that are not scenario run ids", func() {
+			get("/frontier?in_memory_database=true&run=latest")
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	})
+}
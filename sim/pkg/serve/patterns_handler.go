@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"net/http"
+
+	"skenario/pkg/model/trafficpatterns"
+)
+
+type PatternDescription struct {
+	Name         string                  `json:"name"`
+	Description  string                  `json:"description"`
+	ConfigSchema *trafficpatterns.Schema `json:"config_schema"`
+}
+
+func PatternsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	writeJSON(w, http.StatusOK, DescribePatterns())
+}
+
+// DescribePatterns lists every registered traffic pattern along with its config schema.
+func DescribePatterns() []PatternDescription {
+	descriptions := make([]PatternDescription, 0)
+	for _, r := range trafficpatterns.Registered() {
+		descriptions = append(descriptions, PatternDescription{
+			Name:         r.Name,
+			Description:  r.Description,
+			ConfigSchema: r.ConfigSchema(),
+		})
+	}
+
+	return descriptions
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPatternsHandler(t *testing.T, describe spec.G, it spec.S) {
+	var recorder *httptest.ResponseRecorder
+
+	it.Before(func() {
+		req, err := http.NewRequest("GET", "/patterns", nil)
+		require.NoError(t, err)
+
+		recorder = httptest.NewRecorder()
+		PatternsHandler(recorder, req)
+	})
+
+	it("sets the content-type to JSON", func() {
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	})
+
+	it("lists each registered pattern with its config schema", func() {
+		var descriptions []PatternDescription
+		err := json.NewDecoder(recorder.Body).Decode(&descriptions)
+		require.NoError(t, err)
+
+		names := make([]string, 0)
+		for _, d := range descriptions {
+			names = append(names, d.Name)
+			assert.Equal(t, "object", d.ConfigSchema.Type)
+		}
+		assert.Contains(t, names, "step")
+		assert.Contains(t, names, "golang_rand_uniform")
+	})
+
+	describe("writeJSON()", func() {
+		it("reports values that can't be encoded with a 500 and no JSON", func() {
+			recorder = httptest.NewRecorder()
+			writeJSON(recorder, http.StatusOK, math.Inf(1))
+			assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+			assert.NotEqual(t, "application/json", recorder.Header().Get("Content-Type"))
+		})
+
+		it("writes the status before the encoded value", func() {
+			recorder = httptest.NewRecorder()
+			writeJSON(recorder, http.StatusUnprocessableEntity, map[string]int{"a": 1})
+			assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			assert.JSONEq(t, `{"a": 1}`, recorder.Body.String())
+		})
+	})
+}
@@ -16,6 +16,7 @@
 package serve
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -23,7 +24,6 @@ import (
 	"skenario/pkg/simulator"
 	"time"
 
-	"github.com/bvinc/go-sqlite-lite/sqlite3"
 	"github.com/josephburnett/sk-plugin/pkg/skplug"
 	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
 
@@ -34,74 +34,252 @@ import (
 
 var startAt = time.Unix(0, 0)
 
-type TallyLine struct {
-	OccursAt    int64  `json:"occurs_at"`
-	StockName   string `json:"stock_name"`
-	KindStocked string `json:"kind_stocked"`
-	Tally       int64  `json:"tally"`
-}
+type TallyLine = data.TallyLine
 
-type ResponseTime struct {
-	ArrivedAt    int64 `json:"arrived_at"`
-	CompletedAt  int64 `json:"completed_at"`
-	ResponseTime int64 `json:"response_time"`
-}
+type ResponseTime = data.ResponseTime
 
-type RPS struct {
-	Second   int64 `json:"second"`
-	Requests int64 `json:"requests"`
-}
+type RPS = data.RPS
 
-type CPUUtilizationMetric struct {
-	CPUUtilization float64 `json:"cpu_utilization"`
-	CalculatedAt   int64   `json:"calculated_at"`
+// RetryStorm is a run of consecutive seconds in which clients sent at least as many
+// retries as first attempts.
+type RetryStorm struct {
+	StartedAt            int64 `json:"started_at"`
+	EndedAt              int64 `json:"ended_at"`
+	PeakRetriesPerSecond int64 `json:"peak_retries_per_second"`
 }
 
+type CPUUtilizationMetric = data.CPUUtilizationMetric
+
 type SkenarioRunResponse struct {
+	ScenarioRunId     int64                  `json:"scenario_run_id"`
 	RanFor            time.Duration          `json:"ran_for"`
 	TrafficPattern    string                 `json:"traffic_pattern"`
+	Seed              int64                  `json:"seed"`
+	Truncated         bool                   `json:"truncated"`
 	TallyLines        []TallyLine            `json:"tally_lines"`
 	ResponseTimes     []ResponseTime         `json:"response_times"`
 	RequestsPerSecond []RPS                  `json:"requests_per_second"`
 	CPUUtilizations   []CPUUtilizationMetric `json:"cpu_utilizations"`
+
+	// AutoscalerDecisions explain each change to the desired replicas, giving what the
+	// autoscaler was told and what it recommended at every tick.
+	AutoscalerDecisions []data.AutoscalerDecision `json:"autoscaler_decisions"`
+	AutoscalerErrors    int                       `json:"autoscaler_errors"`
+
+	// BucketWidth is set when tallies and response times are given downsampled into
+	// buckets of this width, rather than as a line per movement and per request.
+	BucketWidth         time.Duration             `json:"bucket_width,omitempty"`
+	TallyBuckets        []data.TallyBucket        `json:"tally_buckets,omitempty"`
+	ResponseTimeBuckets []data.ResponseTimeBucket `json:"response_time_buckets,omitempty"`
+
+	RetriesPerSecond   []RPS        `json:"retries_per_second"`
+	RetryAmplification float64      `json:"retry_amplification"`
+	RetryStorms        []RetryStorm `json:"retry_storms"`
+
+	IgnoredMovements []IgnoredMovementLine `json:"ignored_movements"`
+	Notes            []MovementNote        `json:"notes"`
+	Diagnostics      RunDiagnostics        `json:"diagnostics"`
+	Summary          data.RunSummary       `json:"summary"`
+	Cost             data.RunCost          `json:"cost"`
+
+	ValidationFailure *ValidationFailure `json:"validation_failure,omitempty"`
+
+	// AutoscalerFailure is the error of the autoscaler plugin that stopped the run early.
+	AutoscalerFailure string `json:"autoscaler_failure,omitempty"`
+}
+
+// ValidationFailure reports the first movement that broke a check in a validated run.
+type ValidationFailure struct {
+	Check          string `json:"check"`
+	MovementNumber int    `json:"movement_number"`
+	Kind           string `json:"kind"`
+	OccursAt       int64  `json:"occurs_at"`
+	FromStock      string `json:"from_stock"`
+	ToStock        string `json:"to_stock"`
+	Moved          string `json:"moved,omitempty"`
+	Message        string `json:"message"`
 }
 
 type SkenarioRunRequest struct {
 	RunFor           time.Duration `json:"run_for"`
 	TrafficPattern   string        `json:"traffic_pattern"`
 	InMemoryDatabase bool          `json:"in_memory_database,omitempty"`
+	Seed             int64         `json:"seed,omitempty"`
+	WallClockBudget  time.Duration `json:"wall_clock_budget,omitempty"`
+	// Validate checks conservation laws after every movement, failing the run at the first
+	// movement that breaks one. It is ignored when a run is resumed from a snapshot, since
+	// the checks need to see every request and replica from the start.
+	Validate bool `json:"validate,omitempty"`
 
 	InitialNumberOfReplicas uint `json:"initial_number_of_replicas"`
 
 	LaunchDelay    time.Duration `json:"launch_delay"`
 	TerminateDelay time.Duration `json:"terminate_delay"`
 	TickInterval   time.Duration `json:"tick_interval"`
+	AutoscalerYaml string        `json:"autoscaler_yaml,omitempty"`
+
+	RequestTimeout       time.Duration     `json:"request_timeout_nanos"`
+	RequestCPUTimeMillis int               `json:"request_cpu_time_millis"`
+	RequestIOTimeMillis  int               `json:"request_io_time_millis"`
+	RetryConfig          model.RetryConfig `json:"retry_config,omitempty"`
+	// SLOLatencyTarget is the response time that requests should complete within. It
+	// defaults to the request timeout; without either, the run has no SLO.
+	SLOLatencyTarget time.Duration `json:"slo_latency_target,omitempty"`
+	// Pricing is applied to the replicas of every service.
+	Pricing data.Pricing `json:"pricing,omitempty"`
+
+	// TrafficPatternConfig is decoded according to the registered TrafficPattern.
+	TrafficPatternConfig json.RawMessage `json:"traffic_pattern_config,omitempty"`
+	// Older clients give the config of each traffic pattern in a field of its own. These
+	// are read when there is no TrafficPatternConfig.
+	UniformConfig    json.RawMessage `json:"uniform_config,omitempty"`
+	RampConfig       json.RawMessage `json:"ramp_config,omitempty"`
+	StepConfig       json.RawMessage `json:"step_config,omitempty"`
+	SinusoidalConfig json.RawMessage `json:"sinusoidal_config,omitempty"`
+	ClosedLoopConfig json.RawMessage `json:"closed_loop_config,omitempty"`
+
+	// Services are simulated alongside the service described above, which calls refer to
+	// as "main".
+	Services []ServiceRequest `json:"services,omitempty"`
+	Calls    []ServiceCall    `json:"calls,omitempty"`
+}
 
-	RequestTimeout       time.Duration `json:"request_timeout_nanos"`
-	RequestCPUTimeMillis int           `json:"request_cpu_time_millis"`
-	RequestIOTimeMillis  int           `json:"request_io_time_millis"`
+var environmentSequence int32 = 0
 
-	UniformConfig    trafficpatterns.UniformConfig    `json:"uniform_config,omitempty"`
-	RampConfig       trafficpatterns.RampConfig       `json:"ramp_config,omitempty"`
-	StepConfig       trafficpatterns.StepConfig       `json:"step_config,omitempty"`
-	SinusoidalConfig trafficpatterns.SinusoidalConfig `json:"sinusoidal_config,omitempty"`
+// scenario is a SkenarioRunRequest made ready to run. newScenario gives the environment
+// and configs, so that observers can be added before build adds the models.
+type scenario struct {
+	request       *SkenarioRunRequest
+	registration  trafficpatterns.Registration
+	trafficConfig interface{}
+	env           simulator.Environment
+	clusterConf   model.ClusterConfig
+	asConf        model.AutoscalerConfig
+	autoscaler    model.AutoscalerModel
+	traffic       trafficpatterns.Pattern
+	services      []*service
+	// clusters are every service's clusters, by the service name that their stocks are
+	// recorded under, which is empty for the main service.
+	clusters map[string]model.ClusterModel
+	// from is when the recorded run begins: the start of the scenario, or the time of the
+	// snapshot it was resumed from.
+	from time.Time
+	// initialLaunching and initialActive are how many replicas each service had when the
+	// recorded run began.
+	initialLaunching map[string]int64
+	initialActive    map[string]int64
 }
 
-var environmentSequence int32 = 0
+// trafficPatternConfig gives the config of the request's traffic pattern, from the field
+// that older clients give it in if there is no TrafficPatternConfig.
+func (srr *SkenarioRunRequest) trafficPatternConfig() json.RawMessage {
+	if len(srr.TrafficPatternConfig) > 0 {
+		return srr.TrafficPatternConfig
+	}
 
-func RunHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	switch srr.TrafficPattern {
+	case "golang_rand_uniform":
+		return srr.UniformConfig
+	case "ramp":
+		return srr.RampConfig
+	case "step":
+		return srr.StepConfig
+	case "sinusoidal":
+		return srr.SinusoidalConfig
+	case "closed_loop":
+		return srr.ClosedLoopConfig
+	}
 
-	runReq := &SkenarioRunRequest{}
-	err := json.NewDecoder(r.Body).Decode(runReq)
+	return nil
+}
+
+// newScenario checks runReq and creates an environment for it. When runReq has no seed,
+// one is chosen and set on runReq, so that the same run can be asked for again.
+func newScenario(ctx context.Context, runReq *SkenarioRunRequest) (*scenario, error) {
+	registration, ok := trafficpatterns.Lookup(runReq.TrafficPattern)
+	if !ok {
+		return nil, fmt.Errorf("unknown traffic pattern '%s'", runReq.TrafficPattern)
+	}
+	trafficConfig, err := registration.DecodeConfig(runReq.trafficPatternConfig())
 	if err != nil {
-		panic(err.Error())
+		return nil, err
+	}
+
+	if runReq.Seed == 0 {
+		runReq.Seed = time.Now().UnixNano()
+	}
+
+	env := simulator.NewSeededEnvironment(ctx, startAt, runReq.RunFor, runReq.Seed)
+	services, err := newServices(env, runReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scenario{
+		request:       runReq,
+		registration:  registration,
+		trafficConfig: trafficConfig,
+		env:           env,
+		clusterConf:   buildClusterConfig(runReq, trafficConfig),
+		asConf:        buildAutoscalerConfig(runReq),
+		services:      services,
+		from:          startAt,
+	}, nil
+}
+
+func (s *scenario) build() {
+	cluster, autoscaler, trafficSource := buildModels(s.env, s.request, s.clusterConf, s.asConf)
+	s.autoscaler = autoscaler
+
+	s.traffic = s.registration.New(s.env, trafficSource, cluster.RoutingStock(), s.trafficConfig)
+	s.traffic.Generate()
+
+	all := []model.ClusterModel{cluster}
+	clusters := map[string]model.ClusterModel{mainService: cluster}
+	s.clusters = map[string]model.ClusterModel{"": cluster}
+	sources := map[string]model.TrafficSource{mainService: trafficSource}
+	for _, svc := range s.services {
+		svcCluster, svcAutoscaler, svcSource := buildModels(svc.env, svc.request, buildClusterConfig(svc.request, svc.trafficConfig), buildAutoscalerConfig(svc.request))
+		svc.autoscaler = svcAutoscaler
+		all = append(all, svcCluster)
+		clusters[svc.name] = svcCluster
+		s.clusters[svc.name] = svcCluster
+		sources[svc.name] = svcSource
+
+		if svc.request.TrafficPattern != "" {
+			svc.registration.New(svc.env, svcSource, svcCluster.RoutingStock(), svc.trafficConfig).Generate()
+		}
+	}
+
+	for _, call := range s.request.Calls {
+		model.AddDownstream(clusters[call.From], sources[call.To], clusters[call.To].RoutingStock(), call.DownstreamConfig)
+	}
+
+	if s.request.Validate {
+		validator := simulator.NewValidator()
+		for _, c := range all {
+			for _, invariant := range model.ClusterInvariants(c) {
+				validator.AddInvariant(invariant)
+			}
+		}
+		s.env.AddObserver(validator)
 	}
 
-	env := simulator.NewEnvironment(r.Context(), startAt, runReq.RunFor)
+	s.countInitialReplicas()
+}
+
+// countInitialReplicas counts each service's replicas as the recorded run begins.
+func (s *scenario) countInitialReplicas() {
+	s.initialLaunching = make(map[string]int64)
+	s.initialActive = make(map[string]int64)
+	for service, c := range s.clusters {
+		s.initialLaunching[service] = int64(c.CurrentLaunching())
+		s.initialActive[service] = int64(c.CurrentActive())
+	}
+}
 
-	clusterConf := buildClusterConfig(runReq)
-	asConf := buildAutoscalerConfig(runReq)
+// buildModels creates the cluster, autoscaler and traffic source of one service.
+func buildModels(env simulator.Environment, runReq *SkenarioRunRequest, clusterConf model.ClusterConfig, asConf model.AutoscalerConfig) (model.ClusterModel, model.AutoscalerModel, model.TrafficSource) {
 	replicasConfig := model.ReplicasConfig{
 		LaunchDelay:    runReq.LaunchDelay,
 		TerminateDelay: runReq.TerminateDelay,
@@ -111,239 +289,416 @@ func RunHandler(w http.ResponseWriter, r *http.Request) {
 		CPUTimeMillis: runReq.RequestCPUTimeMillis,
 		IOTimeMillis:  runReq.RequestIOTimeMillis,
 		Timeout:       runReq.RequestTimeout,
+		Retry:         runReq.RetryConfig,
 	}
 
 	cluster := model.NewCluster(env, clusterConf, replicasConfig)
-
-	model.NewAutoscaler(env, startAt, cluster, asConf)
+	autoscaler := model.NewAutoscaler(env, startAt, cluster, asConf)
 	trafficSource := model.NewTrafficSource(env, cluster.RoutingStock(), requestConfig)
 
-	var traffic trafficpatterns.Pattern
-	switch runReq.TrafficPattern {
-	case "golang_rand_uniform":
-		traffic = trafficpatterns.NewUniformRandom(env, trafficSource, cluster.RoutingStock(), runReq.UniformConfig)
-	case "step":
-		traffic = trafficpatterns.NewStep(env, trafficSource, cluster.RoutingStock(), runReq.StepConfig)
-	case "ramp":
-		traffic = trafficpatterns.NewRamp(env, trafficSource, cluster.RoutingStock(), runReq.RampConfig)
-	case "sinusoidal":
-		traffic = trafficpatterns.NewSinusoidal(env, trafficSource, cluster.RoutingStock(), runReq.SinusoidalConfig)
+	return cluster, autoscaler, trafficSource
+}
+
+// deleteAutoscalers removes every service's autoscaler from the plugin, however the run
+// ended.
+func (s *scenario) deleteAutoscalers() {
+	deleteAutoscaler(s.env)
+	for _, svc := range s.services {
+		deleteAutoscaler(svc.env)
 	}
+}
 
-	traffic.Generate()
+// record streams the scenario's movements into a new scenario run as it progresses.
+func (s *scenario) record(store data.RunStore) data.RunWriter {
+	writer, err := store.Writer(s.clusterConf, s.asConf, "skenario_web", s.registration.Name, s.request.RunFor)
+	if err != nil {
+		panic(fmt.Errorf("could not record scenario run: %s", err.Error()))
+	}
+	s.env.AddObserver(writer)
+	s.env.DiscardMovements()
 
-	completed, ignored, err := env.Run()
+	err = store.SaveConfiguration(writer.ScenarioRunId(), s.configuration())
 	if err != nil {
-		panic(err.Error())
+		panic(fmt.Errorf("could not record scenario run configuration: %s", err.Error()))
 	}
 
-	var dbFileName string
-	if runReq.InMemoryDatabase {
-		dbFileName = "file::memory:?cache=shared"
-	} else {
-		dbFileName = "skenario.db"
+	return writer
+}
+
+// configuration gives the scenario's request in canonical form, with the seed it runs with
+// and every traffic pattern config written out in full.
+func (s *scenario) configuration() data.RunConfiguration {
+	canonical := *s.request
+	canonical.TrafficPatternConfig = canonicalConfig(s.trafficConfig)
+	canonical.UniformConfig = nil
+	canonical.RampConfig = nil
+	canonical.StepConfig = nil
+	canonical.SinusoidalConfig = nil
+	canonical.ClosedLoopConfig = nil
+
+	canonical.Services = make([]ServiceRequest, len(s.request.Services))
+	copy(canonical.Services, s.request.Services)
+	for i := range canonical.Services {
+		for _, svc := range s.services {
+			if svc.name == canonical.Services[i].Name && canonical.Services[i].TrafficPattern != "" {
+				canonical.Services[i].TrafficPatternConfig = canonicalConfig(svc.trafficConfig)
+			}
+		}
 	}
 
-	conn, err := sqlite3.Open(dbFileName)
+	request, err := json.Marshal(canonical)
 	if err != nil {
-		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+		panic(fmt.Errorf("could not encode scenario run configuration: %s", err.Error()))
 	}
-	defer conn.Close()
 
-	store := data.NewRunStore(conn)
-	scenarioRunId, err := store.Store(completed, ignored, clusterConf, asConf, "skenario_web", traffic.Name(), runReq.RunFor, env.CPUUtilizations())
+	return data.RunConfiguration{
+		Request:                 request,
+		Seed:                    canonical.Seed,
+		InitialNumberOfReplicas: int64(canonical.InitialNumberOfReplicas),
+		RequestTimeout:          canonical.RequestTimeout,
+		RequestCPUTimeMillis:    int64(canonical.RequestCPUTimeMillis),
+		RequestIOTimeMillis:     int64(canonical.RequestIOTimeMillis),
+	}
+}
+
+func canonicalConfig(trafficConfig interface{}) json.RawMessage {
+	config, err := json.Marshal(trafficConfig)
 	if err != nil {
-		fmt.Printf("there was an error saving data: %s", err.Error())
+		panic(fmt.Errorf("could not encode traffic pattern config: %s", err.Error()))
 	}
 
-	var vds = SkenarioRunResponse{
-		RanFor:            env.HaltTime().Sub(startAt),
-		TrafficPattern:    traffic.Name(),
-		TallyLines:        tallyLines(dbFileName, scenarioRunId),
-		ResponseTimes:     responseTimes(dbFileName, scenarioRunId),
-		RequestsPerSecond: requestsPerSecond(dbFileName, scenarioRunId),
-		CPUUtilizations:   cpuUtilizations(dbFileName, scenarioRunId),
+	return config
+}
+
+// runContext stops a run early if the client goes away or the wall clock budget runs out.
+func runContext(r *http.Request, runReq *SkenarioRunRequest) (context.Context, context.CancelFunc) {
+	if runReq.WallClockBudget > 0 {
+		return context.WithTimeout(r.Context(), runReq.WallClockBudget)
 	}
+	return context.WithCancel(r.Context())
+}
 
-	err = json.NewEncoder(w).Encode(vds)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+// openRunStore opens a store for one request's use of the runs, from the in-memory database
+// if the request asks for it. The store must be released once the request is done with it.
+func (ss *SkenarioServer) openRunStore(inMemory bool) (data.RunStore, func()) {
+	backend := ss.Backend
+	if inMemory {
+		backend = ss.InMemoryBackend
 	}
 
-	err = env.Plugin().Event(startAt.UnixNano(), proto.EventType_DELETE, &skplug.Autoscaler{})
+	store, release, err := backend.Open()
 	if err != nil {
-		panic(err)
+		panic(err.Error())
 	}
-	log.Printf("Deleted autoscaler.")
+
+	return store, release
 }
 
-func cpuUtilizations(dbFileName string, scenarioRunId int64) []CPUUtilizationMetric {
-	totalConn, err := sqlite3.Open(dbFileName, sqlite3.OPEN_READONLY)
+func (ss *SkenarioServer) RunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	runReq := &SkenarioRunRequest{}
+	err := json.NewDecoder(r.Body).Decode(runReq)
 	if err != nil {
-		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+		panic(err.Error())
 	}
-	defer totalConn.Close()
 
-	cpuUtilizationStmt, err := totalConn.Prepare(data.CPUUtilizationQuery, scenarioRunId)
+	ss.serveRun(w, r, runReq)
+}
+
+// serveRun runs and records the scenario that runReq describes, then writes its response.
+func (ss *SkenarioServer) serveRun(w http.ResponseWriter, r *http.Request, runReq *SkenarioRunRequest) {
+	bucketWidth, err := bucketWidthParam(r, runReq.RunFor)
 	if err != nil {
-		panic(fmt.Errorf("could not prepare query: %s", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	cpuUtilizations := make([]CPUUtilizationMetric, 0)
+	ctx, cancel := runContext(r, runReq)
+	defer cancel()
 
-	var cpuUtilization float64
-	var calculatedAt int64
-	for {
-		hasRow, err := cpuUtilizationStmt.Step()
-		if err != nil {
-			panic(fmt.Errorf("could not step: %s", err.Error()))
-		}
+	s, err := newScenario(ctx, runReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		if !hasRow {
-			break
-		}
+	store, release := ss.openRunStore(runReq.InMemoryDatabase)
+	defer release()
 
-		err = cpuUtilizationStmt.Scan(&cpuUtilization, &calculatedAt)
-		if err != nil {
-			panic(fmt.Errorf("could not scan: %s", err.Error()))
-		}
+	// Movements are written as the run progresses, rather than held until it ends.
+	writer := s.record(store)
 
-		var metric = CPUUtilizationMetric{
-			CPUUtilization: cpuUtilization,
-			CalculatedAt:   calculatedAt,
-		}
-		cpuUtilizations = append(cpuUtilizations, metric)
+	s.build()
+	defer s.deleteAutoscalers()
+
+	vds := runScenario(r, s, writer, store)
+	if vds == nil {
+		return
 	}
-	return cpuUtilizations
+	bucketSeries(vds, bucketWidth)
+
+	writeRunResponse(w, vds)
 }
 
-func tallyLines(dbFileName string, scenarioRunId int64) []TallyLine {
-	totalConn, err := sqlite3.Open(dbFileName, sqlite3.OPEN_READONLY)
-	if err != nil {
-		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+// maxBuckets is the most buckets that a run's results may be downsampled into. A narrower
+// bucket would give more buckets than there were lines to begin with.
+const maxBuckets = 10000
+
+// bucketWidthParam reads the width of the buckets that results should be downsampled into
+// from the bucket query parameter, such as "1s". It gives zero if results shouldn't be.
+// A width that would split a run of runFor into more than maxBuckets is refused.
+func bucketWidthParam(r *http.Request, runFor time.Duration) (time.Duration, error) {
+	raw := r.URL.Query().Get("bucket")
+	if raw == "" {
+		return 0, nil
 	}
-	defer totalConn.Close()
 
-	totalStmt, err := totalConn.Prepare(data.RunningTallyQuery, scenarioRunId, scenarioRunId)
-	if err != nil {
-		panic(fmt.Errorf("could not prepare query: %s", err.Error()))
+	width, err := time.ParseDuration(raw)
+	if err != nil || width <= 0 {
+		return 0, fmt.Errorf("'%s' is not a bucket width, such as 1s or 500ms", raw)
+	}
+	if runFor/width > maxBuckets {
+		return 0, fmt.Errorf("a bucket width of %s splits the run of %s into more than %d buckets", width, runFor, maxBuckets)
 	}
 
-	var occursAt, tally int64
-	var stockName, kindStocked string
-	tallyLines := make([]TallyLine, 0)
-	for {
-		hasRow, err := totalStmt.Step()
-		if err != nil {
-			panic(fmt.Errorf("could not step: %s", err.Error()))
-		}
+	return width, nil
+}
 
-		if !hasRow {
-			break
-		}
+// bucketSeries replaces the tally lines and response times of a response with buckets of
+// width, unless width is zero.
+func bucketSeries(vds *SkenarioRunResponse, width time.Duration) {
+	if width == 0 {
+		return
+	}
 
-		err = totalStmt.Scan(&occursAt, &stockName, &kindStocked, &tally)
-		if err != nil {
-			panic(fmt.Errorf("could not scan: %s", err.Error()))
-		}
+	from := startAt.UnixNano()
+	vds.BucketWidth = width
+	vds.TallyBuckets = data.BucketTallyLines(vds.TallyLines, from, startAt.Add(vds.RanFor).UnixNano(), width)
+	vds.ResponseTimeBuckets = data.BucketResponseTimes(vds.ResponseTimes, from, width)
+	vds.TallyLines = make([]TallyLine, 0)
+	vds.ResponseTimes = make([]ResponseTime, 0)
+}
 
-		line := TallyLine{
-			OccursAt:    occursAt,
-			StockName:   stockName,
-			KindStocked: kindStocked,
-			Tally:       tally,
-		}
-		tallyLines = append(tallyLines, line)
+// writeRunResponse gives the results of a run, with an Unprocessable Entity status if the
+// run failed validation.
+func writeRunResponse(w http.ResponseWriter, vds *SkenarioRunResponse) {
+	status := http.StatusOK
+	if vds.ValidationFailure != nil {
+		status = http.StatusUnprocessableEntity
+	} else if vds.AutoscalerFailure != "" {
+		status = http.StatusInternalServerError
 	}
 
-	return tallyLines
+	writeJSON(w, status, vds)
 }
 
-func responseTimes(dbFileName string, scenarioRunId int64) []ResponseTime {
-	responseConn, err := sqlite3.Open(dbFileName, sqlite3.OPEN_READONLY)
+// runScenario runs a built scenario from wherever it has reached until it halts, then
+// gives the response for the recorded run. It gives nil if the client went away.
+func runScenario(r *http.Request, s *scenario, writer data.RunWriter, store data.RunStore) *SkenarioRunResponse {
+	_, _, err := s.env.Run()
+	truncated := err == simulator.ErrRunTruncated
+	validationErr, invalid := err.(*simulator.ValidationError)
+	autoscalerErr, failed := err.(*simulator.AutoscalerError)
+	if err != nil && !truncated && !invalid && !failed {
+		panic(err.Error())
+	}
+
+	err = writer.Finish(s.env.CPUUtilizations(), s.env.AutoscalerDecisions())
 	if err != nil {
-		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+		fmt.Printf("there was an error saving data: %s", err.Error())
 	}
-	defer responseConn.Close()
+	scenarioRunId := writer.ScenarioRunId()
 
-	responseStmt, err := responseConn.Prepare(data.ResponseTimesQuery, scenarioRunId)
+	if r.Context().Err() != nil {
+		log.Printf("Client went away, abandoned scenario run %d.", scenarioRunId)
+		return nil
+	}
+
+	ranFor := s.env.HaltTime().Sub(s.from)
+	if truncated || invalid || failed {
+		ranFor = s.env.CurrentMovementTime().Sub(s.from)
+	}
+
+	sloTarget := s.request.SLOLatencyTarget
+	if sloTarget == 0 {
+		sloTarget = s.request.RequestTimeout
+	}
+	summary := runSummary(store, scenarioRunId, data.SummaryConfig{
+		StartAt:          s.from,
+		RanFor:           ranFor,
+		InitialReplicas:  s.initialLaunching[""] + s.initialActive[""],
+		SLOLatencyTarget: sloTarget,
+	})
+	cost := runCost(store, scenarioRunId, data.CostConfig{
+		StartAt:          s.from,
+		RanFor:           ranFor,
+		InitialLaunching: s.initialLaunching,
+		InitialActive:    s.initialActive,
+		ReplicaCPU:       model.ReplicaCPUCapacityMillisPerSecond / 1000.0,
+		Pricing:          s.request.Pricing,
+	})
+
+	vds := runResults(store, scenarioRunId)
+	vds.RanFor = ranFor
+	vds.TrafficPattern = s.traffic.Name()
+	vds.Seed = s.env.Seed()
+	vds.Truncated = truncated || failed
+	vds.Summary = summary
+	vds.Cost = cost
+	vds.ValidationFailure = validationFailure(validationErr)
+	if failed {
+		vds.AutoscalerFailure = autoscalerErr.Error()
+	}
+
+	return vds
+}
+
+// runResults gives the parts of a run's response that are read back from its recorded
+// movements.
+func runResults(store data.RunReader, scenarioRunId int64) *SkenarioRunResponse {
+	rps, err := store.RequestsPerSecond(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not read requests per second: %s", err.Error()))
+	}
+	retries, err := store.RetriesPerSecond(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not read retries per second: %s", err.Error()))
+	}
+	tallyLines, err := store.TallyLines(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not read tally lines: %s", err.Error()))
+	}
+	responseTimes, err := store.ResponseTimes(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not read response times: %s", err.Error()))
+	}
+	cpuUtilizations, err := store.CPUUtilizations(scenarioRunId)
+	if err != nil {
+		panic(fmt.Errorf("could not read CPU utilizations: %s", err.Error()))
+	}
+	decisions, err := store.AutoscalerDecisions(scenarioRunId)
 	if err != nil {
-		panic(fmt.Errorf("could not prepare query: %s", err.Error()))
+		panic(fmt.Errorf("could not read autoscaler decisions: %s", err.Error()))
 	}
+	ignored, notes := ignoredMovements(store, scenarioRunId)
+
+	return &SkenarioRunResponse{
+		ScenarioRunId:       scenarioRunId,
+		TallyLines:          tallyLines,
+		ResponseTimes:       responseTimes,
+		RequestsPerSecond:   rps,
+		CPUUtilizations:     cpuUtilizations,
+		AutoscalerDecisions: decisions,
+		AutoscalerErrors:    autoscalerErrors(decisions),
+		RetriesPerSecond:    retries,
+		RetryAmplification:  retryAmplification(rps, retries),
+		RetryStorms:         retryStorms(rps, retries),
+		IgnoredMovements:    ignored,
+		Notes:               notes,
+		Diagnostics:         runDiagnostics(store, scenarioRunId),
+	}
+}
 
-	var arrivedAt, completedAt, rTime int64
-	responseTimes := make([]ResponseTime, 0)
-	for {
-		hasRow, err := responseStmt.Step()
-		if err != nil {
-			panic(fmt.Errorf("could not step: %s", err.Error()))
+// autoscalerErrors counts the decisions for which the autoscaler plugin failed.
+func autoscalerErrors(decisions []data.AutoscalerDecision) int {
+	count := 0
+	for _, d := range decisions {
+		if d.Error != "" {
+			count++
 		}
+	}
 
-		if !hasRow {
-			break
-		}
+	return count
+}
 
-		err = responseStmt.Scan(&arrivedAt, &completedAt, &rTime)
-		if err != nil {
-			panic(fmt.Errorf("could not scan: %s", err.Error()))
-		}
+func validationFailure(ve *simulator.ValidationError) *ValidationFailure {
+	if ve == nil {
+		return nil
+	}
 
-		var rt = ResponseTime{
-			ArrivedAt:    arrivedAt,
-			CompletedAt:  completedAt,
-			ResponseTime: rTime,
-		}
-		responseTimes = append(responseTimes, rt)
+	failure := &ValidationFailure{
+		Check:          ve.Check,
+		MovementNumber: ve.Number,
+		Kind:           string(ve.Movement.Kind()),
+		OccursAt:       ve.Movement.OccursAt().UnixNano(),
+		FromStock:      string(ve.Movement.From().Name()),
+		ToStock:        string(ve.Movement.To().Name()),
+		Message:        ve.Error(),
+	}
+	if ve.Moved != nil {
+		failure.Moved = string(ve.Moved.Name())
 	}
 
-	return responseTimes
+	return failure
 }
 
-func requestsPerSecond(dbFileName string, scenarioRunId int64) []RPS {
-	rpsConn, err := sqlite3.Open(dbFileName, sqlite3.OPEN_READONLY)
+// deleteAutoscaler removes the run's autoscaler from the plugin, however the run ended.
+func deleteAutoscaler(env simulator.Environment) {
+	err := env.Plugin().Event(startAt.UnixNano(), proto.EventType_DELETE, &skplug.Autoscaler{})
 	if err != nil {
-		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+		log.Printf("Could not delete autoscaler: %s", err.Error())
+		return
 	}
-	defer rpsConn.Close()
+	log.Printf("Deleted autoscaler.")
+}
 
-	requestsPerSecondStmt, err := rpsConn.Prepare(data.RequestsPerSecondQuery, scenarioRunId)
-	if err != nil {
-		panic(fmt.Errorf("could not prepare query: %s", err.Error()))
+// retryAmplification gives the total number of attempts sent for each first attempt.
+func retryAmplification(requestsPerSecond, retriesPerSecond []RPS) float64 {
+	var firstAttempts, retries int64
+	for _, r := range requestsPerSecond {
+		firstAttempts += r.Requests
+	}
+	for _, r := range retriesPerSecond {
+		retries += r.Requests
 	}
 
-	var second, requests int64
-	requestsPerSecond := make([]RPS, 0)
-	for {
-		hasRow, err := requestsPerSecondStmt.Step()
-		if err != nil {
-			panic(fmt.Errorf("could not step: %s", err.Error()))
-		}
+	if firstAttempts == 0 {
+		return 0
+	}
+
+	return float64(firstAttempts+retries) / float64(firstAttempts)
+}
 
-		if !hasRow {
-			break
+func retryStorms(requestsPerSecond, retriesPerSecond []RPS) []RetryStorm {
+	firstAttempts := make(map[int64]int64)
+	for _, r := range requestsPerSecond {
+		firstAttempts[r.Second] = r.Requests
+	}
+
+	storms := make([]RetryStorm, 0)
+	var current *RetryStorm
+	for _, r := range retriesPerSecond {
+		inStorm := r.Requests > 0 && r.Requests >= firstAttempts[r.Second]
+		if !inStorm {
+			current = nil
+			continue
 		}
 
-		err = requestsPerSecondStmt.Scan(&second, &requests)
-		if err != nil {
-			panic(fmt.Errorf("could not scan: %s", err.Error()))
+		if current == nil || current.EndedAt != r.Second-1 {
+			storms = append(storms, RetryStorm{StartedAt: r.Second, EndedAt: r.Second})
+			current = &storms[len(storms)-1]
 		}
 
-		var rps = RPS{
-			Second:   second,
-			Requests: requests,
+		current.EndedAt = r.Second
+		if r.Requests > current.PeakRetriesPerSecond {
+			current.PeakRetriesPerSecond = r.Requests
 		}
-		requestsPerSecond = append(requestsPerSecond, rps)
 	}
 
-	return requestsPerSecond
+	return storms
 }
 
-func buildClusterConfig(srr *SkenarioRunRequest) model.ClusterConfig {
+func buildClusterConfig(srr *SkenarioRunRequest, trafficConfig interface{}) model.ClusterConfig {
+	var numberOfRequests uint
+	if uniformConfig, ok := trafficConfig.(*trafficpatterns.UniformConfig); ok {
+		numberOfRequests = uint(uniformConfig.NumberOfRequests)
+	}
+
 	return model.ClusterConfig{
 		LaunchDelay:             srr.LaunchDelay,
 		TerminateDelay:          srr.TerminateDelay,
-		NumberOfRequests:        uint(srr.UniformConfig.NumberOfRequests),
+		NumberOfRequests:        numberOfRequests,
 		InitialNumberOfReplicas: srr.InitialNumberOfReplicas,
 	}
 }
@@ -351,5 +706,6 @@ func buildClusterConfig(srr *SkenarioRunRequest) model.ClusterConfig {
 func buildAutoscalerConfig(srr *SkenarioRunRequest) model.AutoscalerConfig {
 	return model.AutoscalerConfig{
 		TickInterval: srr.TickInterval,
+		Yaml:         srr.AutoscalerYaml,
 	}
 }
@@ -17,7 +17,9 @@ package serve
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -25,9 +27,12 @@ import (
 
 	"github.com/sclevine/spec"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"skenario/pkg/data"
 	"skenario/pkg/model"
 	"skenario/pkg/model/trafficpatterns"
+	"skenario/pkg/simulator"
 )
 
 func testRunHandler(t *testing.T, describe spec.G, it spec.S) {
@@ -47,11 +52,7 @@ func testRunHandler(t *testing.T, describe spec.G, it spec.S) {
 	//				TickInterval:     2 * time.Second,
 	//				RunFor:           20 * time.Second,
 	//				TrafficPattern:   "golang_rand_uniform",
-	//				UniformConfig: trafficpatterns.UniformConfig{
-	//					NumberOfRequests: 30,
-	//					StartAt:          time.Unix(0, 0),
-	//					RunFor:           20 * time.Second,
-	//				},
+	//				TrafficPatternConfig: json.RawMessage(`{"number_of_requests": 30}`),
 	//			}
 	//			var reqBody = new(bytes.Buffer)
 	//			err = json.NewEncoder(reqBody).Encode(skenarioRunRequest)
@@ -137,12 +138,9 @@ func testRunHandler(t *testing.T, describe spec.G, it spec.S) {
 				InMemoryDatabase: true,
 				LaunchDelay:      11 * time.Second,
 				TerminateDelay:   22 * time.Second,
-				UniformConfig: trafficpatterns.UniformConfig{
-					NumberOfRequests: 33,
-				},
 			}
 
-			subject = buildClusterConfig(srr)
+			subject = buildClusterConfig(srr, &trafficpatterns.UniformConfig{NumberOfRequests: 33})
 		})
 
 		it("sets a launch delay", func() {
@@ -156,6 +154,11 @@ func testRunHandler(t *testing.T, describe spec.G, it spec.S) {
 		it("sets a number of requests", func() {
 			assert.Equal(t, uint(33), subject.NumberOfRequests)
 		})
+
+		it("sets no number of requests for other patterns", func() {
+			subject = buildClusterConfig(srr, &trafficpatterns.StepConfig{RPS: 33})
+			assert.Equal(t, uint(0), subject.NumberOfRequests)
+		})
 	})
 
 	describe("buildAutoscalerConfig()", func() {
@@ -167,9 +170,6 @@ func testRunHandler(t *testing.T, describe spec.G, it spec.S) {
 				InMemoryDatabase: true,
 				LaunchDelay:      time.Second,
 				TickInterval:     11 * time.Second,
-				UniformConfig: trafficpatterns.UniformConfig{
-					NumberOfRequests: 88,
-				},
 			}
 
 			subject = buildAutoscalerConfig(srr)
@@ -178,6 +178,218 @@ func testRunHandler(t *testing.T, describe spec.G, it spec.S) {
 		it("sets a tick interval", func() {
 			assert.Equal(t, 11*time.Second, subject.TickInterval)
 		})
+
+		it("sets the autoscaler yaml", func() {
+			srr.AutoscalerYaml = "kind: HorizontalPodAutoscaler"
+			subject = buildAutoscalerConfig(srr)
+			assert.Equal(t, "kind: HorizontalPodAutoscaler", subject.Yaml)
+		})
+	})
+	describe("retryAmplification()", func() {
+		it("gives the ratio of all attempts to first attempts", func() {
+			rps := []RPS{{Second: 0, Requests: 10}, {Second: 1, Requests: 10}}
+			retries := []RPS{{Second: 1, Requests: 5}}
+			assert.Equal(t, 1.25, retryAmplification(rps, retries))
+		})
+
+		it("gives zero when there were no requests", func() {
+			assert.Equal(t, 0.0, retryAmplification([]RPS{}, []RPS{}))
+		})
+	})
+
+	describe("bucketWidthParam()", func() {
+		it("gives zero when results shouldn't be bucketed", func() {
+			width, err := bucketWidthParam(httptest.NewRequest("POST", "/run", nil), time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, time.Duration(0), width)
+		})
+
+		it("allows as many as maxBuckets buckets", func() {
+			width, err := bucketWidthParam(httptest.NewRequest("POST", "/run?bucket=6ms", nil), time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, 6*time.Millisecond, width)
+		})
+
+		it("refuses widths that would give more than maxBuckets buckets", func() {
+			_, err := bucketWidthParam(httptest.NewRequest("POST", "/run?bucket=1ns", nil), time.Minute)
+			assert.EqualError(t, err, "a bucket width of 1ns splits the run of 1m0s into more than 10000 buckets")
+		})
+	})
+
+	describe("bucketSeries()", func() {
+		var vds *SkenarioRunResponse
+
+		it.Before(func() {
+			vds = &SkenarioRunResponse{
+				RanFor:        2 * time.Second,
+				TallyLines:    []TallyLine{{OccursAt: startAt.UnixNano(), StockName: "ReplicasActive", KindStocked: "Replica", Tally: 1}},
+				ResponseTimes: []ResponseTime{{ArrivedAt: startAt.UnixNano(), CompletedAt: startAt.UnixNano() + 10, ResponseTime: 10}},
+			}
+		})
+
+		it("replaces tally lines and response times with buckets of the width", func() {
+			bucketSeries(vds, time.Second)
+			assert.Equal(t, time.Second, vds.BucketWidth)
+			assert.Len(t, vds.TallyBuckets, 2)
+			assert.Len(t, vds.ResponseTimeBuckets, 1)
+			assert.Empty(t, vds.TallyLines)
+			assert.Empty(t, vds.ResponseTimes)
+		})
+
+		it("leaves the series alone when there is no width", func() {
+			bucketSeries(vds, 0)
+			assert.Len(t, vds.TallyLines, 1)
+			assert.Len(t, vds.ResponseTimes, 1)
+			assert.Nil(t, vds.TallyBuckets)
+		})
+	})
+
+	describe("retryStorms()", func() {
+		var storms []RetryStorm
+
+		it.Before(func() {
+			rps := []RPS{{Second: 0, Requests: 10}, {Second: 1, Requests: 4}, {Second: 2, Requests: 4}, {Second: 3, Requests: 10}, {Second: 4, Requests: 1}}
+			retries := []RPS{{Second: 1, Requests: 5}, {Second: 2, Requests: 8}, {Second: 3, Requests: 2}, {Second: 4, Requests: 3}}
+			storms = retryStorms(rps, retries)
+		})
+
+		it("finds runs of seconds where retries outnumber first attempts", func() {
+			assert.Equal(t, []RetryStorm{
+				{StartedAt: 1, EndedAt: 2, PeakRetriesPerSecond: 8},
+				{StartedAt: 4, EndedAt: 4, PeakRetriesPerSecond: 3},
+			}, storms)
+		})
+	})
+
+	describe("validationFailure()", func() {
+		it("gives nil when the run was valid", func() {
+			assert.Nil(t, validationFailure(nil))
+		})
+
+		it("describes the movement that failed a check", func() {
+			from := simulator.NewThroughStock("from", "thing")
+			to := simulator.NewThroughStock("to", "thing")
+			ve := &simulator.ValidationError{
+				Check:    "entity_location",
+				Number:   12,
+				Movement: simulator.NewMovement("move", time.Unix(0, 99), from, to),
+				Moved:    simulator.NewEntity("thing-1", "thing"),
+				Err:      errors.New("gone astray"),
+			}
+
+			assert.Equal(t, &ValidationFailure{
+				Check:          "entity_location",
+				MovementNumber: 12,
+				Kind:           "move",
+				OccursAt:       99,
+				FromStock:      "from",
+				ToStock:        "to",
+				Moved:          "thing-1",
+				Message:        ve.Error(),
+			}, validationFailure(ve))
+		})
+	})
+
+	describe("autoscalerErrors()", func() {
+		it("counts the decisions whose plugin failed", func() {
+			assert.Equal(t, 2, autoscalerErrors([]data.AutoscalerDecision{
+				{Desired: 1, Recommended: 2},
+				{Desired: 2, Error: "plugin went away"},
+				{Service: "backend", Desired: 1, Error: "plugin went away"},
+			}))
+		})
+	})
+
+	describe("writeRunResponse()", func() {
+		it("fails the response of a run stopped by its autoscaler", func() {
+			rec := httptest.NewRecorder()
+			writeRunResponse(rec, &SkenarioRunResponse{Truncated: true, AutoscalerErrors: 1, AutoscalerFailure: "autoscaler failed at 1: plugin went away"})
+
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"autoscaler_failure":"autoscaler failed at 1: plugin went away"`)
+		})
+	})
+
+	describe("SkenarioRunRequest.trafficPatternConfig()", func() {
+		it("gives traffic_pattern_config", func() {
+			runReq := &SkenarioRunRequest{TrafficPattern: "step", TrafficPatternConfig: json.RawMessage(`{"rps": 10}`), StepConfig: json.RawMessage(`{"rps": 20}`)}
+			assert.JSONEq(t, `{"rps": 10}`, string(runReq.trafficPatternConfig()))
+		})
+
+		it("falls back to the pattern's own field, as older clients send", func() {
+			runReq := &SkenarioRunRequest{TrafficPattern: "sinusoidal", SinusoidalConfig: json.RawMessage(`{"amplitude": 50}`), StepConfig: json.RawMessage(`{"rps": 20}`)}
+			assert.JSONEq(t, `{"amplitude": 50}`, string(runReq.trafficPatternConfig()))
+		})
+
+		it("builds scenarios from the config in an older request", func() {
+			runReq := &SkenarioRunRequest{}
+			require.NoError(t, json.Unmarshal([]byte(`{"run_for": 60000000000, "traffic_pattern": "golang_rand_uniform", "uniform_config": {"number_of_requests": 7}}`), runReq))
+
+			s, err := newScenario(context.Background(), runReq)
+			require.NoError(t, err)
+			assert.Equal(t, uint(7), s.clusterConf.NumberOfRequests)
+
+			var stored SkenarioRunRequest
+			require.NoError(t, json.Unmarshal(s.configuration().Request, &stored))
+			assert.Contains(t, string(stored.TrafficPatternConfig), `"number_of_requests":7`)
+			assert.Empty(t, stored.UniformConfig)
+		})
+	})
+
+	describe("scenario.configuration()", func() {
+		var runReq *SkenarioRunRequest
+		var config data.RunConfiguration
+
+		it.Before(func() {
+			runReq = &SkenarioRunRequest{
+				RunFor:                  time.Minute,
+				TrafficPattern:          "step",
+				TrafficPatternConfig:    json.RawMessage(`{ "rps": 10 }`),
+				Seed:                    99,
+				InitialNumberOfReplicas: 2,
+				RequestTimeout:          time.Second,
+				RequestCPUTimeMillis:    200,
+				RequestIOTimeMillis:     50,
+				Services: []ServiceRequest{
+					{Name: "cart", TrafficPattern: "step", TrafficPatternConfig: json.RawMessage(`{"step_after": 5}`)},
+					{Name: "db"},
+				},
+			}
+
+			s, err := newScenario(context.Background(), runReq)
+			require.NoError(t, err)
+			config = s.configuration()
+		})
+
+		it("copies out the fields that runs are filtered by", func() {
+			assert.Equal(t, int64(99), config.Seed)
+			assert.Equal(t, int64(2), config.InitialNumberOfReplicas)
+			assert.Equal(t, time.Second, config.RequestTimeout)
+			assert.Equal(t, int64(200), config.RequestCPUTimeMillis)
+			assert.Equal(t, int64(50), config.RequestIOTimeMillis)
+		})
+
+		it("writes every traffic pattern config out in full", func() {
+			var stored SkenarioRunRequest
+			require.NoError(t, json.Unmarshal(config.Request, &stored))
+
+			assert.JSONEq(t, `{"rps": 10, "step_after": 0}`, string(stored.TrafficPatternConfig))
+			assert.JSONEq(t, `{"rps": 0, "step_after": 5}`, string(stored.Services[0].TrafficPatternConfig))
+			assert.Empty(t, stored.Services[1].TrafficPatternConfig)
+		})
+
+		it("leaves the request it was made from alone", func() {
+			assert.Equal(t, json.RawMessage(`{"step_after": 5}`), runReq.Services[0].TrafficPatternConfig)
+		})
+
+		it("is unchanged by running the stored request again", func() {
+			var stored SkenarioRunRequest
+			require.NoError(t, json.Unmarshal(config.Request, &stored))
+
+			again, err := newScenario(context.Background(), &stored)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(config.Request), string(again.configuration().Request))
+		})
 	})
 }
 
@@ -197,7 +409,7 @@ func trafficPatternBefore(t *testing.T, pattern string) *SkenarioRunResponse {
 	assert.NoError(t, err)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/run", RunHandler)
+	mux.HandleFunc("/run", newTestServer().RunHandler)
 
 	recorder := httptest.NewRecorder()
 	mux.ServeHTTP(recorder, req)
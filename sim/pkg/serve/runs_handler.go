@@ -0,0 +1,246 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"skenario/pkg/data"
+)
+
+// defaultRunsListed is how many runs are listed when no limit is asked for.
+const defaultRunsListed = 50
+
+type RunList struct {
+	Runs   []data.RunRecord `json:"runs"`
+	Total  int64            `json:"total"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+}
+
+// historyStore opens the store that stored runs are read from: the in-memory database
+// when the "in_memory_database" parameter is set, otherwise the server's backend. The
+// store must be released once the request is done with it.
+func (ss *SkenarioServer) historyStore(r *http.Request) (data.RunStore, func()) {
+	inMemory, _ := strconv.ParseBool(r.URL.Query().Get("in_memory_database"))
+	return ss.openRunStore(inMemory)
+}
+
+// RunsHandler lists stored runs, newest first. Runs can be filtered by origin, traffic
+// pattern, seed, initial number of replicas and request timeout, CPU time and IO time, and
+// paged through with "limit" and "offset".
+func (ss *SkenarioServer) RunsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, err := runFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, release := ss.historyStore(r)
+	defer release()
+
+	runs, total, err := store.ListRuns(filter)
+	if err != nil {
+		panic(fmt.Errorf("could not list scenario runs: %s", err.Error()))
+	}
+
+	writeJSON(w, http.StatusOK, RunList{Runs: runs, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+func runFilter(query url.Values) (data.RunFilter, error) {
+	filter := data.RunFilter{
+		Origin:         query.Get("origin"),
+		TrafficPattern: query.Get("traffic_pattern"),
+		Limit:          defaultRunsListed,
+	}
+
+	var limit, offset, requestTimeout int64
+	numbers := []struct {
+		name  string
+		value *int64
+	}{
+		{"seed", &filter.Seed},
+		{"initial_number_of_replicas", &filter.InitialNumberOfReplicas},
+		{"request_timeout_nanos", &requestTimeout},
+		{"request_cpu_time_millis", &filter.RequestCPUTimeMillis},
+		{"request_io_time_millis", &filter.RequestIOTimeMillis},
+		{"limit", &limit},
+		{"offset", &offset},
+	}
+	for _, n := range numbers {
+		raw := query.Get(n.name)
+		if raw == "" {
+			continue
+		}
+
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value < 0 {
+			return filter, fmt.Errorf("%s must be a whole number, not '%s'", n.name, raw)
+		}
+		*n.value = value
+	}
+
+	filter.RequestTimeout = time.Duration(requestTimeout)
+	if limit > 0 {
+		filter.Limit = int(limit)
+	}
+	if filter.Limit > data.MaxRunsListed {
+		filter.Limit = data.MaxRunsListed
+	}
+	filter.Offset = int(offset)
+
+	return filter, nil
+}
+
+// RunGetHandler gives the results of a stored run, as they were given when it was run.
+// Whether the run failed validation is not stored.
+func (ss *SkenarioServer) RunGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	scenarioRunId, ok := scenarioRunIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	store, release := ss.historyStore(r)
+	defer release()
+
+	record, err := store.LoadRun(scenarioRunId)
+	if err == data.ErrNoSuchRun {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(fmt.Errorf("could not load scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+	bucketWidth, err := bucketWidthParam(r, record.SimulatedDuration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	vds, err := storedRunResponse(store, record)
+	if err != nil {
+		panic(fmt.Errorf("could not load scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+	bucketSeries(vds, bucketWidth)
+
+	writeJSON(w, http.StatusOK, vds)
+}
+
+// storedRunResponse rebuilds the response of a stored run. A run that has no halting
+// movement stopped early, and ran until its last movement.
+func storedRunResponse(store data.RunReader, record data.RunRecord) (*SkenarioRunResponse, error) {
+	lastAt, halted, err := store.LastMovement(record.ScenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+	summary, _, err := store.LoadSummary(record.ScenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+	cost, _, err := store.LoadCost(record.ScenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+
+	vds := runResults(store, record.ScenarioRunId)
+	vds.RanFor = record.SimulatedDuration
+	if !halted {
+		vds.RanFor = time.Unix(0, lastAt).Sub(startAt)
+	}
+	vds.TrafficPattern = record.TrafficPattern
+	vds.Seed = record.Seed
+	vds.Truncated = !halted
+	vds.Summary = summary
+	vds.Cost = cost
+
+	return vds, nil
+}
+
+// RunDeleteHandler deletes a stored run and everything recorded about it.
+func (ss *SkenarioServer) RunDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	scenarioRunId, ok := scenarioRunIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	store, release := ss.historyStore(r)
+	defer release()
+
+	err := store.DeleteRun(scenarioRunId)
+	if err == data.ErrNoSuchRun {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(fmt.Errorf("could not delete scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunRerunHandler runs a stored run's configuration again, recording it as a new run.
+// Runs recorded before configurations were stored can't be run again.
+func (ss *SkenarioServer) RunRerunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	scenarioRunId, ok := scenarioRunIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	store, release := ss.historyStore(r)
+	config, err := store.LoadConfiguration(scenarioRunId)
+	release()
+	switch err {
+	case nil:
+	case data.ErrNoSuchRun:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case data.ErrNoConfiguration:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		panic(fmt.Errorf("could not load configuration of scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	runReq := &SkenarioRunRequest{}
+	err = json.Unmarshal(config.Request, runReq)
+	if err != nil {
+		panic(fmt.Errorf("could not decode configuration of scenario run %d: %s", scenarioRunId, err.Error()))
+	}
+
+	ss.serveRun(w, r, runReq)
+}
+
+func scenarioRunIdParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	raw := chi.URLParam(r, "scenarioRunId")
+	scenarioRunId, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("'%s' is not a scenario run id", raw), http.StatusBadRequest)
+		return 0, false
+	}
+
+	return scenarioRunId, true
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/data"
+	"skenario/pkg/model"
+)
+
+func testRunsHandlers(t *testing.T, describe spec.G, it spec.S) {
+	var server *SkenarioServer
+	var release func()
+	var store data.RunStore
+	var router chi.Router
+	var recorder *httptest.ResponseRecorder
+	var scenarioRunId int64
+
+	send := func(method, path string) {
+		req, err := http.NewRequest(method, path, nil)
+		require.NoError(t, err)
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+	}
+
+	it.Before(func() {
+		var err error
+		server = newTestServer()
+		store, release, err = server.InMemoryBackend.Open()
+		require.NoError(t, err)
+
+		writer, err := store.Writer(model.ClusterConfig{}, model.AutoscalerConfig{}, "history_test", "step", time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, writer.Finish(nil, nil))
+		scenarioRunId = writer.ScenarioRunId()
+
+		router = chi.NewRouter()
+		router.Get("/runs", server.RunsHandler)
+		router.Get("/runs/{scenarioRunId}", server.RunGetHandler)
+		router.Delete("/runs/{scenarioRunId}", server.RunDeleteHandler)
+		router.Post("/runs/{scenarioRunId}/rerun", server.RunRerunHandler)
+	})
+
+	it.After(func() {
+		release()
+	})
+
+	describe("RunsHandler()", func() {
+		it("lists the runs that match the filter", func() {
+			send("GET", "/runs?in_memory_database=true&origin=history_test")
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var list RunList
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&list))
+			require.NotEmpty(t, list.Runs)
+			assert.Equal(t, scenarioRunId, list.Runs[0].ScenarioRunId)
+			assert.Equal(t, defaultRunsListed, list.Limit)
+		})
+
+		it("rejects filters that are not whole numbers", func() {
+			send("GET", "/runs?in_memory_database=true&seed=seven")
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	})
+
+	describe("runFilter()", func() {
+		it("reads each filter from the query", func() {
+			query, err := url.ParseQuery("traffic_pattern=step&request_timeout_nanos=1000000000&request_cpu_time_millis=200&limit=10&offset=20")
+			require.NoError(t, err)
+
+			filter, err := runFilter(query)
+			require.NoError(t, err)
+			assert.Equal(t, data.RunFilter{
+				TrafficPattern:       "step",
+				RequestTimeout:       time.Second,
+				RequestCPUTimeMillis: 200,
+				Limit:                10,
+				Offset:               20,
+			}, filter)
+		})
+
+		it("lists no more than the most runs that can be listed at once", func() {
+			filter, err := runFilter(url.Values{"limit": {"100000"}})
+			require.NoError(t, err)
+			assert.Equal(t, data.MaxRunsListed, filter.Limit)
+		})
+	})
+
+	describe("RunGetHandler()", func() {
+		it("gives the stored run's results", func() {
+			send("GET", fmt.Sprintf("/runs/%d?in_memory_database=true", scenarioRunId))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var vds SkenarioRunResponse
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&vds))
+			assert.Equal(t, scenarioRunId, vds.ScenarioRunId)
+			assert.Equal(t, "step", vds.TrafficPattern)
+			assert.True(t, vds.Truncated) // nothing was moved, so the run never halted
+		})
+
+		it("downsamples the results into buckets of the given width", func() {
+			send("GET", fmt.Sprintf("/runs/%d?in_memory_database=true&bucket=500ms", scenarioRunId))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var vds SkenarioRunResponse
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&vds))
+			assert.Equal(t, 500*time.Millisecond, vds.BucketWidth)
+		})
+
+		it("gives 400 for bucket widths that aren't positive durations", func() {
+			send("GET", fmt.Sprintf("/runs/%d?in_memory_database=true&bucket=-1s", scenarioRunId))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+
+		it("gives 400 for bucket widths that would split the run into too many buckets", func() {
+			send("GET", fmt.Sprintf("/runs/%d?in_memory_database=true&bucket=1ns", scenarioRunId))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), "more than 10000 buckets")
+		})
+
+		it("gives 404 for runs that don't exist", func() {
+			send("GET", "/runs/987654321?in_memory_database=true")
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+		})
+
+		it("gives 400 for ids that aren't numbers", func() {
+			send("GET", "/runs/latest?in_memory_database=true")
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	})
+
+	describe("RunDeleteHandler()", func() {
+		it("deletes the run", func() {
+			send("DELETE", fmt.Sprintf("/runs/%d?in_memory_database=true", scenarioRunId))
+			assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+			send("DELETE", fmt.Sprintf("/runs/%d?in_memory_database=true", scenarioRunId))
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+		})
+	})
+
+	describe("RunRerunHandler()", func() {
+		it("refuses to rerun runs recorded without their configuration", func() {
+			send("POST", fmt.Sprintf("/runs/%d/rerun?in_memory_database=true", scenarioRunId))
+			assert.Equal(t, http.StatusConflict, recorder.Code)
+		})
+	})
+}
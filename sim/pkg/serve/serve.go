@@ -16,7 +16,9 @@
 package serve
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"time"
@@ -24,15 +26,36 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 
+	"skenario/pkg/data"
 	"skenario/pkg/plugin"
 )
 
+// maxInMemoryRuns is how many runs the in-memory database keeps, unless a server is given
+// an in-memory backend of its own.
+const maxInMemoryRuns = 100
+
 type SkenarioServer struct {
 	IndexRoot string
-	srv       *http.Server
+	// Backend is where runs are kept, or the skenario.db SQLite file if nil.
+	Backend data.Backend
+	// InMemoryBackend keeps the runs of requests that ask for the in-memory database. If
+	// nil, the maxInMemoryRuns most recently used of them are kept in this process.
+	InMemoryBackend data.Backend
+	srv             *http.Server
+	stopSweeping    chan struct{}
 }
 
 func (ss *SkenarioServer) Serve() {
+	if ss.Backend == nil {
+		ss.Backend = data.NewSQLiteBackend("skenario.db")
+	}
+	if ss.InMemoryBackend == nil {
+		ss.InMemoryBackend = data.NewMemoryBackend(maxInMemoryRuns)
+	}
+
+	ss.stopSweeping = make(chan struct{})
+	go sweepDebugSessionsEvery(debugSweepInterval, ss.stopSweeping)
+
 	plugin.Init()
 	router := chi.NewRouter()
 	router.Use(middleware.NoCache)
@@ -41,7 +64,21 @@ func (ss *SkenarioServer) Serve() {
 
 	router.Mount("/debug", middleware.Profiler())
 	router.Mount("/", http.FileServer(http.Dir(ss.IndexRoot)))
-	router.HandleFunc("/run", RunHandler)
+	router.HandleFunc("/run", ss.RunHandler)
+	router.HandleFunc("/patterns", PatternsHandler)
+	router.HandleFunc("/snapshot", SnapshotHandler)
+	router.HandleFunc("/resume", ss.ResumeHandler)
+	router.HandleFunc("/fork", ss.ForkHandler)
+	router.Get("/frontier", ss.FrontierHandler)
+	router.Get("/compare", ss.CompareHandler)
+	router.Get("/runs", ss.RunsHandler)
+	router.Get("/runs/{scenarioRunId}", ss.RunGetHandler)
+	router.Delete("/runs/{scenarioRunId}", ss.RunDeleteHandler)
+	router.Post("/runs/{scenarioRunId}/rerun", ss.RunRerunHandler)
+	router.Get("/runs/{scenarioRunId}/export", ss.ExportHandler)
+	router.Post("/debugger", DebuggerStartHandler)
+	router.Post("/debugger/{sessionId}", DebuggerCommandHandler)
+	router.Delete("/debugger/{sessionId}", DebuggerCloseHandler)
 
 	ss.srv = &http.Server{
 		Addr:    "0.0.0.0:3000",
@@ -57,14 +94,38 @@ func (ss *SkenarioServer) Serve() {
 func (ss *SkenarioServer) Shutdown() {
 	log.Println("Shutting down ...")
 
-	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 	err := ss.srv.Shutdown(ctx)
 	if err != nil {
 		log.Fatalf("shutdown error: %s", err.Error())
 	}
+	close(ss.stopSweeping)
+
+	for _, backend := range []data.Backend{ss.Backend, ss.InMemoryBackend} {
+		err = backend.Close()
+		if err != nil {
+			log.Printf("Could not close run backend: %s", err.Error())
+		}
+	}
 
 	log.Println("Shutting down autoscaler plugin")
 	plugin.Shutdown()
 
 	log.Println("Done.")
 }
+
+// writeJSON encodes v before writing any of the response, so that a value which can't be
+// encoded is still reported with an Internal Server Error status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body.WriteTo(w)
+}
@@ -20,10 +20,26 @@ import (
 
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
+
+	"skenario/pkg/data"
 )
 
+// newTestServer gives a server that keeps all of its runs in memory.
+func newTestServer() *SkenarioServer {
+	return &SkenarioServer{Backend: data.NewMemoryBackend(0), InMemoryBackend: data.NewMemoryBackend(0)}
+}
+
 func TestServePkg(t *testing.T) {
 	spec.Run(t, "RunHandler", testRunHandler, spec.Report(report.Terminal{}), spec.Sequential())
+	spec.Run(t, "PatternsHandler", testPatternsHandler, spec.Report(report.Terminal{}))
+	spec.Run(t, "Snapshot handlers", testSnapshotHandlers, spec.Report(report.Terminal{}))
+	spec.Run(t, "Debugger", testDebugger, spec.Report(report.Terminal{}))
+	spec.Run(t, "Diagnostics", testDiagnostics, spec.Report(report.Terminal{}))
+	spec.Run(t, "Services", testServices, spec.Report(report.Terminal{}))
+	spec.Run(t, "FrontierHandler", testFrontierHandler, spec.Report(report.Terminal{}))
+	spec.Run(t, "Runs handlers", testRunsHandlers, spec.Report(report.Terminal{}))
+	spec.Run(t, "CompareHandler", testCompareHandler, spec.Report(report.Terminal{}))
+	spec.Run(t, "ExportHandler", testExportHandler, spec.Report(report.Terminal{}))
 
 	//TODO https://github.com/pivotal/skenario/issues/83
 	//var server *SkenarioServer
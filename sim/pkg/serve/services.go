@@ -0,0 +1,209 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"skenario/pkg/model"
+	"skenario/pkg/model/trafficpatterns"
+	"skenario/pkg/simulator"
+)
+
+// mainService is how calls refer to the service described by the top level of a
+// SkenarioRunRequest.
+const mainService = "main"
+
+// ServiceRequest describes a further service simulated alongside the main one, on the same
+// clock. Each service has its own cluster and autoscaler, and traffic if it has a traffic
+// pattern. Fields left empty take the main service's values.
+type ServiceRequest struct {
+	Name                 string          `json:"name"`
+	TrafficPattern       string          `json:"traffic_pattern,omitempty"`
+	TrafficPatternConfig json.RawMessage `json:"traffic_pattern_config,omitempty"`
+
+	InitialNumberOfReplicas uint          `json:"initial_number_of_replicas,omitempty"`
+	LaunchDelay             time.Duration `json:"launch_delay,omitempty"`
+	TerminateDelay          time.Duration `json:"terminate_delay,omitempty"`
+	TickInterval            time.Duration `json:"tick_interval,omitempty"`
+	AutoscalerYaml          string        `json:"autoscaler_yaml,omitempty"`
+
+	RequestTimeout       time.Duration `json:"request_timeout_nanos,omitempty"`
+	RequestCPUTimeMillis int           `json:"request_cpu_time_millis,omitempty"`
+	RequestIOTimeMillis  int           `json:"request_io_time_millis,omitempty"`
+}
+
+// ServiceCall is an edge of the call graph: each request arriving at From calls To.
+type ServiceCall struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	model.DownstreamConfig
+}
+
+type service struct {
+	name          string
+	request       *SkenarioRunRequest
+	registration  trafficpatterns.Registration
+	trafficConfig interface{}
+	env           simulator.Environment
+	autoscaler    model.AutoscalerModel
+}
+
+// runRequest gives the main service's request with this service's values in place of its
+// own, so that the service can be built in the same way.
+func (sr ServiceRequest) runRequest(main *SkenarioRunRequest) *SkenarioRunRequest {
+	runReq := *main
+	runReq.TrafficPattern = sr.TrafficPattern
+	runReq.TrafficPatternConfig = sr.TrafficPatternConfig
+
+	if sr.InitialNumberOfReplicas != 0 {
+		runReq.InitialNumberOfReplicas = sr.InitialNumberOfReplicas
+	}
+	if sr.LaunchDelay != 0 {
+		runReq.LaunchDelay = sr.LaunchDelay
+	}
+	if sr.TerminateDelay != 0 {
+		runReq.TerminateDelay = sr.TerminateDelay
+	}
+	if sr.TickInterval != 0 {
+		runReq.TickInterval = sr.TickInterval
+	}
+	if sr.AutoscalerYaml != "" {
+		runReq.AutoscalerYaml = sr.AutoscalerYaml
+	}
+	if sr.RequestTimeout != 0 {
+		runReq.RequestTimeout = sr.RequestTimeout
+	}
+	if sr.RequestCPUTimeMillis != 0 {
+		runReq.RequestCPUTimeMillis = sr.RequestCPUTimeMillis
+	}
+	if sr.RequestIOTimeMillis != 0 {
+		runReq.RequestIOTimeMillis = sr.RequestIOTimeMillis
+	}
+
+	return &runReq
+}
+
+// newServices checks the further services and calls of runReq and gives each service an
+// environment within env.
+func newServices(env simulator.Environment, runReq *SkenarioRunRequest) ([]*service, error) {
+	services := make([]*service, 0, len(runReq.Services))
+	names := map[string]bool{mainService: true}
+
+	for _, sr := range runReq.Services {
+		if sr.Name == "" {
+			return nil, fmt.Errorf("every service must have a name")
+		}
+		if names[sr.Name] {
+			return nil, fmt.Errorf("there is more than one service named '%s'", sr.Name)
+		}
+		names[sr.Name] = true
+
+		svc := &service{
+			name:    sr.Name,
+			request: sr.runRequest(runReq),
+			env:     simulator.NewServiceEnvironment(env, sr.Name),
+		}
+
+		if sr.TrafficPattern != "" {
+			registration, ok := trafficpatterns.Lookup(sr.TrafficPattern)
+			if !ok {
+				return nil, fmt.Errorf("unknown traffic pattern '%s' for service '%s'", sr.TrafficPattern, sr.Name)
+			}
+			trafficConfig, err := registration.DecodeConfig(sr.TrafficPatternConfig)
+			if err != nil {
+				return nil, err
+			}
+
+			svc.registration = registration
+			svc.trafficConfig = trafficConfig
+		}
+
+		services = append(services, svc)
+	}
+
+	calls := make(map[string][]string)
+	for _, call := range runReq.Calls {
+		if !names[call.From] || !names[call.To] {
+			return nil, fmt.Errorf("call from '%s' to '%s' names a service that does not exist", call.From, call.To)
+		}
+		if call.CallsPerRequest < 0 {
+			return nil, fmt.Errorf("call from '%s' to '%s' has a negative number of calls per request", call.From, call.To)
+		}
+		calls[call.From] = append(calls[call.From], call.To)
+	}
+
+	if cycle := findCycle(calls); cycle != nil {
+		return nil, fmt.Errorf("calls must not form a cycle, but %v do", cycle)
+	}
+
+	return services, nil
+}
+
+// findCycle gives the services in a cycle of calls, or nil if there is none. Requests
+// would call each other forever in a cycle.
+func findCycle(calls map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	path := make([]string, 0)
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, next := range calls[name] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	names := make([]string, 0, len(calls))
+	for name := range calls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
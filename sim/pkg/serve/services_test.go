@@ -0,0 +1,115 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func testServices(t *testing.T, describe spec.G, it spec.S) {
+	var runReq *SkenarioRunRequest
+	var env simulator.Environment
+
+	it.Before(func() {
+		runReq = &SkenarioRunRequest{
+			RunFor:               time.Minute,
+			TrafficPattern:       "step",
+			LaunchDelay:          time.Second,
+			TickInterval:         2 * time.Second,
+			RequestCPUTimeMillis: 200,
+		}
+		env = simulator.NewEnvironment(context.Background(), startAt, time.Minute)
+	})
+
+	describe("ServiceRequest.runRequest()", func() {
+		it("takes the main service's values where its own are empty", func() {
+			sr := ServiceRequest{Name: "cart", TickInterval: 5 * time.Second}
+			svcReq := sr.runRequest(runReq)
+
+			assert.Equal(t, time.Second, svcReq.LaunchDelay)
+			assert.Equal(t, 200, svcReq.RequestCPUTimeMillis)
+			assert.Equal(t, 5*time.Second, svcReq.TickInterval)
+			assert.Equal(t, 2*time.Second, runReq.TickInterval)
+		})
+
+		it("has no traffic pattern unless given one", func() {
+			sr := ServiceRequest{Name: "cart"}
+			assert.Equal(t, "", sr.runRequest(runReq).TrafficPattern)
+		})
+	})
+
+	describe("newServices()", func() {
+		it("gives each service its own environment", func() {
+			runReq.Services = []ServiceRequest{{Name: "cart"}, {Name: "db", TrafficPattern: "step"}}
+			services, err := newServices(env, runReq)
+			require.NoError(t, err)
+
+			require.Len(t, services, 2)
+			assert.Equal(t, "cart", services[0].name)
+			assert.Equal(t, simulator.StockName("db/RequestsRouting"), simulator.ServiceStockName(services[1].env, "RequestsRouting"))
+			assert.Equal(t, "step", services[1].registration.Name)
+		})
+
+		it("rejects services without names", func() {
+			runReq.Services = []ServiceRequest{{}}
+			_, err := newServices(env, runReq)
+			assert.EqualError(t, err, "every service must have a name")
+		})
+
+		it("rejects services named twice, including the main service", func() {
+			runReq.Services = []ServiceRequest{{Name: "main"}}
+			_, err := newServices(env, runReq)
+			assert.EqualError(t, err, "there is more than one service named 'main'")
+		})
+
+		it("rejects unknown traffic patterns", func() {
+			runReq.Services = []ServiceRequest{{Name: "cart", TrafficPattern: "wibble"}}
+			_, err := newServices(env, runReq)
+			assert.EqualError(t, err, "unknown traffic pattern 'wibble' for service 'cart'")
+		})
+
+		it("rejects calls to services which do not exist", func() {
+			runReq.Calls = []ServiceCall{{From: "main", To: "cart"}}
+			_, err := newServices(env, runReq)
+			assert.EqualError(t, err, "call from 'main' to 'cart' names a service that does not exist")
+		})
+
+		it("rejects cycles of calls", func() {
+			runReq.Services = []ServiceRequest{{Name: "cart"}, {Name: "db"}}
+			runReq.Calls = []ServiceCall{{From: "main", To: "cart"}, {From: "cart", To: "db"}, {From: "db", To: "cart"}}
+			_, err := newServices(env, runReq)
+			assert.EqualError(t, err, "calls must not form a cycle, but [cart db cart] do")
+		})
+	})
+
+	describe("findCycle()", func() {
+		it("gives nil when calls form a tree", func() {
+			assert.Nil(t, findCycle(map[string][]string{"main": {"a", "b"}, "a": {"c"}, "b": {"c"}}))
+		})
+
+		it("finds a service calling itself", func() {
+			assert.Equal(t, []string{"a", "a"}, findCycle(map[string][]string{"a": {"a"}}))
+		})
+	})
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+// ScenarioSnapshot marks a scenario run At some offset from its start. It holds the run
+// request with its seed, so that the run's models can be built again, and the State of
+// the run there, which is restored into them so that the run can carry on.
+type ScenarioSnapshot struct {
+	Run   SkenarioRunRequest `json:"run"`
+	At    time.Duration      `json:"at"`
+	State simulator.Snapshot `json:"state"`
+}
+
+type SnapshotRequest struct {
+	Run SkenarioRunRequest `json:"run"`
+	At  time.Duration      `json:"at"`
+}
+
+// ForkBranch is one what-if branch of a fork. Zero values keep the snapshot's own
+// autoscaler settings.
+type ForkBranch struct {
+	Name           string        `json:"name"`
+	TickInterval   time.Duration `json:"tick_interval,omitempty"`
+	AutoscalerYaml string        `json:"autoscaler_yaml,omitempty"`
+}
+
+type ForkRequest struct {
+	Snapshot ScenarioSnapshot `json:"snapshot"`
+	Branches []ForkBranch     `json:"branches"`
+}
+
+type ForkBranchResult struct {
+	Name   string              `json:"name"`
+	Result SkenarioRunResponse `json:"result"`
+}
+
+type ForkResponse struct {
+	Branches []ForkBranchResult `json:"branches"`
+}
+
+// SnapshotHandler runs a scenario until the requested offset and describes its state there.
+// Nothing is recorded in the database.
+func SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snapReq := &SnapshotRequest{}
+	err := json.NewDecoder(r.Body).Decode(snapReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if snapReq.At <= 0 || snapReq.At >= snapReq.Run.RunFor {
+		http.Error(w, fmt.Sprintf("snapshot offset %s must be within the run of %s", snapReq.At, snapReq.Run.RunFor), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := runContext(r, &snapReq.Run)
+	defer cancel()
+
+	s, err := newScenario(ctx, &snapReq.Run)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.build()
+	defer s.deleteAutoscalers()
+
+	_, _, err = s.env.RunUntil(startAt.Add(snapReq.At))
+	if err == simulator.ErrRunTruncated {
+		http.Error(w, "run was truncated before reaching the snapshot", http.StatusServiceUnavailable)
+		return
+	} else if ae, ok := err.(*simulator.AutoscalerError); ok {
+		http.Error(w, ae.Error(), http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		panic(err.Error())
+	}
+
+	writeJSON(w, http.StatusOK, ScenarioSnapshot{
+		Run:   snapReq.Run,
+		At:    snapReq.At,
+		State: s.env.Snapshot(),
+	})
+}
+
+// ResumeHandler restores a snapshotted run and carries it on until it halts. It gives the
+// same response as RunHandler, but covering the run from the snapshot onwards.
+func (ss *SkenarioServer) ResumeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	snapshot := &ScenarioSnapshot{}
+	err := json.NewDecoder(r.Body).Decode(snapshot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	vds, status, err := ss.resume(r, snapshot, nil)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if vds == nil {
+		return
+	}
+
+	writeRunResponse(w, vds)
+}
+
+// ForkHandler restores a snapshotted run once for each branch, reconfiguring the
+// autoscaler there before each branch carries on.
+func (ss *SkenarioServer) ForkHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	forkReq := &ForkRequest{}
+	err := json.NewDecoder(r.Body).Decode(forkReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(forkReq.Branches) == 0 {
+		http.Error(w, "a fork needs at least one branch", http.StatusBadRequest)
+		return
+	}
+
+	forkResp := ForkResponse{Branches: make([]ForkBranchResult, 0, len(forkReq.Branches))}
+	for _, branch := range forkReq.Branches {
+		// each branch rebuilds the run, so it needs its own copy of the snapshot
+		snapshot := forkReq.Snapshot
+		asConf := branchAutoscalerConfig(buildAutoscalerConfig(&snapshot.Run), branch)
+
+		vds, status, err := ss.resume(r, &snapshot, &asConf)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("branch '%s': %s", branch.Name, err.Error()), status)
+			return
+		}
+		if vds == nil {
+			return
+		}
+
+		forkResp.Branches = append(forkResp.Branches, ForkBranchResult{Name: branch.Name, Result: *vds})
+	}
+
+	writeJSON(w, http.StatusOK, forkResp)
+}
+
+// resume rebuilds the snapshotted run's models and restores the snapshot's state into
+// them. If it cannot be restored, or the restored state does not match the snapshot, the
+// scenario has changed since the snapshot was taken. The autoscaler is then reconfigured,
+// if asked, and the run carries on until it halts.
+func (ss *SkenarioServer) resume(r *http.Request, snapshot *ScenarioSnapshot, reconfigure *model.AutoscalerConfig) (*SkenarioRunResponse, int, error) {
+	if snapshot.Run.Seed == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("snapshot has no seed")
+	}
+	snapshot.Run.Validate = false
+
+	ctx, cancel := runContext(r, &snapshot.Run)
+	defer cancel()
+
+	s, err := newScenario(ctx, &snapshot.Run)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	store, release := ss.openRunStore(snapshot.Run.InMemoryDatabase)
+	defer release()
+
+	writer := s.record(store)
+
+	s.build()
+	defer s.deleteAutoscalers()
+
+	err = s.env.Restore(snapshot.State)
+	if err != nil {
+		return nil, http.StatusConflict, fmt.Errorf("could not restore the snapshot: %s", err.Error())
+	}
+	if !s.env.Snapshot().Matches(snapshot.State) {
+		return nil, http.StatusConflict, fmt.Errorf("restoring the run did not reach the snapshotted state")
+	}
+
+	s.from = snapshot.State.TakenAt
+	s.countInitialReplicas()
+
+	if reconfigure != nil {
+		s.autoscaler.Reconfigure(*reconfigure)
+	}
+
+	return runScenario(r, s, writer, store), http.StatusOK, nil
+}
+
+func branchAutoscalerConfig(base model.AutoscalerConfig, branch ForkBranch) model.AutoscalerConfig {
+	if branch.TickInterval > 0 {
+		base.TickInterval = branch.TickInterval
+	}
+	if branch.AutoscalerYaml != "" {
+		base.Yaml = branch.AutoscalerYaml
+	}
+
+	return base
+}
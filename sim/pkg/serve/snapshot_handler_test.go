@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/stretchr/testify/assert"
+
+	"skenario/pkg/model"
+)
+
+func testSnapshotHandlers(t *testing.T, describe spec.G, it spec.S) {
+	var recorder *httptest.ResponseRecorder
+
+	post := func(handler http.HandlerFunc, body interface{}) {
+		reqBody := new(bytes.Buffer)
+		err := json.NewEncoder(reqBody).Encode(body)
+		assert.NoError(t, err)
+
+		req, err := http.NewRequest("POST", "/", reqBody)
+		assert.NoError(t, err)
+
+		recorder = httptest.NewRecorder()
+		handler(recorder, req)
+	}
+
+	describe("SnapshotHandler()", func() {
+		it("rejects offsets outside the run", func() {
+			post(SnapshotHandler, SnapshotRequest{Run: SkenarioRunRequest{RunFor: 10 * time.Second}, At: 10 * time.Second})
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+
+		it("rejects unknown traffic patterns", func() {
+			post(SnapshotHandler, SnapshotRequest{Run: SkenarioRunRequest{RunFor: 10 * time.Second, TrafficPattern: "nonexistent"}, At: time.Second})
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), "unknown traffic pattern 'nonexistent'")
+		})
+	})
+
+	describe("ResumeHandler()", func() {
+		it("rejects snapshots without a seed", func() {
+			post(newTestServer().ResumeHandler, ScenarioSnapshot{Run: SkenarioRunRequest{RunFor: 10 * time.Second, TrafficPattern: "step"}, At: time.Second})
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), "no seed")
+		})
+	})
+
+	describe("ForkHandler()", func() {
+		it("rejects forks without branches", func() {
+			post(newTestServer().ForkHandler, ForkRequest{})
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	})
+
+	describe("branchAutoscalerConfig()", func() {
+		var base model.AutoscalerConfig
+
+		it.Before(func() {
+			base = model.AutoscalerConfig{TickInterval: 2 * time.Second, Yaml: "kind: Base"}
+		})
+
+		it("keeps the base config for zero values", func() {
+			assert.Equal(t, base, branchAutoscalerConfig(base, ForkBranch{Name: "unchanged"}))
+		})
+
+		it("overrides the tick interval and yaml", func() {
+			subject := branchAutoscalerConfig(base, ForkBranch{TickInterval: 5 * time.Second, AutoscalerYaml: "kind: Branch"})
+			assert.Equal(t, model.AutoscalerConfig{TickInterval: 5 * time.Second, Yaml: "kind: Branch"}, subject)
+		})
+	})
+}
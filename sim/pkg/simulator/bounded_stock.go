@@ -0,0 +1,266 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// OverflowPolicy says what a BoundedStock does with an entity that arrives when it is full.
+type OverflowPolicy string
+
+const (
+	// OverflowReject refuses the entity. The Environment ignores the movement, leaving the
+	// entity where it was.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowDropOldest makes room by evicting the entity which has been in stock longest,
+	// moving it to the overflow stock if there is one.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowBlock holds the movement back until an entity has been removed, when the
+	// Environment tries it again.
+	OverflowBlock OverflowPolicy = "block"
+)
+
+// StockOrder says which entity a BoundedStock gives up when one is removed.
+type StockOrder string
+
+const (
+	OrderFIFO     StockOrder = "fifo"
+	OrderLIFO     StockOrder = "lifo"
+	OrderPriority StockOrder = "priority"
+)
+
+var ErrStockFull = errors.New("stock is full")
+
+// StockConfig describes the capacity and ordering of a BoundedStock. The zero value gives
+// an unbounded FIFO stock, which is how plain stocks behave.
+type StockConfig struct {
+	// Capacity is the most entities the stock will hold. Zero means there is no limit.
+	Capacity uint64
+	Overflow OverflowPolicy
+	Order    StockOrder
+	// Priority ranks entities for OrderPriority. Higher priorities are removed first and
+	// entities of equal priority are removed in the order they arrived.
+	Priority func(entity Entity) int64
+	// OverflowTo receives entities evicted by OverflowDropOldest. Without it they are
+	// discarded.
+	OverflowTo SinkStock
+}
+
+type BoundedStock interface {
+	ThroughStock
+	Config() StockConfig
+	// Admits is whether an entity added now would be stocked without evicting another.
+	Admits() bool
+	// Dropped is how many entities have been evicted to make room.
+	Dropped() uint64
+	// RestoreEntities replaces the stock's contents with entities, in the order they will
+	// be removed, as when it is restored from a Snapshot. They are taken to have arrived
+	// in that order too.
+	RestoreEntities(entities []Entity, dropped uint64) error
+}
+
+// boundedStock keeps its entities in the order they will be removed, except for OrderLIFO
+// stocks which keep them in arrival order and remove from the end.
+type boundedStock struct {
+	name       StockName
+	stocksKind EntityKind
+	config     StockConfig
+
+	entities []*Entity
+	arrivals []uint64
+	arrived  uint64
+	dropped  uint64
+}
+
+func (bs *boundedStock) Name() StockName {
+	return bs.name
+}
+
+func (bs *boundedStock) KindStocked() EntityKind {
+	return bs.stocksKind
+}
+
+func (bs *boundedStock) Count() uint64 {
+	return uint64(len(bs.entities))
+}
+
+func (bs *boundedStock) EntitiesInStock() []*Entity {
+	return bs.entities
+}
+
+func (bs *boundedStock) Config() StockConfig {
+	return bs.config
+}
+
+func (bs *boundedStock) Admits() bool {
+	return bs.config.Capacity == 0 || bs.Count() < bs.config.Capacity
+}
+
+func (bs *boundedStock) Dropped() uint64 {
+	return bs.dropped
+}
+
+func (bs *boundedStock) RestoreEntities(entities []Entity, dropped uint64) error {
+	if bs.config.Capacity > 0 && uint64(len(entities)) > bs.config.Capacity {
+		return fmt.Errorf("stock '%s' could not stock %d entities: %s", bs.Name(), len(entities), ErrStockFull)
+	}
+
+	for _, entity := range entities {
+		if entity.Kind() != bs.KindStocked() {
+			return fmt.Errorf("stock '%s' could not stock entity '%s' of kind '%s'", bs.Name(), entity.Name(), entity.Kind())
+		}
+	}
+
+	bs.entities = make([]*Entity, len(entities))
+	bs.arrivals = make([]uint64, len(entities))
+	for i := range entities {
+		bs.entities[i] = &entities[i]
+		bs.arrivals[i] = uint64(i)
+	}
+	bs.arrived = uint64(len(entities))
+	bs.dropped = dropped
+
+	return nil
+}
+
+func (bs *boundedStock) Add(entity Entity) error {
+	if entity == nil {
+		return fmt.Errorf("could not add Entity, as it was nil")
+	}
+
+	if entity.Kind() != bs.KindStocked() {
+		return fmt.Errorf(
+			"stock '%s' could not stock entity '%s'; stock accepts '%s' but kind is '%s'",
+			bs.Name(),
+			entity.Name(),
+			bs.KindStocked(),
+			entity.Kind(),
+		)
+	}
+
+	if !bs.Admits() {
+		if bs.config.Overflow != OverflowDropOldest {
+			return fmt.Errorf("stock '%s' could not stock entity '%s': %s", bs.Name(), entity.Name(), ErrStockFull)
+		}
+
+		err := bs.dropOldest()
+		if err != nil {
+			return err
+		}
+	}
+
+	i := len(bs.entities)
+	if bs.config.Order == OrderPriority {
+		priority := bs.config.Priority(entity)
+		i = sort.Search(len(bs.entities), func(j int) bool {
+			return bs.config.Priority(*bs.entities[j]) < priority
+		})
+	}
+
+	bs.entities = append(bs.entities, nil)
+	bs.arrivals = append(bs.arrivals, 0)
+	copy(bs.entities[i+1:], bs.entities[i:])
+	copy(bs.arrivals[i+1:], bs.arrivals[i:])
+	bs.entities[i] = &entity
+	bs.arrivals[i] = bs.arrived
+	bs.arrived++
+
+	return nil
+}
+
+func (bs *boundedStock) Remove() Entity {
+	if bs.Count() == 0 {
+		return nil
+	}
+
+	if bs.config.Order == OrderLIFO {
+		return bs.removeAt(len(bs.entities) - 1)
+	}
+	return bs.removeAt(0)
+}
+
+func (bs *boundedStock) dropOldest() error {
+	oldest := 0
+	for i := range bs.arrivals {
+		if bs.arrivals[i] < bs.arrivals[oldest] {
+			oldest = i
+		}
+	}
+
+	evicted := bs.removeAt(oldest)
+	bs.dropped++
+
+	if bs.config.OverflowTo != nil {
+		return bs.config.OverflowTo.Add(evicted)
+	}
+	return nil
+}
+
+func (bs *boundedStock) removeAt(i int) Entity {
+	e := bs.entities[i]
+
+	if i == 0 {
+		bs.entities[0] = nil // release the entity for collection
+		bs.entities, bs.arrivals = bs.entities[1:], bs.arrivals[1:]
+		return *e
+	}
+
+	copy(bs.entities[i:], bs.entities[i+1:])
+	copy(bs.arrivals[i:], bs.arrivals[i+1:])
+	last := len(bs.entities) - 1
+	bs.entities[last] = nil
+	bs.entities, bs.arrivals = bs.entities[:last], bs.arrivals[:last]
+
+	return *e
+}
+
+// NewBoundedStock creates a stock with the given capacity, overflow policy and ordering.
+// It panics if the configuration could not work.
+func NewBoundedStock(name StockName, stocks EntityKind, config StockConfig) BoundedStock {
+	if config.Overflow == "" {
+		config.Overflow = OverflowReject
+	}
+	if config.Order == "" {
+		config.Order = OrderFIFO
+	}
+
+	switch config.Overflow {
+	case OverflowReject, OverflowDropOldest, OverflowBlock:
+	default:
+		panic(fmt.Errorf("stock '%s' has unknown overflow policy '%s'", name, config.Overflow))
+	}
+
+	switch config.Order {
+	case OrderFIFO, OrderLIFO:
+	case OrderPriority:
+		if config.Priority == nil {
+			panic(fmt.Errorf("stock '%s' is ordered by priority but has no Priority function", name))
+		}
+	default:
+		panic(fmt.Errorf("stock '%s' has unknown order '%s'", name, config.Order))
+	}
+
+	return &boundedStock{
+		name:       name,
+		stocksKind: stocks,
+		config:     config,
+		entities:   make([]*Entity, 0),
+		arrivals:   make([]uint64, 0),
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedStock(t *testing.T) {
+	spec.Run(t, "BoundedStock", testBoundedStock, spec.Report(report.Terminal{}))
+}
+
+func testBoundedStock(t *testing.T, describe spec.G, it spec.S) {
+	var subject BoundedStock
+	var config StockConfig
+
+	fill := func(names ...EntityName) {
+		subject = NewBoundedStock("test stock", "test kind", config)
+		for _, name := range names {
+			assert.NoError(t, subject.Add(NewEntity(name, "test kind")))
+		}
+	}
+
+	removeAll := func() []EntityName {
+		removed := make([]EntityName, 0)
+		for subject.Count() > 0 {
+			removed = append(removed, subject.Remove().Name())
+		}
+		return removed
+	}
+
+	it.Before(func() {
+		config = StockConfig{}
+	})
+
+	describe("NewBoundedStock()", func() {
+		it("defaults to an unbounded FIFO stock which rejects overflow", func() {
+			subject = NewBoundedStock("test stock", "test kind", config)
+			assert.Equal(t, StockConfig{Overflow: OverflowReject, Order: OrderFIFO}, subject.Config())
+			assert.True(t, subject.Admits())
+		})
+
+		it("panics for an unknown overflow policy", func() {
+			assert.Panics(t, func() {
+				NewBoundedStock("test stock", "test kind", StockConfig{Overflow: "spill"})
+			})
+		})
+
+		it("panics for an unknown order", func() {
+			assert.Panics(t, func() {
+				NewBoundedStock("test stock", "test kind", StockConfig{Order: "random"})
+			})
+		})
+
+		it("panics for priority order without a Priority function", func() {
+			assert.Panics(t, func() {
+				NewBoundedStock("test stock", "test kind", StockConfig{Order: OrderPriority})
+			})
+		})
+	})
+
+	describe("ordering", func() {
+		it("removes the earliest arrival first for FIFO", func() {
+			fill("a", "b", "c")
+			assert.Equal(t, []EntityName{"a", "b", "c"}, removeAll())
+		})
+
+		it("removes the latest arrival first for LIFO", func() {
+			config.Order = OrderLIFO
+			fill("a", "b", "c")
+			assert.Equal(t, []EntityName{"c", "b", "a"}, removeAll())
+		})
+
+		it("removes the highest priority first for priority, then by arrival", func() {
+			config.Order = OrderPriority
+			config.Priority = func(entity Entity) int64 {
+				return int64(len(entity.Name()))
+			}
+			fill("a", "bb", "c", "ddd", "ee")
+			assert.Equal(t, []EntityName{"ddd", "bb", "ee", "a", "c"}, removeAll())
+		})
+	})
+
+	describe("RestoreEntities()", func() {
+		it("replaces the contents, to be removed in the order given", func() {
+			fill("a")
+			err := subject.RestoreEntities([]Entity{NewEntity("b", "test kind"), NewEntity("c", "test kind")}, 3)
+			assert.NoError(t, err)
+
+			assert.Equal(t, uint64(3), subject.Dropped())
+			assert.Equal(t, []EntityName{"b", "c"}, removeAll())
+		})
+
+		it("refuses entities of another kind", func() {
+			fill("a")
+			err := subject.RestoreEntities([]Entity{NewEntity("b", "other kind")}, 0)
+			assert.Error(t, err)
+			assert.Equal(t, []EntityName{"a"}, removeAll())
+		})
+	})
+
+	describe("when full", func() {
+		it.Before(func() {
+			config.Capacity = 2
+		})
+
+		it("no longer admits entities", func() {
+			fill("a")
+			assert.True(t, subject.Admits())
+			fill("a", "b")
+			assert.False(t, subject.Admits())
+		})
+
+		it("refuses entities when it rejects or blocks", func() {
+			fill("a", "b")
+			err := subject.Add(NewEntity("c", "test kind"))
+			assert.EqualError(t, err, "stock 'test stock' could not stock entity 'c': stock is full")
+			assert.Equal(t, uint64(2), subject.Count())
+		})
+
+		describe("when it drops the oldest", func() {
+			var overflow SinkStock
+
+			it.Before(func() {
+				overflow = NewSinkStock("overflow", "test kind")
+				config.Overflow = OverflowDropOldest
+				config.OverflowTo = overflow
+			})
+
+			it("evicts the earliest arrival to the overflow stock", func() {
+				fill("a", "b", "c")
+				assert.Equal(t, []EntityName{"b", "c"}, removeAll())
+				assert.Equal(t, EntityName("a"), (*overflow.EntitiesInStock()[0]).Name())
+				assert.Equal(t, uint64(1), subject.Dropped())
+			})
+
+			it("evicts the earliest arrival regardless of order", func() {
+				config.Order = OrderPriority
+				config.Priority = func(entity Entity) int64 {
+					return -int64(len(entity.Name()))
+				}
+				fill("aaa", "b", "cc")
+				assert.Equal(t, []EntityName{"b", "cc"}, removeAll())
+				assert.Equal(t, EntityName("aaa"), (*overflow.EntitiesInStock()[0]).Name())
+			})
+		})
+	})
+}
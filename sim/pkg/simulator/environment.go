@@ -17,9 +17,13 @@ package simulator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+
 	"skenario/pkg/plugin"
 )
 
@@ -27,17 +31,36 @@ const (
 	OccursInPast     = "ScheduledToOccurInPast"
 	OccursAfterHalt  = "ScheduledToOccurAfterHalt"
 	FromStockIsEmpty = "FromStockEmptyAtMovementTime"
+	ToStockIsFull    = "ToStockFullAtMovementTime"
 )
 
+// ErrRunTruncated is returned by Run, along with the movements made so far, when the
+// environment's context is cancelled or times out before the scenario halts.
+var ErrRunTruncated = errors.New("run was truncated before the scenario halted")
+
 type Environment interface {
 	Plugin() plugin.PluginPartition
 	AddToSchedule(movement Movement) (added bool)
 	Run() (completed []CompletedMovement, ignored []IgnoredMovement, err error)
+	RunUntil(until time.Time) (completed []CompletedMovement, ignored []IgnoredMovement, err error)
+	RunUntilKind(kind MovementKind) (completed []CompletedMovement, ignored []IgnoredMovement, err error)
+	Step() (stepped bool, err error)
+	Snapshot() Snapshot
+	Restore(snapshot Snapshot) error
 	CurrentMovementTime() time.Time
 	HaltTime() time.Time
 	Context() context.Context
 	CPUUtilizations() []*CPUUtilization
 	AppendCPUUtilization(cpuUtilization *CPUUtilization)
+	AutoscalerDecisions() []*AutoscalerDecision
+	AppendAutoscalerDecision(decision *AutoscalerDecision)
+	Seed() int64
+	Rand(stream string) *rand.Rand
+	NextNumber(sequence string) int
+	AddObserver(observer Observer)
+	AddSampler(interval time.Duration, sampler Sampler)
+	AddStock(stock Stock)
+	DiscardMovements()
 }
 
 type CompletedMovement struct {
@@ -51,14 +74,44 @@ type IgnoredMovement struct {
 	Moved    Entity
 }
 
+// CPUUtilization is the average CPU utilization of a service's active replicas, in
+// percent. Service is empty for the main service.
 type CPUUtilization struct {
+	Service        string
 	CPUUtilization float64
 	CalculatedAt   time.Time
 }
 
+// AutoscalerDecision records one tick of a service's autoscaler: the stats it was sent,
+// the number of replicas desired beforehand, and what it recommended. Err is set if the
+// plugin failed, in which case the desired replicas were left alone and the run stops.
+type AutoscalerDecision struct {
+	Service     string
+	DecidedAt   time.Time
+	Stats       []*proto.Stat
+	Desired     int32
+	Recommended int32
+	Err         error
+}
+
+// AutoscalerError is returned by Run, along with the movements made so far, when a
+// service's autoscaler plugin fails. The failed decision is recorded with the others.
+type AutoscalerError struct {
+	Decision *AutoscalerDecision
+}
+
+func (ae *AutoscalerError) Error() string {
+	service := ""
+	if ae.Decision.Service != "" {
+		service = fmt.Sprintf(" of service '%s'", ae.Decision.Service)
+	}
+
+	return fmt.Sprintf("autoscaler%s failed at %d: %s", service, ae.Decision.DecidedAt.UnixNano(), ae.Decision.Err.Error())
+}
+
 type environment struct {
-	ctx    context.Context
-	plugin plugin.PluginPartition
+	ctx        context.Context
+	pluginLogs map[string]*pluginLog
 
 	current time.Time
 	startAt time.Time
@@ -72,10 +125,25 @@ type environment struct {
 	completed       []CompletedMovement
 	ignored         []IgnoredMovement
 	cpuUtilizations []*CPUUtilization
+	decisions       []*AutoscalerDecision
+	randStreams     *RandStreams
+	numbers         map[string]int
+
+	observers      []Observer
+	samplers       []*scheduledSampler
+	sampledThrough time.Time
+	observerErr    error
+	discard        bool
+
+	movementsSoFar int
+	stocks         []Stock
+	blocked        map[StockName][]Movement
+	unblocking     map[StockName]Movement
+	stockSeen      map[Stock]bool
 }
 
 func (env *environment) Plugin() plugin.PluginPartition {
-	return env.plugin
+	return env.pluginLogs[""]
 }
 
 func (env *environment) AddToSchedule(movement Movement) (added bool) {
@@ -84,17 +152,14 @@ func (env *environment) AddToSchedule(movement Movement) (added bool) {
 
 	schedulable := occursAfterCurrent && occursBeforeHalt
 	if schedulable {
-		_, _, err := env.futureMovements.EnqueueMovement(movement)
-		if err != nil {
-			panic(fmt.Errorf("unknown error meant '%#v' was not added future movements: %s", movement, err.Error()))
-		}
+		env.futureMovements.EnqueueMovement(movement)
 	} else if !occursAfterCurrent {
-		env.ignored = append(env.ignored, IgnoredMovement{
+		env.ignore(IgnoredMovement{
 			Reason:   OccursInPast,
 			Movement: movement,
 		})
 	} else if !occursBeforeHalt {
-		env.ignored = append(env.ignored, IgnoredMovement{
+		env.ignore(IgnoredMovement{
 			Reason:   OccursAfterHalt,
 			Movement: movement,
 		})
@@ -104,9 +169,75 @@ func (env *environment) AddToSchedule(movement Movement) (added bool) {
 }
 
 func (env *environment) Run() ([]CompletedMovement, []IgnoredMovement, error) {
+	return env.runWhile(nil)
+}
+
+// RunUntil runs movements that occur before until, then stops with the current time set
+// to until. Calling Run or RunUntil again carries on from there.
+func (env *environment) RunUntil(until time.Time) ([]CompletedMovement, []IgnoredMovement, error) {
+	completed, ignored, err := env.runWhile(func(next Movement) bool {
+		return next.OccursAt().Before(until)
+	})
+	if err != nil {
+		return completed, ignored, err
+	}
+
+	env.sampleUntil(until.Add(-1 * time.Nanosecond))
+	if !env.futureMovements.IsClosed() && env.observerErr == nil && until.After(env.current) {
+		env.current = until
+	}
+
+	return completed, ignored, nil
+}
+
+// RunUntilKind runs movements until the next one is of the given kind, which is left
+// pending. If no movement of that kind comes, the scenario runs until it halts.
+func (env *environment) RunUntilKind(kind MovementKind) ([]CompletedMovement, []IgnoredMovement, error) {
+	return env.runWhile(func(next Movement) bool {
+		return next.Kind() != kind
+	})
+}
+
+// Step runs the next movement only. It gives false once the scenario has halted.
+func (env *environment) Step() (bool, error) {
+	stepped := false
+	_, _, err := env.runWhile(func(next Movement) bool {
+		more := !stepped
+		stepped = true
+		return more
+	})
+
+	return stepped && err == nil, err
+}
+
+// runWhile runs movements for as long as more gives true for the next pending movement.
+// A nil more runs until the scenario halts.
+func (env *environment) runWhile(more func(next Movement) bool) ([]CompletedMovement, []IgnoredMovement, error) {
+	var done <-chan struct{}
+	if env.ctx != nil {
+		done = env.ctx.Done()
+	}
+
+	if env.observerErr == ErrHaltRun {
+		env.observerErr = nil
+	}
+
 	for {
 		var err error
 
+		select {
+		case <-done:
+			return env.completed, env.ignored, ErrRunTruncated
+		default:
+		}
+
+		if more != nil {
+			next := env.futureMovements.PeekMovement()
+			if next == nil || !more(next) {
+				break
+			}
+		}
+
 		movement, err, closed := env.futureMovements.DequeueMovement()
 		if err != nil {
 			return nil, nil, err
@@ -116,20 +247,187 @@ func (env *environment) Run() ([]CompletedMovement, []IgnoredMovement, error) {
 			break
 		}
 
+		env.sampleUntil(movement.OccursAt())
+		if env.observerErr != nil {
+			break
+		}
+
 		env.current = movement.OccursAt()
+		env.movementsSoFar++
 
-		moved := movement.From().Remove()
-		if moved == nil {
-			env.ignored = append(env.ignored, IgnoredMovement{Movement: movement, Reason: FromStockIsEmpty})
-		} else {
-			movement.To().Add(moved)
-			env.completed = append(env.completed, CompletedMovement{Movement: movement, Moved: moved})
+		env.move(movement)
+
+		if env.observerErr != nil {
+			break
 		}
 	}
 
+	if env.observerErr != nil && env.observerErr != ErrHaltRun {
+		return env.completed, env.ignored, env.observerErr
+	}
+
 	return env.completed, env.ignored, nil
 }
 
+func (env *environment) move(movement Movement) {
+	if to, ok := movement.To().(BoundedStock); ok && !to.Admits() {
+		switch to.Config().Overflow {
+		case OverflowBlock:
+			env.block(movement)
+			return
+		case OverflowReject:
+			env.ignore(IgnoredMovement{Movement: movement, Reason: ToStockIsFull})
+			return
+		}
+	}
+
+	moved := movement.From().Remove()
+	if moved == nil {
+		env.ignore(IgnoredMovement{Movement: movement, Reason: FromStockIsEmpty})
+	} else {
+		movement.To().Add(moved)
+		env.complete(CompletedMovement{Movement: movement, Moved: moved})
+	}
+
+	if len(env.blocked) > 0 {
+		to := movement.To().Name()
+		if env.unblocking[to] == movement {
+			delete(env.unblocking, to)
+		}
+		env.unblock(to)
+		env.unblock(movement.From().Name())
+	}
+}
+
+// block holds a movement back until its stock has room. A movement which was being tried
+// again goes back to the front of the line.
+func (env *environment) block(movement Movement) {
+	name := movement.To().Name()
+	if env.unblocking[name] == movement {
+		delete(env.unblocking, name)
+		env.blocked[name] = append([]Movement{movement}, env.blocked[name]...)
+		return
+	}
+
+	env.blocked[name] = append(env.blocked[name], movement)
+}
+
+// unblock tries the first movement held back by a stock again, once the stock has room.
+// Only one is tried at a time, so that they keep their order.
+func (env *environment) unblock(name StockName) {
+	waiting := env.blocked[name]
+	if len(waiting) == 0 || env.unblocking[name] != nil {
+		return
+	}
+
+	held := waiting[0]
+	if !held.To().(BoundedStock).Admits() {
+		return
+	}
+
+	if len(waiting) == 1 {
+		delete(env.blocked, name)
+	} else {
+		env.blocked[name] = waiting[1:]
+	}
+
+	retry := NewMovement(held.Kind(), env.current.Add(1*time.Nanosecond), held.From(), held.To())
+	for _, note := range held.Notes() {
+		retry.AddNote(note)
+	}
+	retry.AddNote(fmt.Sprintf("held back from %d while '%s' was full", held.OccursAt().UnixNano(), name))
+
+	if env.AddToSchedule(retry) {
+		env.unblocking[name] = retry
+	}
+}
+
+func (env *environment) AddObserver(observer Observer) {
+	env.observers = append(env.observers, observer)
+}
+
+func (env *environment) AddSampler(interval time.Duration, sampler Sampler) {
+	if interval <= 0 {
+		panic(fmt.Errorf("sample interval must be positive, got %s", interval))
+	}
+
+	env.samplers = append(env.samplers, &scheduledSampler{
+		sampler:  sampler,
+		interval: interval,
+		next:     env.startAt,
+	})
+}
+
+// AddStock records a stock that models create when they are built, so that its contents
+// are part of every Snapshot and are given back by Restore. Stocks that hold nothing are
+// otherwise only found through pending movements.
+func (env *environment) AddStock(stock Stock) {
+	if env.stockSeen[stock] {
+		return
+	}
+
+	env.stockSeen[stock] = true
+	env.stocks = append(env.stocks, stock)
+}
+
+// DiscardMovements stops the environment from keeping completed and ignored movements,
+// so that Run returns empty slices. Observers are still told about every movement. This
+// is for callers that stream movements elsewhere and would otherwise hold them twice.
+func (env *environment) DiscardMovements() {
+	env.discard = true
+	env.completed = env.completed[:0]
+	env.ignored = env.ignored[:0]
+}
+
+func (env *environment) complete(completed CompletedMovement) {
+	if !env.discard {
+		env.completed = append(env.completed, completed)
+	}
+
+	for _, o := range env.observers {
+		env.noteObserverErr(o.MovementCompleted(completed))
+	}
+}
+
+func (env *environment) ignore(ignored IgnoredMovement) {
+	if !env.discard {
+		env.ignored = append(env.ignored, ignored)
+	}
+
+	for _, o := range env.observers {
+		env.noteObserverErr(o.MovementIgnored(ignored))
+	}
+}
+
+// sampleUntil calls samplers for every sample time up to and including until, in time
+// order. The current time is moved to each sample time while its sampler is called.
+func (env *environment) sampleUntil(until time.Time) {
+	for env.observerErr == nil {
+		var earliest *scheduledSampler
+		for _, s := range env.samplers {
+			if !s.next.After(until) && (earliest == nil || s.next.Before(earliest.next)) {
+				earliest = s
+			}
+		}
+
+		if earliest == nil {
+			env.sampledThrough = until
+			return
+		}
+
+		env.current = earliest.next
+		env.noteObserverErr(earliest.sampler.Sample(earliest.next))
+		earliest.next = earliest.next.Add(earliest.interval)
+	}
+}
+
+// noteObserverErr keeps the first error from any observer, sampler or failed autoscaler.
+func (env *environment) noteObserverErr(err error) {
+	if err != nil && env.observerErr == nil {
+		env.observerErr = err
+	}
+}
+
 func (env *environment) CurrentMovementTime() time.Time {
 	return env.current
 }
@@ -152,22 +450,56 @@ func (env *environment) AppendCPUUtilization(cpuUtilization *CPUUtilization) {
 	env.cpuUtilizations = append(env.cpuUtilizations, cpuUtilization)
 }
 
+func (env *environment) AutoscalerDecisions() []*AutoscalerDecision {
+	return env.decisions
+}
+
+// AppendAutoscalerDecision records a decision. A failed decision stops the run after the
+// current movement, with an *AutoscalerError.
+func (env *environment) AppendAutoscalerDecision(decision *AutoscalerDecision) {
+	env.decisions = append(env.decisions, decision)
+	if decision.Err != nil {
+		env.noteObserverErr(&AutoscalerError{Decision: decision})
+	}
+}
+
+func (env *environment) Seed() int64 {
+	return env.randStreams.Seed()
+}
+
+func (env *environment) Rand(stream string) *rand.Rand {
+	return env.randStreams.Stream(stream)
+}
+
+// NextNumber gives 1, 2, 3 and so on for each named sequence. Models use it to number
+// their entities and stocks, so that names are the same each time a scenario is run.
+func (env *environment) NextNumber(sequence string) int {
+	env.numbers[sequence]++
+	return env.numbers[sequence]
+}
+
 func NewEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration) Environment {
+	return NewSeededEnvironment(ctx, startAt, runFor, time.Now().UnixNano())
+}
+
+// NewSeededEnvironment creates an environment whose random number streams are derived from
+// seed, so that running the same scenario with the same seed gives the same results.
+func NewSeededEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration, seed int64) Environment {
 	pqueue := NewMovementPriorityQueue()
-	return newEnvironment(ctx, startAt, runFor, pqueue)
+	return newEnvironment(ctx, startAt, runFor, seed, pqueue)
 }
 
-func newEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration, pqueue MovementPriorityQueue) *environment {
+func newEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration, seed int64, pqueue MovementPriorityQueue) *environment {
 	beforeStock := NewThroughStock("BeforeScenario", "Scenario")
 	runningStock := NewThroughStock("RunningScenario", "Scenario")
 	haltingStock := NewHaltingSink("HaltedScenario", "Scenario", pqueue)
 
 	env := &environment{
-		ctx:     ctx,
-		plugin:  plugin.NewPluginPartition(),
-		startAt: startAt,
-		haltAt:  startAt.Add(runFor).Add(1 * time.Nanosecond), // make temporary space for the Halt Scenario movement
-		current: startAt.Add(-1 * time.Nanosecond),            // make temporary space for the Start Scenario movement
+		ctx:        ctx,
+		pluginLogs: map[string]*pluginLog{"": newPluginLog()},
+		startAt:    startAt,
+		haltAt:     startAt.Add(runFor).Add(1 * time.Nanosecond), // make temporary space for the Halt Scenario movement
+		current:    startAt.Add(-1 * time.Nanosecond),            // make temporary space for the Start Scenario movement
 
 		beforeScenario:  beforeStock,
 		runningScenario: runningStock,
@@ -176,8 +508,18 @@ func newEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration
 		completed:       make([]CompletedMovement, 0),
 		ignored:         make([]IgnoredMovement, 0),
 		cpuUtilizations: make([]*CPUUtilization, 0),
+		decisions:       make([]*AutoscalerDecision, 0),
+		randStreams:     NewRandStreams(seed),
+		numbers:         make(map[string]int),
+		stockSeen:       make(map[Stock]bool),
+		blocked:         make(map[StockName][]Movement),
+		unblocking:      make(map[StockName]Movement),
 	}
 
+	env.AddStock(beforeStock)
+	env.AddStock(runningStock)
+	env.AddStock(haltingStock)
+
 	env = setupScenarioMovements(env, startAt, env.haltAt.Add(-1*time.Nanosecond), env.beforeScenario, env.runningScenario, env.haltedScenario)
 	env.current = startAt // restore proper starting time
 	env.haltAt = env.haltAt.Add(-1 * time.Nanosecond)
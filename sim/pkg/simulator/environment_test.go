@@ -17,6 +17,7 @@ package simulator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -256,6 +257,609 @@ func testEnvironment(t *testing.T, describe spec.G, it spec.S) {
 		})
 	}, spec.Nested())
 
+	describe("Run()", func() {
+		describe("when the context is cancelled during the run", func() {
+			var completed []CompletedMovement
+			var err error
+
+			it.Before(func() {
+				cancellable, cancel := context.WithCancel(ctx)
+				defer cancel()
+
+				subject = NewEnvironment(cancellable, startTime, runFor)
+				subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+				subject.AddToSchedule(NewMovement("second kind", time.Unix(444444, 0), fromStock, toStock))
+				subject.AddObserver(ObserverFuncs{
+					OnCompleted: func(c CompletedMovement) error {
+						if c.Movement.Kind() == "first kind" {
+							cancel()
+						}
+						return nil
+					},
+				})
+
+				completed, _, err = subject.Run()
+			})
+
+			it("returns ErrRunTruncated", func() {
+				assert.Equal(t, ErrRunTruncated, err)
+			})
+
+			it("returns the movements completed before cancellation", func() {
+				assert.Equal(t, MovementKind("first kind"), completed[len(completed)-1].Movement.Kind())
+			})
+		})
+
+		describe("when the context has already timed out", func() {
+			it("returns ErrRunTruncated without making any movements", func() {
+				timeout, cancel := context.WithTimeout(ctx, 0)
+				defer cancel()
+				<-timeout.Done()
+
+				subject = NewEnvironment(timeout, startTime, runFor)
+				completed, _, err := subject.Run()
+
+				assert.Equal(t, ErrRunTruncated, err)
+				assert.Empty(t, completed)
+			})
+		})
+	})
+
+	describe("AddObserver()", func() {
+		var completed []CompletedMovement
+		var observedCompleted []CompletedMovement
+		var observedIgnored []IgnoredMovement
+
+		it.Before(func() {
+			observedCompleted = make([]CompletedMovement, 0)
+			observedIgnored = make([]IgnoredMovement, 0)
+
+			subject = NewEnvironment(ctx, startTime, runFor)
+			subject.AddObserver(ObserverFuncs{
+				OnCompleted: func(c CompletedMovement) error {
+					observedCompleted = append(observedCompleted, c)
+					return nil
+				},
+				OnIgnored: func(i IgnoredMovement) error {
+					observedIgnored = append(observedIgnored, i)
+					return nil
+				},
+			})
+		})
+
+		it("is told about each completed movement", func() {
+			subject.AddToSchedule(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+			completed, _, _ = subject.Run()
+
+			assert.Equal(t, completed, observedCompleted)
+		})
+
+		it("is told about each ignored movement", func() {
+			subject.AddToSchedule(NewMovement("test movement kind", time.Unix(999999, 0), fromStock, toStock))
+
+			assert.Len(t, observedIgnored, 1)
+			assert.Equal(t, OccursAfterHalt, observedIgnored[0].Reason)
+		})
+
+		describe("when the observer halts the run", func() {
+			var err error
+
+			it.Before(func() {
+				subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+				subject.AddToSchedule(NewMovement("second kind", time.Unix(444444, 0), fromStock, toStock))
+				subject.AddObserver(ObserverFuncs{
+					OnCompleted: func(c CompletedMovement) error {
+						if c.Movement.Kind() == "first kind" {
+							return ErrHaltRun
+						}
+						return nil
+					},
+				})
+
+				completed, _, err = subject.Run()
+			})
+
+			it("stops after the movement being observed", func() {
+				assert.NoError(t, err)
+				assert.Equal(t, MovementKind("first kind"), completed[len(completed)-1].Movement.Kind())
+				assert.Equal(t, time.Unix(333333, 0), subject.CurrentMovementTime())
+			})
+		})
+
+		describe("when the observer fails", func() {
+			var err error
+
+			it.Before(func() {
+				subject.AddToSchedule(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+				subject.AddObserver(ObserverFuncs{
+					OnCompleted: func(c CompletedMovement) error {
+						return fmt.Errorf("observer failure")
+					},
+				})
+
+				_, _, err = subject.Run()
+			})
+
+			it("returns the error", func() {
+				assert.EqualError(t, err, "observer failure")
+			})
+		})
+	})
+
+	describe("AppendAutoscalerDecision()", func() {
+		var completed []CompletedMovement
+		var err error
+		var failed *AutoscalerDecision
+
+		it.Before(func() {
+			subject = NewEnvironment(ctx, startTime, runFor)
+			failed = &AutoscalerDecision{Service: "backend", DecidedAt: time.Unix(333333, 0), Err: fmt.Errorf("plugin went away")}
+			subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+			subject.AddToSchedule(NewMovement("second kind", time.Unix(444444, 0), fromStock, toStock))
+			subject.AddObserver(ObserverFuncs{
+				OnCompleted: func(c CompletedMovement) error {
+					if c.Movement.Kind() == "first kind" {
+						subject.AppendAutoscalerDecision(failed)
+					}
+					return nil
+				},
+			})
+
+			completed, _, err = subject.Run()
+		})
+
+		it("records the decision", func() {
+			assert.Equal(t, []*AutoscalerDecision{failed}, subject.AutoscalerDecisions())
+		})
+
+		it("stops the run after the current movement when the autoscaler failed", func() {
+			assert.Equal(t, MovementKind("first kind"), completed[len(completed)-1].Movement.Kind())
+			assert.Equal(t, &AutoscalerError{Decision: failed}, err)
+			assert.EqualError(t, err, "autoscaler of service 'backend' failed at 333333000000000: plugin went away")
+		})
+	})
+
+	describe("DiscardMovements()", func() {
+		var completed []CompletedMovement
+		var ignored []IgnoredMovement
+		var observed int
+
+		it.Before(func() {
+			observed = 0
+			subject = NewEnvironment(ctx, startTime, runFor)
+			subject.AddObserver(ObserverFuncs{
+				OnCompleted: func(c CompletedMovement) error {
+					observed++
+					return nil
+				},
+			})
+			subject.DiscardMovements()
+			subject.AddToSchedule(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+			subject.AddToSchedule(NewMovement("test movement kind", time.Unix(999999, 0), fromStock, toStock))
+
+			var err error
+			completed, ignored, err = subject.Run()
+			assert.NoError(t, err)
+		})
+
+		it("keeps no movements", func() {
+			assert.Empty(t, completed)
+			assert.Empty(t, ignored)
+		})
+
+		it("still tells observers about movements", func() {
+			assert.Equal(t, 3, observed)
+		})
+	})
+
+	describe("moving into a full BoundedStock", func() {
+		var source, full BoundedStock
+		var completed []CompletedMovement
+		var ignored []IgnoredMovement
+
+		setup := func(overflow OverflowPolicy) {
+			subject = NewEnvironment(ctx, startTime, runFor)
+			source = NewBoundedStock("source", "test entity kind", StockConfig{})
+			full = NewBoundedStock("full", "test entity kind", StockConfig{Capacity: 1, Overflow: overflow})
+			drain := NewSinkStock("drain", "test entity kind")
+
+			assert.NoError(t, source.Add(NewEntity("first", "test entity kind")))
+			assert.NoError(t, source.Add(NewEntity("second", "test entity kind")))
+
+			subject.AddToSchedule(NewMovement("fill", time.Unix(333333, 0), source, full))
+			subject.AddToSchedule(NewMovement("overflow", time.Unix(444444, 0), source, full))
+			subject.AddToSchedule(NewMovement("drain", time.Unix(555555, 0), full, drain))
+
+			var err error
+			completed, ignored, err = subject.Run()
+			assert.NoError(t, err)
+		}
+
+		describe("when it rejects entities", func() {
+			it.Before(func() {
+				setup(OverflowReject)
+			})
+
+			it("ignores the movement and leaves the entity where it was", func() {
+				assert.Equal(t, MovementKind("overflow"), ignored[0].Movement.Kind())
+				assert.Equal(t, ToStockIsFull, ignored[0].Reason)
+				assert.Equal(t, uint64(1), source.Count())
+			})
+		})
+
+		describe("when it blocks entities", func() {
+			it.Before(func() {
+				setup(OverflowBlock)
+			})
+
+			it("holds the movement back until there is room", func() {
+				assert.Empty(t, ignored)
+				assert.Len(t, completed, 5)
+
+				retried := completed[3].Movement
+				assert.Equal(t, MovementKind("overflow"), retried.Kind())
+				assert.Equal(t, time.Unix(555555, 1), retried.OccursAt())
+				assert.Equal(t, []string{"held back from 444444000000000 while 'full' was full"}, retried.Notes())
+
+				assert.Equal(t, uint64(0), source.Count())
+				assert.Equal(t, uint64(1), full.Count())
+			})
+
+			it("shows held back movements in snapshots", func() {
+				blocked := NewEnvironment(ctx, startTime, runFor)
+				blocked.AddToSchedule(NewMovement("fill", time.Unix(333333, 0), source, full))
+				assert.NoError(t, source.Add(NewEntity("third", "test entity kind")))
+				assert.NoError(t, source.Add(NewEntity("fourth", "test entity kind")))
+				blocked.AddToSchedule(NewMovement("fill", time.Unix(333333, 0), source, full))
+
+				_, _, err := blocked.RunUntil(time.Unix(400000, 0))
+				assert.NoError(t, err)
+
+				pending := blocked.Snapshot().Pending
+				assert.Equal(t, MovementKind("fill"), pending[len(pending)-2].Kind)
+				assert.True(t, pending[len(pending)-2].Blocked)
+				assert.True(t, pending[len(pending)-1].Blocked)
+			})
+		})
+	})
+
+	describe("RunUntil()", func() {
+		var completed []CompletedMovement
+		var err error
+
+		it.Before(func() {
+			subject = NewEnvironment(ctx, startTime, runFor)
+			subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+			subject.AddToSchedule(NewMovement("second kind", time.Unix(444444, 0), fromStock, toStock))
+
+			completed, _, err = subject.RunUntil(time.Unix(444444, 0))
+			assert.NoError(t, err)
+		})
+
+		it("runs movements that occur before the given time", func() {
+			assert.Len(t, completed, 2)
+			assert.Equal(t, MovementKind("first kind"), completed[1].Movement.Kind())
+		})
+
+		it("moves the current time to the given time", func() {
+			assert.Equal(t, time.Unix(444444, 0), subject.CurrentMovementTime())
+		})
+
+		it("can be carried on by Run()", func() {
+			completed, _, err = subject.Run()
+			assert.NoError(t, err)
+			assert.Len(t, completed, 4)
+			assert.Equal(t, MovementKind("second kind"), completed[2].Movement.Kind())
+		})
+	})
+
+	describe("RunUntilKind()", func() {
+		var completed []CompletedMovement
+
+		it.Before(func() {
+			subject = NewEnvironment(ctx, startTime, runFor)
+			subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+			subject.AddToSchedule(NewMovement("second kind", time.Unix(444444, 0), fromStock, toStock))
+
+			var err error
+			completed, _, err = subject.RunUntilKind("second kind")
+			assert.NoError(t, err)
+		})
+
+		it("runs movements until the next is of the given kind", func() {
+			assert.Len(t, completed, 2)
+			assert.Equal(t, time.Unix(333333, 0), subject.CurrentMovementTime())
+		})
+
+		it("leaves the movement of the given kind pending", func() {
+			assert.Equal(t, MovementKind("second kind"), subject.Snapshot().Pending[0].Kind)
+		})
+
+		it("runs until the halt when no movement is of the given kind", func() {
+			completed, _, err := subject.RunUntilKind("nonexistent kind")
+			assert.NoError(t, err)
+			assert.Len(t, completed, 4)
+		})
+	})
+
+	describe("Step()", func() {
+		it.Before(func() {
+			subject = NewEnvironment(ctx, startTime, runFor)
+			subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+		})
+
+		it("runs one movement at a time", func() {
+			stepped, err := subject.Step()
+			assert.NoError(t, err)
+			assert.True(t, stepped)
+			assert.Equal(t, startTime, subject.CurrentMovementTime())
+
+			stepped, err = subject.Step()
+			assert.NoError(t, err)
+			assert.True(t, stepped)
+			assert.Equal(t, time.Unix(333333, 0), subject.CurrentMovementTime())
+			assert.Equal(t, uint64(1), toStock.Count())
+		})
+
+		it("gives false once the scenario has halted", func() {
+			for i := 0; i < 3; i++ {
+				stepped, err := subject.Step()
+				assert.NoError(t, err)
+				assert.True(t, stepped)
+			}
+
+			stepped, err := subject.Step()
+			assert.NoError(t, err)
+			assert.False(t, stepped)
+		})
+	})
+
+	describe("Snapshot()", func() {
+		var snapshot Snapshot
+
+		it.Before(func() {
+			subject = NewSeededEnvironment(ctx, startTime, runFor, 99)
+			subject.Rand("test stream").Int63()
+			subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+			subject.AddToSchedule(NewMovement("second kind", time.Unix(444444, 0), fromStock, toStock))
+
+			_, _, err := subject.RunUntil(time.Unix(400000, 0))
+			assert.NoError(t, err)
+
+			snapshot = subject.Snapshot()
+		})
+
+		it("gives the time it was taken at", func() {
+			assert.Equal(t, time.Unix(400000, 0), snapshot.TakenAt)
+			assert.Equal(t, startTime, snapshot.StartAt)
+			assert.Equal(t, startTime.Add(runFor), snapshot.HaltAt)
+		})
+
+		it("gives the seed and the state of each random number stream", func() {
+			assert.Equal(t, int64(99), snapshot.Seed)
+			assert.Contains(t, snapshot.Rand, "test stream")
+		})
+
+		it("gives the number of movements so far", func() {
+			assert.Equal(t, 2, snapshot.MovementsSoFar)
+		})
+
+		it("gives the pending movements in the order they will occur", func() {
+			assert.Equal(t, []PendingMovement{
+				{Kind: "second kind", OccursAt: time.Unix(444444, 0), From: "from stock", To: "to stock", FromStock: 3, ToStock: 4, Notes: []string{}},
+				{Kind: "running_to_halted", OccursAt: startTime.Add(runFor), From: "RunningScenario", To: "HaltedScenario", FromStock: 2, ToStock: 1, Notes: []string{"Halt scenario"}},
+			}, snapshot.Pending)
+		})
+
+		it("gives the contents of every stock, sorted by name", func() {
+			names := make([]StockName, 0)
+			for _, s := range snapshot.Stocks {
+				names = append(names, s.Name)
+			}
+			assert.Equal(t, []StockName{"BeforeScenario", "HaltedScenario", "RunningScenario", "from stock", "to stock"}, names)
+
+			assert.Equal(t, StockContents{Name: "to stock", KindStocked: "test entity kind", Count: 1, Entities: []EntityName{"entity-0"}}, snapshot.Stocks[4])
+		})
+
+		it("is the same for environments with the same seed run to the same time", func() {
+			other := NewSeededEnvironment(ctx, startTime, runFor, 99)
+			other.Rand("test stream").Int63()
+			otherFrom := &EchoSourceStockType{name: "from stock", kind: "test entity kind"}
+			otherTo := NewSinkStock("to stock", "test entity kind")
+			other.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), otherFrom, otherTo))
+			other.AddToSchedule(NewMovement("second kind", time.Unix(444444, 0), otherFrom, otherTo))
+
+			_, _, err := other.RunUntil(time.Unix(400000, 0))
+			assert.NoError(t, err)
+
+			assert.Equal(t, snapshot, other.Snapshot())
+		})
+	})
+
+	describe("Snapshot.Matches()", func() {
+		var snapshot Snapshot
+
+		it.Before(func() {
+			subject = NewSeededEnvironment(ctx, startTime, runFor, 99)
+			subject.AddToSchedule(NewMovement("first kind", time.Unix(333333, 0), fromStock, toStock))
+			_, _, err := subject.RunUntil(time.Unix(400000, 0))
+			assert.NoError(t, err)
+
+			snapshot = subject.Snapshot()
+		})
+
+		it("matches a snapshot of the same state", func() {
+			assert.True(t, snapshot.Matches(subject.Snapshot()))
+		})
+
+		it("does not match a snapshot whose entities are named differently", func() {
+			other := subject.Snapshot()
+			other.Stocks[len(other.Stocks)-1].Entities = []EntityName{"some other name"}
+
+			assert.False(t, snapshot.Matches(other))
+		})
+
+		it("does not match a snapshot with different stock counts", func() {
+			other := subject.Snapshot()
+			other.Stocks[len(other.Stocks)-1].Count = 2
+
+			assert.False(t, snapshot.Matches(other))
+		})
+
+		it("does not match a snapshot with different random number state", func() {
+			subject.Rand("test stream").Int63()
+
+			assert.False(t, snapshot.Matches(subject.Snapshot()))
+		})
+	})
+
+	describe("Restore()", func() {
+		var snapshot Snapshot
+		var samples []time.Time
+
+		// build places four entities in a stock of one, so that three are held back.
+		build := func(env Environment) {
+			from := NewThroughStock("from stock", "test entity kind")
+			queue := NewBoundedStock("queue", "test entity kind", StockConfig{Capacity: 1, Overflow: OverflowBlock})
+			to := NewSinkStock("to stock", "test entity kind")
+			env.AddStock(from)
+			env.AddStock(queue)
+			env.AddStock(to)
+
+			for i := 0; i < 4; i++ {
+				err := from.Add(NewEntity(EntityName(fmt.Sprintf("entity-%d", i)), "test entity kind"))
+				assert.NoError(t, err)
+
+				env.AddToSchedule(NewMovement("enqueue", time.Unix(300000+int64(i), 0), from, queue))
+				env.AddToSchedule(NewMovement("dequeue", time.Unix(350000+int64(i)*10, 0), queue, to))
+			}
+
+			env.Rand("test stream").Int63()
+		}
+
+		sampleInto := func(env Environment, into *[]time.Time) {
+			env.AddSampler(7*time.Hour, SamplerFunc(func(at time.Time) error {
+				*into = append(*into, at)
+				return nil
+			}))
+		}
+
+		it.Before(func() {
+			samples = make([]time.Time, 0)
+			subject = NewSeededEnvironment(ctx, startTime, runFor, 99)
+			build(subject)
+			sampleInto(subject, &samples)
+
+			_, _, err := subject.RunUntil(time.Unix(320000, 0))
+			assert.NoError(t, err)
+
+			encoded, err := json.Marshal(subject.Snapshot())
+			assert.NoError(t, err)
+			err = json.Unmarshal(encoded, &snapshot)
+			assert.NoError(t, err)
+		})
+
+		describe("into an environment built in the same way", func() {
+			var restored Environment
+			var restoredSamples []time.Time
+
+			it.Before(func() {
+				restoredSamples = make([]time.Time, 0)
+				restored = NewSeededEnvironment(ctx, startTime, runFor, 99)
+				build(restored)
+				sampleInto(restored, &restoredSamples)
+
+				err := restored.Restore(snapshot)
+				assert.NoError(t, err)
+			})
+
+			it("gives an environment whose snapshot matches", func() {
+				assert.True(t, snapshot.Matches(restored.Snapshot()))
+			})
+
+			it("keeps the movements held back by a full stock", func() {
+				blocked := 0
+				for _, mv := range restored.Snapshot().Pending {
+					if mv.Blocked {
+						blocked++
+					}
+				}
+				assert.Equal(t, 3, blocked)
+			})
+
+			it("runs to the same end as the original", func() {
+				samples = samples[:0]
+				completed, _, err := subject.Run()
+				assert.NoError(t, err)
+				restoredCompleted, _, err := restored.Run()
+				assert.NoError(t, err)
+
+				assert.True(t, subject.Snapshot().Matches(restored.Snapshot()))
+				assert.Equal(t, samples, restoredSamples)
+				// the original also gives the movements it completed before the snapshot
+				completed = completed[len(completed)-len(restoredCompleted):]
+				assert.Len(t, restoredCompleted, 8)
+				for i := range completed {
+					assert.Equal(t, completed[i].Movement.Kind(), restoredCompleted[i].Movement.Kind())
+					assert.Equal(t, completed[i].Moved.Name(), restoredCompleted[i].Moved.Name())
+				}
+			})
+		})
+
+		it("fails for an environment with another seed", func() {
+			other := NewSeededEnvironment(ctx, startTime, runFor, 98)
+			build(other)
+
+			assert.Error(t, other.Restore(snapshot))
+		})
+
+		it("fails for an environment with a stock that was not snapshotted", func() {
+			other := NewSeededEnvironment(ctx, startTime, runFor, 99)
+			build(other)
+			other.AddStock(NewSinkStock("another stock", "test entity kind"))
+
+			assert.Error(t, other.Restore(snapshot))
+		})
+	})
+
+	describe("AddSampler()", func() {
+		var samples []time.Time
+		var countsAtSample []uint64
+		var sink SinkStock
+
+		it.Before(func() {
+			samples = make([]time.Time, 0)
+			countsAtSample = make([]uint64, 0)
+			sink = NewSinkStock("sampled sink", "test entity kind")
+
+			subject = NewEnvironment(ctx, time.Unix(0, 0), 10*time.Second)
+			subject.AddToSchedule(NewMovement("test movement kind", time.Unix(2, 0), fromStock, sink))
+			subject.AddSampler(5*time.Second, SamplerFunc(func(at time.Time) error {
+				assert.Equal(t, at, subject.CurrentMovementTime())
+				samples = append(samples, at)
+				countsAtSample = append(countsAtSample, sink.Count())
+				return nil
+			}))
+
+			_, _, err := subject.Run()
+			assert.NoError(t, err)
+		})
+
+		it("samples at each interval from the start until the halt", func() {
+			assert.Equal(t, []time.Time{time.Unix(0, 0), time.Unix(5, 0), time.Unix(10, 0)}, samples)
+		})
+
+		it("samples after the movements that came before", func() {
+			assert.Equal(t, []uint64{0, 1, 1}, countsAtSample)
+		})
+
+		it("rejects intervals that are not positive", func() {
+			assert.Panics(t, func() {
+				subject.AddSampler(0, SamplerFunc(func(time.Time) error { return nil }))
+			})
+		})
+	})
+
 	describe("CurrentMovementTime()", func() {
 		it.Before(func() {
 			subject = NewEnvironment(ctx, startTime, runFor)
@@ -291,6 +895,31 @@ func testEnvironment(t *testing.T, describe spec.G, it spec.S) {
 		})
 	})
 
+	describe("Rand()", func() {
+		it("gives the same numbers for environments with the same seed", func() {
+			one := NewSeededEnvironment(ctx, startTime, runFor, 99)
+			two := NewSeededEnvironment(ctx, startTime, runFor, 99)
+
+			assert.Equal(t, int64(99), one.Seed())
+			assert.Equal(t, one.Rand("traffic").Int63(), two.Rand("traffic").Int63())
+		})
+	})
+
+	describe("NextNumber()", func() {
+		it("counts each sequence separately from 1", func() {
+			subject = NewEnvironment(ctx, startTime, runFor)
+
+			assert.Equal(t, 1, subject.NextNumber("first"))
+			assert.Equal(t, 2, subject.NextNumber("first"))
+			assert.Equal(t, 1, subject.NextNumber("second"))
+		})
+
+		it("counts separately for each environment", func() {
+			NewEnvironment(ctx, startTime, runFor).NextNumber("first")
+			assert.Equal(t, 1, NewEnvironment(ctx, startTime, runFor).NextNumber("first"))
+		})
+	})
+
 	describe("helper funcs", func() {
 		describe("newEnvironment()", func() {
 			var rawSubject *environment
@@ -298,7 +927,7 @@ func testEnvironment(t *testing.T, describe spec.G, it spec.S) {
 
 			it.Before(func() {
 				mpq = NewMovementPriorityQueue()
-				rawSubject = newEnvironment(ctx, time.Unix(0, 0), time.Minute, mpq)
+				rawSubject = newEnvironment(ctx, time.Unix(0, 0), time.Minute, 0, mpq)
 			})
 
 			it("configures the halted scenario stock to use haltingStock", func() {
@@ -16,99 +16,175 @@
 package simulator
 
 import (
-	"strconv"
-	"strings"
+	"errors"
+	"sort"
 	"time"
-
-	"k8s.io/client-go/tools/cache"
 )
 
 type MovementPriorityQueue interface {
-	EnqueueMovement(movement Movement) (wasShifted bool, scheduledAt time.Time, err error)
+	EnqueueMovement(movement Movement)
 	DequeueMovement() (movement Movement, err error, closed bool)
+	PeekMovement() Movement
+	Pending() []Movement
+	Len() int
 	Close()
 	IsClosed() bool
 }
 
+// heapArity is the number of children per node. A 4-ary heap is shallower than a binary
+// heap and keeps siblings together in memory, which makes dequeueing cheaper.
+const heapArity = 4
+
+var ErrQueueEmpty = errors.New("no movements are queued")
+
+// movementPQ is a 4-ary min-heap of movements, ordered by when they occur and then by the
+// order in which they were enqueued. Movements scheduled for the same instant therefore
+// occur in the order they were scheduled. It is not safe for concurrent use.
 type movementPQ struct {
-	heap *cache.Heap
+	entries  []queuedMovement
+	sequence uint64
+	closed   bool
 }
 
-func (mpq *movementPQ) EnqueueMovement(movement Movement) (wasShifted bool, scheduledAt time.Time, err error) {
-	wasShifted = false
-	i := 0 * time.Nanosecond
-	for {
-		key := occursAtToStr(movement.OccursAt().Add(i))
-
-		_, exists, err := mpq.heap.GetByKey(key)
-		if err != nil {
-			return false, time.Unix(0, -1), err
-		}
+type queuedMovement struct {
+	occursAt time.Time
+	sequence uint64
+	movement Movement
+}
 
-		if exists {
-			i++
-			wasShifted = true
-		} else {
-			break
-		}
+func (qm *queuedMovement) before(other *queuedMovement) bool {
+	if qm.occursAt.Equal(other.occursAt) {
+		return qm.sequence < other.sequence
 	}
+	return qm.occursAt.Before(other.occursAt)
+}
 
-	if wasShifted {
-		shiftedMovement := NewMovement(movement.Kind(), movement.OccursAt().Add(i), movement.From(), movement.To())
-		return true, shiftedMovement.OccursAt(), mpq.heap.Add(shiftedMovement)
-	}
+func (mpq *movementPQ) EnqueueMovement(movement Movement) {
+	mpq.entries = append(mpq.entries, queuedMovement{
+		occursAt: movement.OccursAt(),
+		sequence: mpq.sequence,
+		movement: movement,
+	})
+	mpq.sequence++
 
-	return false, movement.OccursAt(), mpq.heap.Add(movement)
+	mpq.siftUp(len(mpq.entries) - 1)
 }
 
 // DequeueMovement picks the next earliest movement from the queue.
-// It will block until there is a Movement to retrieve
 // Returns:
-// 	movement - the next Movement, if available
-// 	err - any errors
-// 	closed - whether the underlying queue has "closed", meaning no further
-// 	movements can be dequeued.
+//
+//	movement - the next Movement, if available
+//	err - ErrQueueEmpty if the queue is open but holds no movements
+//	closed - whether the queue has "closed", meaning no further
+//	movements can be dequeued.
 func (mpq *movementPQ) DequeueMovement() (movement Movement, err error, closed bool) {
-	n, err := mpq.heap.Pop()
-
-	if err != nil && strings.Contains(err.Error(), "heap is closed") {
+	if mpq.closed {
 		return nil, nil, true
-	} else if err != nil {
-		return nil, err, false
 	}
 
-	next := n.(Movement)
+	last := len(mpq.entries) - 1
+	if last < 0 {
+		return nil, ErrQueueEmpty, false
+	}
+
+	next := mpq.entries[0].movement
+
+	mpq.entries[0] = mpq.entries[last]
+	mpq.entries[last] = queuedMovement{} // release the movement for collection
+	mpq.entries = mpq.entries[:last]
+
+	if last > 0 {
+		mpq.siftDown(0)
+	}
+
 	return next, nil, false
 }
 
+// PeekMovement gives the movement that would be dequeued next, without dequeueing it.
+// It gives nil if the queue is closed or empty.
+func (mpq *movementPQ) PeekMovement() Movement {
+	if mpq.closed || len(mpq.entries) == 0 {
+		return nil
+	}
+
+	return mpq.entries[0].movement
+}
+
+// Pending gives every queued movement, in the order they would be dequeued.
+func (mpq *movementPQ) Pending() []Movement {
+	entries := make([]queuedMovement, len(mpq.entries))
+	copy(entries, mpq.entries)
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].before(&entries[j])
+	})
+
+	pending := make([]Movement, len(entries))
+	for i := range entries {
+		pending[i] = entries[i].movement
+	}
+
+	return pending
+}
+
+func (mpq *movementPQ) Len() int {
+	return len(mpq.entries)
+}
+
 func (mpq *movementPQ) Close() {
-	mpq.heap.Close()
+	mpq.closed = true
 }
 
 func (mpq *movementPQ) IsClosed() bool {
-	return mpq.heap.IsClosed()
+	return mpq.closed
 }
 
-func NewMovementPriorityQueue() MovementPriorityQueue {
-	heap := cache.NewHeap(movementToKey, leftMovementIsEarlier)
+func (mpq *movementPQ) siftUp(i int) {
+	entry := mpq.entries[i]
 
-	return &movementPQ{
-		heap: heap,
+	for i > 0 {
+		parent := (i - 1) / heapArity
+		if !entry.before(&mpq.entries[parent]) {
+			break
+		}
+
+		mpq.entries[i] = mpq.entries[parent]
+		i = parent
 	}
-}
 
-func movementToKey(movement interface{}) (key string, err error) {
-	mv := movement.(Movement)
-	return occursAtToStr(mv.OccursAt()), nil
+	mpq.entries[i] = entry
 }
 
-func occursAtToStr(occursAt time.Time) string {
-	return strconv.FormatInt(occursAt.UnixNano(), 10)
-}
+func (mpq *movementPQ) siftDown(i int) {
+	entry := mpq.entries[i]
+	n := len(mpq.entries)
+
+	for {
+		first := i*heapArity + 1
+		if first >= n {
+			break
+		}
 
-func leftMovementIsEarlier(left interface{}, right interface{}) bool {
-	l := left.(Movement)
-	r := right.(Movement)
+		earliest := first
+		for c := first + 1; c < first+heapArity && c < n; c++ {
+			if mpq.entries[c].before(&mpq.entries[earliest]) {
+				earliest = c
+			}
+		}
 
-	return l.OccursAt().Before(r.OccursAt())
+		if !mpq.entries[earliest].before(&entry) {
+			break
+		}
+
+		mpq.entries[i] = mpq.entries[earliest]
+		i = earliest
+	}
+
+	mpq.entries[i] = entry
+}
+
+func NewMovementPriorityQueue() MovementPriorityQueue {
+	return &movementPQ{
+		entries: make([]queuedMovement, 0),
+	}
 }
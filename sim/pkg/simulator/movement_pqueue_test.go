@@ -16,6 +16,7 @@
 package simulator
 
 import (
+	"math/rand"
 	"testing"
 	"time"
 
@@ -31,50 +32,42 @@ func TestMovementPQ(t *testing.T) {
 func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 	var subject MovementPriorityQueue
 	var movement Movement
-	var theTime, scheduledAt time.Time
-	var shifted bool
-	var err error
+	var theTime time.Time
 
 	describe("EnqueueMovement()", func() {
 		it.Before(func() {
+			subject = NewMovementPriorityQueue()
 			theTime = time.Now()
 			movement = NewMovement("test movement kind", theTime, nil, nil)
 		})
 
-		describe("when there is an existing Movement scheduled at the same time", func() {
-			it.Before(func() {
-				subject = NewMovementPriorityQueue()
-
-				_, _, err = subject.EnqueueMovement(movement)
-				assert.NoError(t, err)
-
-				shifted, scheduledAt, err = subject.EnqueueMovement(movement)
-				assert.NoError(t, err)
-
-			})
-			it("time-shifts the Movement to the next free time", func() {
-				assert.Equal(t, theTime.Add(1*time.Nanosecond), scheduledAt)
-			})
-
-			it("indicates that time-shifting occurred", func() {
-				assert.True(t, shifted)
-			})
+		it("adds the Movement to the queue", func() {
+			subject.EnqueueMovement(movement)
+			assert.Equal(t, 1, subject.Len())
 		})
 
-		describe("when no other Movement has been scheduled at the same time", func() {
+		describe("when there is an existing Movement scheduled at the same time", func() {
+			var second Movement
+
 			it.Before(func() {
-				subject = NewMovementPriorityQueue()
+				second = NewMovement("second movement kind", theTime, nil, nil)
 
-				shifted, scheduledAt, err = subject.EnqueueMovement(movement)
-				assert.NoError(t, err)
+				subject.EnqueueMovement(movement)
+				subject.EnqueueMovement(second)
 			})
 
 			it("does not time-shift the Movement", func() {
-				assert.Equal(t, theTime, scheduledAt)
+				_, _, _ = subject.DequeueMovement()
+				dqmv, err, _ := subject.DequeueMovement()
+				assert.NoError(t, err)
+				assert.Equal(t, theTime, dqmv.OccursAt())
 			})
 
-			it("indicates that time-shifting did not occur", func() {
-				assert.False(t, shifted)
+			it("dequeues simultaneous Movements in the order they were enqueued", func() {
+				first, _, _ := subject.DequeueMovement()
+				next, _, _ := subject.DequeueMovement()
+				assert.Equal(t, movement, first)
+				assert.Equal(t, second, next)
 			})
 		})
 	})
@@ -88,8 +81,7 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 		it("returns Movements", func() {
 			var dqmv Movement
 			var err error
-			_, _, err = subject.EnqueueMovement(movement)
-			assert.NoError(t, err)
+			subject.EnqueueMovement(movement)
 
 			dqmv, err, _ = subject.DequeueMovement()
 
@@ -99,6 +91,30 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 			assert.Equal(t, movement, dqmv)
 		})
 
+		it("returns Movements earliest first", func() {
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 1000; i++ {
+				at := time.Unix(0, rng.Int63n(100))
+				subject.EnqueueMovement(NewMovement(MovementKind(at.String()), at, nil, nil))
+			}
+
+			var previous time.Time
+			for subject.Len() > 0 {
+				dqmv, err, _ := subject.DequeueMovement()
+				assert.NoError(t, err)
+				assert.False(t, dqmv.OccursAt().Before(previous))
+				previous = dqmv.OccursAt()
+			}
+		})
+
+		it("returns an error when no Movements are queued", func() {
+			mv, err, closed := subject.DequeueMovement()
+
+			assert.Nil(t, mv)
+			assert.Equal(t, ErrQueueEmpty, err)
+			assert.False(t, closed)
+		})
+
 		it("returns a 'closed' flag to indicate whether the queue has closed", func() {
 			var closed bool
 			var err error
@@ -113,6 +129,64 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 		})
 	})
 
+	describe("PeekMovement()", func() {
+		it.Before(func() {
+			subject = NewMovementPriorityQueue()
+		})
+
+		it("gives the next Movement without dequeueing it", func() {
+			later := NewMovement("later", time.Unix(2, 0), nil, nil)
+			earlier := NewMovement("earlier", time.Unix(1, 0), nil, nil)
+			subject.EnqueueMovement(later)
+			subject.EnqueueMovement(earlier)
+
+			assert.Equal(t, earlier, subject.PeekMovement())
+			assert.Equal(t, 2, subject.Len())
+		})
+
+		it("gives nil when the queue is empty or closed", func() {
+			assert.Nil(t, subject.PeekMovement())
+
+			subject.EnqueueMovement(NewMovement("test movement kind", time.Unix(1, 0), nil, nil))
+			subject.Close()
+			assert.Nil(t, subject.PeekMovement())
+		})
+	})
+
+	describe("Pending()", func() {
+		it.Before(func() {
+			subject = NewMovementPriorityQueue()
+		})
+
+		it("gives queued Movements in the order they would be dequeued", func() {
+			third := NewMovement("third", time.Unix(2, 0), nil, nil)
+			first := NewMovement("first", time.Unix(1, 0), nil, nil)
+			second := NewMovement("second", time.Unix(1, 0), nil, nil)
+			subject.EnqueueMovement(third)
+			subject.EnqueueMovement(first)
+			subject.EnqueueMovement(second)
+
+			assert.Equal(t, []Movement{first, second, third}, subject.Pending())
+			assert.Equal(t, 3, subject.Len())
+		})
+	})
+
+	describe("Len()", func() {
+		it.Before(func() {
+			subject = NewMovementPriorityQueue()
+			movement = NewMovement("test movement kind", time.Now(), nil, nil)
+		})
+
+		it("gives the number of queued Movements", func() {
+			assert.Equal(t, 0, subject.Len())
+			subject.EnqueueMovement(movement)
+			subject.EnqueueMovement(movement)
+			assert.Equal(t, 2, subject.Len())
+			_, _, _ = subject.DequeueMovement()
+			assert.Equal(t, 1, subject.Len())
+		})
+	})
+
 	describe("Close()", func() {
 		it.Before(func() {
 			subject = NewMovementPriorityQueue()
@@ -135,39 +209,46 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 			assert.False(t, subject.IsClosed())
 		})
 	})
+}
 
-	describe("helpers", func() {
-		describe("movementToKey()", func() {
-			it.Before(func() {
-				movement = NewMovement("test movement kind", time.Unix(0, 111000111), nil, nil)
-			})
-
-			it("returns the OccursAt() as a string", func() {
-				key, err := movementToKey(movement)
-				assert.NoError(t, err)
-				assert.Equal(t, "111000111", key)
-			})
-		})
-
-		describe("leftMovementIsEarlier()", func() {
-			var earlier, later Movement
-
-			it.Before(func() {
-				earlier = NewMovement("test movement kind", time.Unix(111, 0), nil, nil)
-				later = NewMovement("test movement kind", time.Unix(999, 0), nil, nil)
-			})
-
-			describe("when the first argument is earlier", func() {
-				it("returns true", func() {
-					assert.True(t, leftMovementIsEarlier(earlier, later))
-				})
-			})
+// BenchmarkMovementPQ enqueues and then dequeues b.N movements at random times.
+func BenchmarkMovementPQ(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	start := time.Unix(0, 0)
+	movements := make([]Movement, b.N)
+	for i := range movements {
+		movements[i] = NewMovement("benchmark", start.Add(time.Duration(rng.Int63n(int64(time.Hour)))), nil, nil)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	subject := NewMovementPriorityQueue()
+	for _, mv := range movements {
+		subject.EnqueueMovement(mv)
+	}
+	for i := 0; i < b.N; i++ {
+		_, _, _ = subject.DequeueMovement()
+	}
+}
 
-			describe("when the second argument is earlier", func() {
-				it("returns false", func() {
-					assert.False(t, leftMovementIsEarlier(later, earlier))
-				})
-			})
-		})
-	})
+// BenchmarkMovementPQSteadyState keeps a million movements queued, as a long scenario
+// would, and measures the cost of each movement scheduling one further movement.
+func BenchmarkMovementPQSteadyState(b *testing.B) {
+	const queued = 1000000
+	rng := rand.New(rand.NewSource(1))
+	start := time.Unix(0, 0)
+
+	subject := NewMovementPriorityQueue()
+	for i := 0; i < queued; i++ {
+		subject.EnqueueMovement(NewMovement("benchmark", start.Add(time.Duration(rng.Int63n(int64(time.Hour)))), nil, nil))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mv, _, _ := subject.DequeueMovement()
+		subject.EnqueueMovement(NewMovement("benchmark", mv.OccursAt().Add(time.Duration(rng.Int63n(int64(time.Hour)))), nil, nil))
+	}
 }
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrHaltRun may be returned by an Observer or Sampler to stop a run early. Run then
+// returns what has happened so far, without an error.
+var ErrHaltRun = errors.New("run halted by observer")
+
+// Observer is told about each movement as the Environment completes or ignores it.
+// Returning an error stops the run; see ErrHaltRun.
+type Observer interface {
+	MovementCompleted(completed CompletedMovement) error
+	MovementIgnored(ignored IgnoredMovement) error
+}
+
+// Sampler is called at a fixed interval of simulated time, after every movement before
+// the sample time has occurred and before any movement at or after it.
+type Sampler interface {
+	Sample(at time.Time) error
+}
+
+// ObserverFuncs adapts plain funcs to Observer. Either func may be nil.
+type ObserverFuncs struct {
+	OnCompleted func(completed CompletedMovement) error
+	OnIgnored   func(ignored IgnoredMovement) error
+}
+
+func (of ObserverFuncs) MovementCompleted(completed CompletedMovement) error {
+	if of.OnCompleted == nil {
+		return nil
+	}
+	return of.OnCompleted(completed)
+}
+
+func (of ObserverFuncs) MovementIgnored(ignored IgnoredMovement) error {
+	if of.OnIgnored == nil {
+		return nil
+	}
+	return of.OnIgnored(ignored)
+}
+
+// SamplerFunc adapts a plain func to Sampler.
+type SamplerFunc func(at time.Time) error
+
+func (sf SamplerFunc) Sample(at time.Time) error {
+	return sf(at)
+}
+
+type scheduledSampler struct {
+	sampler  Sampler
+	interval time.Duration
+	next     time.Time
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/josephburnett/sk-plugin/pkg/skplug"
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+
+	"skenario/pkg/plugin"
+)
+
+const (
+	PluginEvent = "event"
+	PluginStat  = "stat"
+	PluginScale = "scale"
+)
+
+// PluginCall is one call made to an autoscaler plugin. The plugin runs in another process
+// and its state cannot be read back, so a Snapshot keeps every call made to it instead,
+// and a restored environment makes them again.
+type PluginCall struct {
+	Method     string             `json:"method"`
+	Time       int64              `json:"time,omitempty"`
+	EventType  proto.EventType    `json:"event_type,omitempty"`
+	Pod        *skplug.Pod        `json:"pod,omitempty"`
+	Autoscaler *skplug.Autoscaler `json:"autoscaler,omitempty"`
+	Stats      []*proto.Stat      `json:"stats,omitempty"`
+}
+
+// pluginLog passes calls on to a plugin partition and keeps them.
+type pluginLog struct {
+	partition plugin.PluginPartition
+	calls     []PluginCall
+}
+
+func (pl *pluginLog) Event(time int64, typ proto.EventType, object skplug.Object) error {
+	call := PluginCall{Method: PluginEvent, Time: time, EventType: typ}
+	switch o := object.(type) {
+	case *skplug.Pod:
+		call.Pod = o
+	case *skplug.Autoscaler:
+		call.Autoscaler = o
+	}
+	pl.calls = append(pl.calls, call)
+
+	return pl.partition.Event(time, typ, object)
+}
+
+func (pl *pluginLog) Stat(stat []*proto.Stat) error {
+	pl.calls = append(pl.calls, PluginCall{Method: PluginStat, Stats: stat})
+
+	return pl.partition.Stat(stat)
+}
+
+func (pl *pluginLog) Scale(time int64) (int32, error) {
+	pl.calls = append(pl.calls, PluginCall{Method: PluginScale, Time: time})
+
+	return pl.partition.Scale(time)
+}
+
+// restore makes calls again, in a new partition if this one has been used, so that the
+// plugin is in the state the calls left it in. The old partition's autoscaler is deleted.
+func (pl *pluginLog) restore(calls []PluginCall, deleteAt int64) error {
+	if len(pl.calls) > 0 {
+		err := pl.partition.Event(deleteAt, proto.EventType_DELETE, &skplug.Autoscaler{})
+		if err != nil {
+			return err
+		}
+		pl.partition = plugin.NewPluginPartition()
+	}
+
+	pl.calls = make([]PluginCall, 0, len(calls))
+	for _, call := range calls {
+		var err error
+		switch call.Method {
+		case PluginEvent:
+			var object skplug.Object = call.Pod
+			if call.Autoscaler != nil {
+				object = call.Autoscaler
+			}
+			err = pl.Event(call.Time, call.EventType, object)
+		case PluginStat:
+			err = pl.Stat(call.Stats)
+		case PluginScale:
+			_, err = pl.Scale(call.Time)
+		default:
+			err = fmt.Errorf("unknown plugin method '%s'", call.Method)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newPluginLog() *pluginLog {
+	return &pluginLog{partition: plugin.NewPluginPartition()}
+}
+
+// pluginCalls gives the calls made to each service's plugin, leaving out services whose
+// plugins have not been called.
+func (env *environment) pluginCalls() map[string][]PluginCall {
+	var calls map[string][]PluginCall
+	for service, log := range env.pluginLogs {
+		if len(log.calls) == 0 {
+			continue
+		}
+		if calls == nil {
+			calls = make(map[string][]PluginCall)
+		}
+		calls[service] = append([]PluginCall(nil), log.calls...)
+	}
+
+	return calls
+}
+
+func (env *environment) restorePlugins(calls map[string][]PluginCall) error {
+	for service := range calls {
+		if env.pluginLogs[service] == nil {
+			return fmt.Errorf("snapshotted service '%s' is not in the environment", service)
+		}
+	}
+
+	services := make([]string, 0, len(env.pluginLogs))
+	for service := range env.pluginLogs {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		log := env.pluginLogs[service]
+		if len(log.calls) == 0 && len(calls[service]) == 0 {
+			continue
+		}
+
+		err := log.restore(calls[service], env.startAt.UnixNano())
+		if err != nil {
+			return fmt.Errorf("could not restore the plugin of service '%s': %s", service, err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// RandStreams hands out named streams of random numbers, all derived from a single seed.
+// Each part of a simulation draws from its own stream, so that the numbers it sees do not
+// depend on how its draws interleave with those of other parts. The same seed always
+// produces the same streams.
+type RandStreams struct {
+	seed    int64
+	streams map[string]*rand.Rand
+	sources map[string]*splitMix64
+}
+
+func (rs *RandStreams) Seed() int64 {
+	return rs.seed
+}
+
+func (rs *RandStreams) Stream(name string) *rand.Rand {
+	stream, ok := rs.streams[name]
+	if !ok {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(name))
+
+		source := &splitMix64{state: uint64(rs.seed) ^ h.Sum64()}
+		stream = rand.New(source)
+		rs.streams[name] = stream
+		rs.sources[name] = source
+	}
+
+	return stream
+}
+
+// State gives the internal state of every stream used so far. Two RandStreams with equal
+// states will give the same numbers from then on.
+func (rs *RandStreams) State() map[string]uint64 {
+	state := make(map[string]uint64, len(rs.sources))
+	for name, source := range rs.sources {
+		state[name] = source.state
+	}
+
+	return state
+}
+
+// Restore sets every stream to a state given by State. Streams not in state are forgotten,
+// and start again from the seed if they are used.
+func (rs *RandStreams) Restore(state map[string]uint64) {
+	for name := range rs.sources {
+		if _, ok := state[name]; !ok {
+			delete(rs.sources, name)
+			delete(rs.streams, name)
+		}
+	}
+
+	for name, st := range state {
+		rs.Stream(name)
+		rs.sources[name].state = st
+	}
+}
+
+func NewRandStreams(seed int64) *RandStreams {
+	return &RandStreams{
+		seed:    seed,
+		streams: make(map[string]*rand.Rand),
+		sources: make(map[string]*splitMix64),
+	}
+}
+
+// splitMix64 is a small rand.Source64 whose entire state is a single integer.
+type splitMix64 struct {
+	state uint64
+}
+
+func (sm *splitMix64) Seed(seed int64) {
+	sm.state = uint64(seed)
+}
+
+func (sm *splitMix64) Uint64() uint64 {
+	sm.state += 0x9e3779b97f4a7c15
+	z := sm.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (sm *splitMix64) Int63() int64 {
+	return int64(sm.Uint64() >> 1)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandStreams(t *testing.T) {
+	spec.Run(t, "Random number streams", testRandStreams, spec.Report(report.Terminal{}))
+}
+
+func testRandStreams(t *testing.T, describe spec.G, it spec.S) {
+	var subject *RandStreams
+
+	it.Before(func() {
+		subject = NewRandStreams(42)
+	})
+
+	describe("Seed()", func() {
+		it("gives the seed", func() {
+			assert.Equal(t, int64(42), subject.Seed())
+		})
+	})
+
+	describe("Stream()", func() {
+		it("returns the same stream for the same name", func() {
+			assert.Same(t, subject.Stream("traffic"), subject.Stream("traffic"))
+		})
+
+		it("gives the same numbers for the same seed and name", func() {
+			other := NewRandStreams(42)
+			for i := 0; i < 10; i++ {
+				assert.Equal(t, subject.Stream("traffic").Int63(), other.Stream("traffic").Int63())
+			}
+		})
+
+		it("gives different numbers for different names", func() {
+			assert.NotEqual(t, subject.Stream("traffic").Int63(), subject.Stream("retries").Int63())
+		})
+
+		it("gives different numbers for different seeds", func() {
+			assert.NotEqual(t, subject.Stream("traffic").Int63(), NewRandStreams(43).Stream("traffic").Int63())
+		})
+
+		it("is not affected by draws from other streams", func() {
+			other := NewRandStreams(42)
+			for i := 0; i < 10; i++ {
+				other.Stream("retries").Int63()
+			}
+			assert.Equal(t, subject.Stream("traffic").Int63(), other.Stream("traffic").Int63())
+		})
+
+		describe("State()", func() {
+			it("gives the state of each stream used", func() {
+				subject.Stream("traffic").Int63()
+				other := NewRandStreams(42)
+				other.Stream("traffic").Int63()
+
+				assert.Len(t, subject.State(), 1)
+				assert.Equal(t, other.State(), subject.State())
+			})
+
+			it("changes as numbers are drawn", func() {
+				before := subject.State()
+				subject.Stream("traffic").Int63()
+				assert.NotEqual(t, before, subject.State())
+			})
+		})
+
+		describe("Restore()", func() {
+			it("gives the same numbers from then on as the streams it was taken from", func() {
+				subject.Stream("traffic").Int63()
+				other := NewRandStreams(42)
+				other.Stream("retries").Int63()
+
+				other.Restore(subject.State())
+				assert.Equal(t, subject.State(), other.State())
+				assert.Equal(t, subject.Stream("traffic").Int63(), other.Stream("traffic").Int63())
+			})
+		})
+	})
+}
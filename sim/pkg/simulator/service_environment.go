@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"math/rand"
+
+	"skenario/pkg/plugin"
+)
+
+// serviceEnvironment is one of several services simulated in a single environment. It
+// shares the environment's clock, schedule, numbering and observers, but has its own
+// plugin partition and random streams.
+type serviceEnvironment struct {
+	Environment
+
+	service string
+	plugin  *pluginLog
+}
+
+func (se *serviceEnvironment) Plugin() plugin.PluginPartition {
+	return se.plugin
+}
+
+func (se *serviceEnvironment) Rand(stream string) *rand.Rand {
+	return se.Environment.Rand(se.service + "/" + stream)
+}
+
+// NewServiceEnvironment gives the environment for a service simulated alongside others
+// in env. Models built with it autoscale independently of the other services and give
+// their stocks names prefixed by the service's name.
+func NewServiceEnvironment(env Environment, service string) Environment {
+	se := &serviceEnvironment{
+		Environment: env,
+		service:     service,
+		plugin:      newPluginLog(),
+	}
+
+	if base, ok := env.(*environment); ok {
+		base.pluginLogs[service] = se.plugin
+	}
+
+	return se
+}
+
+// ServiceStockName gives the name a model should use for a stock it creates in env, so
+// that stocks of different services can be told apart.
+func ServiceStockName(env Environment, name StockName) StockName {
+	if se, ok := env.(*serviceEnvironment); ok {
+		return StockName(se.service + "/" + string(name))
+	}
+
+	return name
+}
+
+// ServiceName gives the name of the service that env simulates, or an empty name for the
+// main service.
+func ServiceName(env Environment) string {
+	if se, ok := env.(*serviceEnvironment); ok {
+		return se.service
+	}
+
+	return ""
+}
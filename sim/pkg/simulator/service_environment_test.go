@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceEnvironment(t *testing.T) {
+	spec.Run(t, "Service environment", testServiceEnvironment, spec.Report(report.Terminal{}))
+}
+
+func testServiceEnvironment(t *testing.T, describe spec.G, it spec.S) {
+	var env, subject Environment
+
+	it.Before(func() {
+		env = NewSeededEnvironment(context.Background(), time.Unix(0, 0), time.Minute, 42)
+		subject = NewServiceEnvironment(env, "checkout")
+	})
+
+	it("has its own plugin partition", func() {
+		assert.NotEqual(t, env.Plugin(), subject.Plugin())
+		assert.NotEqual(t, subject.Plugin(), NewServiceEnvironment(env, "checkout").Plugin())
+	})
+
+	it("has its own random streams", func() {
+		other := NewSeededEnvironment(context.Background(), time.Unix(0, 0), time.Minute, 42)
+		assert.Equal(t, other.Rand("checkout/traffic").Int63(), subject.Rand("traffic").Int63())
+	})
+
+	it("shares the clock and numbering", func() {
+		assert.Equal(t, env.CurrentMovementTime(), subject.CurrentMovementTime())
+		assert.Equal(t, 1, env.NextNumber("replica"))
+		assert.Equal(t, 2, subject.NextNumber("replica"))
+	})
+
+	describe("ServiceStockName()", func() {
+		it("prefixes stock names with the service", func() {
+			assert.Equal(t, StockName("checkout/RequestsRouting"), ServiceStockName(subject, "RequestsRouting"))
+		})
+
+		it("leaves names alone outside of a service", func() {
+			assert.Equal(t, StockName("RequestsRouting"), ServiceStockName(env, "RequestsRouting"))
+		})
+	})
+	describe("ServiceName()", func() {
+		it("gives the service's name", func() {
+			assert.Equal(t, "checkout", ServiceName(subject))
+		})
+
+		it("gives an empty name outside of a service", func() {
+			assert.Equal(t, "", ServiceName(env))
+		})
+	})
+
+	it("shares autoscaler decisions with the environment", func() {
+		subject.AppendAutoscalerDecision(&AutoscalerDecision{Service: "checkout"})
+		assert.Len(t, env.AutoscalerDecisions(), 1)
+	})
+}
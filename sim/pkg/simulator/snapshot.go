@@ -0,0 +1,503 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Snapshot is the state of an Environment at a point in simulated time: what is scheduled
+// to move next, what every stock holds, where each random number stream and numbering
+// sequence has reached, and what each autoscaler plugin has been told.
+//
+// Movements and stocks hold behaviour as well as data, so a Snapshot is restored into an
+// Environment whose models have been built again in the same way. Restore finds the
+// stocks there by name and gives them back what they held.
+type Snapshot struct {
+	StartAt        time.Time         `json:"start_at"`
+	HaltAt         time.Time         `json:"halt_at"`
+	TakenAt        time.Time         `json:"taken_at"`
+	Seed           int64             `json:"seed"`
+	Rand           map[string]uint64 `json:"rand"`
+	Numbers        map[string]int    `json:"numbers,omitempty"`
+	MovementsSoFar int               `json:"movements_so_far"`
+	SampledThrough time.Time         `json:"sampled_through"`
+	Halted         bool              `json:"halted,omitempty"`
+	Pending        []PendingMovement `json:"pending"`
+	Stocks         []StockContents   `json:"stocks"`
+	// Plugin holds the calls made to each service's autoscaler plugin so far, by service
+	// name. The main service's name is empty.
+	Plugin map[string][]PluginCall `json:"plugin,omitempty"`
+}
+
+type PendingMovement struct {
+	Kind     MovementKind `json:"kind"`
+	OccursAt time.Time    `json:"occurs_at"`
+	From     StockName    `json:"from"`
+	To       StockName    `json:"to"`
+	// FromStock and ToStock are the positions of From and To in the Snapshot's Stocks,
+	// since a few stocks share their names.
+	FromStock int      `json:"from_stock"`
+	ToStock   int      `json:"to_stock"`
+	Notes     []string `json:"notes,omitempty"`
+	// Blocked movements are waiting for room in a full stock, rather than for a time.
+	Blocked bool `json:"blocked,omitempty"`
+	// Unblocking is set on the movement trying a blocked movement again.
+	Unblocking bool `json:"unblocking,omitempty"`
+}
+
+type StockContents struct {
+	Name        StockName    `json:"name"`
+	KindStocked EntityKind   `json:"kind_stocked"`
+	Count       uint64       `json:"count"`
+	Entities    []EntityName `json:"entities,omitempty"`
+	Dropped     uint64       `json:"dropped,omitempty"`
+	// State is saved by a StatefulStock, for the stock alone to make sense of.
+	State json.RawMessage `json:"state,omitempty"`
+}
+
+// StatefulStock is a stock which saves what it holds itself, because its entities or the
+// stock keep more than names. Other stocks are restored with plain entities of the names
+// they held.
+type StatefulStock interface {
+	Stock
+	SaveState() json.RawMessage
+	RestoreState(state json.RawMessage) error
+}
+
+// StockOwner is an entity with stocks of its own, which a Snapshot finds through it.
+type StockOwner interface {
+	OwnedStocks() []Stock
+}
+
+func (env *environment) Snapshot() Snapshot {
+	pending := env.futureMovements.Pending()
+	blocked := env.blockedMovements()
+	stocks := env.snapshotStocks(pending, blocked)
+
+	snapshot := Snapshot{
+		StartAt:        env.startAt,
+		HaltAt:         env.haltAt,
+		TakenAt:        env.current,
+		Seed:           env.Seed(),
+		Rand:           env.randStreams.State(),
+		Numbers:        make(map[string]int, len(env.numbers)),
+		MovementsSoFar: env.movementsSoFar,
+		SampledThrough: env.sampledThrough,
+		Halted:         env.futureMovements.IsClosed(),
+		Pending:        make([]PendingMovement, 0, len(pending)+len(blocked)),
+		Stocks:         make([]StockContents, len(stocks)),
+		Plugin:         env.pluginCalls(),
+	}
+
+	for sequence, n := range env.numbers {
+		snapshot.Numbers[sequence] = n
+	}
+
+	positions := make(map[Stock]int, len(stocks))
+	for i, stock := range stocks {
+		positions[stock] = i
+		snapshot.Stocks[i] = stockContents(stock)
+	}
+
+	for _, mv := range pending {
+		pm := pendingMovement(mv, positions)
+		pm.Unblocking = env.unblocking[mv.To().Name()] == mv
+		snapshot.Pending = append(snapshot.Pending, pm)
+	}
+	for _, mv := range blocked {
+		pm := pendingMovement(mv, positions)
+		pm.Blocked = true
+		snapshot.Pending = append(snapshot.Pending, pm)
+	}
+
+	return snapshot
+}
+
+func pendingMovement(mv Movement, positions map[Stock]int) PendingMovement {
+	return PendingMovement{
+		Kind:      mv.Kind(),
+		OccursAt:  mv.OccursAt(),
+		From:      mv.From().Name(),
+		To:        mv.To().Name(),
+		FromStock: positions[mv.From()],
+		ToStock:   positions[mv.To()],
+		Notes:     mv.Notes(),
+	}
+}
+
+func stockContents(stock Stock) StockContents {
+	contents := StockContents{
+		Name:        stock.Name(),
+		KindStocked: stock.KindStocked(),
+		Count:       stock.Count(),
+	}
+	for _, e := range stock.EntitiesInStock() {
+		contents.Entities = append(contents.Entities, (*e).Name())
+	}
+	if bounded, ok := stock.(BoundedStock); ok {
+		contents.Dropped = bounded.Dropped()
+	}
+	if stateful, ok := stock.(StatefulStock); ok {
+		contents.State = stateful.SaveState()
+	}
+
+	return contents
+}
+
+// blockedMovements gives the movements held back by full stocks, by stock name and then
+// in the order they will be tried again.
+func (env *environment) blockedMovements() []Movement {
+	names := make([]StockName, 0, len(env.blocked))
+	for name := range env.blocked {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+
+	blocked := make([]Movement, 0)
+	for _, name := range names {
+		blocked = append(blocked, env.blocked[name]...)
+	}
+
+	return blocked
+}
+
+// topStocks gives the stocks added with AddStock, followed by any others that pending or
+// blocked movements refer to.
+func (env *environment) topStocks(pending, blocked []Movement) []Stock {
+	stocks := make([]Stock, 0, len(env.stocks))
+	seen := make(map[Stock]bool, len(env.stocks))
+	add := func(stock Stock) {
+		if stock != nil && !seen[stock] {
+			seen[stock] = true
+			stocks = append(stocks, stock)
+		}
+	}
+
+	for _, stock := range env.stocks {
+		add(stock)
+	}
+	for _, movements := range [][]Movement{pending, blocked} {
+		for _, mv := range movements {
+			add(mv.From())
+			add(mv.To())
+		}
+	}
+
+	return stocks
+}
+
+// ownedStocks gives the stocks owned by entities held in stocks.
+func ownedStocks(stocks []Stock) []Stock {
+	owned := make([]Stock, 0)
+	for _, stock := range stocks {
+		for _, e := range stock.EntitiesInStock() {
+			if owner, ok := (*e).(StockOwner); ok {
+				owned = append(owned, owner.OwnedStocks()...)
+			}
+		}
+	}
+
+	return owned
+}
+
+// snapshotStocks gives every stock that a Snapshot describes, sorted by name. Stocks which
+// share a name keep the order in which they were found.
+func (env *environment) snapshotStocks(pending, blocked []Movement) []Stock {
+	stocks := make([]Stock, 0)
+	for level := env.topStocks(pending, blocked); len(level) > 0; level = ownedStocks(level) {
+		stocks = append(stocks, level...)
+	}
+
+	sort.SliceStable(stocks, func(i, j int) bool {
+		return stocks[i].Name() < stocks[j].Name()
+	})
+
+	return stocks
+}
+
+// Restore brings the environment to the state in snapshot, in place of whatever it had
+// reached. Its models must have been built in the same way as those of the environment
+// that the snapshot was taken from, but not yet run. Observers and samplers are kept and
+// see only what happens from the snapshot onwards. If Restore fails, the environment is
+// left partly restored and should not be run.
+func (env *environment) Restore(snapshot Snapshot) error {
+	if !snapshot.StartAt.Equal(env.startAt) || !snapshot.HaltAt.Equal(env.haltAt) {
+		return fmt.Errorf(
+			"snapshot runs from %d to %d, but the environment runs from %d to %d",
+			snapshot.StartAt.UnixNano(), snapshot.HaltAt.UnixNano(), env.startAt.UnixNano(), env.haltAt.UnixNano(),
+		)
+	}
+	if snapshot.Seed != env.Seed() {
+		return fmt.Errorf("snapshot has seed %d, but the environment has seed %d", snapshot.Seed, env.Seed())
+	}
+	if env.futureMovements.IsClosed() {
+		return fmt.Errorf("the environment has already halted")
+	}
+
+	stocks, err := env.restoreStocks(snapshot.Stocks)
+	if err != nil {
+		return err
+	}
+
+	err = env.restorePlugins(snapshot.Plugin)
+	if err != nil {
+		return err
+	}
+
+	for env.futureMovements.Len() > 0 {
+		env.futureMovements.DequeueMovement()
+	}
+	env.blocked = make(map[StockName][]Movement)
+	env.unblocking = make(map[StockName]Movement)
+
+	for _, pm := range snapshot.Pending {
+		mv, err := pm.movement(stocks)
+		if err != nil {
+			return err
+		}
+
+		if pm.Blocked {
+			env.blocked[mv.To().Name()] = append(env.blocked[mv.To().Name()], mv)
+			continue
+		}
+
+		env.futureMovements.EnqueueMovement(mv)
+		if pm.Unblocking {
+			env.unblocking[mv.To().Name()] = mv
+		}
+	}
+	if snapshot.Halted {
+		env.futureMovements.Close()
+	}
+
+	env.current = snapshot.TakenAt
+	env.movementsSoFar = snapshot.MovementsSoFar
+	env.randStreams.Restore(snapshot.Rand)
+	env.numbers = make(map[string]int, len(snapshot.Numbers))
+	for sequence, n := range snapshot.Numbers {
+		env.numbers[sequence] = n
+	}
+
+	env.sampledThrough = snapshot.SampledThrough
+	for _, s := range env.samplers {
+		s.next = env.startAt
+		for !s.next.After(env.sampledThrough) {
+			s.next = s.next.Add(s.interval)
+		}
+	}
+
+	env.completed = env.completed[:0]
+	env.ignored = env.ignored[:0]
+	env.cpuUtilizations = make([]*CPUUtilization, 0)
+	env.decisions = make([]*AutoscalerDecision, 0)
+	env.observerErr = nil
+
+	return nil
+}
+
+// restoreStocks gives back every snapshotted stock its contents, giving the stocks in the
+// same order as contents. Stocks added with AddStock are restored first, then the stocks
+// owned by entities restored into them, and so on. Stocks sharing a name are matched in
+// the order they were found.
+func (env *environment) restoreStocks(contents []StockContents) ([]Stock, error) {
+	unmatched := make(map[StockName][]int)
+	for i, c := range contents {
+		unmatched[c.Name] = append(unmatched[c.Name], i)
+	}
+
+	stocks := make([]Stock, len(contents))
+	for level := env.stocks; len(level) > 0; level = ownedStocks(level) {
+		for _, stock := range level {
+			candidates := unmatched[stock.Name()]
+			if len(candidates) == 0 {
+				return nil, fmt.Errorf("stock '%s' is not in the snapshot", stock.Name())
+			}
+			unmatched[stock.Name()] = candidates[1:]
+
+			err := restoreStock(stock, contents[candidates[0]])
+			if err != nil {
+				return nil, fmt.Errorf("could not restore stock '%s': %s", stock.Name(), err.Error())
+			}
+			stocks[candidates[0]] = stock
+		}
+	}
+
+	for i, stock := range stocks {
+		if stock == nil {
+			return nil, fmt.Errorf("snapshotted stock '%s' was not added to the environment", contents[i].Name)
+		}
+	}
+
+	return stocks, nil
+}
+
+func restoreStock(stock Stock, contents StockContents) error {
+	if stock.KindStocked() != contents.KindStocked {
+		return fmt.Errorf("it stocks '%s', but '%s' were snapshotted", stock.KindStocked(), contents.KindStocked)
+	}
+
+	if stateful, ok := stock.(StatefulStock); ok {
+		return stateful.RestoreState(contents.State)
+	}
+
+	if bounded, ok := stock.(BoundedStock); ok {
+		entities := make([]Entity, len(contents.Entities))
+		for i, name := range contents.Entities {
+			entities[i] = NewEntity(name, contents.KindStocked)
+		}
+		return bounded.RestoreEntities(entities, contents.Dropped)
+	}
+
+	if stock.Count() != contents.Count {
+		return fmt.Errorf("it holds %d entities and cannot be given the %d snapshotted", stock.Count(), contents.Count)
+	}
+
+	return nil
+}
+
+func (pm PendingMovement) movement(stocks []Stock) (Movement, error) {
+	if pm.FromStock < 0 || pm.FromStock >= len(stocks) || pm.ToStock < 0 || pm.ToStock >= len(stocks) {
+		return nil, fmt.Errorf("movement '%s' refers to a stock that was not snapshotted", pm.Kind)
+	}
+
+	from, ok := stocks[pm.FromStock].(SourceStock)
+	if !ok || from.Name() != pm.From {
+		return nil, fmt.Errorf("movement '%s' cannot move from stock '%s'", pm.Kind, pm.From)
+	}
+	to, ok := stocks[pm.ToStock].(SinkStock)
+	if !ok || to.Name() != pm.To {
+		return nil, fmt.Errorf("movement '%s' cannot move to stock '%s'", pm.Kind, pm.To)
+	}
+
+	mv := NewMovement(pm.Kind, pm.OccursAt, from, to)
+	for _, note := range pm.Notes {
+		mv.AddNote(note)
+	}
+
+	return mv, nil
+}
+
+// Matches reports whether two snapshots describe the same simulation state.
+func (s Snapshot) Matches(other Snapshot) bool {
+	if !s.StartAt.Equal(other.StartAt) || !s.HaltAt.Equal(other.HaltAt) || !s.TakenAt.Equal(other.TakenAt) || !s.SampledThrough.Equal(other.SampledThrough) {
+		return false
+	}
+
+	if s.Seed != other.Seed || s.MovementsSoFar != other.MovementsSoFar || s.Halted != other.Halted {
+		return false
+	}
+
+	if !reflect.DeepEqual(s.Rand, other.Rand) || len(s.Numbers) != len(other.Numbers) || len(s.Pending) != len(other.Pending) || len(s.Stocks) != len(other.Stocks) {
+		return false
+	}
+
+	for sequence, n := range s.Numbers {
+		if other.Numbers[sequence] != n {
+			return false
+		}
+	}
+
+	for i, mv := range s.Pending {
+		o := other.Pending[i]
+		if mv.Kind != o.Kind || !mv.OccursAt.Equal(o.OccursAt) || mv.From != o.From || mv.To != o.To ||
+			mv.FromStock != o.FromStock || mv.ToStock != o.ToStock || mv.Blocked != o.Blocked || mv.Unblocking != o.Unblocking ||
+			!sameStrings(mv.Notes, o.Notes) {
+			return false
+		}
+	}
+
+	for i, stock := range s.Stocks {
+		o := other.Stocks[i]
+		if stock.Name != o.Name || stock.KindStocked != o.KindStocked || stock.Count != o.Count || stock.Dropped != o.Dropped {
+			return false
+		}
+		if len(stock.Entities) != len(o.Entities) || !sameJSON(stock.State, o.State) {
+			return false
+		}
+		for j, name := range stock.Entities {
+			if o.Entities[j] != name {
+				return false
+			}
+		}
+	}
+
+	return samePluginCalls(s.Plugin, other.Plugin)
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameJSON is whether two JSON documents hold the same values, however they are laid out.
+func sameJSON(a, b json.RawMessage) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+
+	var av, bv interface{}
+	if decodeJSON(a, &av) != nil || decodeJSON(b, &bv) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(av, bv)
+}
+
+func decodeJSON(data json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func samePluginCalls(a, b map[string][]PluginCall) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for service, calls := range a {
+		otherCalls, ok := b[service]
+		if !ok {
+			return false
+		}
+
+		encoded, err := json.Marshal(calls)
+		if err != nil {
+			return false
+		}
+		otherEncoded, err := json.Marshal(otherCalls)
+		if err != nil || !sameJSON(encoded, otherEncoded) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -24,6 +24,11 @@ type baseStock interface {
 	EntitiesInStock() []*Entity
 }
 
+// Stock is any kind of stock, whether it can be added to, removed from, or both.
+type Stock interface {
+	baseStock
+}
+
 type removable interface {
 	Remove() Entity
 }
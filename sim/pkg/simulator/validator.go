@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"fmt"
+)
+
+// Invariant is a named check that a Validator runs after every movement. The Observer
+// returns an error describing the broken invariant, if any.
+type Invariant struct {
+	Name string
+	Observer
+}
+
+// ValidationError describes the first movement after which a Validator found the
+// simulation in an impossible state.
+type ValidationError struct {
+	Check    string
+	Number   int // counting every movement the Validator saw, from 1
+	Movement Movement
+	Moved    Entity
+	Err      error
+}
+
+func (ve *ValidationError) Error() string {
+	moved := "nothing"
+	if ve.Moved != nil {
+		moved = string(ve.Moved.Name())
+	}
+
+	return fmt.Sprintf(
+		"movement %d ('%s' at %d moving %s from '%s' to '%s') failed check '%s': %s",
+		ve.Number,
+		ve.Movement.Kind(),
+		ve.Movement.OccursAt().UnixNano(),
+		moved,
+		ve.Movement.From().Name(),
+		ve.Movement.To().Name(),
+		ve.Check,
+		ve.Err.Error(),
+	)
+}
+
+// Validator observes a run and stops it with a *ValidationError at the first movement
+// that leaves it in an impossible state. It checks that every entity is moved out of the
+// stock it was last moved into, that no movement is ignored because its from stock was
+// empty, and any Invariants it is given.
+//
+// Entities that are added to stocks outside of movements are not seen until they first
+// move, so the Validator trusts the from stock of that first movement. Stocks are told
+// apart by name, since model stocks often wrap another stock and move entities through it.
+type Validator struct {
+	locations  map[Entity]StockName
+	invariants []Invariant
+	movements  int
+}
+
+func (v *Validator) AddInvariant(invariant Invariant) {
+	v.invariants = append(v.invariants, invariant)
+}
+
+func (v *Validator) MovementCompleted(completed CompletedMovement) error {
+	v.movements++
+	from := completed.Movement.From()
+	to := completed.Movement.To()
+
+	if last, ok := v.locations[completed.Moved]; ok && last != from.Name() {
+		return v.violation("entity_location", completed.Movement, completed.Moved, fmt.Errorf(
+			"entity was last moved to '%s', so it may be in two stocks at once", last,
+		))
+	}
+	v.locations[completed.Moved] = to.Name()
+
+	for _, inv := range v.invariants {
+		err := inv.MovementCompleted(completed)
+		if err != nil {
+			return v.violation(inv.Name, completed.Movement, completed.Moved, err)
+		}
+	}
+
+	return nil
+}
+
+func (v *Validator) MovementIgnored(ignored IgnoredMovement) error {
+	v.movements++
+
+	if ignored.Reason == FromStockIsEmpty {
+		return v.violation("empty_from_stock", ignored.Movement, nil, fmt.Errorf(
+			"there was nothing in '%s' to move", ignored.Movement.From().Name(),
+		))
+	}
+
+	for _, inv := range v.invariants {
+		err := inv.MovementIgnored(ignored)
+		if err != nil {
+			return v.violation(inv.Name, ignored.Movement, nil, err)
+		}
+	}
+
+	return nil
+}
+
+func (v *Validator) violation(check string, movement Movement, moved Entity, err error) error {
+	return &ValidationError{
+		Check:    check,
+		Number:   v.movements,
+		Movement: movement,
+		Moved:    moved,
+		Err:      err,
+	}
+}
+
+func NewValidator() *Validator {
+	return &Validator{
+		locations: make(map[Entity]StockName),
+	}
+}
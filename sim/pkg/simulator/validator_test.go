@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator(t *testing.T) {
+	spec.Run(t, "Validator", testValidator, spec.Report(report.Terminal{}))
+}
+
+func testValidator(t *testing.T, describe spec.G, it spec.S) {
+	var subject *Validator
+	var env Environment
+	var first, second, third ThroughStock
+	var entity Entity
+	startAt := time.Unix(0, 0)
+
+	it.Before(func() {
+		subject = NewValidator()
+		env = NewEnvironment(context.Background(), startAt, time.Minute)
+		env.AddObserver(subject)
+
+		first = NewThroughStock("first", "thing")
+		second = NewThroughStock("second", "thing")
+		third = NewThroughStock("third", "thing")
+		entity = NewEntity("thing-1", "thing")
+		require.NoError(t, first.Add(entity))
+	})
+
+	describe("when every movement is sound", func() {
+		it("lets the run finish", func() {
+			env.AddToSchedule(NewMovement("first_to_second", startAt.Add(time.Second), first, second))
+			env.AddToSchedule(NewMovement("second_to_third", startAt.Add(2*time.Second), second, third))
+
+			_, _, err := env.Run()
+			assert.NoError(t, err)
+		})
+	})
+
+	describe("when an entity is in two stocks at once", func() {
+		var err error
+
+		it.Before(func() {
+			env.AddToSchedule(NewMovement("first_to_second", startAt.Add(time.Second), first, second))
+			env.AddToSchedule(NewMovement("third_to_first", startAt.Add(2*time.Second), third, first))
+			require.NoError(t, third.Add(entity))
+
+			_, _, err = env.Run()
+		})
+
+		it("stops the run at the first movement that shows it", func() {
+			require.IsType(t, &ValidationError{}, err)
+			ve := err.(*ValidationError)
+
+			assert.Equal(t, "entity_location", ve.Check)
+			assert.Equal(t, MovementKind("third_to_first"), ve.Movement.Kind())
+			assert.Equal(t, 3, ve.Number)
+			assert.Equal(t, startAt.Add(2*time.Second), env.CurrentMovementTime())
+		})
+
+		it("describes the violation precisely", func() {
+			assert.EqualError(t, err, "movement 3 ('third_to_first' at 2000000000 moving thing-1 from 'third' to 'first') failed check 'entity_location': entity was last moved to 'second', so it may be in two stocks at once")
+		})
+	})
+
+	describe("when a movement finds its from stock empty", func() {
+		it("stops the run", func() {
+			env.AddToSchedule(NewMovement("second_to_third", startAt.Add(time.Second), second, third))
+
+			_, _, err := env.Run()
+			require.IsType(t, &ValidationError{}, err)
+			assert.Equal(t, "empty_from_stock", err.(*ValidationError).Check)
+		})
+	})
+
+	describe("AddInvariant()", func() {
+		it("checks the invariant after each movement", func() {
+			subject.AddInvariant(Invariant{
+				Name: "second_stays_empty",
+				Observer: ObserverFuncs{OnCompleted: func(CompletedMovement) error {
+					if second.Count() > 0 {
+						return fmt.Errorf("second has %d entities", second.Count())
+					}
+					return nil
+				}},
+			})
+			env.AddToSchedule(NewMovement("first_to_second", startAt.Add(time.Second), first, second))
+
+			_, _, err := env.Run()
+			require.IsType(t, &ValidationError{}, err)
+			assert.Equal(t, "second_stays_empty", err.(*ValidationError).Check)
+			assert.EqualError(t, err.(*ValidationError).Err, "second has 1 entities")
+		})
+	})
+}